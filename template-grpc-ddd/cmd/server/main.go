@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	"log/slog"
-	"net"
 	"os"
 
 	"github.com/spf13/viper"
@@ -10,13 +10,25 @@ import (
 	handler "github.com/user/go-templates/template-grpc-ddd/internal/adapter/handler/grpc"
 	"github.com/user/go-templates/template-grpc-ddd/internal/adapter/storage/memory"
 	"github.com/user/go-templates/template-grpc-ddd/internal/core/service"
+	"github.com/user/go-templates/template-grpc-ddd/pkg/auth"
+	"github.com/user/go-templates/template-grpc-ddd/pkg/authz"
+	"github.com/user/go-templates/template-grpc-ddd/pkg/idgen"
+	"github.com/user/go-templates/template-grpc-ddd/pkg/requestid"
+	"github.com/user/go-templates/template-grpc-ddd/pkg/server"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
 
+// publicMethods can be called without a bearer token.
+var publicMethods = []string{
+	"/grpc.reflection.v1.ServerReflection/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+}
+
 func main() {
 	// Logger
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(logger)
 
 	// Config
 	viper.SetConfigName("config")
@@ -37,19 +49,52 @@ func main() {
 	userRepo := memory.NewUserRepository()
 
 	// 2. Core (Service)
-	userSvc := service.NewUserService(userRepo, logger)
+	// New users get IDs of the configured strategy, and IDs written any
+	// other way are rejected.
+	ids, err := idgen.New(viper.GetString("ids.strategy"))
+	if err != nil {
+		logger.Error("invalid id strategy", "error", err)
+		os.Exit(1)
+	}
+	userSvc := service.NewUserService(userRepo, ids)
 
 	// 3. Adapters (Handler)
 	userHandler := handler.NewUserHandler(userSvc)
 
-	// gRPC Server Setup
-	lis, err := net.Listen("tcp", ":"+port)
+	// Authentication
+	authKeys, err := auth.LoadKeySet(context.Background(), auth.KeyOptions{
+		JWKS:            viper.GetString("auth.jwks"),
+		JWKSRefresh:     viper.GetDuration("auth.jwks_refresh"),
+		HMACSecret:      viper.GetString("auth.hmac_secret"),
+		PublicKeyFile:   viper.GetString("auth.public_key_file"),
+		AllowWeakSecret: viper.GetString("app.env") == "dev",
+	})
 	if err != nil {
-		logger.Error("failed to listen", "error", err)
+		logger.Error("failed to load auth keys", "error", err)
 		os.Exit(1)
 	}
+	verifier := auth.NewVerifier(authKeys, auth.Options{
+		Issuer:    viper.GetString("auth.issuer"),
+		Audience:  viper.GetString("auth.audience"),
+		ClockSkew: viper.GetDuration("auth.clock_skew"),
+	})
 
-	s := grpc.NewServer()
+	// Authorization
+	authorizer := authz.NewAuthorizer(authz.StaticRoles(viper.GetStringMapStringSlice("authz.roles")), 0)
+
+	// gRPC Server Setup
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			requestid.UnaryServerInterceptor(logger),
+			auth.UnaryServerInterceptor(verifier, publicMethods...),
+			authz.UnaryServerInterceptor(authorizer, handler.MethodPermissions),
+		),
+		grpc.ChainStreamInterceptor(
+			requestid.StreamServerInterceptor(logger),
+			auth.StreamServerInterceptor(verifier, publicMethods...),
+			authz.StreamServerInterceptor(authorizer, handler.MethodPermissions),
+		),
+	)
 
 	// Register generated service
 	userv1.RegisterUserServiceServer(s, userHandler)
@@ -57,8 +102,26 @@ func main() {
 	// Register reflection for debugging (grpcurl)
 	reflection.Register(s)
 
-	logger.Info("gRPC server starting", "port", port)
-	if err := s.Serve(lis); err != nil {
+	// gRPC shares the port with HTTP; requests other than gRPC get 404.
+	srv, err := server.New(server.Options{
+		Addr: ":" + port,
+		GRPC: s,
+		H2C:  viper.GetBool("server.h2c"),
+		TLS: server.TLSOptions{
+			CertFile:       viper.GetString("server.tls.cert_file"),
+			KeyFile:        viper.GetString("server.tls.key_file"),
+			ClientCAFile:   viper.GetString("server.tls.client_ca_file"),
+			ReloadInterval: viper.GetDuration("server.tls.reload_interval"),
+		},
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	})
+	if err != nil {
+		logger.Error("failed to configure server", "error", err)
+		os.Exit(1)
+	}
+
+	logger.Info("gRPC server starting", "port", port, "tls", srv.TLS())
+	if err := srv.ListenAndServe(); err != nil {
 		logger.Error("failed to serve", "error", err)
 		os.Exit(1)
 	}
@@ -2,12 +2,23 @@ package handler
 
 import (
 	"context"
+	"errors"
 
 	userv1 "github.com/user/go-templates/template-grpc-ddd/gen/go/user/v1"
 	"github.com/user/go-templates/template-grpc-ddd/internal/core/domain"
 	"github.com/user/go-templates/template-grpc-ddd/internal/core/port"
+	"github.com/user/go-templates/template-grpc-ddd/pkg/authz"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// MethodPermissions declares the permissions each RPC requires, for use with
+// authz.UnaryServerInterceptor.
+var MethodPermissions = map[string][]string{
+	userv1.UserService_GetUser_FullMethodName:    {domain.PermissionUsersRead},
+	userv1.UserService_CreateUser_FullMethodName: {domain.PermissionUsersWrite},
+}
+
 type UserHandler struct {
 	userv1.UnimplementedUserServiceServer
 	svc port.UserService
@@ -20,9 +31,9 @@ func NewUserHandler(svc port.UserService) *UserHandler {
 }
 
 func (h *UserHandler) GetUser(ctx context.Context, req *userv1.GetUserRequest) (*userv1.GetUserResponse, error) {
-	user, err := h.svc.GetUser(ctx, req.Id)
+	user, err := h.svc.GetUser(ctx, req.Id, req.GetReadMask().GetPaths())
 	if err != nil {
-		return nil, err
+		return nil, toStatus(err)
 	}
 
 	return &userv1.GetUserResponse{
@@ -56,3 +67,14 @@ func mapDomainToProto(u *domain.User) *userv1.User {
 		Email: u.Email,
 	}
 }
+
+// toStatus maps core errors to gRPC status codes.
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, authz.ErrPermissionDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, domain.ErrUnknownField), errors.Is(err, domain.ErrInvalidID):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return err
+}
@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/user/go-templates/template-grpc-ddd/internal/core/domain"
+	"github.com/user/go-templates/template-grpc-ddd/pkg/logger"
 )
 
 type UserRepository struct {
@@ -19,7 +20,9 @@ func NewUserRepository() *UserRepository {
 	}
 }
 
-func (r *UserRepository) Get(ctx context.Context, id string) (*domain.User, error) {
+func (r *UserRepository) Get(ctx context.Context, id string, fields []string) (*domain.User, error) {
+	logger.FromContext(ctx).DebugContext(ctx, "querying user", "id", id)
+
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -27,10 +30,27 @@ func (r *UserRepository) Get(ctx context.Context, id string) (*domain.User, erro
 	if !ok {
 		return nil, errors.New("user not found")
 	}
-	return user, nil
+	if len(fields) == 0 {
+		return user, nil
+	}
+
+	selected := &domain.User{}
+	for _, f := range fields {
+		switch f {
+		case "id":
+			selected.ID = user.ID
+		case "name":
+			selected.Name = user.Name
+		case "email":
+			selected.Email = user.Email
+		}
+	}
+	return selected, nil
 }
 
 func (r *UserRepository) Save(ctx context.Context, user *domain.User) error {
+	logger.FromContext(ctx).DebugContext(ctx, "saving user", "id", user.ID)
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
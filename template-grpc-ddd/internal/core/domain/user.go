@@ -1,8 +1,28 @@
 package domain
 
+import "errors"
+
 // User represents the core domain entity.
 type User struct {
 	ID    string
 	Name  string
 	Email string
 }
+
+// UserFields are the User attributes a read mask may select, named as in the
+// proto User message.
+var UserFields = []string{"id", "name", "email"}
+
+var ErrUnknownField = errors.New("unknown field")
+
+// ErrInvalidID reports a user ID that is not written in the format of the
+// service's port.IDGenerator.
+var ErrInvalidID = errors.New("invalid user id")
+
+// Permissions guarding user operations.
+const (
+	PermissionUsersRead  = "users:read"
+	PermissionUsersWrite = "users:write"
+	// PermissionUsersAdmin lets a caller act on any user, not only themselves.
+	PermissionUsersAdmin = "users:admin"
+)
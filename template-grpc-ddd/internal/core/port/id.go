@@ -0,0 +1,13 @@
+package port
+
+// IDGenerator defines the output port for entity IDs. The core gives new
+// entities their IDs and checks the IDs callers send with it.
+type IDGenerator interface {
+	// New returns a new ID in canonical form.
+	New() string
+	// Parse returns the 16 bytes of id, or an error when id is not written
+	// in the generator's format.
+	Parse(id string) ([16]byte, error)
+	// Format writes b in canonical form.
+	Format(b [16]byte) string
+}
@@ -9,6 +9,8 @@ import (
 // UserRepository defines the output port for persistence.
 // This is what the application core will use to save/retrieve data.
 type UserRepository interface {
-	Get(ctx context.Context, id string) (*domain.User, error)
+	// Get loads only the domain.UserFields listed in fields, leaving the
+	// others zero; no fields loads all of them.
+	Get(ctx context.Context, id string, fields []string) (*domain.User, error)
 	Save(ctx context.Context, user *domain.User) error
 }
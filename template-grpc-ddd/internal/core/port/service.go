@@ -9,6 +9,10 @@ import (
 // UserService defines the input port for user operations.
 // This is what the adapter (gRPC handler) will call.
 type UserService interface {
-	GetUser(ctx context.Context, id string) (*domain.User, error)
+	// GetUser returns domain.ErrUnknownField when fields lists an attribute
+	// outside domain.UserFields and domain.ErrInvalidID for IDs the
+	// service's IDGenerator cannot parse.
+	GetUser(ctx context.Context, id string, fields []string) (*domain.User, error)
+	// CreateUser gives user a new ID, replacing any it had.
 	CreateUser(ctx context.Context, user *domain.User) (*domain.User, error)
 }
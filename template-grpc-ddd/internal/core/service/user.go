@@ -3,41 +3,76 @@ package service
 import (
 	"context"
 	"fmt"
-	"log/slog"
+	"slices"
 
-	"github.com/google/uuid"
 	"github.com/user/go-templates/template-grpc-ddd/internal/core/domain"
 	"github.com/user/go-templates/template-grpc-ddd/internal/core/port"
+	"github.com/user/go-templates/template-grpc-ddd/pkg/auth"
+	"github.com/user/go-templates/template-grpc-ddd/pkg/authz"
+	"github.com/user/go-templates/template-grpc-ddd/pkg/logger"
 )
 
 type UserService struct {
-	repo   port.UserRepository
-	logger *slog.Logger
+	repo port.UserRepository
+	ids  port.IDGenerator
 }
 
-func NewUserService(repo port.UserRepository, logger *slog.Logger) *UserService {
+// NewUserService returns the user service. ids generates the IDs of new
+// users and parses the IDs callers send.
+func NewUserService(repo port.UserRepository, ids port.IDGenerator) *UserService {
 	return &UserService{
-		repo:   repo,
-		logger: logger,
+		repo: repo,
+		ids:  ids,
 	}
 }
 
-func (s *UserService) GetUser(ctx context.Context, id string) (*domain.User, error) {
-	s.logger.InfoContext(ctx, "fetching user", "id", id)
-	return s.repo.Get(ctx, id)
+func (s *UserService) GetUser(ctx context.Context, id string, fields []string) (*domain.User, error) {
+	logger.FromContext(ctx).InfoContext(ctx, "fetching user", "id", id)
+	for _, f := range fields {
+		if !slices.Contains(domain.UserFields, f) {
+			return nil, fmt.Errorf("%w %q", domain.ErrUnknownField, f)
+		}
+	}
+	id, err := s.parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeAccess(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.Get(ctx, id, fields)
 }
 
 func (s *UserService) CreateUser(ctx context.Context, user *domain.User) (*domain.User, error) {
-	s.logger.InfoContext(ctx, "creating user", "email", user.Email)
+	logger.FromContext(ctx).InfoContext(ctx, "creating user", "email", user.Email)
 
 	if user.Name == "" {
 		return nil, fmt.Errorf("name is required")
 	}
 
-	user.ID = uuid.New().String()
+	user.ID = s.ids.New()
 	if err := s.repo.Save(ctx, user); err != nil {
 		return nil, err
 	}
 
 	return user, nil
 }
+
+// parseID validates an ID sent by a caller and returns it in the canonical
+// form IDs are stored in, so that every way of writing it finds the user.
+func (s *UserService) parseID(id string) (string, error) {
+	b, err := s.ids.Parse(id)
+	if err != nil {
+		return "", domain.ErrInvalidID
+	}
+	return s.ids.Format(b), nil
+}
+
+// authorizeAccess lets callers access their own record; any other record
+// requires domain.PermissionUsersAdmin.
+func authorizeAccess(ctx context.Context, id string) error {
+	if claims, ok := auth.FromContext(ctx); ok && claims.Subject == id {
+		return nil
+	}
+	return authz.Check(ctx, domain.PermissionUsersAdmin)
+}
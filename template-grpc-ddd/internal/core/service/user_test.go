@@ -3,22 +3,32 @@ package service
 import (
 	"context"
 	"errors"
-	"log/slog"
-	"os"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/user/go-templates/template-grpc-ddd/internal/core/domain"
+	"github.com/user/go-templates/template-grpc-ddd/pkg/auth"
+	"github.com/user/go-templates/template-grpc-ddd/pkg/authz"
+	"github.com/user/go-templates/template-grpc-ddd/pkg/idgen"
+)
+
+// IDs of the users the service tests act on, written the way idgen.UUIDv7
+// writes them.
+const (
+	testUserID  = "0190a0b4-3f1c-7c2a-9b1e-5d2f8a4c6e01"
+	otherUserID = "0190a0b4-3f1c-7c2a-9b1e-5d2f8a4c6e02"
 )
 
 // MockUserRepository is a manual mock for the port.UserRepository interface
 type MockUserRepository struct {
-	GetFunc  func(ctx context.Context, id string) (*domain.User, error)
+	GetFunc  func(ctx context.Context, id string, fields []string) (*domain.User, error)
 	SaveFunc func(ctx context.Context, user *domain.User) error
 }
 
-func (m *MockUserRepository) Get(ctx context.Context, id string) (*domain.User, error) {
+func (m *MockUserRepository) Get(ctx context.Context, id string, fields []string) (*domain.User, error) {
 	if m.GetFunc != nil {
-		return m.GetFunc(ctx, id)
+		return m.GetFunc(ctx, id, fields)
 	}
 	return nil, errors.New("unimplemented")
 }
@@ -31,8 +41,6 @@ func (m *MockUserRepository) Save(ctx context.Context, user *domain.User) error
 }
 
 func TestUserService_CreateUser(t *testing.T) {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-
 	tests := []struct {
 		name          string
 		inputUser     *domain.User
@@ -44,7 +52,7 @@ func TestUserService_CreateUser(t *testing.T) {
 			inputUser: &domain.User{Name: "John", Email: "john@example.com"},
 			mockRepo: &MockUserRepository{
 				SaveFunc: func(ctx context.Context, user *domain.User) error {
-					if user.ID == "" {
+					if _, err := (idgen.UUIDv7{}).Parse(user.ID); err != nil {
 						return errors.New("ID should be generated")
 					}
 					return nil
@@ -72,7 +80,7 @@ func TestUserService_CreateUser(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			svc := NewUserService(tt.mockRepo, logger)
+			svc := NewUserService(tt.mockRepo, idgen.UUIDv7{})
 			_, err := svc.CreateUser(context.Background(), tt.inputUser)
 
 			if (err != nil) != tt.expectedError {
@@ -81,3 +89,98 @@ func TestUserService_CreateUser(t *testing.T) {
 		})
 	}
 }
+
+func TestUserService_GetUser_Authorization(t *testing.T) {
+	repo := &MockUserRepository{
+		GetFunc: func(ctx context.Context, id string, fields []string) (*domain.User, error) {
+			return &domain.User{ID: id}, nil
+		},
+	}
+	svc := NewUserService(repo, idgen.UUIDv7{})
+	authorizer := authz.NewAuthorizer(authz.StaticRoles{
+		"admin": {"*"},
+		"user":  {domain.PermissionUsersRead},
+	}, 0)
+
+	tests := []struct {
+		name          string
+		claims        *auth.Claims
+		userID        string
+		expectedError error
+	}{
+		{name: "Internal", userID: testUserID},
+		{name: "Self", claims: &auth.Claims{Roles: []string{"user"}}, userID: testUserID},
+		{name: "Other", claims: &auth.Claims{Roles: []string{"user"}}, userID: otherUserID, expectedError: authz.ErrPermissionDenied},
+		{name: "Admin", claims: &auth.Claims{Roles: []string{"admin"}}, userID: otherUserID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := authz.NewContext(context.Background(), authorizer)
+			if tt.claims != nil {
+				tt.claims.Subject = testUserID
+				ctx = auth.NewContext(ctx, tt.claims)
+			}
+
+			_, err := svc.GetUser(ctx, tt.userID, nil)
+			if !errors.Is(err, tt.expectedError) {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestUserService_GetUser_Fields(t *testing.T) {
+	var got []string
+	repo := &MockUserRepository{
+		GetFunc: func(ctx context.Context, id string, fields []string) (*domain.User, error) {
+			got = fields
+			return &domain.User{ID: id}, nil
+		},
+	}
+	svc := NewUserService(repo, idgen.UUIDv7{})
+
+	if _, err := svc.GetUser(context.Background(), testUserID, []string{"id", "name"}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, []string{"id", "name"}) {
+		t.Errorf("expected fields to reach the repository, got %v", got)
+	}
+
+	got = nil
+	if _, err := svc.GetUser(context.Background(), testUserID, []string{"password"}); !errors.Is(err, domain.ErrUnknownField) {
+		t.Errorf("expected error %v, got %v", domain.ErrUnknownField, err)
+	}
+	if got != nil {
+		t.Error("unknown fields must not reach the repository")
+	}
+}
+
+func TestUserService_GetUser_IDs(t *testing.T) {
+	var got string
+	repo := &MockUserRepository{
+		GetFunc: func(ctx context.Context, id string, fields []string) (*domain.User, error) {
+			got = id
+			return &domain.User{ID: id}, nil
+		},
+	}
+	svc := NewUserService(repo, idgen.UUIDv7{})
+
+	// IDs reach the repository in canonical form.
+	if _, err := svc.GetUser(context.Background(), strings.ToUpper(testUserID), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got != testUserID {
+		t.Errorf("expected %q, got %q", testUserID, got)
+	}
+
+	for _, id := range []string{"", "123", testUserID + "0", "01ARYZ6S41TSV4RRFFQ69G5FAV"} {
+		got = ""
+		if _, err := svc.GetUser(context.Background(), id, nil); !errors.Is(err, domain.ErrInvalidID) {
+			t.Errorf("GetUser(%q): expected error %v, got %v", id, domain.ErrInvalidID, err)
+		}
+		if got != "" {
+			t.Errorf("GetUser(%q): invalid IDs must not reach the repository", id)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/user/go-templates/template-grpc-ddd/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor authenticates calls carrying "authorization: Bearer"
+// metadata and stores the validated claims in the handler context. Methods
+// matched by public may be called anonymously; all others require a token.
+// Entries are full method names ("/pkg.Service/Method") or whole services
+// ("/pkg.Service/").
+func UnaryServerInterceptor(v *Verifier, public ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, v, info.FullMethod, public)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of UnaryServerInterceptor.
+func StreamServerInterceptor(v *Verifier, public ...string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), v, info.FullMethod, public)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func authenticate(ctx context.Context, v *Verifier, method string, public []string) (context.Context, error) {
+	token, err := bearerToken(ctx)
+	if errors.Is(err, ErrMissingToken) && isPublic(method, public) {
+		return ctx, nil
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	claims, err := v.Verify(ctx, token)
+	if err != nil {
+		logger.FromContext(ctx).InfoContext(ctx, "rejected bearer token", "error", err)
+		return nil, status.Error(codes.Unauthenticated, ErrInvalidToken.Error())
+	}
+
+	ctx = NewContext(ctx, claims)
+	ctx = logger.NewContext(ctx, logger.FromContext(ctx).With("subject", claims.Subject))
+	return ctx, nil
+}
+
+func bearerToken(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", ErrMissingToken
+	}
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", ErrMissingToken
+	}
+	token = strings.TrimSpace(token)
+	if !ok || token == "" {
+		return "", ErrInvalidToken
+	}
+	return token, nil
+}
+
+func isPublic(method string, public []string) bool {
+	for _, p := range public {
+		if method == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(method, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
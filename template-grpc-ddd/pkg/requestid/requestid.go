@@ -0,0 +1,111 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+
+	"github.com/user/go-templates/template-grpc-ddd/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// MetadataKey is the gRPC metadata key used to accept and return the request ID.
+const MetadataKey = "x-request-id"
+
+// maxLen bounds the size of caller supplied IDs so they cannot bloat logs.
+const maxLen = 128
+
+type ctxKey struct{}
+
+// New returns a random 128-bit request ID encoded as hex.
+func New() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// NewContext returns a copy of ctx that carries id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, or "" if there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// UnaryServerInterceptor accepts the caller's x-request-id metadata (or
+// generates one), returns it in the response header and trailer and stores it,
+// together with a logger annotated with it, in the handler context.
+func UnaryServerInterceptor(log *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		id := incoming(ctx)
+
+		md := metadata.Pairs(MetadataKey, id)
+		_ = grpc.SetHeader(ctx, md)
+		_ = grpc.SetTrailer(ctx, md)
+
+		ctx = NewContext(ctx, id)
+		ctx = logger.NewContext(ctx, log.With("request_id", id, "method", info.FullMethod))
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor. The handler's stream carries the ID and logger in
+// its Context.
+func StreamServerInterceptor(log *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		id := incoming(ctx)
+
+		md := metadata.Pairs(MetadataKey, id)
+		_ = ss.SetHeader(md)
+		ss.SetTrailer(md)
+
+		ctx = NewContext(ctx, id)
+		ctx = logger.NewContext(ctx, log.With("request_id", id, "method", info.FullMethod))
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// incoming returns the caller's x-request-id metadata, or a new ID when it is
+// missing or invalid.
+func incoming(ctx context.Context) string {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(MetadataKey); len(v) > 0 {
+			id = v[0]
+		}
+	}
+	if !valid(id) {
+		id = New()
+	}
+	return id
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,137 @@
+package requestid
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// transportStream records the header and trailer a unary handler sets.
+type transportStream struct {
+	header, trailer metadata.MD
+}
+
+func (s *transportStream) Method() string { return "/user.v1.UserService/GetUser" }
+
+func (s *transportStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *transportStream) SendHeader(md metadata.MD) error { return s.SetHeader(md) }
+
+func (s *transportStream) SetTrailer(md metadata.MD) error {
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
+
+// serverStreamStub is a grpc.ServerStream recording the header and trailer a
+// streaming handler sets.
+type serverStreamStub struct {
+	grpc.ServerStream
+	ctx             context.Context
+	header, trailer metadata.MD
+}
+
+func (s *serverStreamStub) Context() context.Context { return s.ctx }
+
+func (s *serverStreamStub) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *serverStreamStub) SetTrailer(md metadata.MD) {
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+var requestIDTests = []struct {
+	name     string
+	incoming string
+	expected string
+}{
+	{name: "Passthrough", incoming: "req-123", expected: "req-123"},
+	{name: "Generated"},
+	{name: "Invalid", incoming: "bad id\n"},
+	{name: "TooLong", incoming: strings.Repeat("a", maxLen+1)},
+}
+
+// checkID reports whether id is the expected one, or a generated one when
+// none is expected.
+func checkID(t *testing.T, id, expected string) {
+	t.Helper()
+	if expected != "" {
+		if id != expected {
+			t.Errorf("expected request ID %q, got %q", expected, id)
+		}
+		return
+	}
+	if len(id) != 32 {
+		t.Errorf("expected a generated request ID, got %q", id)
+	}
+}
+
+func incomingContext(id string) context.Context {
+	if id == "" {
+		return context.Background()
+	}
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, id))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor(slog.Default())
+
+	for _, tt := range requestIDTests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &transportStream{}
+			ctx := grpc.NewContextWithServerTransportStream(incomingContext(tt.incoming), stream)
+
+			var id string
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: stream.Method()}, func(ctx context.Context, req any) (any, error) {
+				id = FromContext(ctx)
+				return nil, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkID(t, id, tt.expected)
+			if got := stream.header.Get(MetadataKey); len(got) != 1 || got[0] != id {
+				t.Errorf("expected response header %q, got %v", id, got)
+			}
+			if got := stream.trailer.Get(MetadataKey); len(got) != 1 || got[0] != id {
+				t.Errorf("expected response trailer %q, got %v", id, got)
+			}
+		})
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := StreamServerInterceptor(slog.Default())
+
+	for _, tt := range requestIDTests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &serverStreamStub{ctx: incomingContext(tt.incoming)}
+
+			var id string
+			err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/test.Service/Stream"}, func(srv any, ss grpc.ServerStream) error {
+				id = FromContext(ss.Context())
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkID(t, id, tt.expected)
+			if got := stream.header.Get(MetadataKey); len(got) != 1 || got[0] != id {
+				t.Errorf("expected response header %q, got %v", id, got)
+			}
+			if got := stream.trailer.Get(MetadataKey); len(got) != 1 || got[0] != id {
+				t.Errorf("expected response trailer %q, got %v", id, got)
+			}
+		})
+	}
+}
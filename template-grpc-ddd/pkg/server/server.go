@@ -0,0 +1,255 @@
+// Package server serves HTTP and gRPC on one listener, over TLS with
+// certificates reloaded from disk or, for local development, over plain
+// HTTP/1.1 and h2c.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval is used when TLSOptions.ReloadInterval is zero.
+const DefaultReloadInterval = time.Minute
+
+// nextProtos are offered via ALPN; HTTP/2 is required by gRPC.
+var nextProtos = []string{"h2", "http/1.1"}
+
+// Options configures a Server.
+type Options struct {
+	Addr string
+	// Handler serves HTTP requests; nil answers them with 404.
+	Handler http.Handler
+	// GRPC serves gRPC requests, typically a *grpc.Server. When nil, gRPC
+	// requests reach Handler like any other.
+	GRPC http.Handler
+	// H2C accepts HTTP/2 without TLS. gRPC clients need it, or TLS, to
+	// connect.
+	H2C bool
+	TLS TLSOptions
+	// ErrorLog receives connection and certificate reload errors; nil logs
+	// with the log package.
+	ErrorLog *log.Logger
+}
+
+// TLSOptions configures TLS, which is enabled when CertFile is set.
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables mutual TLS: clients must present a certificate
+	// signed by one of its CAs.
+	ClientCAFile string
+	// ReloadInterval is how often the files are checked for changes during
+	// handshakes; negative disables reloading.
+	ReloadInterval time.Duration
+}
+
+// Server is an http.Server dispatching gRPC requests to Options.GRPC.
+type Server struct {
+	srv   *http.Server
+	certs *certReloader
+}
+
+// New creates a Server. With TLS enabled the certificates are loaded eagerly
+// so that configuration errors surface at startup.
+func New(opts Options) (*Server, error) {
+	handler := opts.Handler
+	if handler == nil {
+		handler = http.NotFoundHandler()
+	}
+	if opts.GRPC != nil {
+		handler = dispatch(opts.GRPC, handler)
+	}
+
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	s := &Server{srv: &http.Server{
+		Addr:      opts.Addr,
+		Handler:   handler,
+		Protocols: protocols,
+		ErrorLog:  opts.ErrorLog,
+	}}
+
+	if opts.TLS.CertFile == "" {
+		protocols.SetUnencryptedHTTP2(opts.H2C)
+		return s, nil
+	}
+	if opts.TLS.KeyFile == "" {
+		return nil, errors.New("server: tls key file is required with a cert file")
+	}
+	protocols.SetHTTP2(true)
+	certs, err := newCertReloader(opts.TLS, opts.ErrorLog)
+	if err != nil {
+		return nil, err
+	}
+	s.certs = certs
+	s.srv.TLSConfig = &tls.Config{NextProtos: nextProtos, GetConfigForClient: certs.config}
+	return s, nil
+}
+
+// dispatch routes gRPC requests, which are HTTP/2 with an application/grpc
+// content type, to grpc and everything else to next.
+func dispatch(grpc, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpc.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// TLS reports whether the server terminates TLS.
+func (s *Server) TLS() bool {
+	return s.certs != nil
+}
+
+// ListenAndServe listens on Options.Addr and serves until Shutdown, after
+// which it returns http.ErrServerClosed.
+func (s *Server) ListenAndServe() error {
+	addr := s.srv.Addr
+	if addr == "" {
+		addr = ":http"
+		if s.TLS() {
+			addr = ":https"
+		}
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves connections accepted on l, wrapping it in TLS if enabled.
+func (s *Server) Serve(l net.Listener) error {
+	if s.TLS() {
+		l = tls.NewListener(l, s.srv.TLSConfig)
+	}
+	return s.srv.Serve(l)
+}
+
+// Shutdown gracefully shuts the server down; see http.Server.Shutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+// RegisterOnShutdown registers f to be called on Shutdown, e.g. to end
+// long-lived streams.
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.srv.RegisterOnShutdown(f)
+}
+
+// certReloader hands out the TLS configuration for each handshake, reloading
+// the certificate files once they change. A failed reload keeps the previous
+// certificates.
+type certReloader struct {
+	opts     TLSOptions
+	interval time.Duration
+	errorLog *log.Logger
+
+	mu        sync.Mutex
+	current   *tls.Config
+	stamp     string
+	checkedAt time.Time
+}
+
+func newCertReloader(opts TLSOptions, errorLog *log.Logger) (*certReloader, error) {
+	interval := opts.ReloadInterval
+	if interval == 0 {
+		interval = DefaultReloadInterval
+	}
+	c := &certReloader{opts: opts, interval: interval, errorLog: errorLog}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *certReloader) config(*tls.ClientHelloInfo) (*tls.Config, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.interval > 0 && time.Since(c.checkedAt) >= c.interval {
+		if err := c.reload(); err != nil {
+			c.logf("server: %v", err)
+		}
+	}
+	return c.current, nil
+}
+
+// reload loads the files if their modification times or sizes have changed.
+func (c *certReloader) reload() error {
+	c.checkedAt = time.Now()
+
+	stamp, err := c.stat()
+	if err != nil {
+		return err
+	}
+	if stamp == c.stamp {
+		return nil
+	}
+	return c.load(stamp)
+}
+
+func (c *certReloader) load(stamp string) error {
+	cert, err := tls.LoadX509KeyPair(c.opts.CertFile, c.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load tls certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   nextProtos,
+	}
+	if c.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.opts.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("load client ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("load client ca: no certificates in %s", c.opts.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	c.current = cfg
+	c.stamp = stamp
+	return nil
+}
+
+// stat summarises the modification times and sizes of the files. Stat
+// follows symlinks, so swapping a mounted secret's target is noticed too.
+func (c *certReloader) stat() (string, error) {
+	var b strings.Builder
+	for _, name := range []string{c.opts.CertFile, c.opts.KeyFile, c.opts.ClientCAFile} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return "", fmt.Errorf("load tls certificate: %w", err)
+		}
+		fmt.Fprintf(&b, "%d:%d;", fi.ModTime().UnixNano(), fi.Size())
+	}
+	return b.String(), nil
+}
+
+func (c *certReloader) logf(format string, args ...any) {
+	if c.errorLog != nil {
+		c.errorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
@@ -1,18 +1,29 @@
 package main
 
 import (
+	"context"
 	"log"
-	"net"
 
 	userv1 "github.com/user/go-templates/template-grpc-sdk/gen/go/user/v1"
 	"github.com/user/go-templates/template-grpc-sdk/internal/config"
 	"github.com/user/go-templates/template-grpc-sdk/internal/user"
+	"github.com/user/go-templates/template-grpc-sdk/pkg/auth"
+	"github.com/user/go-templates/template-grpc-sdk/pkg/authz"
+	"github.com/user/go-templates/template-grpc-sdk/pkg/idgen"
 	"github.com/user/go-templates/template-grpc-sdk/pkg/logger"
+	"github.com/user/go-templates/template-grpc-sdk/pkg/requestid"
+	"github.com/user/go-templates/template-grpc-sdk/pkg/server"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
 
+// publicMethods can be called without a bearer token.
+var publicMethods = []string{
+	"/grpc.reflection.v1.ServerReflection/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+}
+
 func main() {
 	cfg, err := config.LoadConfig("config")
 	if err != nil {
@@ -24,23 +35,72 @@ func main() {
 		panic(err)
 	}
 	defer logger.Sync()
+	zap.ReplaceGlobals(logger)
 
-	lis, err := net.Listen("tcp", ":"+cfg.Server.Port)
+	// Authentication
+	authKeys, err := auth.LoadKeySet(context.Background(), auth.KeyOptions{
+		JWKS:            cfg.Auth.JWKS,
+		JWKSRefresh:     cfg.Auth.JWKSRefresh,
+		HMACSecret:      cfg.Auth.HMACSecret,
+		PublicKeyFile:   cfg.Auth.PublicKeyFile,
+		AllowWeakSecret: cfg.App.Env == "dev",
+	})
 	if err != nil {
-		logger.Fatal("failed to listen", zap.Error(err))
+		logger.Fatal("cannot load auth keys", zap.Error(err))
 	}
+	verifier := auth.NewVerifier(authKeys, auth.Options{
+		Issuer:    cfg.Auth.Issuer,
+		Audience:  cfg.Auth.Audience,
+		ClockSkew: cfg.Auth.ClockSkew,
+	})
 
-	s := grpc.NewServer()
+	// Authorization
+	authorizer := authz.NewAuthorizer(authz.StaticRoles(cfg.Authz.Roles), 0)
+
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			requestid.UnaryServerInterceptor(logger),
+			auth.UnaryServerInterceptor(verifier, publicMethods...),
+			authz.UnaryServerInterceptor(authorizer, user.MethodPermissions),
+		),
+		grpc.ChainStreamInterceptor(
+			auth.StreamServerInterceptor(verifier, publicMethods...),
+			authz.StreamServerInterceptor(authorizer, user.MethodPermissions),
+		),
+	)
 
 	// Register services
-	userSvc := user.NewService(logger)
+	// The user service gives new users IDs of the configured strategy and
+	// rejects IDs written any other way.
+	ids, err := idgen.New(cfg.IDs.Strategy)
+	if err != nil {
+		logger.Fatal("invalid id strategy", zap.Error(err))
+	}
+	userSvc := user.NewService(ids)
 	userv1.RegisterUserServiceServer(s, userSvc)
 
 	// Register reflection service on gRPC server.
 	reflection.Register(s)
 
-	logger.Info("gRPC server starting", zap.String("port", cfg.Server.Port))
-	if err := s.Serve(lis); err != nil {
+	// gRPC shares the port with HTTP; requests other than gRPC get 404.
+	srv, err := server.New(server.Options{
+		Addr: ":" + cfg.Server.Port,
+		GRPC: s,
+		H2C:  cfg.Server.H2C,
+		TLS: server.TLSOptions{
+			CertFile:       cfg.Server.TLS.CertFile,
+			KeyFile:        cfg.Server.TLS.KeyFile,
+			ClientCAFile:   cfg.Server.TLS.ClientCAFile,
+			ReloadInterval: cfg.Server.TLS.ReloadInterval,
+		},
+		ErrorLog: zap.NewStdLog(logger),
+	})
+	if err != nil {
+		logger.Fatal("cannot configure server", zap.Error(err))
+	}
+
+	logger.Info("gRPC server starting", zap.String("port", cfg.Server.Port), zap.Bool("tls", srv.TLS()))
+	if err := srv.ListenAndServe(); err != nil {
 		logger.Fatal("failed to serve", zap.Error(err))
 	}
 }
@@ -9,6 +9,7 @@ package userv1
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	fieldmaskpb "google.golang.org/protobuf/types/known/fieldmaskpb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -82,8 +83,11 @@ func (x *User) GetEmail() string {
 }
 
 type GetUserRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Limits the returned user to these User fields, e.g. "id,name". An empty
+	// mask returns every field.
+	ReadMask      *fieldmaskpb.FieldMask `protobuf:"bytes,2,opt,name=read_mask,json=readMask,proto3" json:"read_mask,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -125,6 +129,13 @@ func (x *GetUserRequest) GetId() string {
 	return ""
 }
 
+func (x *GetUserRequest) GetReadMask() *fieldmaskpb.FieldMask {
+	if x != nil {
+		return x.ReadMask
+	}
+	return nil
+}
+
 type GetUserResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	User          *User                  `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
@@ -269,13 +280,14 @@ var File_user_v1_user_proto protoreflect.FileDescriptor
 
 const file_user_v1_user_proto_rawDesc = "" +
 	"\n" +
-	"\x12user/v1/user.proto\x12\auser.v1\"@\n" +
+	"\x12user/v1/user.proto\x12\auser.v1\x1a google/protobuf/field_mask.proto\"@\n" +
 	"\x04User\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
 	"\x04name\x18\x02 \x01(\tR\x04name\x12\x14\n" +
-	"\x05email\x18\x03 \x01(\tR\x05email\" \n" +
+	"\x05email\x18\x03 \x01(\tR\x05email\"Y\n" +
 	"\x0eGetUserRequest\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\tR\x02id\"4\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x127\n" +
+	"\tread_mask\x18\x02 \x01(\v2\x1a.google.protobuf.FieldMaskR\breadMask\"4\n" +
 	"\x0fGetUserResponse\x12!\n" +
 	"\x04user\x18\x01 \x01(\v2\r.user.v1.UserR\x04user\"=\n" +
 	"\x11CreateUserRequest\x12\x12\n" +
@@ -302,24 +314,26 @@ func file_user_v1_user_proto_rawDescGZIP() []byte {
 
 var file_user_v1_user_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
 var file_user_v1_user_proto_goTypes = []any{
-	(*User)(nil),               // 0: user.v1.User
-	(*GetUserRequest)(nil),     // 1: user.v1.GetUserRequest
-	(*GetUserResponse)(nil),    // 2: user.v1.GetUserResponse
-	(*CreateUserRequest)(nil),  // 3: user.v1.CreateUserRequest
-	(*CreateUserResponse)(nil), // 4: user.v1.CreateUserResponse
+	(*User)(nil),                  // 0: user.v1.User
+	(*GetUserRequest)(nil),        // 1: user.v1.GetUserRequest
+	(*GetUserResponse)(nil),       // 2: user.v1.GetUserResponse
+	(*CreateUserRequest)(nil),     // 3: user.v1.CreateUserRequest
+	(*CreateUserResponse)(nil),    // 4: user.v1.CreateUserResponse
+	(*fieldmaskpb.FieldMask)(nil), // 5: google.protobuf.FieldMask
 }
 var file_user_v1_user_proto_depIdxs = []int32{
-	0, // 0: user.v1.GetUserResponse.user:type_name -> user.v1.User
-	0, // 1: user.v1.CreateUserResponse.user:type_name -> user.v1.User
-	1, // 2: user.v1.UserService.GetUser:input_type -> user.v1.GetUserRequest
-	3, // 3: user.v1.UserService.CreateUser:input_type -> user.v1.CreateUserRequest
-	2, // 4: user.v1.UserService.GetUser:output_type -> user.v1.GetUserResponse
-	4, // 5: user.v1.UserService.CreateUser:output_type -> user.v1.CreateUserResponse
-	4, // [4:6] is the sub-list for method output_type
-	2, // [2:4] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	5, // 0: user.v1.GetUserRequest.read_mask:type_name -> google.protobuf.FieldMask
+	0, // 1: user.v1.GetUserResponse.user:type_name -> user.v1.User
+	0, // 2: user.v1.CreateUserResponse.user:type_name -> user.v1.User
+	1, // 3: user.v1.UserService.GetUser:input_type -> user.v1.GetUserRequest
+	3, // 4: user.v1.UserService.CreateUser:input_type -> user.v1.CreateUserRequest
+	2, // 5: user.v1.UserService.GetUser:output_type -> user.v1.GetUserResponse
+	4, // 6: user.v1.UserService.CreateUser:output_type -> user.v1.CreateUserResponse
+	5, // [5:7] is the sub-list for method output_type
+	3, // [3:5] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_user_v1_user_proto_init() }
@@ -2,37 +2,79 @@ package user
 
 import (
 	"context"
+	"errors"
+	"slices"
 
 	userv1 "github.com/user/go-templates/template-grpc-sdk/gen/go/user/v1"
+	"github.com/user/go-templates/template-grpc-sdk/pkg/auth"
+	"github.com/user/go-templates/template-grpc-sdk/pkg/authz"
+	"github.com/user/go-templates/template-grpc-sdk/pkg/idgen"
+	"github.com/user/go-templates/template-grpc-sdk/pkg/logger"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
+// Permissions guarding user operations.
+const (
+	PermissionRead  = "users:read"
+	PermissionWrite = "users:write"
+	// PermissionAdmin lets a caller act on any user, not only themselves.
+	PermissionAdmin = "users:admin"
+)
+
+// MethodPermissions declares the permissions each RPC requires, for use with
+// authz.UnaryServerInterceptor.
+var MethodPermissions = map[string][]string{
+	userv1.UserService_GetUser_FullMethodName:    {PermissionRead},
+	userv1.UserService_CreateUser_FullMethodName: {PermissionWrite},
+}
+
 type Service struct {
 	userv1.UnimplementedUserServiceServer
-	logger *zap.Logger
+	ids idgen.Generator
 }
 
-func NewService(logger *zap.Logger) *Service {
-	return &Service{logger: logger}
+// NewService returns the user service. ids generates the IDs of new users
+// and parses the IDs callers send.
+func NewService(ids idgen.Generator) *Service {
+	return &Service{ids: ids}
 }
 
 func (s *Service) GetUser(ctx context.Context, req *userv1.GetUserRequest) (*userv1.GetUserResponse, error) {
-	s.logger.Info("fetching user", zap.String("id", req.GetId()))
+	logger.FromContext(ctx).Info("fetching user", zap.String("id", req.GetId()))
+
+	if !req.GetReadMask().IsValid(&userv1.User{}) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid read_mask %v", req.GetReadMask().GetPaths())
+	}
+	// IDs are used in canonical form, so that every way of writing one
+	// finds the user.
+	b, err := s.ids.Parse(req.GetId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid user id %q", req.GetId())
+	}
+	id := s.ids.Format(b)
+	if err := authorizeAccess(ctx, id); err != nil {
+		if errors.Is(err, authz.ErrPermissionDenied) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, err
+	}
 
 	// Mock implementation
-	return &userv1.GetUserResponse{
-		User: &userv1.User{
-			Id:    req.GetId(),
-			Name:  "John Doe",
-			Email: "john@example.com",
-		},
-	}, nil
+	user := &userv1.User{
+		Id:    id,
+		Name:  "John Doe",
+		Email: "john@example.com",
+	}
+	applyReadMask(user, req.GetReadMask())
+	return &userv1.GetUserResponse{User: user}, nil
 }
 
 func (s *Service) CreateUser(ctx context.Context, req *userv1.CreateUserRequest) (*userv1.CreateUserResponse, error) {
-	s.logger.Info("creating user", zap.String("email", req.GetEmail()))
+	logger.FromContext(ctx).Info("creating user", zap.String("email", req.GetEmail()))
 
 	if req.GetName() == "" {
 		return nil, status.Error(codes.InvalidArgument, "name is required")
@@ -40,9 +82,33 @@ func (s *Service) CreateUser(ctx context.Context, req *userv1.CreateUserRequest)
 
 	return &userv1.CreateUserResponse{
 		User: &userv1.User{
-			Id:    "new-uuid",
+			Id:    s.ids.New(),
 			Name:  req.GetName(),
 			Email: req.GetEmail(),
 		},
 	}, nil
 }
+
+// applyReadMask clears the fields of m not listed in mask. An empty mask
+// keeps every field.
+func applyReadMask(m proto.Message, mask *fieldmaskpb.FieldMask) {
+	if len(mask.GetPaths()) == 0 {
+		return
+	}
+	msg := m.ProtoReflect()
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if fd := fields.Get(i); !slices.Contains(mask.GetPaths(), string(fd.Name())) {
+			msg.Clear(fd)
+		}
+	}
+}
+
+// authorizeAccess lets callers access their own record; any other record
+// requires PermissionAdmin.
+func authorizeAccess(ctx context.Context, id string) error {
+	if claims, ok := auth.FromContext(ctx); ok && claims.Subject == id {
+		return nil
+	}
+	return authz.Check(ctx, PermissionAdmin)
+}
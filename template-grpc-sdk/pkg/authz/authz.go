@@ -0,0 +1,152 @@
+// Package authz implements role-based authorization on top of pkg/auth.
+//
+// Permissions are plain strings such as "users:read". Callers are granted
+// permissions through the roles in their token, which a Store maps to
+// permissions, and directly through their scopes (API keys carry scopes
+// only). A grant of "*" matches every permission and "users:*" matches every
+// permission starting with "users:".
+package authz
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/go-templates/template-grpc-sdk/pkg/auth"
+	"github.com/user/go-templates/template-grpc-sdk/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// ErrPermissionDenied is returned when the caller lacks a permission.
+var ErrPermissionDenied = errors.New("permission denied")
+
+// Store supplies the mapping from role names to permissions.
+type Store interface {
+	RolePermissions(ctx context.Context) (map[string][]string, error)
+}
+
+// StaticRoles is a Store backed by a fixed mapping, typically from config.
+type StaticRoles map[string][]string
+
+func (s StaticRoles) RolePermissions(ctx context.Context) (map[string][]string, error) {
+	return s, nil
+}
+
+// Authorizer decides whether claims grant a permission. The role mapping is
+// loaded from the Store on first use and reloaded once it is older than the
+// refresh interval; a failed reload keeps the previous mapping.
+type Authorizer struct {
+	store   Store
+	refresh time.Duration
+
+	mu       sync.Mutex
+	roles    map[string][]string
+	loadedAt time.Time
+}
+
+// NewAuthorizer returns an Authorizer reading roles from store. A zero refresh
+// loads the mapping once.
+func NewAuthorizer(store Store, refresh time.Duration) *Authorizer {
+	return &Authorizer{store: store, refresh: refresh}
+}
+
+// Load fetches the role mapping from the store.
+func (a *Authorizer) Load(ctx context.Context) error {
+	roles, err := a.store.RolePermissions(ctx)
+	if err != nil {
+		return err
+	}
+	if roles == nil {
+		roles = map[string][]string{}
+	}
+
+	a.mu.Lock()
+	a.roles = roles
+	a.loadedAt = time.Now()
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *Authorizer) rolePermissions(ctx context.Context) map[string][]string {
+	a.mu.Lock()
+	roles, loadedAt := a.roles, a.loadedAt
+	a.mu.Unlock()
+
+	if !loadedAt.IsZero() && (a.refresh <= 0 || time.Since(loadedAt) < a.refresh) {
+		return roles
+	}
+	if err := a.Load(ctx); err != nil {
+		logger.FromContext(ctx).Warn("cannot load role permissions", zap.Error(err))
+		a.mu.Lock()
+		a.loadedAt = time.Now() // back off until the next refresh
+		a.mu.Unlock()
+		return roles
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.roles
+}
+
+// Allowed reports whether claims grant every one of perms.
+func (a *Authorizer) Allowed(ctx context.Context, claims *auth.Claims, perms ...string) bool {
+	if claims == nil {
+		return false
+	}
+
+	grants := claims.Scopes()
+	roles := a.rolePermissions(ctx)
+	for _, role := range claims.Roles {
+		grants = append(grants, roles[role]...)
+	}
+
+	for _, perm := range perms {
+		if !granted(grants, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+func granted(grants []string, perm string) bool {
+	for _, g := range grants {
+		if g == "*" || g == perm {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(g, "*"); ok && strings.HasSuffix(prefix, ":") && strings.HasPrefix(perm, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying a.
+func NewContext(ctx context.Context, a *Authorizer) context.Context {
+	return context.WithValue(ctx, contextKey{}, a)
+}
+
+// FromContext returns the Authorizer stored in ctx, if any.
+func FromContext(ctx context.Context) (*Authorizer, bool) {
+	a, ok := ctx.Value(contextKey{}).(*Authorizer)
+	return a, ok
+}
+
+// Check returns ErrPermissionDenied unless the caller in ctx holds every one
+// of perms. Contexts without claims belong to internal callers (jobs,
+// startup code) and are always allowed; transports are responsible for
+// rejecting anonymous requests before they reach the service layer.
+func Check(ctx context.Context, perms ...string) error {
+	claims, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	a, ok := FromContext(ctx)
+	if !ok || !a.Allowed(ctx, claims, perms...) {
+		return ErrPermissionDenied
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package authz
+
+import (
+	"context"
+
+	"github.com/user/go-templates/template-grpc-sdk/pkg/auth"
+	"github.com/user/go-templates/template-grpc-sdk/pkg/logger"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor makes a available to Check and enforces the
+// permissions declared per full method ("/pkg.Service/Method") in perms.
+// Anonymous callers of a listed method get Unauthenticated, callers lacking a
+// permission get PermissionDenied. Methods without an entry are left to the
+// service implementation. Chain it after auth.UnaryServerInterceptor.
+func UnaryServerInterceptor(a *Authorizer, perms map[string][]string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authorize(ctx, a, info.FullMethod, perms)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of UnaryServerInterceptor.
+func StreamServerInterceptor(a *Authorizer, perms map[string][]string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), a, info.FullMethod, perms)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func authorize(ctx context.Context, a *Authorizer, method string, perms map[string][]string) (context.Context, error) {
+	ctx = NewContext(ctx, a)
+
+	required, ok := perms[method]
+	if !ok {
+		return ctx, nil
+	}
+	if _, ok := auth.FromContext(ctx); !ok {
+		return nil, status.Error(codes.Unauthenticated, auth.ErrMissingToken.Error())
+	}
+	if err := Check(ctx, required...); err != nil {
+		logger.FromContext(ctx).Info("permission denied", zap.String("method", method), zap.Strings("permissions", required))
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return ctx, nil
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
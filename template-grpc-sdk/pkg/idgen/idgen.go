@@ -0,0 +1,143 @@
+// Package idgen generates the IDs of new entities and parses the IDs callers
+// send. Every strategy makes 128-bit IDs, so a store keeping them as 16
+// bytes, such as a Postgres uuid column, can hold any of them.
+package idgen
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalid reports an ID that is not written in a generator's format.
+var ErrInvalid = errors.New("invalid id")
+
+// Generator is a strategy for the IDs of new entities.
+type Generator interface {
+	// New returns a new ID in canonical form.
+	New() string
+	// Parse returns the 16 bytes of id, or ErrInvalid when id is not
+	// written in the generator's format.
+	Parse(id string) ([16]byte, error)
+	// Format writes b in canonical form, so that Format of Parse(id) is id
+	// in canonical form.
+	Format(b [16]byte) string
+}
+
+// Strategies accepted by New.
+const (
+	StrategyUUIDv4 = "uuidv4"
+	StrategyUUIDv7 = "uuidv7"
+	StrategyULID   = "ulid"
+)
+
+// New returns the generator of strategy. Empty is StrategyUUIDv7.
+func New(strategy string) (Generator, error) {
+	switch strategy {
+	case StrategyUUIDv4:
+		return UUIDv4{}, nil
+	case StrategyUUIDv7, "":
+		return UUIDv7{}, nil
+	case StrategyULID:
+		return ULID{}, nil
+	default:
+		return nil, fmt.Errorf("unknown id strategy %q", strategy)
+	}
+}
+
+// uuidFormat parses and formats IDs as UUIDs. Every UUID version parses, so
+// IDs made under the other UUID strategy stay valid.
+type uuidFormat struct{}
+
+func (uuidFormat) Parse(id string) ([16]byte, error) {
+	// uuid.Parse also accepts braces, URNs and missing hyphens, which would
+	// let callers write the same ID many ways.
+	if len(id) != 36 {
+		return [16]byte{}, ErrInvalid
+	}
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return [16]byte{}, ErrInvalid
+	}
+	return u, nil
+}
+
+func (uuidFormat) Format(b [16]byte) string {
+	return uuid.UUID(b).String()
+}
+
+// UUIDv4 generates random UUIDs.
+type UUIDv4 struct{ uuidFormat }
+
+func (UUIDv4) New() string {
+	return uuid.NewString()
+}
+
+// UUIDv7 generates UUIDs starting with their creation time in milliseconds,
+// so that they sort by creation and keep B-tree indexes compact.
+type UUIDv7 struct{ uuidFormat }
+
+func (UUIDv7) New() string {
+	return uuid.Must(uuid.NewV7()).String()
+}
+
+// crockford is the alphabet of ULIDs, Crockford's base32.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID generates ULIDs: a 48-bit millisecond timestamp and 80 random bits
+// written as 26 characters of Crockford's base32. Like UUIDv7s they sort by
+// creation, except within a millisecond. Parse accepts lowercase; Format
+// writes uppercase.
+type ULID struct{}
+
+func (g ULID) New() string {
+	var b [16]byte
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixMilli()))
+	copy(b[:6], ms[2:])
+	if _, err := rand.Read(b[6:]); err != nil {
+		panic(err)
+	}
+	return g.Format(b)
+}
+
+func (ULID) Parse(id string) ([16]byte, error) {
+	// 26 characters hold 130 bits, so the first may only use the low 3.
+	if len(id) != 26 || id[0] > '7' {
+		return [16]byte{}, ErrInvalid
+	}
+	var hi, lo uint64
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		v := strings.IndexByte(crockford, c)
+		if v < 0 {
+			return [16]byte{}, ErrInvalid
+		}
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(v)
+	}
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], hi)
+	binary.BigEndian.PutUint64(b[8:], lo)
+	return b, nil
+}
+
+func (ULID) Format(b [16]byte) string {
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	var s [26]byte
+	for i := len(s) - 1; i >= 0; i-- {
+		s[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
@@ -0,0 +1,77 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/user/go-templates/template-grpc-sdk/pkg/logger"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// MetadataKey is the gRPC metadata key used to accept and return the request ID.
+const MetadataKey = "x-request-id"
+
+// maxLen bounds the size of caller supplied IDs so they cannot bloat logs.
+const maxLen = 128
+
+type ctxKey struct{}
+
+// New returns a random 128-bit request ID encoded as hex.
+func New() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// NewContext returns a copy of ctx that carries id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, or "" if there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// UnaryServerInterceptor accepts the caller's x-request-id metadata (or
+// generates one), returns it in the response header and trailer and stores it,
+// together with a logger annotated with it, in the handler context.
+func UnaryServerInterceptor(log *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var id string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if v := md.Get(MetadataKey); len(v) > 0 {
+				id = v[0]
+			}
+		}
+		if !valid(id) {
+			id = New()
+		}
+
+		md := metadata.Pairs(MetadataKey, id)
+		_ = grpc.SetHeader(ctx, md)
+		_ = grpc.SetTrailer(ctx, md)
+
+		ctx = NewContext(ctx, id)
+		ctx = logger.NewContext(ctx, log.With(zap.String("request_id", id), zap.String("method", info.FullMethod)))
+		return handler(ctx, req)
+	}
+}
+
+func valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 
 	userv1 "github.com/user/go-templates/template-grpc-sdk/gen/go/user/v1"
+	"github.com/user/go-templates/template-grpc-sdk/pkg/requestid"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 type Client struct {
@@ -14,8 +17,14 @@ type Client struct {
 	conn *grpc.ClientConn
 }
 
-func NewClient(target string) (*Client, error) {
-	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// NewClient dials target. Extra options are appended to the defaults, e.g.
+// grpc.WithPerRPCCredentials to attach a bearer token to every call.
+func NewClient(target string, opts ...grpc.DialOption) (*Client, error) {
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(propagateRequestID),
+	}, opts...)
+	conn, err := grpc.Dial(target, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial: %w", err)
 	}
@@ -30,9 +39,23 @@ func (c *Client) Close() error {
 	return c.conn.Close()
 }
 
-// Example method
-func (c *Client) GetUser(ctx context.Context, id string) (*userv1.User, error) {
-	resp, err := c.User.GetUser(ctx, &userv1.GetUserRequest{Id: id})
+// propagateRequestID forwards the request ID found in ctx so that calls made
+// while serving a request can be correlated with it on the server side.
+func propagateRequestID(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if id := requestid.FromContext(ctx); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, requestid.MetadataKey, id)
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// GetUser fetches a user. When fields are given, only those User fields
+// (e.g. "id", "name") are returned.
+func (c *Client) GetUser(ctx context.Context, id string, fields ...string) (*userv1.User, error) {
+	req := &userv1.GetUserRequest{Id: id}
+	if len(fields) > 0 {
+		req.ReadMask = &fieldmaskpb.FieldMask{Paths: fields}
+	}
+	resp, err := c.User.GetUser(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
 	"log"
-	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/user/go-templates/template-http-proto/internal/config"
 	"github.com/user/go-templates/template-http-proto/internal/user"
+	"github.com/user/go-templates/template-http-proto/pkg/auth"
+	"github.com/user/go-templates/template-http-proto/pkg/authz"
+	"github.com/user/go-templates/template-http-proto/pkg/bodylimit"
+	"github.com/user/go-templates/template-http-proto/pkg/compress"
+	"github.com/user/go-templates/template-http-proto/pkg/cors"
+	"github.com/user/go-templates/template-http-proto/pkg/idgen"
 	"github.com/user/go-templates/template-http-proto/pkg/logger"
+	"github.com/user/go-templates/template-http-proto/pkg/requestid"
+	"github.com/user/go-templates/template-http-proto/pkg/secureheaders"
+	"github.com/user/go-templates/template-http-proto/pkg/server"
 	"go.uber.org/zap"
 )
 
@@ -23,20 +32,88 @@ func main() {
 		panic(err)
 	}
 	defer logger.Sync()
+	zap.ReplaceGlobals(logger)
 
-	userSvc := user.NewService(logger)
+	// The user service gives new users IDs of the configured strategy and
+	// rejects IDs written any other way.
+	ids, err := idgen.New(cfg.IDs.Strategy)
+	if err != nil {
+		logger.Fatal("invalid id strategy", zap.Error(err))
+	}
+	userSvc := user.NewService(ids)
 	userHandler := user.NewHandler(userSvc)
 
+	// Authentication
+	authKeys, err := auth.LoadKeySet(context.Background(), auth.KeyOptions{
+		JWKS:            cfg.Auth.JWKS,
+		JWKSRefresh:     cfg.Auth.JWKSRefresh,
+		HMACSecret:      cfg.Auth.HMACSecret,
+		PublicKeyFile:   cfg.Auth.PublicKeyFile,
+		AllowWeakSecret: cfg.App.Env == "dev",
+	})
+	if err != nil {
+		logger.Fatal("cannot load auth keys", zap.Error(err))
+	}
+	verifier := auth.NewVerifier(authKeys, auth.Options{
+		Issuer:    cfg.Auth.Issuer,
+		Audience:  cfg.Auth.Audience,
+		ClockSkew: cfg.Auth.ClockSkew,
+	})
+
+	// Authorization
+	authorizer := authz.NewAuthorizer(authz.StaticRoles(cfg.Authz.Roles), 0)
+
 	r := chi.NewRouter()
+	r.Use(requestid.Middleware(logger))
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(secureheaders.Middleware(secureheaders.Options{
+		HSTSMaxAge:            cfg.Server.SecurityHeaders.HSTSMaxAge,
+		HSTSIncludeSubdomains: cfg.Server.SecurityHeaders.HSTSIncludeSubdomains,
+		ContentSecurityPolicy: cfg.Server.SecurityHeaders.ContentSecurityPolicy,
+		ReferrerPolicy:        cfg.Server.SecurityHeaders.ReferrerPolicy,
+	}))
+	// CORS runs before authentication so preflight requests need no credentials.
+	r.Use(cors.Middleware(cors.Options{
+		AllowedOrigins:   cfg.Server.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.Server.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.Server.CORS.AllowedHeaders,
+		ExposedHeaders:   cfg.Server.CORS.ExposedHeaders,
+		AllowCredentials: cfg.Server.CORS.AllowCredentials,
+		MaxAge:           cfg.Server.CORS.MaxAge,
+	}))
+	if cfg.Server.Compression.Enabled {
+		r.Use(compress.Middleware(compress.Options{MinSize: cfg.Server.Compression.MinSize}))
+	}
+	r.Use(bodylimit.Middleware(bodylimit.Options{
+		Default: cfg.Server.BodyLimit.Default,
+		Routes:  cfg.Server.BodyLimit.Limits(),
+	}))
+	r.Use(auth.Middleware(verifier))
+	r.Use(authz.Middleware(authorizer))
 
 	r.Route("/api/v1", func(r chi.Router) {
 		userHandler.RegisterRoutes(r)
 	})
 
-	logger.Info("HTTP Proto server starting", zap.String("port", cfg.Server.Port))
-	if err := http.ListenAndServe(":"+cfg.Server.Port, r); err != nil {
+	srv, err := server.New(server.Options{
+		Addr:    ":" + cfg.Server.Port,
+		Handler: r,
+		H2C:     cfg.Server.H2C,
+		TLS: server.TLSOptions{
+			CertFile:       cfg.Server.TLS.CertFile,
+			KeyFile:        cfg.Server.TLS.KeyFile,
+			ClientCAFile:   cfg.Server.TLS.ClientCAFile,
+			ReloadInterval: cfg.Server.TLS.ReloadInterval,
+		},
+		ErrorLog: zap.NewStdLog(logger),
+	})
+	if err != nil {
+		logger.Fatal("cannot configure server", zap.Error(err))
+	}
+
+	logger.Info("HTTP Proto server starting", zap.String("port", cfg.Server.Port), zap.Bool("tls", srv.TLS()))
+	if err := srv.ListenAndServe(); err != nil {
 		logger.Fatal("server failed", zap.Error(err))
 	}
 }
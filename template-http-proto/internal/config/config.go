@@ -2,6 +2,7 @@ package config
 
 import (
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -10,6 +11,9 @@ type Config struct {
 	App    AppConfig    `mapstructure:"app"`
 	Server ServerConfig `mapstructure:"server"`
 	Log    LogConfig    `mapstructure:"log"`
+	IDs    IDsConfig    `mapstructure:"ids"`
+	Auth   AuthConfig   `mapstructure:"auth"`
+	Authz  AuthzConfig  `mapstructure:"authz"`
 }
 
 type AppConfig struct {
@@ -18,13 +22,102 @@ type AppConfig struct {
 }
 
 type ServerConfig struct {
-	Port string `mapstructure:"port"`
+	Port            string                `mapstructure:"port"`
+	H2C             bool                  `mapstructure:"h2c"`
+	TLS             TLSConfig             `mapstructure:"tls"`
+	CORS            CORSConfig            `mapstructure:"cors"`
+	SecurityHeaders SecurityHeadersConfig `mapstructure:"security_headers"`
+	BodyLimit       BodyLimitConfig       `mapstructure:"body_limit"`
+	Compression     CompressionConfig     `mapstructure:"compression"`
+}
+
+type TLSConfig struct {
+	// CertFile and KeyFile enable TLS. They are reloaded when they change,
+	// checked at most every ReloadInterval.
+	CertFile       string        `mapstructure:"cert_file"`
+	KeyFile        string        `mapstructure:"key_file"`
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+	// ClientCAFile requires clients to present a certificate signed by one
+	// of its CAs (mutual TLS).
+	ClientCAFile string `mapstructure:"client_ca_file"`
+}
+
+type CORSConfig struct {
+	// AllowedOrigins may contain "*" or wildcard subdomain patterns such as
+	// "https://*.example.com". Leave empty to disable CORS.
+	AllowedOrigins   []string      `mapstructure:"allowed_origins"`
+	AllowedMethods   []string      `mapstructure:"allowed_methods"`
+	AllowedHeaders   []string      `mapstructure:"allowed_headers"`
+	ExposedHeaders   []string      `mapstructure:"exposed_headers"`
+	AllowCredentials bool          `mapstructure:"allow_credentials"`
+	MaxAge           time.Duration `mapstructure:"max_age"`
+}
+
+type SecurityHeadersConfig struct {
+	// HSTSMaxAge enables Strict-Transport-Security when positive.
+	HSTSMaxAge            time.Duration `mapstructure:"hsts_max_age"`
+	HSTSIncludeSubdomains bool          `mapstructure:"hsts_include_subdomains"`
+	ContentSecurityPolicy string        `mapstructure:"content_security_policy"`
+	ReferrerPolicy        string        `mapstructure:"referrer_policy"`
+}
+
+type BodyLimitConfig struct {
+	// Default is the maximum request body size in bytes; zero disables it.
+	Default int64        `mapstructure:"default"`
+	Routes  []RouteLimit `mapstructure:"routes"`
+}
+
+type RouteLimit struct {
+	// Route is a chi route pattern, optionally prefixed with a method, e.g.
+	// "POST /api/v1/users".
+	Route string `mapstructure:"route"`
+	Limit int64  `mapstructure:"limit"`
+}
+
+// Limits returns the per-route limits keyed by route.
+func (c BodyLimitConfig) Limits() map[string]int64 {
+	limits := make(map[string]int64, len(c.Routes))
+	for _, rl := range c.Routes {
+		limits[rl.Route] = rl.Limit
+	}
+	return limits
+}
+
+type CompressionConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MinSize is the smallest response in bytes worth compressing.
+	MinSize int `mapstructure:"min_size"`
 }
 
 type LogConfig struct {
 	Level string `mapstructure:"level"`
 }
 
+type IDsConfig struct {
+	// Strategy generating the IDs of new users: "uuidv7", "uuidv4" or
+	// "ulid". Empty is "uuidv7".
+	Strategy string `mapstructure:"strategy"`
+}
+
+type AuthConfig struct {
+	Issuer    string        `mapstructure:"issuer"`
+	Audience  string        `mapstructure:"audience"`
+	ClockSkew time.Duration `mapstructure:"clock_skew"`
+
+	// JWKS is a URL or file path of a JSON Web Key Set.
+	JWKS        string        `mapstructure:"jwks"`
+	JWKSRefresh time.Duration `mapstructure:"jwks_refresh"`
+
+	// Local keys, used when no JWKS is configured.
+	HMACSecret    string `mapstructure:"hmac_secret"`
+	PublicKeyFile string `mapstructure:"public_key_file"`
+}
+
+type AuthzConfig struct {
+	// Roles maps role names from the token's "roles" claim to permissions.
+	Roles map[string][]string `mapstructure:"roles"`
+}
+
 func LoadConfig(path string) (*Config, error) {
 	viper.AddConfigPath(path)
 	viper.SetConfigName("config")
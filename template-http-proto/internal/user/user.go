@@ -2,38 +2,100 @@ package user
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	userv1 "github.com/user/go-templates/template-http-proto/gen/go/user/v1"
+	"github.com/user/go-templates/template-http-proto/pkg/auth"
+	"github.com/user/go-templates/template-http-proto/pkg/authz"
+	"github.com/user/go-templates/template-http-proto/pkg/idgen"
+	"github.com/user/go-templates/template-http-proto/pkg/logger"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 // --- Domain/Service ---
 
+// Permissions guarding user operations.
+const (
+	PermissionRead  = "users:read"
+	PermissionWrite = "users:write"
+	// PermissionAdmin lets a caller act on any user, not only themselves.
+	PermissionAdmin = "users:admin"
+)
+
+// ErrInvalidID reports an ID that is not written in the format of the
+// service's idgen.Generator.
+var ErrInvalidID = errors.New("invalid user id")
+
 type Service interface {
-	GetUser(ctx context.Context, id string) (*userv1.User, error)
+	// GetUser returns only the User fields in readMask; an empty mask
+	// returns every field. It returns ErrInvalidID for IDs the service's
+	// idgen.Generator cannot parse.
+	GetUser(ctx context.Context, id string, readMask *fieldmaskpb.FieldMask) (*userv1.User, error)
 	CreateUser(ctx context.Context, name, email string) (*userv1.User, error)
 }
 
 type userService struct {
-	logger *zap.Logger
+	ids idgen.Generator
 }
 
-func NewService(logger *zap.Logger) Service {
-	return &userService{logger: logger}
+// NewService returns the user service. ids generates the IDs of new users
+// and parses the IDs callers send.
+func NewService(ids idgen.Generator) Service {
+	return &userService{ids: ids}
 }
 
-func (s *userService) GetUser(ctx context.Context, id string) (*userv1.User, error) {
-	s.logger.Info("fetching user", zap.String("id", id))
-	return &userv1.User{Id: id, Name: "John Doe", Email: "john@example.com"}, nil
+func (s *userService) GetUser(ctx context.Context, id string, readMask *fieldmaskpb.FieldMask) (*userv1.User, error) {
+	logger.FromContext(ctx).Info("fetching user", zap.String("id", id))
+	// IDs are used in canonical form, so that every way of writing one
+	// finds the user.
+	b, err := s.ids.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidID
+	}
+	id = s.ids.Format(b)
+	if err := authorizeAccess(ctx, id); err != nil {
+		return nil, err
+	}
+	user := &userv1.User{Id: id, Name: "John Doe", Email: "john@example.com"}
+	applyReadMask(user, readMask)
+	return user, nil
 }
 
 func (s *userService) CreateUser(ctx context.Context, name, email string) (*userv1.User, error) {
-	s.logger.Info("creating user", zap.String("email", email))
-	return &userv1.User{Id: "new-uuid", Name: name, Email: email}, nil
+	logger.FromContext(ctx).Info("creating user", zap.String("email", email))
+	return &userv1.User{Id: s.ids.New(), Name: name, Email: email}, nil
+}
+
+// applyReadMask clears the fields of m not listed in mask. An empty mask
+// keeps every field.
+func applyReadMask(m proto.Message, mask *fieldmaskpb.FieldMask) {
+	if len(mask.GetPaths()) == 0 {
+		return
+	}
+	msg := m.ProtoReflect()
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if fd := fields.Get(i); !slices.Contains(mask.GetPaths(), string(fd.Name())) {
+			msg.Clear(fd)
+		}
+	}
+}
+
+// authorizeAccess lets callers access their own record; any other record
+// requires PermissionAdmin.
+func authorizeAccess(ctx context.Context, id string) error {
+	if claims, ok := auth.FromContext(ctx); ok && claims.Subject == id {
+		return nil
+	}
+	return authz.Check(ctx, PermissionAdmin)
 }
 
 // --- Handler ---
@@ -47,15 +109,34 @@ func NewHandler(svc Service) *Handler {
 }
 
 func (h *Handler) RegisterRoutes(r chi.Router) {
-	r.Get("/users/{id}", h.GetUser)
-	r.Post("/users", h.CreateUser)
+	r.With(authz.Require(PermissionRead)).Get("/users/{id}", h.GetUser)
+	r.With(authz.Require(PermissionWrite)).Post("/users", h.CreateUser)
 }
 
 func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	// ?fields=id,name selects User fields by their proto names.
+	readMask := &fieldmaskpb.FieldMask{}
+	for _, f := range strings.Split(r.URL.Query().Get("fields"), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			readMask.Paths = append(readMask.Paths, f)
+		}
+	}
+	if !readMask.IsValid(&userv1.User{}) {
+		http.Error(w, "unknown field in "+strings.Join(readMask.GetPaths(), ","), http.StatusBadRequest)
+		return
+	}
+
 	id := chi.URLParam(r, "id")
-	user, err := h.svc.GetUser(r.Context(), id)
+	user, err := h.svc.GetUser(r.Context(), id, readMask)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, authz.ErrPermissionDenied):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrInvalidID):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -67,17 +148,20 @@ func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	var req userv1.CreateUserRequest
 
-	// Unmarshal from JSON to Proto message
-	dec := json.NewDecoder(r.Body)
-	var raw map[string]interface{}
-	if err := dec.Decode(&raw); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+	// Unmarshal from JSON to Proto message. protojson rejects unknown fields
+	// and anything after the top-level object.
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
-
-	jsonBytes, _ := json.Marshal(raw)
-	if err := protojson.Unmarshal(jsonBytes, &req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+	if err := protojson.Unmarshal(body, &req); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
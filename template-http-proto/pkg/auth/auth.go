@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// DefaultAlgorithms are the signing algorithms accepted when Options.Algorithms is empty.
+var DefaultAlgorithms = []string{"RS256", "ES256", "EdDSA", "HS256"}
+
+// Claims are the validated token claims made available to handlers.
+type Claims struct {
+	jwt.RegisteredClaims
+	Scope string   `json:"scope,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Scopes splits the space separated scope claim.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx that carries the authenticated claims.
+func NewContext(ctx context.Context, c *Claims) context.Context {
+	return context.WithValue(ctx, ctxKey{}, c)
+}
+
+// FromContext returns the claims of the authenticated caller, if any.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	c, ok := ctx.Value(ctxKey{}).(*Claims)
+	return c, ok
+}
+
+// KeySet resolves the key used to verify a token signed with alg and,
+// optionally, identified by kid.
+type KeySet interface {
+	Key(ctx context.Context, kid, alg string) (any, error)
+}
+
+type Options struct {
+	Issuer     string
+	Audience   string
+	ClockSkew  time.Duration
+	Algorithms []string
+}
+
+// Verifier validates JWT bearer tokens against a KeySet.
+type Verifier struct {
+	keys   KeySet
+	parser *jwt.Parser
+}
+
+func NewVerifier(keys KeySet, opts Options) *Verifier {
+	algs := opts.Algorithms
+	if len(algs) == 0 {
+		algs = DefaultAlgorithms
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(algs),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(opts.ClockSkew),
+	}
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+
+	return &Verifier{
+		keys:   keys,
+		parser: jwt.NewParser(parserOpts...),
+	}
+}
+
+// Verify checks the token signature and its registered claims and returns the
+// decoded claims.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	var claims Claims
+	_, err := v.parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid, t.Method.Alg())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return &claims, nil
+}
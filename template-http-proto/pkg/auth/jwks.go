@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minRefreshInterval rate-limits reloads triggered by unknown key IDs so a
+// flood of forged tokens cannot hammer the JWKS endpoint.
+const minRefreshInterval = 10 * time.Second
+
+// maxRetryInterval caps the backoff between reloads while the JWKS source
+// keeps failing.
+const maxRetryInterval = 5 * time.Minute
+
+// JWKS is a KeySet loaded from a JSON Web Key Set document on disk or over
+// HTTP. Keys are cached for the refresh interval and reloaded early when a
+// token references a key ID that is not cached yet, which picks up key
+// rotation at the issuer. Reloads run outside the lock, one at a time, and
+// back off while the source fails; the cached keys are served meanwhile.
+type JWKS struct {
+	source  string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]jwk
+	fetchedAt time.Time
+	triedAt   time.Time
+	// backoff is how long after triedAt the next reload may start. It
+	// doubles with every failed reload, up to maxRetryInterval.
+	backoff time.Duration
+	// loading is closed when the reload in progress, if any, completes.
+	loading chan struct{}
+	loadErr error
+}
+
+// NewJWKS creates a JWKS key set reading from source, which is either an
+// http(s) URL or a file path. The set is loaded eagerly so that configuration
+// errors surface at startup.
+func NewJWKS(ctx context.Context, source string, refresh time.Duration) (*JWKS, error) {
+	s := &JWKS{
+		source:  source,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		backoff: minRefreshInterval,
+	}
+	s.triedAt = time.Now()
+	keys, err := s.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.keys = keys
+	s.fetchedAt = s.triedAt
+	return s, nil
+}
+
+func (s *JWKS) Key(ctx context.Context, kid, alg string) (any, error) {
+	s.mu.Lock()
+	if s.refresh > 0 && time.Since(s.fetchedAt) > s.refresh && s.mayReload() {
+		// The refresh runs in the background; the cached keys are still
+		// good until it completes.
+		s.reload(ctx)
+	}
+	k, ok := s.lookup(kid, alg)
+	if ok {
+		s.mu.Unlock()
+		return k.key, nil
+	}
+
+	// An unknown key ID may have been rotated in at the issuer: wait for a
+	// reload, joining the one in progress if there is one.
+	done := s.loading
+	if done == nil && s.mayReload() {
+		done = s.reload(ctx)
+	}
+	s.mu.Unlock()
+	if done == nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.lookup(kid, alg); ok {
+		return k.key, nil
+	}
+	if s.loadErr != nil {
+		return nil, s.loadErr
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// mayReload reports whether the backoff since the last reload has passed.
+// s.mu must be held.
+func (s *JWKS) mayReload() bool {
+	return s.loading == nil && time.Since(s.triedAt) > s.backoff
+}
+
+// reload starts loading the key set in the background and returns a
+// channel closed when it completes. s.mu must be held.
+func (s *JWKS) reload(ctx context.Context) chan struct{} {
+	done := make(chan struct{})
+	s.loading = done
+	s.triedAt = time.Now()
+	// The reload is shared by every caller waiting for it, so it must not
+	// be cancelled with the request that started it.
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		keys, err := s.fetch(ctx)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err != nil {
+			s.loadErr = err
+			s.backoff = min(2*s.backoff, maxRetryInterval)
+		} else {
+			s.keys = keys
+			s.fetchedAt = s.triedAt
+			s.loadErr = nil
+			s.backoff = minRefreshInterval
+		}
+		s.loading = nil
+		close(done)
+	}()
+	return done
+}
+
+func (s *JWKS) lookup(kid, alg string) (jwk, bool) {
+	if kid != "" {
+		k, ok := s.keys[kid]
+		return k, ok && k.usableFor(alg)
+	}
+	// Tokens without a kid are only accepted when the choice is unambiguous.
+	var found jwk
+	n := 0
+	for _, k := range s.keys {
+		if k.usableFor(alg) {
+			found = k
+			n++
+		}
+	}
+	return found, n == 1
+}
+
+func (s *JWKS) fetch(ctx context.Context) (map[string]jwk, error) {
+	data, err := s.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load jwks: %w", err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("load jwks: %w", err)
+	}
+	return keys, nil
+}
+
+func (s *JWKS) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.source, "http://") && !strings.HasPrefix(s.source, "https://") {
+		return os.ReadFile(s.source)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+type jwk struct {
+	alg string
+	key any
+}
+
+func (k jwk) usableFor(alg string) bool {
+	if k.alg != "" && k.alg != alg {
+		return false
+	}
+	return keyMatchesAlg(k.key, alg)
+}
+
+type rawJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+func parseJWKS(data []byte) (map[string]jwk, error) {
+	var doc struct {
+		Keys []rawJWK `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]jwk, len(doc.Keys))
+	for _, raw := range doc.Keys {
+		if raw.Use != "" && raw.Use != "sig" {
+			continue
+		}
+		key, err := raw.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", raw.Kid, err)
+		}
+		keys[raw.Kid] = jwk{alg: raw.Alg, key: key}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys found")
+	}
+	return keys, nil
+}
+
+func (k rawJWK) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return nil, err
+		}
+		return secret, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// keyMatchesAlg guards against algorithm confusion, e.g. an RSA public key
+// being accepted as an HMAC secret.
+func keyMatchesAlg(key any, alg string) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return alg == "RS256"
+	case *ecdsa.PublicKey:
+		return alg == "ES256"
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	case []byte:
+		return alg == "HS256"
+	}
+	return false
+}
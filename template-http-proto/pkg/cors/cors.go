@@ -0,0 +1,159 @@
+// Package cors implements Cross-Origin Resource Sharing for browser clients.
+package cors
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMethods are allowed when Options.AllowedMethods is empty.
+var DefaultMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// Options configures the middleware.
+type Options struct {
+	// AllowedOrigins lists origins allowed to call the API, e.g.
+	// "https://app.example.com". "*" allows any origin and
+	// "https://*.example.com" allows any subdomain of example.com over https.
+	// An empty list disables CORS.
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders lists request headers allowed in preflight requests.
+	// "*" allows any header.
+	AllowedHeaders []string
+	// ExposedHeaders lists response headers readable by browser scripts.
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and authorization headers
+	// to origins matching an AllowedOrigins pattern other than "*"; with
+	// "*" any site could make credentialed requests and read the responses.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration
+}
+
+// Middleware answers preflight requests and adds CORS headers to responses
+// for allowed origins. Requests from other origins are served without CORS
+// headers, so browsers block them; their preflights get 403.
+func Middleware(opts Options) func(http.Handler) http.Handler {
+	if len(opts.AllowedOrigins) == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	methods := opts.AllowedMethods
+	if len(methods) == 0 {
+		methods = DefaultMethods
+	}
+	allowMethods := strings.Join(methods, ", ")
+	exposeHeaders := strings.Join(opts.ExposedHeaders, ", ")
+	var credentialed []string
+	if opts.AllowCredentials {
+		credentialed = slices.DeleteFunc(slices.Clone(opts.AllowedOrigins), func(p string) bool { return p == "*" })
+	}
+	maxAge := ""
+	if opts.MaxAge > 0 {
+		maxAge = strconv.Itoa(int(opts.MaxAge.Seconds()))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed := originAllowed(opts.AllowedOrigins, origin)
+			credentials := originAllowed(credentialed, origin)
+			if !preflight {
+				if allowed {
+					setOrigin(h, origin, credentials)
+					if exposeHeaders != "" {
+						h.Set("Access-Control-Expose-Headers", exposeHeaders)
+					}
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			method := r.Header.Get("Access-Control-Request-Method")
+			requested := r.Header.Get("Access-Control-Request-Headers")
+			if !allowed || !contains(methods, method) || !headersAllowed(opts.AllowedHeaders, requested) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			setOrigin(h, origin, credentials)
+			h.Set("Access-Control-Allow-Methods", allowMethods)
+			if requested != "" {
+				h.Set("Access-Control-Allow-Headers", requested)
+			}
+			if maxAge != "" {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+func setOrigin(h http.Header, origin string, credentials bool) {
+	// Credentialed requests may not use the "*" wildcard, so always echo the
+	// origin.
+	h.Set("Access-Control-Allow-Origin", origin)
+	if credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func originAllowed(patterns []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if p == "*" || p == origin {
+			return true
+		}
+		// "https://*.example.com" matches "https://api.example.com" but not
+		// "https://example.com" or "https://evil-example.com".
+		if prefix, suffix, ok := strings.Cut(p, "*"); ok && strings.HasPrefix(suffix, ".") {
+			if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) && len(origin) > len(prefix)+len(suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func headersAllowed(allowed []string, requested string) bool {
+	if requested == "" || contains(allowed, "*") {
+		return true
+	}
+	for _, name := range strings.Split(requested, ",") {
+		if name = strings.TrimSpace(name); name != "" && !contains(allowed, name) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,17 +2,41 @@ package main
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	chiadapter "github.com/awslabs/aws-lambda-go-api-proxy/chi"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/redis/go-redis/v9"
+	"github.com/user/go-templates/template-mongo/internal/apikey"
 	"github.com/user/go-templates/template-mongo/internal/config"
+	"github.com/user/go-templates/template-mongo/internal/operation"
+	"github.com/user/go-templates/template-mongo/internal/outbox"
+	"github.com/user/go-templates/template-mongo/internal/role"
 	"github.com/user/go-templates/template-mongo/internal/user"
+	userv1 "github.com/user/go-templates/template-mongo/internal/user/v1"
+	userv2 "github.com/user/go-templates/template-mongo/internal/user/v2"
+	"github.com/user/go-templates/template-mongo/internal/webhook"
+	"github.com/user/go-templates/template-mongo/pkg/auth"
+	"github.com/user/go-templates/template-mongo/pkg/authz"
+	"github.com/user/go-templates/template-mongo/pkg/batch"
+	"github.com/user/go-templates/template-mongo/pkg/bodylimit"
+	"github.com/user/go-templates/template-mongo/pkg/cache"
+	"github.com/user/go-templates/template-mongo/pkg/compress"
+	"github.com/user/go-templates/template-mongo/pkg/cors"
+	"github.com/user/go-templates/template-mongo/pkg/httpcache"
+	"github.com/user/go-templates/template-mongo/pkg/idgen"
 	"github.com/user/go-templates/template-mongo/pkg/logger"
+	"github.com/user/go-templates/template-mongo/pkg/requestid"
+	"github.com/user/go-templates/template-mongo/pkg/secureheaders"
+	"github.com/user/go-templates/template-mongo/pkg/tenant"
+	"github.com/user/go-templates/template-mongo/pkg/transaction"
 	mongoDriver "go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
 )
 
 var chiLambda *chiadapter.ChiLambda
@@ -26,6 +50,7 @@ func init() {
 
 	// Initialize Logger
 	log, _ := logger.New(cfg.Log.Level)
+	zap.ReplaceGlobals(log)
 
 	// Connect to Database
 	client, err := mongoDriver.Connect(context.Background(), options.Client().ApplyURI(cfg.DB.URI))
@@ -35,17 +60,219 @@ func init() {
 	db := client.Database(cfg.DB.Database)
 
 	// Initialize Layers
+	// Services give new users, webhook subscriptions and deliveries,
+	// operations and API keys IDs of the configured strategy; the user
+	// service also rejects IDs written any other way.
+	ids, err := idgen.New(cfg.IDs.Strategy)
+	if err != nil {
+		log.Fatal("invalid id strategy", zap.Error(err))
+	}
+
+	// The worker only runs while the function is thawed, so deliveries are
+	// sent during later invocations rather than immediately.
+	webhookRepo := webhook.NewMongoRepository(db)
+	if err := webhookRepo.EnsureIndexes(context.Background()); err != nil {
+		// handle error
+	}
+	webhookDispatcher := webhook.NewDispatcher(webhookRepo, ids)
+	_ = webhook.NewWorker(webhookRepo, &http.Client{Timeout: cfg.Webhooks.Timeout}, webhook.WorkerOptions{
+		Interval:    cfg.Webhooks.Interval,
+		MaxAttempts: cfg.Webhooks.MaxAttempts,
+		Backoff:     cfg.Webhooks.Backoff,
+		MaxBackoff:  cfg.Webhooks.MaxBackoff,
+		Timeout:     cfg.Webhooks.Timeout,
+	})
+	webhookHandler := webhook.NewHandler(webhook.NewService(webhookRepo, ids))
+
+	// Operations only progress while the function is thawed, so they may take
+	// far longer than on a server.
+	operationRepo := operation.NewMongoRepository(db)
+	if err := operationRepo.MigrateTenants(context.Background()); err != nil {
+		// handle error
+	}
+	operations := operation.NewManager(operationRepo, ids, operation.ManagerOptions{
+		Workers: cfg.Operations.Workers,
+		Queue:   cfg.Operations.Queue,
+	})
+	operationHandler := operation.NewHandler(operations)
+
 	userRepo := user.NewMongoRepository(db)
-	userService := user.NewService(userRepo, log)
-	userHandler := user.NewHandler(userService)
+	if err := userRepo.EnsureIndexes(context.Background()); err != nil {
+		// handle error
+	}
+	// Users read by ID are cached in front of the database; writes remove
+	// them from the cache once they commit.
+	var users user.Repository = userRepo
+	var usersCache cache.Cache
+	switch cfg.UserCache.Backend {
+	case "":
+	case "memory":
+		usersCache = cache.NewLRU(cache.LRUOptions{MaxEntries: cfg.UserCache.MaxEntries})
+	case "redis":
+		redisClient := redis.NewClient(&redis.Options{
+			Addr:     cfg.UserCache.Redis.Addr,
+			Password: cfg.UserCache.Redis.Password,
+			DB:       cfg.UserCache.Redis.DB,
+		})
+		usersCache = cache.NewRedis(redisClient, cfg.App.Name+":")
+	default:
+		log.Fatal("unknown user cache backend", zap.String("backend", cfg.UserCache.Backend))
+	}
+	if usersCache != nil {
+		users = user.NewCachingRepository(userRepo, usersCache, user.CacheOptions{
+			TTL:         cfg.UserCache.TTL,
+			NotFoundTTL: cfg.UserCache.NotFoundTTL,
+		})
+	}
+	txManager := transaction.NewMongoManager(client)
+	if cfg.DB.Transactions || cfg.Outbox.Enabled {
+		if err := txManager.Check(context.Background()); err != nil {
+			log.Fatal("db.transactions and outbox.enabled need MongoDB to run as a replica set", zap.Error(err))
+		}
+	}
+	// Lambda cannot hold event streams open, so user events only feed
+	// webhooks.
+	userService := user.NewService(users, ids, webhookDispatcher)
+	if cfg.DB.Transactions {
+		// Each write and its history entry commit together.
+		userService = user.NewAuditedService(users, ids, txManager, webhookDispatcher)
+	}
+	if cfg.Outbox.Enabled {
+		// User events are written to the outbox with each change and
+		// published by the relay, so none is lost if the process stops in
+		// between. Like the webhook worker, the relay only runs while the
+		// function is thawed.
+		outboxRepo := outbox.NewMongoRepository(db)
+		userService = user.NewTransactionalService(users, ids, txManager, outboxRepo)
+		_ = outbox.NewRelay(outboxRepo, user.NewOutboxPublisher(webhookDispatcher), outbox.RelayOptions{
+			Interval:  cfg.Outbox.Interval,
+			BatchSize: cfg.Outbox.BatchSize,
+			Lease:     cfg.Outbox.Lease,
+		})
+	}
+	// Deleted users can be restored until the purger removes them. Like the
+	// relay, it only runs while the function is thawed.
+	_ = user.NewPurger(userRepo, user.PurgeOptions{
+		Retention: cfg.UserTrash.Retention,
+		Interval:  cfg.UserTrash.PurgeInterval,
+	})
+	userV1Handler := userv1.NewHandler(userService)
+	userV2Handler := userv2.NewHandler(userService, operations)
+	// Responses to user reads are cached per caller; writes through the user
+	// routes purge the cache.
+	userCache := httpcache.New(httpcache.Options{
+		MaxBytes:      cfg.Server.Cache.MaxBytes,
+		MaxEntryBytes: cfg.Server.Cache.MaxEntryBytes,
+		TTL:           cfg.Server.Cache.TTL,
+	})
+
+	apiKeyRepo := apikey.NewMongoRepository(db)
+	if err := apiKeyRepo.EnsureIndexes(context.Background()); err != nil {
+		// handle error
+	}
+	apiKeyUsage := apikey.NewUsageRecorder(apiKeyRepo, 30*time.Second)
+	apiKeyService := apikey.NewService(apiKeyRepo, ids, apiKeyUsage)
+	apiKeyHandler := apikey.NewHandler(apiKeyService)
+
+	// Authentication
+	authKeys, err := auth.LoadKeySet(context.Background(), auth.KeyOptions{
+		JWKS:            cfg.Auth.JWKS,
+		JWKSRefresh:     cfg.Auth.JWKSRefresh,
+		HMACSecret:      cfg.Auth.HMACSecret,
+		PublicKeyFile:   cfg.Auth.PublicKeyFile,
+		AllowWeakSecret: cfg.App.Env == "dev",
+	})
+	if err != nil {
+		// handle error
+	}
+	verifier := auth.NewVerifier(authKeys, auth.Options{
+		Issuer:    cfg.Auth.Issuer,
+		Audience:  cfg.Auth.Audience,
+		ClockSkew: cfg.Auth.ClockSkew,
+	})
+
+	// Authorization
+	var roleStore authz.Store = authz.StaticRoles(cfg.Authz.Roles)
+	if cfg.Authz.Source == "database" {
+		roleStore = role.NewMongoRepository(db)
+	}
+	authorizer := authz.NewAuthorizer(roleStore, cfg.Authz.Refresh)
+
+	// Tenancy
+	// Every request acts for one tenant, which scopes the user and webhook
+	// queries.
+	tenantMiddleware, err := tenant.Middleware(tenant.Options{
+		Source:  cfg.Tenancy.Source,
+		Header:  cfg.Tenancy.Header,
+		Domain:  cfg.Tenancy.Domain,
+		Default: cfg.Tenancy.Default,
+	})
+	if err != nil {
+		log.Fatal("invalid tenancy config", zap.Error(err))
+	}
 
 	// Router Setup
 	r := chi.NewRouter()
+	r.Use(requestid.Middleware(log))
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(secureheaders.Middleware(secureheaders.Options{
+		HSTSMaxAge:            cfg.Server.SecurityHeaders.HSTSMaxAge,
+		HSTSIncludeSubdomains: cfg.Server.SecurityHeaders.HSTSIncludeSubdomains,
+		ContentSecurityPolicy: cfg.Server.SecurityHeaders.ContentSecurityPolicy,
+		ReferrerPolicy:        cfg.Server.SecurityHeaders.ReferrerPolicy,
+	}))
+	// CORS runs before authentication so preflight requests need no credentials.
+	r.Use(cors.Middleware(cors.Options{
+		AllowedOrigins:   cfg.Server.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.Server.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.Server.CORS.AllowedHeaders,
+		ExposedHeaders:   cfg.Server.CORS.ExposedHeaders,
+		AllowCredentials: cfg.Server.CORS.AllowCredentials,
+		MaxAge:           cfg.Server.CORS.MaxAge,
+	}))
+	if cfg.Server.Compression.Enabled {
+		r.Use(compress.Middleware(compress.Options{MinSize: cfg.Server.Compression.MinSize}))
+	}
+	r.Use(bodylimit.Middleware(bodylimit.Options{
+		Default: cfg.Server.BodyLimit.Default,
+		Routes:  cfg.Server.BodyLimit.Limits(),
+	}))
+	r.Use(httpcache.Control(httpcache.ControlOptions{
+		Default: cfg.Server.Cache.Control,
+		Routes:  cfg.Server.Cache.Controls(),
+	}))
+	r.Use(auth.Middleware(verifier))
+	r.Use(apikey.Middleware(apiKeyService))
+	r.Use(authz.Middleware(authorizer))
+	r.Use(tenantMiddleware)
+
+	// Batch operations are dispatched through r itself; atomic batches run
+	// their writes in one transaction.
+	batchHandler := batch.NewHandler(r, batch.Options{
+		MaxOperations: cfg.Server.Batch.MaxOperations,
+		Concurrency:   cfg.Server.Batch.Concurrency,
+		Timeout:       cfg.Server.Batch.Timeout,
+		Tx:            txManager,
+	})
 
 	r.Route("/api/v1", func(r chi.Router) {
-		userHandler.RegisterRoutes(r)
+		r.Group(func(r chi.Router) {
+			if cfg.Server.Cache.Enabled {
+				r.Use(userCache.Middleware)
+			}
+			userV1Handler.RegisterRoutes(r)
+		})
+		apiKeyHandler.RegisterRoutes(r)
+		webhookHandler.RegisterRoutes(r)
+		operationHandler.RegisterRoutes(r)
+		batchHandler.RegisterRoutes(r)
+	})
+	r.Route("/api/v2", func(r chi.Router) {
+		if cfg.Server.Cache.Enabled {
+			r.Use(userCache.Middleware)
+		}
+		userV2Handler.RegisterRoutes(r)
 	})
 
 	chiLambda = chiadapter.New(r)
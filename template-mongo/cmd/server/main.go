@@ -2,15 +2,44 @@ package main
 
 import (
 	"context"
+	"errors"
+	"expvar"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/redis/go-redis/v9"
+	"github.com/user/go-templates/template-mongo/internal/apikey"
 	"github.com/user/go-templates/template-mongo/internal/config"
+	"github.com/user/go-templates/template-mongo/internal/operation"
+	"github.com/user/go-templates/template-mongo/internal/outbox"
+	"github.com/user/go-templates/template-mongo/internal/role"
 	"github.com/user/go-templates/template-mongo/internal/user"
+	userstream "github.com/user/go-templates/template-mongo/internal/user/stream"
+	userv1 "github.com/user/go-templates/template-mongo/internal/user/v1"
+	userv2 "github.com/user/go-templates/template-mongo/internal/user/v2"
+	"github.com/user/go-templates/template-mongo/internal/webhook"
+	"github.com/user/go-templates/template-mongo/pkg/auth"
+	"github.com/user/go-templates/template-mongo/pkg/authz"
+	"github.com/user/go-templates/template-mongo/pkg/batch"
+	"github.com/user/go-templates/template-mongo/pkg/bodylimit"
+	"github.com/user/go-templates/template-mongo/pkg/broker"
+	"github.com/user/go-templates/template-mongo/pkg/cache"
+	"github.com/user/go-templates/template-mongo/pkg/compress"
+	"github.com/user/go-templates/template-mongo/pkg/cors"
+	"github.com/user/go-templates/template-mongo/pkg/httpcache"
+	"github.com/user/go-templates/template-mongo/pkg/idgen"
 	"github.com/user/go-templates/template-mongo/pkg/logger"
+	"github.com/user/go-templates/template-mongo/pkg/requestid"
+	"github.com/user/go-templates/template-mongo/pkg/secureheaders"
+	"github.com/user/go-templates/template-mongo/pkg/server"
+	"github.com/user/go-templates/template-mongo/pkg/tenant"
+	"github.com/user/go-templates/template-mongo/pkg/transaction"
 	mongoDriver "go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
@@ -29,6 +58,7 @@ func main() {
 		panic(err)
 	}
 	defer logger.Sync()
+	zap.ReplaceGlobals(logger)
 
 	// Connect to Database
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -43,22 +73,269 @@ func main() {
 	db := client.Database(cfg.DB.Database)
 
 	// Initialize Architecture Layers (Feature-based)
+	// Services give new users, webhook subscriptions and deliveries,
+	// operations and API keys IDs of the configured strategy; the user
+	// service also rejects IDs written any other way.
+	ids, err := idgen.New(cfg.IDs.Strategy)
+	if err != nil {
+		logger.Fatal("invalid id strategy", zap.Error(err))
+	}
+
+	webhookRepo := webhook.NewMongoRepository(db)
+	if err := webhookRepo.EnsureIndexes(ctx); err != nil {
+		logger.Fatal("cannot create webhook indexes", zap.Error(err))
+	}
+	webhookDispatcher := webhook.NewDispatcher(webhookRepo, ids)
+	webhookWorker := webhook.NewWorker(webhookRepo, &http.Client{Timeout: cfg.Webhooks.Timeout}, webhook.WorkerOptions{
+		Interval:    cfg.Webhooks.Interval,
+		MaxAttempts: cfg.Webhooks.MaxAttempts,
+		Backoff:     cfg.Webhooks.Backoff,
+		MaxBackoff:  cfg.Webhooks.MaxBackoff,
+		Timeout:     cfg.Webhooks.Timeout,
+	})
+	defer webhookWorker.Close()
+	webhookHandler := webhook.NewHandler(webhook.NewService(webhookRepo, ids))
+
+	operationRepo := operation.NewMongoRepository(db)
+	if err := operationRepo.MigrateTenants(ctx); err != nil {
+		logger.Fatal("cannot migrate operation tenants", zap.Error(err))
+	}
+	operations := operation.NewManager(operationRepo, ids, operation.ManagerOptions{
+		Workers: cfg.Operations.Workers,
+		Queue:   cfg.Operations.Queue,
+	})
+	defer operations.Close()
+	operationHandler := operation.NewHandler(operations)
+
 	userRepo := user.NewMongoRepository(db)
-	userService := user.NewService(userRepo, logger)
-	userHandler := user.NewHandler(userService)
+	if err := userRepo.EnsureIndexes(ctx); err != nil {
+		logger.Fatal("cannot create user indexes", zap.Error(err))
+	}
+	// Users read by ID are cached in front of the database; writes remove
+	// them from the cache once they commit.
+	var users user.Repository = userRepo
+	var usersCache cache.Cache
+	switch cfg.UserCache.Backend {
+	case "":
+	case "memory":
+		usersCache = cache.NewLRU(cache.LRUOptions{MaxEntries: cfg.UserCache.MaxEntries})
+	case "redis":
+		redisClient := redis.NewClient(&redis.Options{
+			Addr:     cfg.UserCache.Redis.Addr,
+			Password: cfg.UserCache.Redis.Password,
+			DB:       cfg.UserCache.Redis.DB,
+		})
+		defer redisClient.Close()
+		usersCache = cache.NewRedis(redisClient, cfg.App.Name+":")
+	default:
+		logger.Fatal("unknown user cache backend", zap.String("backend", cfg.UserCache.Backend))
+	}
+	if usersCache != nil {
+		cachingUsers := user.NewCachingRepository(userRepo, usersCache, user.CacheOptions{
+			TTL:         cfg.UserCache.TTL,
+			NotFoundTTL: cfg.UserCache.NotFoundTTL,
+		})
+		expvar.Publish("user_cache", expvar.Func(func() any { return cachingUsers.Stats() }))
+		users = cachingUsers
+	}
+	userEvents := broker.New[user.Event](broker.Options{
+		History: cfg.Events.History,
+		Buffer:  cfg.Events.Buffer,
+	})
+	txManager := transaction.NewMongoManager(client)
+	if cfg.DB.Transactions || cfg.Outbox.Enabled {
+		if err := txManager.Check(ctx); err != nil {
+			logger.Fatal("db.transactions and outbox.enabled need MongoDB to run as a replica set", zap.Error(err))
+		}
+	}
+	userPublisher := user.Publishers{userEvents, webhookDispatcher}
+	userService := user.NewService(users, ids, userPublisher)
+	if cfg.DB.Transactions {
+		// Each write and its history entry commit together.
+		userService = user.NewAuditedService(users, ids, txManager, userPublisher)
+	}
+	if cfg.Outbox.Enabled {
+		// User events are written to the outbox with each change and
+		// published by the relay, so none is lost if the process stops in
+		// between.
+		outboxRepo := outbox.NewMongoRepository(db)
+		userService = user.NewTransactionalService(users, ids, txManager, outboxRepo)
+		outboxRelay := outbox.NewRelay(outboxRepo, user.NewOutboxPublisher(userPublisher), outbox.RelayOptions{
+			Interval:  cfg.Outbox.Interval,
+			BatchSize: cfg.Outbox.BatchSize,
+			Lease:     cfg.Outbox.Lease,
+		})
+		defer outboxRelay.Close()
+	}
+	// Deleted users can be restored until the purger removes them.
+	userPurger := user.NewPurger(userRepo, user.PurgeOptions{
+		Retention: cfg.UserTrash.Retention,
+		Interval:  cfg.UserTrash.PurgeInterval,
+	})
+	defer userPurger.Close()
+	userV1Handler := userv1.NewHandler(userService)
+	userV2Handler := userv2.NewHandler(userService, operations)
+	// Responses to user reads are cached per caller; writes through the user
+	// routes purge the cache.
+	userCache := httpcache.New(httpcache.Options{
+		MaxBytes:      cfg.Server.Cache.MaxBytes,
+		MaxEntryBytes: cfg.Server.Cache.MaxEntryBytes,
+		TTL:           cfg.Server.Cache.TTL,
+	})
+	userStreamHandler := userstream.NewHandler(userEvents, userstream.Options{
+		Heartbeat:      cfg.Events.Heartbeat,
+		AllowedOrigins: cfg.Server.CORS.AllowedOrigins,
+	})
+
+	apiKeyRepo := apikey.NewMongoRepository(db)
+	if err := apiKeyRepo.EnsureIndexes(ctx); err != nil {
+		logger.Fatal("cannot create api key indexes", zap.Error(err))
+	}
+	apiKeyUsage := apikey.NewUsageRecorder(apiKeyRepo, 30*time.Second)
+	defer apiKeyUsage.Close()
+	apiKeyService := apikey.NewService(apiKeyRepo, ids, apiKeyUsage)
+	apiKeyHandler := apikey.NewHandler(apiKeyService)
+
+	// Authentication
+	authKeys, err := auth.LoadKeySet(context.Background(), auth.KeyOptions{
+		JWKS:            cfg.Auth.JWKS,
+		JWKSRefresh:     cfg.Auth.JWKSRefresh,
+		HMACSecret:      cfg.Auth.HMACSecret,
+		PublicKeyFile:   cfg.Auth.PublicKeyFile,
+		AllowWeakSecret: cfg.App.Env == "dev",
+	})
+	if err != nil {
+		logger.Fatal("cannot load auth keys", zap.Error(err))
+	}
+	verifier := auth.NewVerifier(authKeys, auth.Options{
+		Issuer:    cfg.Auth.Issuer,
+		Audience:  cfg.Auth.Audience,
+		ClockSkew: cfg.Auth.ClockSkew,
+	})
+
+	// Authorization
+	var roleStore authz.Store = authz.StaticRoles(cfg.Authz.Roles)
+	if cfg.Authz.Source == "database" {
+		roleStore = role.NewMongoRepository(db)
+	}
+	authorizer := authz.NewAuthorizer(roleStore, cfg.Authz.Refresh)
+
+	// Tenancy
+	// Every request acts for one tenant, which scopes the user and webhook
+	// queries.
+	tenantMiddleware, err := tenant.Middleware(tenant.Options{
+		Source:  cfg.Tenancy.Source,
+		Header:  cfg.Tenancy.Header,
+		Domain:  cfg.Tenancy.Domain,
+		Default: cfg.Tenancy.Default,
+	})
+	if err != nil {
+		logger.Fatal("invalid tenancy config", zap.Error(err))
+	}
 
 	// Router Setup
 	r := chi.NewRouter()
+	r.Use(requestid.Middleware(logger))
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(secureheaders.Middleware(secureheaders.Options{
+		HSTSMaxAge:            cfg.Server.SecurityHeaders.HSTSMaxAge,
+		HSTSIncludeSubdomains: cfg.Server.SecurityHeaders.HSTSIncludeSubdomains,
+		ContentSecurityPolicy: cfg.Server.SecurityHeaders.ContentSecurityPolicy,
+		ReferrerPolicy:        cfg.Server.SecurityHeaders.ReferrerPolicy,
+	}))
+	// CORS runs before authentication so preflight requests need no credentials.
+	r.Use(cors.Middleware(cors.Options{
+		AllowedOrigins:   cfg.Server.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.Server.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.Server.CORS.AllowedHeaders,
+		ExposedHeaders:   cfg.Server.CORS.ExposedHeaders,
+		AllowCredentials: cfg.Server.CORS.AllowCredentials,
+		MaxAge:           cfg.Server.CORS.MaxAge,
+	}))
+	if cfg.Server.Compression.Enabled {
+		r.Use(compress.Middleware(compress.Options{MinSize: cfg.Server.Compression.MinSize}))
+	}
+	r.Use(bodylimit.Middleware(bodylimit.Options{
+		Default: cfg.Server.BodyLimit.Default,
+		Routes:  cfg.Server.BodyLimit.Limits(),
+	}))
+	r.Use(httpcache.Control(httpcache.ControlOptions{
+		Default: cfg.Server.Cache.Control,
+		Routes:  cfg.Server.Cache.Controls(),
+	}))
+	r.Use(auth.Middleware(verifier))
+	r.Use(apikey.Middleware(apiKeyService))
+	r.Use(authz.Middleware(authorizer))
+	r.Use(tenantMiddleware)
+
+	// Batch operations are dispatched through r itself; atomic batches run
+	// their writes in one transaction.
+	batchHandler := batch.NewHandler(r, batch.Options{
+		MaxOperations: cfg.Server.Batch.MaxOperations,
+		Concurrency:   cfg.Server.Batch.Concurrency,
+		Timeout:       cfg.Server.Batch.Timeout,
+		Tx:            txManager,
+	})
 
 	r.Route("/api/v1", func(r chi.Router) {
-		userHandler.RegisterRoutes(r)
+		r.Group(func(r chi.Router) {
+			if cfg.Server.Cache.Enabled {
+				r.Use(userCache.Middleware)
+			}
+			userV1Handler.RegisterRoutes(r)
+		})
+		userStreamHandler.RegisterRoutes(r)
+		apiKeyHandler.RegisterRoutes(r)
+		webhookHandler.RegisterRoutes(r)
+		operationHandler.RegisterRoutes(r)
+		batchHandler.RegisterRoutes(r)
+	})
+	r.Route("/api/v2", func(r chi.Router) {
+		if cfg.Server.Cache.Enabled {
+			r.Use(userCache.Middleware)
+		}
+		userV2Handler.RegisterRoutes(r)
 	})
 
+	// Runtime and user cache counters as JSON, for operators.
+	r.With(authz.Require(user.PermissionAdmin)).Get("/debug/vars", expvar.Handler().ServeHTTP)
+
 	// Start Server
-	logger.Info("server starting", zap.String("port", cfg.Server.Port))
-	if err := http.ListenAndServe(":"+cfg.Server.Port, r); err != nil {
-		logger.Fatal("server failed", zap.Error(err))
+	srv, err := server.New(server.Options{
+		Addr:    ":" + cfg.Server.Port,
+		Handler: r,
+		H2C:     cfg.Server.H2C,
+		TLS: server.TLSOptions{
+			CertFile:       cfg.Server.TLS.CertFile,
+			KeyFile:        cfg.Server.TLS.KeyFile,
+			ClientCAFile:   cfg.Server.TLS.ClientCAFile,
+			ReloadInterval: cfg.Server.TLS.ReloadInterval,
+		},
+		ErrorLog: zap.NewStdLog(logger),
+	})
+	if err != nil {
+		logger.Fatal("cannot configure server", zap.Error(err))
+	}
+	// Event streams never go idle; closing the broker ends them so Shutdown
+	// can drain.
+	srv.RegisterOnShutdown(userEvents.Close)
+
+	go func() {
+		logger.Info("server starting", zap.String("port", cfg.Server.Port), zap.Bool("tls", srv.TLS()))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal("server failed", zap.Error(err))
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	logger.Info("server shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("server shutdown failed", zap.Error(err))
 	}
 }
@@ -0,0 +1,496 @@
+package operation_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/go-templates/template-mongo/internal/operation"
+	"github.com/user/go-templates/template-mongo/pkg/auth"
+	"github.com/user/go-templates/template-mongo/pkg/authz"
+	"github.com/user/go-templates/template-mongo/pkg/idgen"
+	"github.com/user/go-templates/template-mongo/pkg/tenant"
+)
+
+// --- Mocks ---
+
+type mockRepository struct {
+	mu  sync.Mutex
+	seq int
+	ops map[string]*operation.Operation
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{ops: make(map[string]*operation.Operation)}
+}
+
+// acme is the tenant the tests act for unless they say otherwise.
+var acme = tenant.NewContext(context.Background(), "acme")
+
+func requireTenant(ctx context.Context) (string, error) {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return "", tenant.ErrMissing
+	}
+	return id, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, op *operation.Operation) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	if op.ID == "" {
+		return errors.New("operation has no ID")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seq++
+	// Number the operations so the tests can refer to them.
+	op.ID = "op-" + strconv.Itoa(m.seq)
+	op.TenantID = tenantID
+	op.Status = operation.StatusPending
+	op.CreatedAt = time.Now()
+	op.UpdatedAt = op.CreatedAt
+	c := *op
+	m.ops[op.ID] = &c
+	return nil
+}
+
+func (m *mockRepository) Get(ctx context.Context, id string) (*operation.Operation, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	op, ok := m.ops[id]
+	if !ok || op.TenantID != tenantID {
+		return nil, operation.ErrNotFound
+	}
+	c := *op
+	return &c, nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, op *operation.Operation) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.ops[op.ID]
+	if !ok || stored.TenantID != tenantID || stored.Done() {
+		return operation.ErrFinished
+	}
+	c := *op
+	c.TenantID = tenantID
+	c.UpdatedAt = time.Now()
+	m.ops[op.ID] = &c
+	return nil
+}
+
+func newManager(t *testing.T, repo operation.Repository, opts operation.ManagerOptions) *operation.Manager {
+	t.Helper()
+	m := operation.NewManager(repo, idgen.UUIDv7{}, opts)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// wait polls the repository until the operation is final.
+func wait(t *testing.T, repo *mockRepository, id string) *operation.Operation {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		op, err := repo.Get(acme, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op.Done() {
+			return op
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("operation %s did not finish", id)
+	return nil
+}
+
+func withCaller(ctx context.Context, subject string, roles ...string) context.Context {
+	claims := &auth.Claims{Roles: roles}
+	claims.Subject = subject
+	ctx = authz.NewContext(ctx, authz.NewAuthorizer(authz.StaticRoles{"admin": {"*"}}, 0))
+	return auth.NewContext(ctx, claims)
+}
+
+// --- Manager Tests ---
+
+func TestManager_Start(t *testing.T) {
+	tests := []struct {
+		name           string
+		fn             operation.Func
+		expectedStatus string
+		expectedResult string
+		expectedError  string
+	}{
+		{
+			name: "Succeeded",
+			fn: func(ctx context.Context, progress operation.Progress) (any, error) {
+				progress(50)
+				return map[string]int{"created": 2}, nil
+			},
+			expectedStatus: operation.StatusSucceeded,
+			expectedResult: `{"created":2}`,
+		},
+		{
+			name: "Failed",
+			fn: func(ctx context.Context, progress operation.Progress) (any, error) {
+				return nil, errors.New("boom")
+			},
+			expectedStatus: operation.StatusFailed,
+			expectedError:  "boom",
+		},
+		{
+			name: "Panicked",
+			fn: func(ctx context.Context, progress operation.Progress) (any, error) {
+				panic("boom")
+			},
+			expectedStatus: operation.StatusFailed,
+			expectedError:  "operation panicked: boom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMockRepository()
+			m := newManager(t, repo, operation.ManagerOptions{})
+
+			op, err := m.Start(withCaller(acme, "user-1"), "test", tt.fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if op.Status != operation.StatusPending || op.Owner != "user-1" {
+				t.Errorf("expected pending operation owned by user-1, got %+v", op)
+			}
+
+			op = wait(t, repo, op.ID)
+			if op.Status != tt.expectedStatus {
+				t.Errorf("expected status %q, got %q", tt.expectedStatus, op.Status)
+			}
+			if string(op.Result) != tt.expectedResult {
+				t.Errorf("expected result %s, got %s", tt.expectedResult, op.Result)
+			}
+			if op.Error != tt.expectedError {
+				t.Errorf("expected error %q, got %q", tt.expectedError, op.Error)
+			}
+			if tt.expectedStatus == operation.StatusSucceeded && op.Progress != 100 {
+				t.Errorf("expected progress 100, got %d", op.Progress)
+			}
+		})
+	}
+}
+
+func TestManager_KeepsCallerIdentity(t *testing.T) {
+	repo := newMockRepository()
+	m := newManager(t, repo, operation.ManagerOptions{})
+
+	ctx, cancel := context.WithCancel(withCaller(acme, "user-1"))
+	op, err := m.Start(ctx, "test", func(ctx context.Context, progress operation.Progress) (any, error) {
+		claims, _ := auth.FromContext(ctx)
+		return claims.Subject, ctx.Err()
+	})
+	// The request ends before the operation runs.
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op = wait(t, repo, op.ID)
+	if op.Status != operation.StatusSucceeded || string(op.Result) != `"user-1"` {
+		t.Errorf("expected the operation to run as user-1, got %+v", op)
+	}
+}
+
+func TestManager_Cancel(t *testing.T) {
+	repo := newMockRepository()
+	m := newManager(t, repo, operation.ManagerOptions{})
+	ctx := withCaller(acme, "user-1")
+
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+	op, err := m.Start(ctx, "test", func(ctx context.Context, progress operation.Progress) (any, error) {
+		close(started)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	cancelled, err := m.Cancel(ctx, op.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status != operation.StatusCancelled {
+		t.Errorf("expected status cancelled, got %q", cancelled.Status)
+	}
+	if err := <-stopped; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the operation's context to be cancelled, got %v", err)
+	}
+	if op := wait(t, repo, op.ID); op.Status != operation.StatusCancelled || op.Error != "" {
+		t.Errorf("expected the operation to stay cancelled, got %+v", op)
+	}
+	if _, err := m.Cancel(ctx, op.ID); !errors.Is(err, operation.ErrFinished) {
+		t.Errorf("expected ErrFinished, got %v", err)
+	}
+}
+
+func TestManager_CancelElsewhere(t *testing.T) {
+	repo := newMockRepository()
+	m := newManager(t, repo, operation.ManagerOptions{})
+
+	release := make(chan struct{})
+	op, err := m.Start(acme, "test", func(ctx context.Context, progress operation.Progress) (any, error) {
+		<-release
+		// Another process cancelled the operation; the next report notices.
+		progress(10)
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := repo.Get(acme, op.ID)
+	stored.Status = operation.StatusCancelled
+	repo.Update(acme, stored)
+	close(release)
+
+	if op := wait(t, repo, op.ID); op.Status != operation.StatusCancelled {
+		t.Errorf("expected status cancelled, got %q", op.Status)
+	}
+}
+
+func TestManager_Busy(t *testing.T) {
+	repo := newMockRepository()
+	m := newManager(t, repo, operation.ManagerOptions{Workers: 1, Queue: 1})
+
+	release := make(chan struct{})
+	defer close(release)
+	block := func(ctx context.Context, progress operation.Progress) (any, error) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil, nil
+	}
+
+	running, err := m.Start(acme, "test", block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the worker to take the first operation off the queue.
+	for {
+		op, _ := repo.Get(acme, running.ID)
+		if op.Status == operation.StatusRunning {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := m.Start(acme, "test", block); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Start(acme, "test", block); !errors.Is(err, operation.ErrBusy) {
+		t.Errorf("expected ErrBusy, got %v", err)
+	}
+	if op, _ := repo.Get(acme, "op-3"); op.Status != operation.StatusFailed {
+		t.Errorf("expected the rejected operation to be failed, got %q", op.Status)
+	}
+}
+
+func TestManager_Close(t *testing.T) {
+	repo := newMockRepository()
+	m := operation.NewManager(repo, idgen.UUIDv7{}, operation.ManagerOptions{Workers: 1})
+
+	started := make(chan struct{})
+	block := func(ctx context.Context, progress operation.Progress) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	running, _ := m.Start(acme, "test", block)
+	<-started
+	queued, _ := m.Start(acme, "test", block)
+	m.Close()
+
+	for _, id := range []string{running.ID, queued.ID} {
+		op, _ := repo.Get(acme, id)
+		if op.Status != operation.StatusFailed || !strings.Contains(op.Error, "shutdown") {
+			t.Errorf("expected %s to fail on shutdown, got %+v", id, op)
+		}
+	}
+}
+
+func TestManager_Get(t *testing.T) {
+	repo := newMockRepository()
+	m := newManager(t, repo, operation.ManagerOptions{})
+	op, _ := m.Start(withCaller(acme, "user-1"), "test", func(ctx context.Context, progress operation.Progress) (any, error) {
+		return nil, nil
+	})
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		expectedErr error
+	}{
+		{name: "Owner", ctx: withCaller(acme, "user-1")},
+		{name: "OtherUser", ctx: withCaller(acme, "user-2"), expectedErr: operation.ErrNotFound},
+		{name: "Admin", ctx: withCaller(acme, "user-2", "admin")},
+		{name: "Internal", ctx: acme},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.Get(tt.ctx, op.ID)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("expected error %v, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestManager_Tenants(t *testing.T) {
+	repo := newMockRepository()
+	m := newManager(t, repo, operation.ManagerOptions{})
+
+	release := make(chan struct{})
+	defer close(release)
+	op, err := m.Start(withCaller(acme, "user-1"), "test", func(ctx context.Context, progress operation.Progress) (any, error) {
+		<-release
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op.TenantID != "acme" {
+		t.Errorf("expected the operation to belong to acme, got %q", op.TenantID)
+	}
+
+	// An admin of another tenant cannot tell the operation exists.
+	globex := withCaller(tenant.NewContext(context.Background(), "globex"), "user-2", "admin")
+	if _, err := m.Get(globex, op.ID); !errors.Is(err, operation.ErrNotFound) {
+		t.Errorf("expected ErrNotFound from another tenant, got %v", err)
+	}
+	if _, err := m.Cancel(globex, op.ID); !errors.Is(err, operation.ErrNotFound) {
+		t.Errorf("expected ErrNotFound cancelling from another tenant, got %v", err)
+	}
+	if stored, _ := repo.Get(acme, op.ID); stored.Done() {
+		t.Errorf("expected the operation to keep running, got %+v", stored)
+	}
+	if _, err := m.Start(context.Background(), "test", nil); !errors.Is(err, tenant.ErrMissing) {
+		t.Errorf("expected tenant.ErrMissing without a tenant, got %v", err)
+	}
+}
+
+// --- Handler Tests ---
+
+func TestHandler(t *testing.T) {
+	repo := newMockRepository()
+	m := newManager(t, repo, operation.ManagerOptions{})
+
+	release := make(chan struct{})
+	defer close(release)
+	ctx := withCaller(acme, "user-1")
+	done, _ := m.Start(ctx, "test", func(ctx context.Context, progress operation.Progress) (any, error) {
+		return map[string]int{"created": 1}, nil
+	})
+	wait(t, repo, done.ID)
+	running, _ := m.Start(ctx, "test", func(ctx context.Context, progress operation.Progress) (any, error) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil, ctx.Err()
+	})
+
+	r := chi.NewRouter()
+	r.Use(authz.Middleware(authz.NewAuthorizer(authz.StaticRoles{"admin": {"*"}}, 0)))
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get("X-Test-Tenant")
+			if id == "" {
+				id = "acme"
+			}
+			r = r.WithContext(tenant.NewContext(r.Context(), id))
+			if sub := r.Header.Get("X-Test-Subject"); sub != "" {
+				claims := &auth.Claims{}
+				claims.Subject = sub
+				r = r.WithContext(auth.NewContext(r.Context(), claims))
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	operation.NewHandler(m).RegisterRoutes(r)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		subject        string
+		tenant         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Anonymous", method: "GET", path: "/operations/" + done.ID, expectedStatus: http.StatusUnauthorized},
+		{name: "Get", method: "GET", path: "/operations/" + done.ID, subject: "user-1", expectedStatus: http.StatusOK, expectedBody: `"status":"succeeded","progress":100,"result":{"created":1}`},
+		{name: "GetOtherUser", method: "GET", path: "/operations/" + done.ID, subject: "user-2", expectedStatus: http.StatusNotFound},
+		{name: "GetOtherTenant", method: "GET", path: "/operations/" + done.ID, subject: "user-1", tenant: "globex", expectedStatus: http.StatusNotFound},
+		{name: "GetUnknown", method: "GET", path: "/operations/op-404", subject: "user-1", expectedStatus: http.StatusNotFound},
+		{name: "CancelFinished", method: "POST", path: "/operations/" + done.ID + "/cancel", subject: "user-1", expectedStatus: http.StatusConflict},
+		{name: "CancelOtherTenant", method: "POST", path: "/operations/" + running.ID + "/cancel", subject: "user-1", tenant: "globex", expectedStatus: http.StatusNotFound},
+		{name: "CancelOtherUser", method: "POST", path: "/operations/" + running.ID + "/cancel", subject: "user-2", expectedStatus: http.StatusNotFound},
+		{name: "Cancel", method: "POST", path: "/operations/" + running.ID + "/cancel", subject: "user-1", expectedStatus: http.StatusOK, expectedBody: `"status":"cancelled"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.subject != "" {
+				req.Header.Set("X-Test-Subject", tt.subject)
+			}
+			if tt.tenant != "" {
+				req.Header.Set("X-Test-Tenant", tt.tenant)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedBody != "" && !strings.Contains(w.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAccepted(t *testing.T) {
+	w := httptest.NewRecorder()
+	operation.Accepted(w, &operation.Operation{ID: "op-1", Kind: "test", Status: operation.StatusPending})
+
+	if w.Code != http.StatusAccepted {
+		t.Errorf("expected status 202, got %d", w.Code)
+	}
+	if got := w.Header().Get("Location"); got != "/api/v1/operations/op-1" {
+		t.Errorf("expected Location /api/v1/operations/op-1, got %q", got)
+	}
+	if !strings.Contains(w.Body.String(), `"status":"pending"`) {
+		t.Errorf("expected the operation in the body, got %q", w.Body.String())
+	}
+}
@@ -0,0 +1,50 @@
+// Package role loads the role → permission mapping used by pkg/authz from
+// the database, so operators can change grants without a redeploy.
+package role
+
+import (
+	"context"
+
+	"github.com/user/go-templates/template-mongo/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// --- Mongo Repository ---
+
+// MongoRepository reads role grants from the roles collection, one document
+// per role: {"_id": "admin", "permissions": ["*"]}. It implements authz.Store.
+type MongoRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRepository(db *mongo.Database) *MongoRepository {
+	return &MongoRepository{
+		collection: db.Collection("roles"),
+	}
+}
+
+type roleDoc struct {
+	Name        string   `bson:"_id"`
+	Permissions []string `bson:"permissions"`
+}
+
+func (r *MongoRepository) RolePermissions(ctx context.Context) (map[string][]string, error) {
+	logger.FromContext(ctx).Debug("querying role permissions")
+
+	cursor, err := r.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []roleDoc
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string][]string, len(docs))
+	for _, d := range docs {
+		roles[d.Name] = d.Permissions
+	}
+	return roles, nil
+}
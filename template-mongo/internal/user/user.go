@@ -4,138 +4,1522 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"net/http"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/google/uuid"
+	"github.com/user/go-templates/template-mongo/internal/outbox"
+	"github.com/user/go-templates/template-mongo/pkg/auth"
+	"github.com/user/go-templates/template-mongo/pkg/authz"
+	"github.com/user/go-templates/template-mongo/pkg/cache"
+	"github.com/user/go-templates/template-mongo/pkg/fieldmask"
+	"github.com/user/go-templates/template-mongo/pkg/idgen"
+	"github.com/user/go-templates/template-mongo/pkg/logger"
+	"github.com/user/go-templates/template-mongo/pkg/requestid"
+	"github.com/user/go-templates/template-mongo/pkg/tenant"
+	"github.com/user/go-templates/template-mongo/pkg/transaction"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 )
 
 // --- Domain ---
 
+// Permissions guarding user operations.
+const (
+	PermissionRead  = "users:read"
+	PermissionWrite = "users:write"
+	// PermissionAdmin lets a caller act on any user, not only themselves.
+	PermissionAdmin = "users:admin"
+	// PermissionSearch lets a caller search across all users.
+	PermissionSearch = "users:search"
+)
+
+var ErrNotFound = errors.New("user not found")
+
+// ErrInvalidID reports an ID that is not written in the format of the
+// service's idgen.Generator.
+var ErrInvalidID = errors.New("invalid user id")
+
+// Search limits. Queries shorter than MinSearchLength match too much to be
+// useful.
+const (
+	MinSearchLength    = 3
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// MaxImportUsers caps the users created by one ImportUsers call.
+const MaxImportUsers = 1000
+
+var (
+	ErrSearchQueryTooShort = fmt.Errorf("search query must be at least %d characters", MinSearchLength)
+	ErrSearchUnsupported   = errors.New("user search is not supported by this repository")
+	ErrTrashUnsupported    = errors.New("restoring users is not supported by this repository")
+	ErrAuditUnsupported    = errors.New("user history is not supported by this repository")
+	// ErrEmailTaken reports a restore of a user whose email another user has
+	// taken since it was deleted.
+	ErrEmailTaken = errors.New("email is taken by another user")
+)
+
+// Limits of ListDeletedUsers and UserHistory.
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+// User is the domain entity. Its wire formats live in the versioned handler
+// packages (v1, v2), so fields can be added here without breaking clients.
 type User struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// TenantID is the tenant owning the user. Repositories set it from the
+	// context; it is not part of the wire formats, and left out of the JSON
+	// of a User, which webhooks and event streams send.
+	TenantID string `json:"-"`
+	// DeletedAt is set on users listed from a Trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// LastModified is when the user was last written, for Last-Modified headers.
+// It is zero if neither timestamp was loaded.
+func (u *User) LastModified() time.Time {
+	if u.UpdatedAt.After(u.CreatedAt) {
+		return u.UpdatedAt
+	}
+	return u.CreatedAt
 }
 
+// Fields are the user attributes that can be selected with a fieldmask.Mask.
+var Fields = []string{"id", "name", "email", "created_at", "updated_at"}
+
+// Repository stores users. Implementations scope every call by the tenant
+// in ctx, see package tenant, and return tenant.ErrMissing without one.
 type Repository interface {
-	Get(ctx context.Context, id string) (*User, error)
+	// Get loads only the fields selected by fields, leaving the others zero;
+	// an empty mask loads every field.
+	Get(ctx context.Context, id string, fields fieldmask.Mask) (*User, error)
+	// Create stores user under the ID the service generated for it.
 	Create(ctx context.Context, user *User) error
+	// Update replaces name and email and fills in the stored CreatedAt and
+	// UpdatedAt. It returns ErrNotFound when no user has the ID.
+	Update(ctx context.Context, user *User) error
+	// Delete hides the user from the other methods, for good unless the
+	// repository is a Trash.
+	Delete(ctx context.Context, id string) error
+}
+
+// Searcher is implemented by repositories that can search users by name or
+// email. Results are ordered by relevance, best match first, with newer
+// users first among equal matches.
+type Searcher interface {
+	Search(ctx context.Context, query string, limit, offset int) ([]*User, error)
+}
+
+// Trash is implemented by repositories that delete users softly, keeping
+// them to be restored until they are purged. Emails only need to be unique
+// among users that are not deleted.
+type Trash interface {
+	// ListDeleted returns the deleted users, most recently deleted first,
+	// with DeletedAt set.
+	ListDeleted(ctx context.Context, limit, offset int) ([]*User, error)
+	// Restore undeletes a user and returns it. It returns ErrNotFound
+	// unless the user is deleted, and ErrEmailTaken when its email is in
+	// use again.
+	Restore(ctx context.Context, id string) (*User, error)
+	// Purge removes the users deleted before before for good, across all
+	// tenants, and returns how many it removed.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// AuditEntry records one change to a user: who made it, in which request,
+// and the user before and after it. Before is nil for creations and
+// restores, After for deletions.
+type AuditEntry struct {
+	ID       int64  `json:"id"`
+	UserID   string `json:"user_id"`
+	TenantID string `json:"tenant_id"`
+	// Action is the type of the event the change published, such as
+	// EventUpdated.
+	Action string `json:"action"`
+	// Actor is the subject of the caller's claims, "" without any.
+	Actor     string    `json:"actor"`
+	RequestID string    `json:"request_id"`
+	Before    *User     `json:"before,omitempty"`
+	After     *User     `json:"after,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Auditor is implemented by repositories that keep the history of changes
+// to users. The service adds an entry for each of its writes in the same
+// transaction as the write. Entries outlive purged users.
+type Auditor interface {
+	// GetForUpdate returns the whole user and locks it until the
+	// transaction in ctx ends, so that it is still the user a write in the
+	// same transaction replaces.
+	GetForUpdate(ctx context.Context, id string) (*User, error)
+	// AddAudit stores entry and sets its ID and TenantID.
+	AddAudit(ctx context.Context, entry *AuditEntry) error
+	// History returns the entries of a user, newest first.
+	History(ctx context.Context, userID string, limit, offset int) ([]*AuditEntry, error)
+}
+
+// ImportResult reports a bulk import. Failed holds the reason each user that
+// was not created failed, keyed by its index in the input.
+type ImportResult struct {
+	Created int
+	Failed  map[int]error
 }
 
 type Service interface {
-	GetUser(ctx context.Context, id string) (*User, error)
+	// GetUser returns fieldmask.ErrUnknownField when fields selects an
+	// attribute outside Fields. It and the other methods taking an ID return
+	// ErrInvalidID for IDs the service's idgen.Generator cannot parse.
+	GetUser(ctx context.Context, id string, fields fieldmask.Mask) (*User, error)
+	// CreateUser gives user a new ID, replacing any it had.
 	CreateUser(ctx context.Context, user *User) error
+	UpdateUser(ctx context.Context, user *User) error
+	DeleteUser(ctx context.Context, id string) error
+	// SearchUsers returns ErrSearchQueryTooShort for short queries and
+	// ErrSearchUnsupported when the repository is not a Searcher. limit is
+	// clamped to MaxSearchLimit and defaults to DefaultSearchLimit.
+	SearchUsers(ctx context.Context, query string, limit, offset int) ([]*User, error)
+	// ImportUsers creates users in order and calls progress, if not nil,
+	// with the number handled after each one. A user that cannot be created
+	// is recorded in the result and does not stop the import. It requires
+	// PermissionAdmin, and returns the partial result with ctx's error once
+	// ctx is cancelled.
+	ImportUsers(ctx context.Context, users []*User, progress func(done int)) (*ImportResult, error)
+	// ListDeletedUsers and RestoreUser require PermissionAdmin and return
+	// ErrTrashUnsupported when the repository is not a Trash. limit is
+	// clamped to MaxListLimit and defaults to DefaultListLimit.
+	ListDeletedUsers(ctx context.Context, limit, offset int) ([]*User, error)
+	RestoreUser(ctx context.Context, id string) (*User, error)
+	// UserHistory requires PermissionAdmin and returns ErrAuditUnsupported
+	// when the repository is not an Auditor. Like ListDeletedUsers, it
+	// clamps limit to MaxListLimit.
+	UserHistory(ctx context.Context, id string, limit, offset int) ([]*AuditEntry, error)
+}
+
+// --- Events ---
+
+// Event types published after successful writes.
+const (
+	EventCreated  = "user.created"
+	EventUpdated  = "user.updated"
+	EventDeleted  = "user.deleted"
+	EventRestored = "user.restored"
+)
+
+// Event describes a change to a user. Deletions only carry User.ID and
+// User.TenantID.
+type Event struct {
+	// ID identifies the event; the outbox relays it with the same ID
+	// however often it retries.
+	ID   string    `json:"id,omitempty"`
+	Type string    `json:"type"`
+	User User      `json:"user"`
+	Time time.Time `json:"time"`
+}
+
+// storedUser is the JSON of a User stored by the service itself, in the
+// outbox and the user cache, which keeps its TenantID.
+type storedUser struct {
+	User
+	TenantID string `json:"tenant_id"`
+}
+
+func newStoredUser(u *User) storedUser {
+	return storedUser{User: *u, TenantID: u.TenantID}
+}
+
+func (s storedUser) user() *User {
+	u := s.User
+	u.TenantID = s.TenantID
+	return &u
+}
+
+// storedEvent is the JSON of an Event in the outbox.
+type storedEvent struct {
+	ID   string     `json:"id"`
+	Type string     `json:"type"`
+	User storedUser `json:"user"`
+	Time time.Time  `json:"time"`
+}
+
+// Publisher receives the service's events; *broker.Broker[Event] implements
+// it. Without an outbox Publish is called synchronously after each write,
+// otherwise by the outbox relay; either way it should return quickly.
+type Publisher interface {
+	Publish(e Event)
+}
+
+// Enqueuer is a Publisher that can report failure, such as
+// webhook.Dispatcher. OutboxPublisher calls Enqueue so that a failure leaves
+// the event in the outbox to be retried.
+type Enqueuer interface {
+	Enqueue(ctx context.Context, e Event) error
+}
+
+// Publishers fans events out to several publishers in order.
+type Publishers []Publisher
+
+func (p Publishers) Publish(e Event) {
+	for _, pub := range p {
+		pub.Publish(e)
+	}
+}
+
+// AggregateType identifies user events in the outbox.
+const AggregateType = "user"
+
+// OutboxPublisher passes user events relayed from the outbox on to a
+// Publisher. It implements outbox.Publisher.
+type OutboxPublisher struct {
+	events Publisher
+}
+
+func NewOutboxPublisher(events Publisher) *OutboxPublisher {
+	return &OutboxPublisher{events: events}
+}
+
+// Publish decodes m and publishes it. A message that cannot be decoded is
+// logged and dropped, since retrying it cannot succeed.
+func (p *OutboxPublisher) Publish(ctx context.Context, m *outbox.Message) error {
+	var e storedEvent
+	if err := json.Unmarshal(m.Payload, &e); err != nil {
+		logger.FromContext(ctx).Error("dropping undecodable outbox message", zap.Int64("id", m.ID), zap.Error(err))
+		return nil
+	}
+	return enqueue(ctx, p.events, Event{ID: e.ID, Type: e.Type, User: *e.User.user(), Time: e.Time})
+}
+
+// enqueue publishes e to pub, through Enqueue where pub supports it. Of
+// several Publishers, those before a failing one receive e again on retry.
+func enqueue(ctx context.Context, pub Publisher, e Event) error {
+	switch pub := pub.(type) {
+	case Publishers:
+		for _, p := range pub {
+			if err := enqueue(ctx, p, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Enqueuer:
+		return pub.Enqueue(ctx, e)
+	default:
+		pub.Publish(e)
+		return nil
+	}
 }
 
 // --- Service Implementation ---
 
 type userService struct {
 	repo   Repository
-	logger *zap.Logger
+	ids    idgen.Generator
+	events Publisher
+	tx     transaction.Manager
+	outbox outbox.Writer
+}
+
+// NewService returns the user service. ids generates the IDs of new users
+// and parses the IDs callers send. events may be nil when nothing consumes
+// user events.
+func NewService(repo Repository, ids idgen.Generator, events Publisher) Service {
+	return &userService{
+		repo:   repo,
+		ids:    ids,
+		events: events,
+	}
+}
+
+// NewAuditedService returns the user service making each write and its
+// audit entry, see Auditor, in one transaction of tx and publishing its
+// event to events, which may be nil, once the transaction commits.
+func NewAuditedService(repo Repository, ids idgen.Generator, tx transaction.Manager, events Publisher) Service {
+	return &userService{
+		repo:   repo,
+		ids:    ids,
+		events: events,
+		tx:     tx,
+	}
 }
 
-func NewService(repo Repository, logger *zap.Logger) Service {
+// NewTransactionalService returns the user service adding its events to
+// events within the transaction of each write, so an event is stored if and
+// only if its write commits. An outbox.Relay publishes them afterwards.
+func NewTransactionalService(repo Repository, ids idgen.Generator, tx transaction.Manager, events outbox.Writer) Service {
 	return &userService{
 		repo:   repo,
-		logger: logger,
+		ids:    ids,
+		tx:     tx,
+		outbox: events,
 	}
 }
 
-func (s *userService) GetUser(ctx context.Context, id string) (*User, error) {
-	s.logger.Info("fetching user", zap.String("id", id))
-	return s.repo.Get(ctx, id)
+func (s *userService) GetUser(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+	logger.FromContext(ctx).Info("fetching user", zap.String("id", id))
+	if err := fields.Validate(Fields); err != nil {
+		return nil, err
+	}
+	id, err := s.parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeAccess(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.Get(ctx, id, fields)
 }
 
 func (s *userService) CreateUser(ctx context.Context, user *User) error {
-	s.logger.Info("creating user", zap.String("email", user.Email))
-	return s.repo.Create(ctx, user)
+	logger.FromContext(ctx).Info("creating user", zap.String("email", user.Email))
+	user.ID = s.ids.New()
+	return s.write(ctx, func(ctx context.Context) (change, error) {
+		if err := s.repo.Create(ctx, user); err != nil {
+			return change{}, err
+		}
+		return change{event: s.newEvent(EventCreated, *user)}, nil
+	})
+}
+
+func (s *userService) UpdateUser(ctx context.Context, user *User) error {
+	logger.FromContext(ctx).Info("updating user", zap.String("id", user.ID))
+	id, err := s.parseID(user.ID)
+	if err != nil {
+		return err
+	}
+	user.ID = id
+	if err := authorizeAccess(ctx, user.ID); err != nil {
+		return err
+	}
+	return s.write(ctx, func(ctx context.Context) (change, error) {
+		before, err := s.snapshot(ctx, user.ID)
+		if err != nil {
+			return change{}, err
+		}
+		if err := s.repo.Update(ctx, user); err != nil {
+			return change{}, err
+		}
+		return change{event: s.newEvent(EventUpdated, *user), before: before}, nil
+	})
+}
+
+func (s *userService) DeleteUser(ctx context.Context, id string) error {
+	logger.FromContext(ctx).Info("deleting user", zap.String("id", id))
+	id, err := s.parseID(id)
+	if err != nil {
+		return err
+	}
+	if err := authorizeAccess(ctx, id); err != nil {
+		return err
+	}
+	return s.write(ctx, func(ctx context.Context) (change, error) {
+		before, err := s.snapshot(ctx, id)
+		if err != nil {
+			return change{}, err
+		}
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return change{}, err
+		}
+		tenantID, _ := tenant.FromContext(ctx)
+		return change{event: s.newEvent(EventDeleted, User{ID: id, TenantID: tenantID}), before: before}, nil
+	})
+}
+
+func (s *userService) SearchUsers(ctx context.Context, query string, limit, offset int) ([]*User, error) {
+	logger.FromContext(ctx).Info("searching users", zap.String("query", query))
+	query = strings.TrimSpace(query)
+	if utf8.RuneCountInString(query) < MinSearchLength {
+		return nil, ErrSearchQueryTooShort
+	}
+	searcher, ok := s.repo.(Searcher)
+	if !ok {
+		return nil, ErrSearchUnsupported
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	limit = min(limit, MaxSearchLimit)
+	offset = max(offset, 0)
+	return searcher.Search(ctx, query, limit, offset)
+}
+
+func (s *userService) ImportUsers(ctx context.Context, users []*User, progress func(done int)) (*ImportResult, error) {
+	logger.FromContext(ctx).Info("importing users", zap.Int("count", len(users)))
+	if err := authz.Check(ctx, PermissionAdmin); err != nil {
+		return nil, err
+	}
+
+	res := &ImportResult{Failed: make(map[int]error)}
+	for i, u := range users {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		if err := s.CreateUser(ctx, u); err != nil {
+			res.Failed[i] = err
+		} else {
+			res.Created++
+		}
+		if progress != nil {
+			progress(i + 1)
+		}
+	}
+	return res, nil
+}
+
+func (s *userService) ListDeletedUsers(ctx context.Context, limit, offset int) ([]*User, error) {
+	logger.FromContext(ctx).Info("listing deleted users")
+	if err := authz.Check(ctx, PermissionAdmin); err != nil {
+		return nil, err
+	}
+	trash, ok := s.repo.(Trash)
+	if !ok {
+		return nil, ErrTrashUnsupported
+	}
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	limit = min(limit, MaxListLimit)
+	offset = max(offset, 0)
+	return trash.ListDeleted(ctx, limit, offset)
+}
+
+func (s *userService) RestoreUser(ctx context.Context, id string) (*User, error) {
+	logger.FromContext(ctx).Info("restoring user", zap.String("id", id))
+	if err := authz.Check(ctx, PermissionAdmin); err != nil {
+		return nil, err
+	}
+	id, err := s.parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	trash, ok := s.repo.(Trash)
+	if !ok {
+		return nil, ErrTrashUnsupported
+	}
+	var user *User
+	err = s.write(ctx, func(ctx context.Context) (change, error) {
+		u, err := trash.Restore(ctx, id)
+		if err != nil {
+			return change{}, err
+		}
+		user = u
+		return change{event: s.newEvent(EventRestored, *u)}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *userService) UserHistory(ctx context.Context, id string, limit, offset int) ([]*AuditEntry, error) {
+	logger.FromContext(ctx).Info("fetching user history", zap.String("id", id))
+	if err := authz.Check(ctx, PermissionAdmin); err != nil {
+		return nil, err
+	}
+	id, err := s.parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	auditor, ok := s.repo.(Auditor)
+	if !ok {
+		return nil, ErrAuditUnsupported
+	}
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	limit = min(limit, MaxListLimit)
+	offset = max(offset, 0)
+	return auditor.History(ctx, id, limit, offset)
+}
+
+// change is a write made by the service: the event describing it and, for
+// the audit history, the user it replaced.
+type change struct {
+	event  Event
+	before *User
+}
+
+// write runs fn, which makes a change and describes it. With a transaction
+// manager the audit entry is added in the same transaction as the change,
+// and with an outbox so is the event; otherwise the event is published once
+// the transaction commits, see transaction.AfterCommit.
+func (s *userService) write(ctx context.Context, fn func(ctx context.Context) (change, error)) error {
+	if s.tx == nil {
+		c, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+		if err := s.audit(ctx, c); err != nil {
+			return err
+		}
+		s.publish(c.event)
+		return nil
+	}
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		c, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+		if err := s.audit(ctx, c); err != nil {
+			return err
+		}
+		if s.outbox == nil {
+			transaction.AfterCommit(ctx, func() { s.publish(c.event) })
+			return nil
+		}
+		e := c.event
+		payload, err := json.Marshal(storedEvent{ID: e.ID, Type: e.Type, User: newStoredUser(&e.User), Time: e.Time})
+		if err != nil {
+			return err
+		}
+		return s.outbox.Add(ctx, &outbox.Message{
+			AggregateType: AggregateType,
+			AggregateID:   e.User.ID,
+			EventType:     e.Type,
+			Payload:       payload,
+		})
+	})
+}
+
+// publish sends e to the service's publisher, if it has one.
+func (s *userService) publish(e Event) {
+	if s.events != nil {
+		s.events.Publish(e)
+	}
+}
+
+// snapshot returns the user as it is before a change, for the audit
+// history, or nil when the repository keeps none.
+func (s *userService) snapshot(ctx context.Context, id string) (*User, error) {
+	auditor, ok := s.repo.(Auditor)
+	if !ok {
+		return nil, nil
+	}
+	user, err := auditor.GetForUpdate(ctx, id)
+	if errors.Is(err, ErrAuditUnsupported) {
+		return nil, nil
+	}
+	return user, err
+}
+
+// audit adds the entry describing c to the history, if the repository keeps
+// one. The actor and request are taken from ctx.
+func (s *userService) audit(ctx context.Context, c change) error {
+	auditor, ok := s.repo.(Auditor)
+	if !ok {
+		return nil
+	}
+	entry := &AuditEntry{
+		UserID:    c.event.User.ID,
+		Action:    c.event.Type,
+		RequestID: requestid.FromContext(ctx),
+		Before:    c.before,
+		Time:      c.event.Time,
+	}
+	if claims, ok := auth.FromContext(ctx); ok {
+		entry.Actor = claims.Subject
+	}
+	if c.event.Type != EventDeleted {
+		after := c.event.User
+		entry.After = &after
+	}
+	err := auditor.AddAudit(ctx, entry)
+	if errors.Is(err, ErrAuditUnsupported) {
+		return nil
+	}
+	return err
+}
+
+func (s *userService) newEvent(eventType string, user User) Event {
+	return Event{ID: s.ids.New(), Type: eventType, User: user, Time: time.Now().UTC()}
+}
+
+// requireTenant returns the tenant in ctx, by which repositories scope every
+// query.
+func requireTenant(ctx context.Context) (string, error) {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return "", tenant.ErrMissing
+	}
+	return id, nil
+}
+
+// parseID validates an ID sent by a caller and returns it in the canonical
+// form IDs are stored in, so that every way of writing it finds the user.
+func (s *userService) parseID(id string) (string, error) {
+	b, err := s.ids.Parse(id)
+	if err != nil {
+		return "", ErrInvalidID
+	}
+	return s.ids.Format(b), nil
+}
+
+// authorizeAccess lets callers access their own record; any other record
+// requires PermissionAdmin.
+func authorizeAccess(ctx context.Context, id string) error {
+	if claims, ok := auth.FromContext(ctx); ok && claims.Subject == id {
+		return nil
+	}
+	return authz.Check(ctx, PermissionAdmin)
+}
+
+// --- Purger ---
+
+// DefaultRetention is how long deleted users can be restored before a
+// Purger removes them.
+const DefaultRetention = 30 * 24 * time.Hour
+
+// PurgeOptions configures a Purger. Zero values use the defaults noted.
+type PurgeOptions struct {
+	// Retention is how long deleted users are kept (DefaultRetention).
+	Retention time.Duration
+	// Interval between purges (1h).
+	Interval time.Duration
+}
+
+// Purger purges the users deleted more than Retention ago in the background
+// until it is closed. A purge is a single delete, so every instance can run
+// one.
+type Purger struct {
+	trash  Trash
+	opts   PurgeOptions
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewPurger(trash Trash, opts PurgeOptions) *Purger {
+	if opts.Retention <= 0 {
+		opts.Retention = DefaultRetention
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Hour
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Purger{
+		trash:  trash,
+		opts:   opts,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go p.run(ctx)
+	return p
+}
+
+// Close stops the purger and waits for it to exit.
+func (p *Purger) Close() {
+	p.cancel()
+	<-p.done
+}
+
+func (p *Purger) run(ctx context.Context) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := p.Purge(ctx); err != nil && ctx.Err() == nil {
+			zap.L().Error("cannot purge deleted users", zap.Error(err))
+		}
+	}
+}
+
+// Purge removes the users deleted more than Retention ago and returns how
+// many it removed.
+func (p *Purger) Purge(ctx context.Context) (int64, error) {
+	n, err := p.trash.Purge(ctx, time.Now().Add(-p.opts.Retention))
+	if n > 0 {
+		zap.L().Info("purged deleted users", zap.Int64("count", n))
+	}
+	return n, err
+}
+
+// --- Caching Repository ---
+
+// Default CacheOptions.
+const (
+	DefaultCacheTTL         = time.Minute
+	DefaultCacheNotFoundTTL = 10 * time.Second
+)
+
+// CacheOptions configures a CachingRepository.
+type CacheOptions struct {
+	// TTL is how long a user is served from the cache.
+	TTL time.Duration
+	// NotFoundTTL is how long an ID without a user is remembered as missing,
+	// sparing the database repeated lookups of it.
+	NotFoundTTL time.Duration
+}
+
+// CacheStats counts the Get calls a CachingRepository answered from the
+// cache (Hits) and from the wrapped repository (Misses).
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// CachingRepository is a Repository serving Get from a cache.Cache in front
+// of another Repository. Concurrent misses for one user share a single load
+// of the whole user, from which each caller's fields are selected. Writes
+// remove the user from the cache once they commit; a load racing a write may
+// still store the old user, which is then served until TTL. Reads inside a
+// transaction skip the cache, so they see the transaction's own writes.
+type CachingRepository struct {
+	repo  Repository
+	cache cache.Cache
+	opts  CacheOptions
+	group singleflight.Group
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
 }
 
-// --- Handler ---
+func NewCachingRepository(repo Repository, c cache.Cache, opts CacheOptions) *CachingRepository {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultCacheTTL
+	}
+	if opts.NotFoundTTL <= 0 {
+		opts.NotFoundTTL = DefaultCacheNotFoundTTL
+	}
+	return &CachingRepository{repo: repo, cache: c, opts: opts}
+}
+
+// Stats returns the hit and miss counts so far.
+func (r *CachingRepository) Stats() CacheStats {
+	return CacheStats{Hits: r.hits.Load(), Misses: r.misses.Load()}
+}
+
+func (r *CachingRepository) Get(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+	if transaction.InTx(ctx) {
+		return r.repo.Get(ctx, id, fields)
+	}
+
+	key := cacheKey(ctx, id)
+	data, ok, err := r.cache.Get(ctx, key)
+	if err != nil {
+		logger.FromContext(ctx).Warn("cannot read user cache", zap.Error(err))
+	}
+	if ok {
+		r.hits.Add(1)
+		// A user that does not exist is cached as an empty value.
+		if len(data) == 0 {
+			return nil, ErrNotFound
+		}
+		var user storedUser
+		if err := json.Unmarshal(data, &user); err != nil {
+			return nil, err
+		}
+		return selectFields(user.user(), fields), nil
+	}
 
-type Handler struct {
-	svc Service
+	r.misses.Add(1)
+	// The load is shared by every caller waiting for it, so one caller
+	// cancelling does not fail the others.
+	v, err, _ := r.group.Do(key, func() (any, error) {
+		return r.load(context.WithoutCancel(ctx), key, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return selectFields(v.(*User), fields), nil
 }
 
-func NewHandler(svc Service) *Handler {
-	return &Handler{svc: svc}
+// load reads the whole user from the wrapped repository and caches it, or
+// caches that it does not exist.
+func (r *CachingRepository) load(ctx context.Context, key, id string) (*User, error) {
+	user, err := r.repo.Get(ctx, id, nil)
+	var data []byte
+	ttl := r.opts.TTL
+	switch {
+	case errors.Is(err, ErrNotFound):
+		data, ttl = []byte{}, r.opts.NotFoundTTL
+	case err != nil:
+		return nil, err
+	default:
+		if data, err = json.Marshal(newStoredUser(user)); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.cache.Set(ctx, key, data, ttl); err != nil {
+		logger.FromContext(ctx).Warn("cannot write user cache", zap.Error(err))
+	}
+	if user == nil {
+		return nil, ErrNotFound
+	}
+	return user, nil
+}
+
+// Create removes the new ID from the cache, where it may be remembered as
+// missing.
+func (r *CachingRepository) Create(ctx context.Context, user *User) error {
+	if err := r.repo.Create(ctx, user); err != nil {
+		return err
+	}
+	r.invalidate(ctx, user.ID)
+	return nil
 }
 
-func (h *Handler) RegisterRoutes(r chi.Router) {
-	r.Get("/users/{id}", h.GetUser)
-	r.Post("/users", h.CreateUser)
+func (r *CachingRepository) Update(ctx context.Context, user *User) error {
+	if err := r.repo.Update(ctx, user); err != nil {
+		return err
+	}
+	r.invalidate(ctx, user.ID)
+	return nil
 }
 
-func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	user, err := h.svc.GetUser(r.Context(), id)
+func (r *CachingRepository) Delete(ctx context.Context, id string) error {
+	if err := r.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	r.invalidate(ctx, id)
+	return nil
+}
+
+// Search is not cached; it returns ErrSearchUnsupported unless the wrapped
+// repository is a Searcher.
+func (r *CachingRepository) Search(ctx context.Context, query string, limit, offset int) ([]*User, error) {
+	searcher, ok := r.repo.(Searcher)
+	if !ok {
+		return nil, ErrSearchUnsupported
+	}
+	return searcher.Search(ctx, query, limit, offset)
+}
+
+// ListDeleted is not cached; it returns ErrTrashUnsupported unless the
+// wrapped repository is a Trash.
+func (r *CachingRepository) ListDeleted(ctx context.Context, limit, offset int) ([]*User, error) {
+	trash, ok := r.repo.(Trash)
+	if !ok {
+		return nil, ErrTrashUnsupported
+	}
+	return trash.ListDeleted(ctx, limit, offset)
+}
+
+// Restore removes the user from the cache, where it is remembered as
+// missing.
+func (r *CachingRepository) Restore(ctx context.Context, id string) (*User, error) {
+	trash, ok := r.repo.(Trash)
+	if !ok {
+		return nil, ErrTrashUnsupported
+	}
+	user, err := trash.Restore(ctx, id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
+		return nil, err
+	}
+	r.invalidate(ctx, id)
+	return user, nil
+}
+
+// Purge only removes deleted users, which are not cached.
+func (r *CachingRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	trash, ok := r.repo.(Trash)
+	if !ok {
+		return 0, ErrTrashUnsupported
 	}
-	json.NewEncoder(w).Encode(user)
+	return trash.Purge(ctx, before)
+}
+
+// GetForUpdate, AddAudit and History are not cached; they return
+// ErrAuditUnsupported unless the wrapped repository is an Auditor.
+func (r *CachingRepository) GetForUpdate(ctx context.Context, id string) (*User, error) {
+	auditor, ok := r.repo.(Auditor)
+	if !ok {
+		return nil, ErrAuditUnsupported
+	}
+	return auditor.GetForUpdate(ctx, id)
+}
+
+func (r *CachingRepository) AddAudit(ctx context.Context, entry *AuditEntry) error {
+	auditor, ok := r.repo.(Auditor)
+	if !ok {
+		return ErrAuditUnsupported
+	}
+	return auditor.AddAudit(ctx, entry)
+}
+
+func (r *CachingRepository) History(ctx context.Context, userID string, limit, offset int) ([]*AuditEntry, error) {
+	auditor, ok := r.repo.(Auditor)
+	if !ok {
+		return nil, ErrAuditUnsupported
+	}
+	return auditor.History(ctx, userID, limit, offset)
+}
+
+// invalidate removes the user from the cache once the transaction in ctx, if
+// any, commits.
+func (r *CachingRepository) invalidate(ctx context.Context, id string) {
+	ctx = context.WithoutCancel(ctx)
+	transaction.AfterCommit(ctx, func() {
+		if err := r.cache.Delete(ctx, cacheKey(ctx, id)); err != nil {
+			logger.FromContext(ctx).Warn("cannot invalidate user cache", zap.String("id", id), zap.Error(err))
+		}
+	})
 }
 
-func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	var user User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
-		return
+// cacheKey scopes the key by the tenant in ctx. Users of other tenants are
+// never found under it, nor are their IDs remembered as missing.
+func cacheKey(ctx context.Context, id string) string {
+	tenantID, _ := tenant.FromContext(ctx)
+	return "user:" + tenantID + ":" + id
+}
+
+// selectFields returns a copy of user with only the fields in fields set.
+func selectFields(user *User, fields fieldmask.Mask) *User {
+	u := *user
+	if !fields.Has("id") {
+		u.ID = ""
+	}
+	if !fields.Has("name") {
+		u.Name = ""
+	}
+	if !fields.Has("email") {
+		u.Email = ""
 	}
-	if err := h.svc.CreateUser(r.Context(), &user); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if !fields.Has("created_at") {
+		u.CreatedAt = time.Time{}
 	}
-	w.WriteHeader(http.StatusCreated)
+	if !fields.Has("updated_at") {
+		u.UpdatedAt = time.Time{}
+	}
+	return &u
 }
 
 // --- Mongo Repository ---
 
+// MongoRepository stores users in the users collection and their history
+// in user_audit. Entry IDs come from a counter document, like outbox
+// message IDs.
 type MongoRepository struct {
 	collection *mongo.Collection
+	audit      *mongo.Collection
+	counters   *mongo.Collection
 }
 
 func NewMongoRepository(db *mongo.Database) *MongoRepository {
 	return &MongoRepository{
 		collection: db.Collection("users"),
+		audit:      db.Collection("user_audit"),
+		counters:   db.Collection("counters"),
+	}
+}
+
+// EnsureIndexes creates the text index used by Search, the index keeping
+// emails unique per tenant among users that are not deleted and the index
+// History reads. Mongo maintains them on every write. Users stored before tenancy was introduced are moved
+// to tenant.DefaultTenant first, and users stored before soft deletes get a
+// null deleted_at, which the unique index requires.
+func (r *MongoRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"tenant_id": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"tenant_id": tenant.DefaultTenant}},
+	)
+	if err != nil {
+		return err
+	}
+	_, err = r.collection.UpdateMany(ctx,
+		bson.M{"deleted_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"deleted_at": nil}},
+	)
+	if err != nil {
+		return err
+	}
+	// users_tenant_id_email covered deleted users too; it is replaced by
+	// users_tenant_id_email_live.
+	if _, err := r.collection.Indexes().DropOne(ctx, "users_tenant_id_email"); err != nil && !isNotFound(err) {
+		return err
+	}
+	_, err = r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "name", Value: "text"}, {Key: "email", Value: "text"}},
+			Options: options.Index().
+				SetName("users_search").
+				SetWeights(bson.D{{Key: "name", Value: 2}, {Key: "email", Value: 1}}).
+				// Names are not words of any one language; skip stemming and
+				// stop words.
+				SetDefaultLanguage("none"),
+		},
+		{
+			Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "email", Value: 1}},
+			Options: options.Index().
+				SetName("users_tenant_id_email_live").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"deleted_at": bson.M{"$type": "null"}}),
+		},
+		{
+			Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+			Options: options.Index().SetName("users_deleted_at"),
+		},
+	})
+	if err != nil {
+		return err
 	}
+	_, err = r.audit.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "_id", Value: -1}},
+		Options: options.Index().SetName("user_audit_tenant_id_user_id"),
+	})
+	return err
+}
+
+// isNotFound reports whether err is Mongo failing to find the collection or
+// index a command names.
+func isNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && (cmdErr.Name == "NamespaceNotFound" || cmdErr.Name == "IndexNotFound")
 }
 
 type userDoc struct {
-	ID    string `bson:"_id"`
-	Name  string `bson:"name"`
-	Email string `bson:"email"`
+	ID        string    `bson:"_id"`
+	TenantID  string    `bson:"tenant_id"`
+	Name      string    `bson:"name"`
+	Email     string    `bson:"email"`
+	CreatedAt time.Time `bson:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at"`
+	// DeletedAt is stored as null rather than omitted for live users, which
+	// the partial unique index on emails matches by type.
+	DeletedAt *time.Time `bson:"deleted_at"`
+}
+
+// updatedAt returns UpdatedAt, which users stored before it was introduced
+// lack, falling back to CreatedAt.
+func (d userDoc) updatedAt() time.Time {
+	if d.UpdatedAt.IsZero() {
+		return d.CreatedAt
+	}
+	return d.UpdatedAt
 }
 
-func (r *MongoRepository) Get(ctx context.Context, id string) (*User, error) {
+func (r *MongoRepository) Get(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+	logger.FromContext(ctx).Debug("querying user", zap.String("id", id))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts := options.FindOne()
+	if len(fields) > 0 {
+		opts.SetProjection(userProjection(fields))
+	}
+
 	var doc userDoc
-	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
+	err = r.collection.FindOne(ctx, bson.M{"_id": id, "tenant_id": tenantID, "deleted_at": nil}, opts).Decode(&doc)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, errors.New("user not found")
+			return nil, ErrNotFound
 		}
 		return nil, err
 	}
 
 	return &User{
-		ID:    doc.ID,
-		Name:  doc.Name,
-		Email: doc.Email,
+		ID:        doc.ID,
+		Name:      doc.Name,
+		Email:     doc.Email,
+		CreatedAt: doc.CreatedAt,
+		UpdatedAt: doc.updatedAt(),
+		TenantID:  tenantID,
 	}, nil
 }
 
+// userProjection returns the projection loading only the userDoc fields
+// selected by fields. _id is returned unless excluded explicitly.
+func userProjection(fields fieldmask.Mask) bson.M {
+	keys := map[string]string{
+		"id":         "_id",
+		"name":       "name",
+		"email":      "email",
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+	}
+	projection := bson.M{"_id": 0}
+	for _, f := range fields {
+		if key, ok := keys[f]; ok {
+			projection[key] = 1
+		}
+	}
+	return projection
+}
+
 func (r *MongoRepository) Create(ctx context.Context, user *User) error {
-	user.ID = uuid.New().String()
+	logger.FromContext(ctx).Debug("inserting user", zap.String("email", user.Email))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	user.TenantID = tenantID
+	// Mongo stores times with millisecond precision.
+	user.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	user.UpdatedAt = user.CreatedAt
 	doc := userDoc{
-		ID:    user.ID,
-		Name:  user.Name,
-		Email: user.Email,
+		ID:        user.ID,
+		TenantID:  user.TenantID,
+		Name:      user.Name,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
 	}
 
-	_, err := r.collection.InsertOne(ctx, doc)
+	_, err = r.collection.InsertOne(ctx, doc)
 	return err
 }
+
+func (r *MongoRepository) Update(ctx context.Context, user *User) error {
+	logger.FromContext(ctx).Debug("updating user", zap.String("id", user.ID))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	var doc userDoc
+	err = r.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": user.ID, "tenant_id": tenantID, "deleted_at": nil},
+		bson.M{"$set": bson.M{"name": user.Name, "email": user.Email, "updated_at": time.Now().UTC().Truncate(time.Millisecond)}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	user.CreatedAt = doc.CreatedAt
+	user.UpdatedAt = doc.UpdatedAt
+	user.TenantID = doc.TenantID
+	return nil
+}
+
+func (r *MongoRepository) Delete(ctx context.Context, id string) error {
+	logger.FromContext(ctx).Debug("deleting user", zap.String("id", id))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "tenant_id": tenantID, "deleted_at": nil},
+		bson.M{"$set": bson.M{"deleted_at": time.Now().UTC().Truncate(time.Millisecond)}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Search returns the tenant's users whose name or email matches query,
+// leaving out deleted ones. Whole-word matches come first, found through the
+// text index and ranked by text score; email addresses are split into words
+// at punctuation. When they do not fill the page, a case-insensitive regex
+// adds the users whose name or email merely contains query, newest first.
+func (r *MongoRepository) Search(ctx context.Context, query string, limit, offset int) ([]*User, error) {
+	logger.FromContext(ctx).Debug("searching users", zap.String("query", query))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// $text only matches whole words, so users whose name or email merely
+	// contains the query are matched by a regex and ranked after every text
+	// match, newest first, as the SQL repositories do. Both queries fetch
+	// the users up to the end of the page, which is then cut from them.
+	window := int64(offset + limit)
+	cur, err := r.collection.Find(ctx,
+		bson.M{"$text": bson.M{"$search": textSearch(query)}, "tenant_id": tenantID, "deleted_at": nil},
+		options.Find().
+			SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "created_at", Value: -1}}).
+			SetLimit(window),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var docs []userDoc
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	if n := int64(len(docs)); n < window {
+		// Every text match was fetched, so excluding them leaves the users
+		// matching the substring only.
+		ids := make([]string, 0, len(docs))
+		for _, doc := range docs {
+			ids = append(ids, doc.ID)
+		}
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(query), Options: "i"}
+		cur, err := r.collection.Find(ctx,
+			bson.M{
+				"$or":        bson.A{bson.M{"name": pattern}, bson.M{"email": pattern}},
+				"_id":        bson.M{"$nin": ids},
+				"tenant_id":  tenantID,
+				"deleted_at": nil,
+			},
+			options.Find().
+				SetSort(bson.D{{Key: "created_at", Value: -1}}).
+				SetLimit(window-n),
+		)
+		if err != nil {
+			return nil, err
+		}
+		var more []userDoc
+		if err := cur.All(ctx, &more); err != nil {
+			return nil, err
+		}
+		docs = append(docs, more...)
+	}
+	docs = docs[min(offset, len(docs)):]
+
+	users := make([]*User, 0, len(docs))
+	for _, doc := range docs {
+		users = append(users, &User{
+			ID:        doc.ID,
+			Name:      doc.Name,
+			Email:     doc.Email,
+			CreatedAt: doc.CreatedAt,
+			UpdatedAt: doc.updatedAt(),
+			TenantID:  doc.TenantID,
+		})
+	}
+	return users, nil
+}
+
+func (r *MongoRepository) ListDeleted(ctx context.Context, limit, offset int) ([]*User, error) {
+	logger.FromContext(ctx).Debug("listing deleted users")
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := r.collection.Find(ctx,
+		bson.M{"tenant_id": tenantID, "deleted_at": bson.M{"$ne": nil}},
+		options.Find().
+			SetSort(bson.D{{Key: "deleted_at", Value: -1}, {Key: "_id", Value: 1}}).
+			SetSkip(int64(offset)).
+			SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var docs []userDoc
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	users := make([]*User, 0, len(docs))
+	for _, doc := range docs {
+		users = append(users, doc.user())
+	}
+	return users, nil
+}
+
+func (r *MongoRepository) Restore(ctx context.Context, id string) (*User, error) {
+	logger.FromContext(ctx).Debug("restoring user", zap.String("id", id))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var doc userDoc
+	err = r.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "tenant_id": tenantID, "deleted_at": bson.M{"$ne": nil}},
+		bson.M{"$set": bson.M{"deleted_at": nil, "updated_at": time.Now().UTC().Truncate(time.Millisecond)}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrEmailTaken
+		}
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return doc.user(), nil
+}
+
+func (r *MongoRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	logger.FromContext(ctx).Debug("purging deleted users", zap.Time("before", before))
+
+	res, err := r.collection.DeleteMany(ctx, bson.M{"deleted_at": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// GetForUpdate locks the user by incrementing its lock_version, as Mongo has
+// no read locks: the write holds the document until the transaction in ctx
+// ends, so any other transaction writing the user meanwhile fails with a
+// write conflict, and the user read is the one the write in ctx replaces.
+func (r *MongoRepository) GetForUpdate(ctx context.Context, id string) (*User, error) {
+	logger.FromContext(ctx).Debug("locking user", zap.String("id", id))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var doc userDoc
+	err = r.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "tenant_id": tenantID, "deleted_at": nil},
+		bson.M{"$inc": bson.M{"lock_version": 1}},
+	).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return doc.user(), nil
+}
+
+// auditDoc stores the states before and after a change as user documents.
+type auditDoc struct {
+	ID        int64     `bson:"_id"`
+	TenantID  string    `bson:"tenant_id"`
+	UserID    string    `bson:"user_id"`
+	Action    string    `bson:"action"`
+	Actor     string    `bson:"actor"`
+	RequestID string    `bson:"request_id"`
+	Before    *userDoc  `bson:"before"`
+	After     *userDoc  `bson:"after"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+func (r *MongoRepository) AddAudit(ctx context.Context, entry *AuditEntry) error {
+	logger.FromContext(ctx).Debug("adding user audit entry", zap.String("id", entry.UserID), zap.String("action", entry.Action))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err = r.counters.FindOneAndUpdate(ctx,
+		bson.M{"_id": "user_audit"},
+		bson.M{"$inc": bson.M{"seq": int64(1)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.audit.InsertOne(ctx, auditDoc{
+		ID:        counter.Seq,
+		TenantID:  tenantID,
+		UserID:    entry.UserID,
+		Action:    entry.Action,
+		Actor:     entry.Actor,
+		RequestID: entry.RequestID,
+		Before:    newUserDoc(entry.Before),
+		After:     newUserDoc(entry.After),
+		CreatedAt: entry.Time,
+	})
+	if err != nil {
+		return err
+	}
+	entry.ID = counter.Seq
+	entry.TenantID = tenantID
+	return nil
+}
+
+func (r *MongoRepository) History(ctx context.Context, userID string, limit, offset int) ([]*AuditEntry, error) {
+	logger.FromContext(ctx).Debug("listing user audit entries", zap.String("id", userID))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := r.audit.Find(ctx,
+		bson.M{"tenant_id": tenantID, "user_id": userID},
+		options.Find().
+			SetSort(bson.D{{Key: "_id", Value: -1}}).
+			SetSkip(int64(offset)).
+			SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var docs []auditDoc
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	entries := make([]*AuditEntry, 0, len(docs))
+	for _, d := range docs {
+		entry := &AuditEntry{
+			ID:        d.ID,
+			UserID:    d.UserID,
+			TenantID:  d.TenantID,
+			Action:    d.Action,
+			Actor:     d.Actor,
+			RequestID: d.RequestID,
+			Time:      d.CreatedAt,
+		}
+		if d.Before != nil {
+			entry.Before = d.Before.user()
+		}
+		if d.After != nil {
+			entry.After = d.After.user()
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// newUserDoc converts a user, or returns nil without one.
+func newUserDoc(user *User) *userDoc {
+	if user == nil {
+		return nil
+	}
+	return &userDoc{
+		ID:        user.ID,
+		TenantID:  user.TenantID,
+		Name:      user.Name,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		DeletedAt: user.DeletedAt,
+	}
+}
+
+// user converts the document, including DeletedAt.
+func (d userDoc) user() *User {
+	return &User{
+		ID:        d.ID,
+		Name:      d.Name,
+		Email:     d.Email,
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.updatedAt(),
+		TenantID:  d.TenantID,
+		DeletedAt: d.DeletedAt,
+	}
+}
+
+// textSearch strips the quotes and negations $text would interpret, so every
+// word of the query is an optional search term.
+func textSearch(query string) string {
+	words := strings.Fields(strings.ReplaceAll(query, `"`, " "))
+	for i, w := range words {
+		words[i] = strings.TrimLeft(w, "-")
+	}
+	return strings.Join(words, " ")
+}
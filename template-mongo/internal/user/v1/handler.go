@@ -0,0 +1,226 @@
+// Package v1 serves the original /api/v1 user representation. It is
+// deprecated in favour of /api/v2 and must stay wire-compatible for existing
+// clients: change the v2 representation instead.
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/go-templates/template-mongo/internal/user"
+	"github.com/user/go-templates/template-mongo/pkg/apiversion"
+	"github.com/user/go-templates/template-mongo/pkg/authz"
+	"github.com/user/go-templates/template-mongo/pkg/fieldmask"
+	"github.com/user/go-templates/template-mongo/pkg/httpcache"
+	"github.com/user/go-templates/template-mongo/pkg/jsonbody"
+)
+
+// Deprecation schedule advertised on every v1 user response.
+var (
+	DeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	SunsetAt     = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// --- Representation ---
+
+// User is the v1 wire representation of user.User.
+type User struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func fromDomain(u *user.User) User {
+	return User{
+		ID:    u.ID,
+		Name:  u.Name,
+		Email: u.Email,
+	}
+}
+
+func (u User) toDomain() *user.User {
+	return &user.User{
+		ID:    u.ID,
+		Name:  u.Name,
+		Email: u.Email,
+	}
+}
+
+// AuditEntry is the v1 wire representation of user.AuditEntry. Before is
+// null for creations and restores, After for deletions.
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor"`
+	RequestID string    `json:"request_id"`
+	Before    *User     `json:"before"`
+	After     *User     `json:"after"`
+	Time      time.Time `json:"time"`
+}
+
+func fromDomainEntry(e *user.AuditEntry) AuditEntry {
+	entry := AuditEntry{
+		ID:        e.ID,
+		Action:    e.Action,
+		Actor:     e.Actor,
+		RequestID: e.RequestID,
+		Time:      e.Time,
+	}
+	if e.Before != nil {
+		before := fromDomain(e.Before)
+		entry.Before = &before
+	}
+	if e.After != nil {
+		after := fromDomain(e.After)
+		entry.After = &after
+	}
+	return entry
+}
+
+// Fields are the representation's members selectable with ?fields=. They
+// share their names with user.Fields, so a parsed mask is passed to the
+// service unchanged.
+var Fields = []string{"id", "name", "email"}
+
+// --- Handler ---
+
+type Handler struct {
+	svc user.Service
+}
+
+func NewHandler(svc user.Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(apiversion.Deprecated(DeprecatedAt, SunsetAt, "/api/v2/users"))
+		r.With(authz.Require(user.PermissionSearch)).Get("/users/search", h.SearchUsers)
+		r.With(authz.Require(user.PermissionRead)).Get("/users/{id}", h.GetUser)
+		r.With(authz.Require(user.PermissionAdmin)).Get("/users/{id}/history", h.UserHistory)
+		r.With(authz.Require(user.PermissionWrite)).Post("/users", h.CreateUser)
+	})
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	fields, err := fieldmask.Parse(r.URL.Query().Get("fields"), Fields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The timestamps are loaded for Last-Modified even when not selected.
+	id := chi.URLParam(r, "id")
+	u, err := h.svc.GetUser(r.Context(), id, fields.With("created_at", "updated_at"))
+	if err != nil {
+		switch {
+		case errors.Is(err, authz.ErrPermissionDenied):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, user.ErrInvalidID):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, user.ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if httpcache.LastModified(w, r, u.LastModified()) {
+		return
+	}
+	json.NewEncoder(w).Encode(fieldmask.Select(fromDomain(u), fields))
+}
+
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req User
+	if err := jsonbody.Decode(r, &req); err != nil {
+		http.Error(w, err.Error(), jsonbody.Status(err))
+		return
+	}
+	if err := h.svc.CreateUser(r.Context(), req.toDomain()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// SearchUsers serves GET /users/search?q=&limit=&offset=, best match first.
+func (h *Handler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", user.DefaultSearchLimit)
+	if err != nil || limit < 1 || limit > user.MaxSearchLimit {
+		http.Error(w, fmt.Sprintf("limit must be between 1 and %d", user.MaxSearchLimit), http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "offset must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	users, err := h.svc.SearchUsers(r.Context(), r.URL.Query().Get("q"), limit, offset)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrSearchQueryTooShort):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, user.ErrSearchUnsupported):
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	resp := make([]User, 0, len(users))
+	for _, u := range users {
+		resp = append(resp, fromDomain(u))
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// UserHistory serves GET /users/{id}/history?limit=&offset=, newest first.
+func (h *Handler) UserHistory(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", user.DefaultListLimit)
+	if err != nil || limit < 1 || limit > user.MaxListLimit {
+		http.Error(w, fmt.Sprintf("limit must be between 1 and %d", user.MaxListLimit), http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "offset must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.svc.UserHistory(r.Context(), chi.URLParam(r, "id"), limit, offset)
+	if err != nil {
+		switch {
+		case errors.Is(err, authz.ErrPermissionDenied):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, user.ErrInvalidID):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, user.ErrAuditUnsupported):
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	resp := make([]AuditEntry, 0, len(entries))
+	for _, e := range entries {
+		resp = append(resp, fromDomainEntry(e))
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
@@ -0,0 +1,352 @@
+// Package v2 serves the /api/v2 user representation, which splits the name
+// into given and family parts and exposes the creation and modification
+// times. It shares user.Service with v1; only the wire format differs.
+package v2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/go-templates/template-mongo/internal/operation"
+	"github.com/user/go-templates/template-mongo/internal/user"
+	"github.com/user/go-templates/template-mongo/pkg/authz"
+	"github.com/user/go-templates/template-mongo/pkg/fieldmask"
+	"github.com/user/go-templates/template-mongo/pkg/httpcache"
+	"github.com/user/go-templates/template-mongo/pkg/jsonbody"
+)
+
+// --- Representation ---
+
+type Name struct {
+	Given  string `json:"given"`
+	Family string `json:"family"`
+}
+
+// splitName splits a stored full name at the first space.
+func splitName(full string) Name {
+	given, family, _ := strings.Cut(strings.TrimSpace(full), " ")
+	return Name{Given: given, Family: strings.TrimSpace(family)}
+}
+
+func (n Name) String() string {
+	return strings.TrimSpace(strings.TrimSpace(n.Given) + " " + strings.TrimSpace(n.Family))
+}
+
+// User is the v2 wire representation of user.User.
+type User struct {
+	ID        string    `json:"id"`
+	Name      Name      `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is only set on deleted users.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func fromDomain(u *user.User) User {
+	return User{
+		ID:        u.ID,
+		Name:      splitName(u.Name),
+		Email:     u.Email,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+		DeletedAt: u.DeletedAt,
+	}
+}
+
+type CreateUserRequest struct {
+	Name  Name   `json:"name"`
+	Email string `json:"email"`
+}
+
+func (req CreateUserRequest) toDomain() *user.User {
+	return &user.User{
+		Name:  req.Name.String(),
+		Email: req.Email,
+	}
+}
+
+// UpdateUserRequest replaces a user's name and email.
+type UpdateUserRequest struct {
+	Name  Name   `json:"name"`
+	Email string `json:"email"`
+}
+
+func (req UpdateUserRequest) toDomain(id string) *user.User {
+	return &user.User{
+		ID:    id,
+		Name:  req.Name.String(),
+		Email: req.Email,
+	}
+}
+
+// ImportUsersRequest creates users in bulk.
+type ImportUsersRequest struct {
+	Users []CreateUserRequest `json:"users"`
+}
+
+// ImportResult is the result of an OperationImport operation. Failed lists
+// the users that were not created by their index in the request.
+type ImportResult struct {
+	Created int           `json:"created"`
+	Failed  []ImportError `json:"failed"`
+}
+
+type ImportError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+func fromImportResult(res *user.ImportResult) ImportResult {
+	out := ImportResult{Created: res.Created, Failed: make([]ImportError, 0, len(res.Failed))}
+	for i, err := range res.Failed {
+		out.Failed = append(out.Failed, ImportError{Index: i, Error: err.Error()})
+	}
+	slices.SortFunc(out.Failed, func(a, b ImportError) int { return a.Index - b.Index })
+	return out
+}
+
+// Fields are the representation's members selectable with ?fields=. They
+// share their names with user.Fields, so a parsed mask is passed to the
+// service unchanged.
+var Fields = []string{"id", "name", "email", "created_at", "updated_at"}
+
+// --- Handler ---
+
+// OperationImport is the kind of the operations started by ImportUsers.
+const OperationImport = "users.import"
+
+type Handler struct {
+	svc user.Service
+	ops operation.Service
+}
+
+// NewHandler returns the v2 handler. ops runs bulk imports; when it is nil,
+// POST /users/import is not served.
+func NewHandler(svc user.Service, ops operation.Service) *Handler {
+	return &Handler{svc: svc, ops: ops}
+}
+
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.With(authz.Require(user.PermissionSearch)).Get("/users/search", h.SearchUsers)
+	r.With(authz.Require(user.PermissionAdmin)).Get("/users/deleted", h.ListDeletedUsers)
+	r.With(authz.Require(user.PermissionRead)).Get("/users/{id}", h.GetUser)
+	r.With(authz.Require(user.PermissionWrite)).Post("/users", h.CreateUser)
+	if h.ops != nil {
+		r.With(authz.Require(user.PermissionWrite, user.PermissionAdmin)).Post("/users/import", h.ImportUsers)
+	}
+	r.With(authz.Require(user.PermissionWrite)).Put("/users/{id}", h.UpdateUser)
+	r.With(authz.Require(user.PermissionWrite)).Delete("/users/{id}", h.DeleteUser)
+	r.With(authz.Require(user.PermissionWrite, user.PermissionAdmin)).Post("/users/{id}/restore", h.RestoreUser)
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	fields, err := fieldmask.Parse(r.URL.Query().Get("fields"), Fields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The timestamps are loaded for Last-Modified even when not selected.
+	id := chi.URLParam(r, "id")
+	u, err := h.svc.GetUser(r.Context(), id, fields.With("created_at", "updated_at"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if httpcache.LastModified(w, r, u.LastModified()) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fieldmask.Select(fromDomain(u), fields))
+}
+
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req CreateUserRequest
+	if err := jsonbody.Decode(r, &req); err != nil {
+		http.Error(w, err.Error(), jsonbody.Status(err))
+		return
+	}
+	if strings.TrimSpace(req.Name.Given) == "" {
+		http.Error(w, "name.given is required", http.StatusBadRequest)
+		return
+	}
+
+	u := req.toDomain()
+	if err := h.svc.CreateUser(r.Context(), u); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+u.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(fromDomain(u))
+}
+
+func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	var req UpdateUserRequest
+	if err := jsonbody.Decode(r, &req); err != nil {
+		http.Error(w, err.Error(), jsonbody.Status(err))
+		return
+	}
+	if strings.TrimSpace(req.Name.Given) == "" {
+		http.Error(w, "name.given is required", http.StatusBadRequest)
+		return
+	}
+
+	u := req.toDomain(chi.URLParam(r, "id"))
+	if err := h.svc.UpdateUser(r.Context(), u); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fromDomain(u))
+}
+
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.DeleteUser(r.Context(), chi.URLParam(r, "id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ImportUsers validates the users and creates them in a background
+// operation, answering 202 Accepted with its Location. The operation's result
+// is an ImportResult.
+func (h *Handler) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	var req ImportUsersRequest
+	if err := jsonbody.Decode(r, &req); err != nil {
+		http.Error(w, err.Error(), jsonbody.Status(err))
+		return
+	}
+	if len(req.Users) == 0 || len(req.Users) > user.MaxImportUsers {
+		http.Error(w, fmt.Sprintf("users must list between 1 and %d users", user.MaxImportUsers), http.StatusBadRequest)
+		return
+	}
+	users := make([]*user.User, len(req.Users))
+	for i, u := range req.Users {
+		if strings.TrimSpace(u.Name.Given) == "" {
+			http.Error(w, fmt.Sprintf("users[%d]: name.given is required", i), http.StatusBadRequest)
+			return
+		}
+		users[i] = u.toDomain()
+	}
+
+	op, err := h.ops.Start(r.Context(), OperationImport, func(ctx context.Context, progress operation.Progress) (any, error) {
+		res, err := h.svc.ImportUsers(ctx, users, func(done int) {
+			progress(done * 100 / len(users))
+		})
+		if err != nil {
+			return nil, err
+		}
+		return fromImportResult(res), nil
+	})
+	if err != nil {
+		operation.WriteError(w, err)
+		return
+	}
+	operation.Accepted(w, op)
+}
+
+// SearchUsers serves GET /users/search?q=&limit=&offset=, best match first.
+func (h *Handler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", user.DefaultSearchLimit)
+	if err != nil || limit < 1 || limit > user.MaxSearchLimit {
+		http.Error(w, fmt.Sprintf("limit must be between 1 and %d", user.MaxSearchLimit), http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "offset must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	users, err := h.svc.SearchUsers(r.Context(), r.URL.Query().Get("q"), limit, offset)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resp := make([]User, 0, len(users))
+	for _, u := range users {
+		resp = append(resp, fromDomain(u))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ListDeletedUsers serves GET /users/deleted?limit=&offset=, most recently
+// deleted first.
+func (h *Handler) ListDeletedUsers(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", user.DefaultListLimit)
+	if err != nil || limit < 1 || limit > user.MaxListLimit {
+		http.Error(w, fmt.Sprintf("limit must be between 1 and %d", user.MaxListLimit), http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "offset must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	users, err := h.svc.ListDeletedUsers(r.Context(), limit, offset)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resp := make([]User, 0, len(users))
+	for _, u := range users {
+		resp = append(resp, fromDomain(u))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RestoreUser undeletes a user and returns it. It answers 409 Conflict when
+// another user has taken its email since.
+func (h *Handler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	u, err := h.svc.RestoreUser(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fromDomain(u))
+}
+
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, authz.ErrPermissionDenied):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, user.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, user.ErrInvalidID), errors.Is(err, user.ErrSearchQueryTooShort):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, user.ErrSearchUnsupported), errors.Is(err, user.ErrTrashUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+	case errors.Is(err, user.ErrEmailTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,917 @@
+package v2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/go-templates/template-mongo/internal/operation"
+	"github.com/user/go-templates/template-mongo/internal/user"
+	v1 "github.com/user/go-templates/template-mongo/internal/user/v1"
+	"github.com/user/go-templates/template-mongo/pkg/auth"
+	"github.com/user/go-templates/template-mongo/pkg/authz"
+	"github.com/user/go-templates/template-mongo/pkg/bodylimit"
+	"github.com/user/go-templates/template-mongo/pkg/fieldmask"
+	"github.com/user/go-templates/template-mongo/pkg/idgen"
+)
+
+// --- Mocks ---
+
+type mockService struct {
+	GetUserFunc     func(ctx context.Context, id string, fields fieldmask.Mask) (*user.User, error)
+	CreateUserFunc  func(ctx context.Context, u *user.User) error
+	UpdateUserFunc  func(ctx context.Context, u *user.User) error
+	DeleteUserFunc  func(ctx context.Context, id string) error
+	SearchUsersFunc func(ctx context.Context, query string, limit, offset int) ([]*user.User, error)
+	ImportUsersFunc func(ctx context.Context, users []*user.User, progress func(done int)) (*user.ImportResult, error)
+	ListDeletedFunc func(ctx context.Context, limit, offset int) ([]*user.User, error)
+	RestoreUserFunc func(ctx context.Context, id string) (*user.User, error)
+}
+
+func (m *mockService) GetUser(ctx context.Context, id string, fields fieldmask.Mask) (*user.User, error) {
+	if m.GetUserFunc != nil {
+		return m.GetUserFunc(ctx, id, fields)
+	}
+	return nil, errors.New("unimplemented")
+}
+
+func (m *mockService) CreateUser(ctx context.Context, u *user.User) error {
+	if m.CreateUserFunc != nil {
+		return m.CreateUserFunc(ctx, u)
+	}
+	return errors.New("unimplemented")
+}
+
+func (m *mockService) UpdateUser(ctx context.Context, u *user.User) error {
+	if m.UpdateUserFunc != nil {
+		return m.UpdateUserFunc(ctx, u)
+	}
+	return errors.New("unimplemented")
+}
+
+func (m *mockService) DeleteUser(ctx context.Context, id string) error {
+	if m.DeleteUserFunc != nil {
+		return m.DeleteUserFunc(ctx, id)
+	}
+	return errors.New("unimplemented")
+}
+
+func (m *mockService) SearchUsers(ctx context.Context, query string, limit, offset int) ([]*user.User, error) {
+	if m.SearchUsersFunc != nil {
+		return m.SearchUsersFunc(ctx, query, limit, offset)
+	}
+	return nil, errors.New("unimplemented")
+}
+
+func (m *mockService) ImportUsers(ctx context.Context, users []*user.User, progress func(done int)) (*user.ImportResult, error) {
+	if m.ImportUsersFunc != nil {
+		return m.ImportUsersFunc(ctx, users, progress)
+	}
+	return nil, errors.New("unimplemented")
+}
+
+func (m *mockService) ListDeletedUsers(ctx context.Context, limit, offset int) ([]*user.User, error) {
+	if m.ListDeletedFunc != nil {
+		return m.ListDeletedFunc(ctx, limit, offset)
+	}
+	return nil, errors.New("unimplemented")
+}
+
+func (m *mockService) RestoreUser(ctx context.Context, id string) (*user.User, error) {
+	if m.RestoreUserFunc != nil {
+		return m.RestoreUserFunc(ctx, id)
+	}
+	return nil, errors.New("unimplemented")
+}
+
+// v2 does not expose the history.
+
+func (m *mockService) UserHistory(ctx context.Context, id string, limit, offset int) ([]*user.AuditEntry, error) {
+	return nil, errors.New("unimplemented")
+}
+
+// syncOperations is an operation.Service that runs operations inline and
+// keeps the outcome of the last one.
+type syncOperations struct {
+	result   any
+	err      error
+	progress []int
+}
+
+func (s *syncOperations) Start(ctx context.Context, kind string, fn operation.Func) (*operation.Operation, error) {
+	s.result, s.err = fn(ctx, func(percent int) { s.progress = append(s.progress, percent) })
+	return &operation.Operation{ID: "op-1", Kind: kind, Status: operation.StatusPending}, nil
+}
+
+func (s *syncOperations) Get(ctx context.Context, id string) (*operation.Operation, error) {
+	return nil, operation.ErrNotFound
+}
+
+func (s *syncOperations) Cancel(ctx context.Context, id string) (*operation.Operation, error) {
+	return nil, operation.ErrNotFound
+}
+
+// fakeRepository is a minimal user.Repository for exercising the real service.
+type fakeRepository struct {
+	users map[string]*user.User
+}
+
+func (f *fakeRepository) Get(ctx context.Context, id string, fields fieldmask.Mask) (*user.User, error) {
+	u, ok := f.users[id]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	return u, nil
+}
+
+func (f *fakeRepository) Create(ctx context.Context, u *user.User) error {
+	u.CreatedAt = time.Date(2026, time.January, 2, 3, 4, 5, 0, time.UTC)
+	u.UpdatedAt = u.CreatedAt
+	f.users[u.ID] = u
+	return nil
+}
+
+func (f *fakeRepository) Update(ctx context.Context, u *user.User) error {
+	existing, ok := f.users[u.ID]
+	if !ok {
+		return user.ErrNotFound
+	}
+	u.CreatedAt = existing.CreatedAt
+	u.UpdatedAt = existing.UpdatedAt.Add(time.Hour)
+	f.users[u.ID] = u
+	return nil
+}
+
+func (f *fakeRepository) Delete(ctx context.Context, id string) error {
+	if _, ok := f.users[id]; !ok {
+		return user.ErrNotFound
+	}
+	delete(f.users, id)
+	return nil
+}
+
+// --- Handler Tests ---
+
+func TestSplitName(t *testing.T) {
+	tests := []struct {
+		full     string
+		expected Name
+	}{
+		{full: "Ada Lovelace", expected: Name{Given: "Ada", Family: "Lovelace"}},
+		{full: "Ada", expected: Name{Given: "Ada"}},
+		{full: "Ada King Lovelace", expected: Name{Given: "Ada", Family: "King Lovelace"}},
+		{full: "  ", expected: Name{}},
+	}
+
+	for _, tt := range tests {
+		if got := splitName(tt.full); got != tt.expected {
+			t.Errorf("splitName(%q): expected %+v, got %+v", tt.full, tt.expected, got)
+		}
+		if got := tt.expected.String(); got != strings.Join(strings.Fields(tt.full), " ") {
+			t.Errorf("%+v.String(): got %q", tt.expected, got)
+		}
+	}
+}
+
+func TestHandler_GetUser(t *testing.T) {
+	createdAt := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	updatedAt := time.Date(2026, time.March, 2, 8, 30, 0, 0, time.UTC)
+	found := func(m *mockService) {
+		m.GetUserFunc = func(ctx context.Context, id string, fields fieldmask.Mask) (*user.User, error) {
+			return &user.User{ID: id, Name: "Ada Lovelace", Email: "ada@example.com", CreatedAt: createdAt, UpdatedAt: updatedAt}, nil
+		}
+	}
+
+	tests := []struct {
+		name                 string
+		query                string
+		ifModifiedSince      string
+		mockBehavior         func(m *mockService)
+		expectedStatus       int
+		expectedBody         string
+		expectedLastModified string
+	}{
+		{
+			name:                 "Success",
+			mockBehavior:         found,
+			expectedStatus:       http.StatusOK,
+			expectedBody:         `{"id":"123","name":{"given":"Ada","family":"Lovelace"},"email":"ada@example.com","created_at":"2026-03-01T12:00:00Z","updated_at":"2026-03-02T08:30:00Z"}`,
+			expectedLastModified: "Mon, 02 Mar 2026 08:30:00 GMT",
+		},
+		{
+			name:  "Fields",
+			query: "?fields=name,id",
+			mockBehavior: func(m *mockService) {
+				m.GetUserFunc = func(ctx context.Context, id string, fields fieldmask.Mask) (*user.User, error) {
+					if !slices.Equal(fields, fieldmask.Mask{"id", "name", "created_at", "updated_at"}) {
+						return nil, fmt.Errorf("unexpected fields %v", fields)
+					}
+					return &user.User{ID: id, Name: "Ada Lovelace", CreatedAt: createdAt, UpdatedAt: updatedAt}, nil
+				}
+			},
+			expectedStatus:       http.StatusOK,
+			expectedBody:         `{"id":"123","name":{"given":"Ada","family":"Lovelace"}}`,
+			expectedLastModified: "Mon, 02 Mar 2026 08:30:00 GMT",
+		},
+		{
+			name:                 "NotModified",
+			ifModifiedSince:      "Mon, 02 Mar 2026 08:30:00 GMT",
+			mockBehavior:         found,
+			expectedStatus:       http.StatusNotModified,
+			expectedLastModified: "Mon, 02 Mar 2026 08:30:00 GMT",
+		},
+		{
+			name:                 "Modified",
+			ifModifiedSince:      "Sun, 01 Mar 2026 12:00:00 GMT",
+			mockBehavior:         found,
+			expectedStatus:       http.StatusOK,
+			expectedBody:         `{"id":"123","name":{"given":"Ada","family":"Lovelace"},"email":"ada@example.com","created_at":"2026-03-01T12:00:00Z","updated_at":"2026-03-02T08:30:00Z"}`,
+			expectedLastModified: "Mon, 02 Mar 2026 08:30:00 GMT",
+		},
+		{
+			name:           "UnknownField",
+			query:          "?fields=id,password",
+			mockBehavior:   func(m *mockService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `unknown field "password"`,
+		},
+		{
+			name: "NotFound",
+			mockBehavior: func(m *mockService) {
+				m.GetUserFunc = func(ctx context.Context, id string, fields fieldmask.Mask) (*user.User, error) {
+					return nil, user.ErrNotFound
+				}
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "user not found",
+		},
+		{
+			name: "InternalError",
+			mockBehavior: func(m *mockService) {
+				m.GetUserFunc = func(ctx context.Context, id string, fields fieldmask.Mask) (*user.User, error) {
+					return nil, errors.New("connection refused")
+				}
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "connection refused",
+		},
+		{
+			name: "Forbidden",
+			mockBehavior: func(m *mockService) {
+				m.GetUserFunc = func(ctx context.Context, id string, fields fieldmask.Mask) (*user.User, error) {
+					return nil, authz.ErrPermissionDenied
+				}
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "permission denied",
+		},
+		{
+			name: "InvalidID",
+			mockBehavior: func(m *mockService) {
+				m.GetUserFunc = func(ctx context.Context, id string, fields fieldmask.Mask) (*user.User, error) {
+					return nil, user.ErrInvalidID
+				}
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid user id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockService{}
+			tt.mockBehavior(mockSvc)
+
+			r := chi.NewRouter()
+			r.Get("/users/{id}", NewHandler(mockSvc, nil).GetUser)
+
+			req := httptest.NewRequest("GET", "/users/123"+tt.query, nil)
+			if tt.ifModifiedSince != "" {
+				req.Header.Set("If-Modified-Since", tt.ifModifiedSince)
+			}
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, body)
+			}
+			if got := w.Header().Get("Last-Modified"); got != tt.expectedLastModified {
+				t.Errorf("expected Last-Modified %q, got %q", tt.expectedLastModified, got)
+			}
+		})
+	}
+}
+
+func TestHandler_CreateUser(t *testing.T) {
+	tests := []struct {
+		name             string
+		inputBody        string
+		mockBehavior     func(m *mockService)
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{
+			name:      "Success",
+			inputBody: `{"name":{"given":"Ada","family":"Lovelace"},"email":"ada@example.com"}`,
+			mockBehavior: func(m *mockService) {
+				m.CreateUserFunc = func(ctx context.Context, u *user.User) error {
+					if u.Name != "Ada Lovelace" {
+						return errors.New("unexpected name " + u.Name)
+					}
+					u.ID = "456"
+					return nil
+				}
+			},
+			expectedStatus:   http.StatusCreated,
+			expectedLocation: "/users/456",
+		},
+		{
+			name:           "MissingGivenName",
+			inputBody:      `{"name":{"family":"Lovelace"},"email":"ada@example.com"}`,
+			mockBehavior:   func(m *mockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "V1Shape",
+			inputBody:      `{"name":"Ada Lovelace","email":"ada@example.com"}`,
+			mockBehavior:   func(m *mockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "UnknownField",
+			inputBody:      `{"name":{"given":"Ada","middle":"King"},"email":"ada@example.com"}`,
+			mockBehavior:   func(m *mockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "TooLarge",
+			inputBody:      `{"name":{"given":"` + strings.Repeat("A", 2048) + `"}}`,
+			mockBehavior:   func(m *mockService) {},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:      "InternalError",
+			inputBody: `{"name":{"given":"Ada"}}`,
+			mockBehavior: func(m *mockService) {
+				m.CreateUserFunc = func(ctx context.Context, u *user.User) error {
+					return errors.New("internal error")
+				}
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockService{}
+			tt.mockBehavior(mockSvc)
+
+			r := chi.NewRouter()
+			r.Use(bodylimit.Middleware(bodylimit.Options{Default: 1024}))
+			r.Post("/users", NewHandler(mockSvc, nil).CreateUser)
+
+			req := httptest.NewRequest("POST", "/users", bytes.NewBufferString(tt.inputBody))
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Location"); got != tt.expectedLocation {
+				t.Errorf("expected Location %q, got %q", tt.expectedLocation, got)
+			}
+		})
+	}
+}
+
+func TestHandler_UpdateUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		inputBody      string
+		mockBehavior   func(m *mockService)
+		expectedStatus int
+	}{
+		{
+			name:      "Success",
+			inputBody: `{"name":{"given":"Ada","family":"King"},"email":"ada@example.com"}`,
+			mockBehavior: func(m *mockService) {
+				m.UpdateUserFunc = func(ctx context.Context, u *user.User) error {
+					if u.ID != "123" || u.Name != "Ada King" {
+						return errors.New("unexpected user")
+					}
+					return nil
+				}
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "MissingGivenName",
+			inputBody:      `{"name":{"family":"King"}}`,
+			mockBehavior:   func(m *mockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:      "NotFound",
+			inputBody: `{"name":{"given":"Ada"}}`,
+			mockBehavior: func(m *mockService) {
+				m.UpdateUserFunc = func(ctx context.Context, u *user.User) error {
+					return user.ErrNotFound
+				}
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:      "Forbidden",
+			inputBody: `{"name":{"given":"Ada"}}`,
+			mockBehavior: func(m *mockService) {
+				m.UpdateUserFunc = func(ctx context.Context, u *user.User) error {
+					return authz.ErrPermissionDenied
+				}
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockService{}
+			tt.mockBehavior(mockSvc)
+
+			r := chi.NewRouter()
+			r.Put("/users/{id}", NewHandler(mockSvc, nil).UpdateUser)
+
+			req := httptest.NewRequest("PUT", "/users/123", bytes.NewBufferString(tt.inputBody))
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_DeleteUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		mockBehavior   func(m *mockService)
+		expectedStatus int
+	}{
+		{
+			name: "Success",
+			mockBehavior: func(m *mockService) {
+				m.DeleteUserFunc = func(ctx context.Context, id string) error {
+					return nil
+				}
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name: "NotFound",
+			mockBehavior: func(m *mockService) {
+				m.DeleteUserFunc = func(ctx context.Context, id string) error {
+					return user.ErrNotFound
+				}
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "InvalidID",
+			mockBehavior: func(m *mockService) {
+				m.DeleteUserFunc = func(ctx context.Context, id string) error {
+					return user.ErrInvalidID
+				}
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "InternalError",
+			mockBehavior: func(m *mockService) {
+				m.DeleteUserFunc = func(ctx context.Context, id string) error {
+					return errors.New("internal error")
+				}
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockService{}
+			tt.mockBehavior(mockSvc)
+
+			r := chi.NewRouter()
+			r.Delete("/users/{id}", NewHandler(mockSvc, nil).DeleteUser)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("DELETE", "/users/123", nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_SearchUsers(t *testing.T) {
+	createdAt := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		query          string
+		mockBehavior   func(m *mockService)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:  "Success",
+			query: "?q=ada&limit=5&offset=10",
+			mockBehavior: func(m *mockService) {
+				m.SearchUsersFunc = func(ctx context.Context, query string, limit, offset int) ([]*user.User, error) {
+					if query != "ada" || limit != 5 || offset != 10 {
+						return nil, fmt.Errorf("unexpected search %q %d %d", query, limit, offset)
+					}
+					return []*user.User{{ID: "123", Name: "Ada Lovelace", Email: "ada@example.com", CreatedAt: createdAt, UpdatedAt: createdAt}}, nil
+				}
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"id":"123","name":{"given":"Ada","family":"Lovelace"},"email":"ada@example.com","created_at":"2026-03-01T12:00:00Z","updated_at":"2026-03-01T12:00:00Z"}]`,
+		},
+		{
+			name:  "NoResults",
+			query: "?q=nobody",
+			mockBehavior: func(m *mockService) {
+				m.SearchUsersFunc = func(ctx context.Context, query string, limit, offset int) ([]*user.User, error) {
+					if limit != user.DefaultSearchLimit || offset != 0 {
+						return nil, fmt.Errorf("unexpected page %d %d", limit, offset)
+					}
+					return nil, nil
+				}
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[]`,
+		},
+		{
+			name:           "InvalidLimit",
+			query:          "?q=ada&limit=1000",
+			mockBehavior:   func(m *mockService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "limit must be between 1 and 100",
+		},
+		{
+			name:           "InvalidOffset",
+			query:          "?q=ada&offset=-1",
+			mockBehavior:   func(m *mockService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "offset must not be negative",
+		},
+		{
+			name:  "QueryTooShort",
+			query: "?q=a",
+			mockBehavior: func(m *mockService) {
+				m.SearchUsersFunc = func(ctx context.Context, query string, limit, offset int) ([]*user.User, error) {
+					return nil, user.ErrSearchQueryTooShort
+				}
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "search query must be at least 3 characters",
+		},
+		{
+			name:  "Unsupported",
+			query: "?q=ada",
+			mockBehavior: func(m *mockService) {
+				m.SearchUsersFunc = func(ctx context.Context, query string, limit, offset int) ([]*user.User, error) {
+					return nil, user.ErrSearchUnsupported
+				}
+			},
+			expectedStatus: http.StatusNotImplemented,
+			expectedBody:   "user search is not supported by this repository",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockService{}
+			tt.mockBehavior(mockSvc)
+
+			r := chi.NewRouter()
+			r.Get("/users/search", NewHandler(mockSvc, nil).SearchUsers)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/users/search"+tt.query, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, body)
+			}
+		})
+	}
+}
+
+func TestHandler_ListDeletedUsers(t *testing.T) {
+	createdAt := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	deletedAt := createdAt.Add(24 * time.Hour)
+
+	tests := []struct {
+		name           string
+		query          string
+		mockBehavior   func(m *mockService)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:  "Success",
+			query: "?limit=5&offset=10",
+			mockBehavior: func(m *mockService) {
+				m.ListDeletedFunc = func(ctx context.Context, limit, offset int) ([]*user.User, error) {
+					if limit != 5 || offset != 10 {
+						return nil, fmt.Errorf("unexpected page %d %d", limit, offset)
+					}
+					return []*user.User{{ID: "123", Name: "Ada Lovelace", Email: "ada@example.com", CreatedAt: createdAt, UpdatedAt: createdAt, DeletedAt: &deletedAt}}, nil
+				}
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"id":"123","name":{"given":"Ada","family":"Lovelace"},"email":"ada@example.com","created_at":"2026-03-01T12:00:00Z","updated_at":"2026-03-01T12:00:00Z","deleted_at":"2026-03-02T12:00:00Z"}]`,
+		},
+		{
+			name: "Empty",
+			mockBehavior: func(m *mockService) {
+				m.ListDeletedFunc = func(ctx context.Context, limit, offset int) ([]*user.User, error) {
+					if limit != user.DefaultListLimit || offset != 0 {
+						return nil, fmt.Errorf("unexpected page %d %d", limit, offset)
+					}
+					return nil, nil
+				}
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[]`,
+		},
+		{
+			name:           "InvalidLimit",
+			query:          "?limit=0",
+			mockBehavior:   func(m *mockService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "limit must be between 1 and 100",
+		},
+		{
+			name: "Forbidden",
+			mockBehavior: func(m *mockService) {
+				m.ListDeletedFunc = func(ctx context.Context, limit, offset int) ([]*user.User, error) {
+					return nil, authz.ErrPermissionDenied
+				}
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   authz.ErrPermissionDenied.Error(),
+		},
+		{
+			name: "Unsupported",
+			mockBehavior: func(m *mockService) {
+				m.ListDeletedFunc = func(ctx context.Context, limit, offset int) ([]*user.User, error) {
+					return nil, user.ErrTrashUnsupported
+				}
+			},
+			expectedStatus: http.StatusNotImplemented,
+			expectedBody:   user.ErrTrashUnsupported.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockService{}
+			tt.mockBehavior(mockSvc)
+
+			r := chi.NewRouter()
+			r.Get("/users/deleted", NewHandler(mockSvc, nil).ListDeletedUsers)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/users/deleted"+tt.query, nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, body)
+			}
+		})
+	}
+}
+
+func TestHandler_RestoreUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{name: "Success", expectedStatus: http.StatusOK},
+		{name: "NotFound", err: user.ErrNotFound, expectedStatus: http.StatusNotFound},
+		{name: "EmailTaken", err: user.ErrEmailTaken, expectedStatus: http.StatusConflict},
+		{name: "Forbidden", err: authz.ErrPermissionDenied, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockService{
+				RestoreUserFunc: func(ctx context.Context, id string) (*user.User, error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &user.User{ID: id, Name: "Ada Lovelace", Email: "ada@example.com"}, nil
+				},
+			}
+
+			r := chi.NewRouter()
+			r.Post("/users/{id}/restore", NewHandler(mockSvc, nil).RestoreUser)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("POST", "/users/123/restore", nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.err == nil {
+				var got User
+				if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+					t.Fatal(err)
+				}
+				if got.ID != "123" || got.DeletedAt != nil {
+					t.Errorf("expected the restored user, got %+v", got)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_ImportUsers(t *testing.T) {
+	tests := []struct {
+		name             string
+		inputBody        string
+		role             string
+		mockBehavior     func(m *mockService)
+		expectedStatus   int
+		expectedLocation string
+		expectedResult   string
+	}{
+		{
+			name:      "Accepted",
+			inputBody: `{"users":[{"name":{"given":"Ada","family":"Lovelace"},"email":"ada@example.com"},{"name":{"given":"Alan"},"email":"alan@example.com"}]}`,
+			role:      "admin",
+			mockBehavior: func(m *mockService) {
+				m.ImportUsersFunc = func(ctx context.Context, users []*user.User, progress func(done int)) (*user.ImportResult, error) {
+					if len(users) != 2 || users[0].Name != "Ada Lovelace" {
+						return nil, fmt.Errorf("unexpected users %v", users)
+					}
+					progress(1)
+					progress(2)
+					return &user.ImportResult{Created: 1, Failed: map[int]error{1: errors.New("duplicate email")}}, nil
+				}
+			},
+			expectedStatus:   http.StatusAccepted,
+			expectedLocation: "/api/v1/operations/op-1",
+			expectedResult:   `{"created":1,"failed":[{"index":1,"error":"duplicate email"}]}`,
+		},
+		{
+			name:           "Forbidden",
+			inputBody:      `{"users":[{"name":{"given":"Ada"}}]}`,
+			mockBehavior:   func(m *mockService) {},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Empty",
+			inputBody:      `{"users":[]}`,
+			role:           "admin",
+			mockBehavior:   func(m *mockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "MissingGivenName",
+			inputBody:      `{"users":[{"name":{"given":"Ada"}},{"name":{"family":"Lovelace"}}]}`,
+			role:           "admin",
+			mockBehavior:   func(m *mockService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := &mockService{}
+			tt.mockBehavior(mockSvc)
+			ops := &syncOperations{}
+
+			r := chi.NewRouter()
+			r.Use(authz.Middleware(authz.NewAuthorizer(authz.StaticRoles{"admin": {"*"}, "service": {user.PermissionWrite}}, 0)))
+			r.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					claims := &auth.Claims{Roles: []string{"service", tt.role}}
+					next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), claims)))
+				})
+			})
+			NewHandler(mockSvc, ops).RegisterRoutes(r)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("POST", "/users/import", bytes.NewBufferString(tt.inputBody)))
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Location"); got != tt.expectedLocation {
+				t.Errorf("expected Location %q, got %q", tt.expectedLocation, got)
+			}
+			if tt.expectedResult == "" {
+				return
+			}
+			if ops.err != nil {
+				t.Fatal(ops.err)
+			}
+			if got, _ := json.Marshal(ops.result); string(got) != tt.expectedResult {
+				t.Errorf("expected result %s, got %s", tt.expectedResult, got)
+			}
+			if !slices.Equal(ops.progress, []int{50, 100}) {
+				t.Errorf("expected progress [50 100], got %v", ops.progress)
+			}
+		})
+	}
+}
+
+// TestVersions mounts both API versions on one service, as cmd/server does,
+// and checks that each keeps its own representation.
+func TestVersions(t *testing.T) {
+	repo := &fakeRepository{users: map[string]*user.User{}}
+	svc := user.NewService(repo, idgen.UUIDv7{}, nil)
+
+	r := chi.NewRouter()
+	r.Use(authz.Middleware(authz.NewAuthorizer(authz.StaticRoles{"admin": {"*"}}, 0)))
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := &auth.Claims{Roles: []string{"admin"}}
+			next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), claims)))
+		})
+	})
+	r.Route("/api/v1", v1.NewHandler(svc).RegisterRoutes)
+	r.Route("/api/v2", NewHandler(svc, nil).RegisterRoutes)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return w
+	}
+
+	w := do("POST", "/api/v1/users", `{"name":"Ada Lovelace","email":"ada@example.com"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("v1 create: expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+	var id string
+	for id = range repo.users {
+	}
+
+	w = do("GET", "/api/v1/users/"+id, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("v1 get: expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var gotV1 map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &gotV1); err != nil {
+		t.Fatal(err)
+	}
+	if gotV1["name"] != "Ada Lovelace" || len(gotV1) != 3 {
+		t.Errorf("v1 representation changed: %v", gotV1)
+	}
+	if w.Header().Get("Sunset") == "" {
+		t.Error("expected v1 responses to carry a Sunset header")
+	}
+
+	w = do("GET", "/api/v2/users/"+id, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("v2 get: expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var gotV2 User
+	if err := json.Unmarshal(w.Body.Bytes(), &gotV2); err != nil {
+		t.Fatal(err)
+	}
+	createdAt := time.Date(2026, time.January, 2, 3, 4, 5, 0, time.UTC)
+	expected := User{ID: id, Name: Name{Given: "Ada", Family: "Lovelace"}, Email: "ada@example.com", CreatedAt: createdAt, UpdatedAt: createdAt}
+	if gotV2 != expected {
+		t.Errorf("expected %+v, got %+v", expected, gotV2)
+	}
+	if got := w.Header().Get("Last-Modified"); got != "Fri, 02 Jan 2026 03:04:05 GMT" {
+		t.Errorf("expected Last-Modified from created_at, got %q", got)
+	}
+	if w.Header().Get("Sunset") != "" {
+		t.Error("v2 responses must not be marked deprecated")
+	}
+}
@@ -0,0 +1,991 @@
+// Package webhook delivers user lifecycle events to subscriber URLs. Events
+// are stored as pending deliveries when the user service publishes them and
+// sent by a background worker, which retries failures with exponential
+// backoff and dead-letters deliveries that keep failing. Delivery is at least
+// once; receivers should deduplicate on the Webhook-Id header. Subscriptions
+// belong to a tenant and receive only the events of its users.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/go-templates/template-mongo/internal/user"
+	"github.com/user/go-templates/template-mongo/pkg/authz"
+	"github.com/user/go-templates/template-mongo/pkg/idgen"
+	"github.com/user/go-templates/template-mongo/pkg/jsonbody"
+	"github.com/user/go-templates/template-mongo/pkg/logger"
+	"github.com/user/go-templates/template-mongo/pkg/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// PermissionManage is required to manage subscriptions and inspect deliveries.
+const PermissionManage = "webhooks:manage"
+
+// EventAll subscribes to every event type.
+const EventAll = "*"
+
+// secretPrefix marks signing secrets so they are easy to recognise in secret scanners.
+const secretPrefix = "whsec_"
+
+// Headers sent with every delivery.
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+)
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+var (
+	ErrNotFound         = errors.New("webhook not found")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// eventTypes are the events a subscription may list besides EventAll.
+var eventTypes = map[string]bool{
+	user.EventCreated:  true,
+	user.EventUpdated:  true,
+	user.EventDeleted:  true,
+	user.EventRestored: true,
+}
+
+// --- Domain ---
+
+// Subscription receives the listed event types at URL. Secret signs the
+// payloads; it is returned once, on creation.
+type Subscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+	// TenantID is the tenant whose events the subscription receives.
+	TenantID string `json:"-"`
+}
+
+// Matches reports whether the subscription wants events of the given type.
+func (s *Subscription) Matches(eventType string) bool {
+	for _, e := range s.Events {
+		if e == EventAll || e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is one event sent, or to be sent, to one subscription.
+type Delivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastError      string          `json:"last_error,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	// TenantID is the tenant of the subscription.
+	TenantID string `json:"-"`
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      user.User `json:"data"`
+}
+
+// Repository stores subscriptions and their deliveries. Implementations
+// scope every call by the tenant in ctx, see package tenant, and return
+// tenant.ErrMissing without one; only ClaimDueDeliveries, which feeds the
+// worker, reads across tenants.
+type Repository interface {
+	// CreateSubscription stores sub under the ID the service gave it.
+	CreateSubscription(ctx context.Context, sub *Subscription) error
+	GetSubscription(ctx context.Context, id string) (*Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]*Subscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	// CreateDelivery stores d under the ID the dispatcher gave it, unless
+	// the subscription already has a delivery of d.EventID.
+	CreateDelivery(ctx context.Context, d *Delivery) error
+	// ClaimDueDeliveries claims up to limit pending deliveries of every
+	// tenant whose next attempt is at or before now, the longest due first,
+	// by moving their next attempt to until, and returns them. Workers
+	// calling it at the same time never claim the same delivery; one that
+	// is not updated by until is due again.
+	ClaimDueDeliveries(ctx context.Context, now, until time.Time, limit int) ([]*Delivery, error)
+	UpdateDelivery(ctx context.Context, d *Delivery) error
+	// ListDeliveries returns a subscription's deliveries, newest first.
+	ListDeliveries(ctx context.Context, subscriptionID string, limit, offset int) ([]*Delivery, error)
+	// RetryDelivery makes a dead delivery pending again with its attempts
+	// reset. It returns ErrNotFound unless the delivery exists and is dead.
+	RetryDelivery(ctx context.Context, subscriptionID, id string, at time.Time) error
+}
+
+type Service interface {
+	CreateSubscription(ctx context.Context, url string, events []string) (*Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]*Subscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	ListDeliveries(ctx context.Context, subscriptionID string, limit, offset int) ([]*Delivery, error)
+	RetryDelivery(ctx context.Context, subscriptionID, id string) error
+}
+
+// --- Signing ---
+
+// Sign returns the Webhook-Signature value for body sent at timestamp, the
+// Webhook-Timestamp value in Unix seconds: "sha256=" followed by the hex
+// HMAC-SHA256 of timestamp + "." + body.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature headers of a received delivery. Deliveries
+// whose timestamp is further than tolerance from now are rejected to limit
+// replays; zero disables the check.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp := header.Get(HeaderTimestamp)
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 {
+		if skew := time.Since(time.Unix(sec, 0)); skew > tolerance || skew < -tolerance {
+			return ErrInvalidSignature
+		}
+	}
+	if !hmac.Equal([]byte(header.Get(HeaderSignature)), []byte(Sign(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// --- Service Implementation ---
+
+type webhookService struct {
+	repo Repository
+	ids  idgen.Generator
+}
+
+// NewService returns the webhook service. ids generates the IDs of new
+// subscriptions.
+func NewService(repo Repository, ids idgen.Generator) Service {
+	return &webhookService{repo: repo, ids: ids}
+}
+
+func (s *webhookService) CreateSubscription(ctx context.Context, rawURL string, events []string) (*Subscription, error) {
+	logger.FromContext(ctx).Info("creating webhook subscription", zap.String("url", rawURL))
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("events is required")
+	}
+	for _, e := range events {
+		if e != EventAll && !eventTypes[e] {
+			return nil, fmt.Errorf("unknown event type %q", e)
+		}
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	sub := &Subscription{
+		ID:     s.ids.New(),
+		URL:    rawURL,
+		Secret: secretPrefix + secret,
+		Events: events,
+	}
+	if err := s.repo.CreateSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (s *webhookService) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	return s.repo.ListSubscriptions(ctx)
+}
+
+func (s *webhookService) DeleteSubscription(ctx context.Context, id string) error {
+	logger.FromContext(ctx).Info("deleting webhook subscription", zap.String("id", id))
+	return s.repo.DeleteSubscription(ctx, id)
+}
+
+func (s *webhookService) ListDeliveries(ctx context.Context, subscriptionID string, limit, offset int) ([]*Delivery, error) {
+	if _, err := s.repo.GetSubscription(ctx, subscriptionID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListDeliveries(ctx, subscriptionID, limit, offset)
+}
+
+func (s *webhookService) RetryDelivery(ctx context.Context, subscriptionID, id string) error {
+	logger.FromContext(ctx).Info("retrying webhook delivery", zap.String("id", id))
+	return s.repo.RetryDelivery(ctx, subscriptionID, id, time.Now())
+}
+
+// --- Dispatcher ---
+
+// Dispatcher turns user events into pending deliveries. It implements
+// user.Publisher.
+type Dispatcher struct {
+	repo Repository
+	ids  idgen.Generator
+}
+
+// NewDispatcher returns a dispatcher storing deliveries in repo. ids
+// generates their IDs.
+func NewDispatcher(repo Repository, ids idgen.Generator) *Dispatcher {
+	return &Dispatcher{repo: repo, ids: ids}
+}
+
+// Publish enqueues e. The user write has already succeeded, so failures are
+// logged rather than returned.
+func (d *Dispatcher) Publish(e user.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Enqueue(ctx, e); err != nil {
+		zap.L().Error("cannot enqueue webhook deliveries", zap.String("event", e.Type), zap.Error(err))
+	}
+}
+
+// Enqueue stores a pending delivery of e for every matching subscription of
+// the tenant of e.User. All deliveries of one event share its Webhook-Id,
+// which is derived from e.ID, so enqueueing e again, as the outbox relay does
+// after a failure, stores no second delivery.
+func (d *Dispatcher) Enqueue(ctx context.Context, e user.Event) error {
+	ctx = tenant.NewContext(ctx, e.User.TenantID)
+	subs, err := d.repo.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	var eventID string
+	for _, sub := range subs {
+		if !sub.Matches(e.Type) {
+			continue
+		}
+		if body == nil {
+			id := e.ID
+			if id == "" {
+				if id, err = randomHex(16); err != nil {
+					return err
+				}
+			}
+			eventID = "evt_" + id
+			body, err = json.Marshal(Payload{ID: eventID, Type: e.Type, CreatedAt: e.Time, Data: e.User})
+			if err != nil {
+				return err
+			}
+		}
+		err := d.repo.CreateDelivery(ctx, &Delivery{
+			ID:             d.ids.New(),
+			SubscriptionID: sub.ID,
+			TenantID:       sub.TenantID,
+			EventID:        eventID,
+			EventType:      e.Type,
+			Payload:        body,
+			Status:         StatusPending,
+			NextAttemptAt:  e.Time,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- Worker ---
+
+// WorkerOptions configures a Worker. Zero values use the defaults noted.
+type WorkerOptions struct {
+	// Interval between polls for due deliveries (5s).
+	Interval time.Duration
+	// MaxAttempts after which a failing delivery is dead-lettered (8).
+	MaxAttempts int
+	// Backoff is the delay after the first failed attempt; it doubles with
+	// every further attempt up to MaxBackoff (30s, 1h).
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds each request to a subscriber (10s).
+	Timeout time.Duration
+	// BatchSize is the number of deliveries attempted per poll (100).
+	BatchSize int
+	// Lease is how long the deliveries of a poll are left to this worker
+	// before other workers may send them too; it should exceed the time
+	// taken to attempt them (BatchSize times Timeout).
+	Lease time.Duration
+}
+
+// Worker sends due deliveries in the background until it is closed. A
+// delivery succeeds when the subscriber answers with a 2xx status.
+type Worker struct {
+	repo   Repository
+	client *http.Client
+	opts   WorkerOptions
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewWorker(repo Repository, client *http.Client, opts WorkerOptions) *Worker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 8
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 30 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Hour
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = time.Duration(opts.BatchSize) * opts.Timeout
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Worker{
+		repo:   repo,
+		client: client,
+		opts:   opts,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go w.run(ctx)
+	return w
+}
+
+// Close stops the worker, abandoning in-flight requests, and waits for it to
+// exit. Abandoned deliveries stay pending and are retried once their lease
+// expires.
+func (w *Worker) Close() {
+	w.cancel()
+	<-w.done
+}
+
+func (w *Worker) run(ctx context.Context) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := w.ProcessDue(ctx); err != nil && ctx.Err() == nil {
+			zap.L().Error("cannot process webhook deliveries", zap.Error(err))
+		}
+	}
+}
+
+// ProcessDue claims one batch of due deliveries, of any tenant, attempts
+// them and returns how many were attempted. Workers of several instances
+// claim different deliveries. Each delivery is read and updated in the
+// scope of its own tenant.
+func (w *Worker) ProcessDue(ctx context.Context) (int, error) {
+	now := time.Now()
+	due, err := w.repo.ClaimDueDeliveries(ctx, now, now.Add(w.opts.Lease), w.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	subs := make(map[string]*Subscription)
+	for i, d := range due {
+		ctx := tenant.NewContext(ctx, d.TenantID)
+		sub, ok := subs[d.SubscriptionID]
+		if !ok {
+			sub, err = w.repo.GetSubscription(ctx, d.SubscriptionID)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return i, err
+			}
+			subs[d.SubscriptionID] = sub
+		}
+		if err := w.attempt(ctx, sub, d); err != nil {
+			return i, err
+		}
+	}
+	return len(due), nil
+}
+
+// attempt sends d to sub, which is nil when the subscription no longer
+// exists, and records the outcome.
+func (w *Worker) attempt(ctx context.Context, sub *Subscription, d *Delivery) error {
+	status, err := 0, ErrNotFound
+	if sub != nil {
+		status, err = w.send(ctx, sub, d)
+	}
+	if ctx.Err() != nil {
+		// Shutting down; the attempt does not count.
+		return ctx.Err()
+	}
+
+	now := time.Now()
+	d.Attempts++
+	d.ResponseStatus = status
+	switch {
+	case err == nil:
+		d.Status = StatusSucceeded
+		d.LastError = ""
+		d.DeliveredAt = &now
+	case sub == nil || d.Attempts >= w.opts.MaxAttempts:
+		d.Status = StatusDead
+		d.LastError = err.Error()
+	default:
+		d.LastError = err.Error()
+		d.NextAttemptAt = now.Add(w.backoff(d.Attempts))
+	}
+
+	if d.Status == StatusDead {
+		zap.L().Warn("webhook delivery dead-lettered",
+			zap.String("id", d.ID),
+			zap.String("subscription_id", d.SubscriptionID),
+			zap.Int("attempts", d.Attempts),
+			zap.String("error", d.LastError),
+		)
+	}
+	return w.repo.UpdateDelivery(ctx, d)
+}
+
+func (w *Worker) send(ctx context.Context, sub *Subscription, d *Delivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, w.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, d.EventID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, d.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay after the given number of failed attempts.
+func (w *Worker) backoff(attempts int) time.Duration {
+	d := w.opts.Backoff
+	for i := 1; i < attempts && d < w.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, w.opts.MaxBackoff)
+}
+
+// --- Handler ---
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 200
+)
+
+type Handler struct {
+	svc Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(authz.Require(PermissionManage), tenantRequired)
+		r.Get("/admin/webhooks", h.ListSubscriptions)
+		r.Post("/admin/webhooks", h.CreateSubscription)
+		r.Delete("/admin/webhooks/{id}", h.DeleteSubscription)
+		r.Get("/admin/webhooks/{id}/deliveries", h.ListDeliveries)
+		r.Post("/admin/webhooks/{id}/deliveries/{deliveryID}/retry", h.RetryDelivery)
+	})
+}
+
+// tenantRequired rejects requests without a tenant to scope the
+// subscriptions by; tenant.Middleware gives every routed request one.
+func tenantRequired(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := tenant.FromContext(r.Context()); !ok {
+			http.Error(w, tenant.ErrMissing.Error(), http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type createSubscriptionRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type createSubscriptionResponse struct {
+	*Subscription
+	// Secret signs deliveries. It is only ever returned here.
+	Secret string `json:"secret"`
+}
+
+func (h *Handler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	var req createSubscriptionRequest
+	if err := jsonbody.Decode(r, &req); err != nil {
+		http.Error(w, err.Error(), jsonbody.Status(err))
+		return
+	}
+	sub, err := h.svc.CreateSubscription(r.Context(), req.URL, req.Events)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createSubscriptionResponse{Subscription: sub, Secret: sub.Secret})
+}
+
+func (h *Handler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.svc.ListSubscriptions(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if subs == nil {
+		subs = []*Subscription{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subs)
+}
+
+func (h *Handler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.DeleteSubscription(r.Context(), chi.URLParam(r, "id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries returns the delivery log of a subscription, newest first,
+// paginated with the limit (default 50, at most 200) and offset parameters.
+func (h *Handler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", defaultDeliveryLimit)
+	if err != nil || limit < 1 || limit > maxDeliveryLimit {
+		http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxDeliveryLimit), http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "offset must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := h.svc.ListDeliveries(r.Context(), chi.URLParam(r, "id"), limit, offset)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*Delivery{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// RetryDelivery schedules a dead delivery for immediate redelivery.
+func (h *Handler) RetryDelivery(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.RetryDelivery(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "deliveryID")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// --- Mongo Repository ---
+
+type MongoRepository struct {
+	subscriptions *mongo.Collection
+	deliveries    *mongo.Collection
+}
+
+func NewMongoRepository(db *mongo.Database) *MongoRepository {
+	return &MongoRepository{
+		subscriptions: db.Collection("webhook_subscriptions"),
+		deliveries:    db.Collection("webhook_deliveries"),
+	}
+}
+
+// EnsureIndexes creates the indexes used to list a tenant's subscriptions,
+// find due deliveries and list a subscription's delivery log. Subscriptions
+// and deliveries stored before tenancy was introduced are moved to
+// tenant.DefaultTenant first.
+func (r *MongoRepository) EnsureIndexes(ctx context.Context) error {
+	for _, c := range []*mongo.Collection{r.subscriptions, r.deliveries} {
+		_, err := c.UpdateMany(ctx,
+			bson.M{"tenant_id": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"tenant_id": tenant.DefaultTenant}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := r.subscriptions.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.deliveries.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "subscription_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{
+			Keys:    bson.D{{Key: "subscription_id", Value: 1}, {Key: "event_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	return err
+}
+
+type subscriptionDoc struct {
+	ID        string    `bson:"_id"`
+	URL       string    `bson:"url"`
+	Secret    string    `bson:"secret"`
+	Events    []string  `bson:"events"`
+	CreatedAt time.Time `bson:"created_at"`
+	TenantID  string    `bson:"tenant_id"`
+}
+
+// deliveryDoc keeps the payload as a string so it is sent, and signed,
+// byte for byte as it was stored.
+type deliveryDoc struct {
+	ID             string     `bson:"_id"`
+	SubscriptionID string     `bson:"subscription_id"`
+	EventID        string     `bson:"event_id"`
+	EventType      string     `bson:"event_type"`
+	Payload        string     `bson:"payload"`
+	Status         string     `bson:"status"`
+	Attempts       int        `bson:"attempts"`
+	NextAttemptAt  time.Time  `bson:"next_attempt_at"`
+	LastError      string     `bson:"last_error"`
+	ResponseStatus int        `bson:"response_status"`
+	DeliveredAt    *time.Time `bson:"delivered_at"`
+	CreatedAt      time.Time  `bson:"created_at"`
+	TenantID       string     `bson:"tenant_id"`
+}
+
+func (r *MongoRepository) CreateSubscription(ctx context.Context, sub *Subscription) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	sub.TenantID = tenantID
+	sub.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+
+	doc := subscriptionDoc{
+		ID:        sub.ID,
+		URL:       sub.URL,
+		Secret:    sub.Secret,
+		Events:    sub.Events,
+		CreatedAt: sub.CreatedAt,
+		TenantID:  sub.TenantID,
+	}
+
+	_, err = r.subscriptions.InsertOne(ctx, doc)
+	return err
+}
+
+func (r *MongoRepository) GetSubscription(ctx context.Context, id string) (*Subscription, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc subscriptionDoc
+	err = r.subscriptions.FindOne(ctx, bson.M{"_id": id, "tenant_id": tenantID}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return fromSubscriptionDoc(doc), nil
+}
+
+func (r *MongoRepository) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := r.subscriptions.Find(ctx, bson.M{"tenant_id": tenantID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []subscriptionDoc
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	subs := make([]*Subscription, 0, len(docs))
+	for _, d := range docs {
+		subs = append(subs, fromSubscriptionDoc(d))
+	}
+	return subs, nil
+}
+
+// DeleteSubscription removes the subscription and then its deliveries.
+func (r *MongoRepository) DeleteSubscription(ctx context.Context, id string) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.subscriptions.DeleteOne(ctx, bson.M{"_id": id, "tenant_id": tenantID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	_, err = r.deliveries.DeleteMany(ctx, bson.M{"subscription_id": id, "tenant_id": tenantID})
+	return err
+}
+
+func (r *MongoRepository) CreateDelivery(ctx context.Context, d *Delivery) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	d.TenantID = tenantID
+	d.Status = StatusPending
+	d.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+
+	_, err = r.deliveries.InsertOne(ctx, toDeliveryDoc(d))
+	if mongo.IsDuplicateKeyError(err) {
+		// The subscription already has a delivery of the event.
+		return nil
+	}
+	return err
+}
+
+// ClaimDueDeliveries claims one delivery at a time, each with an atomic
+// FindOneAndUpdate.
+func (r *MongoRepository) ClaimDueDeliveries(ctx context.Context, now, until time.Time, limit int) ([]*Delivery, error) {
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+	var claimed []*Delivery
+	for len(claimed) < limit {
+		var doc deliveryDoc
+		err := r.deliveries.FindOneAndUpdate(ctx,
+			bson.M{"status": StatusPending, "next_attempt_at": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"next_attempt_at": until.UTC().Truncate(time.Millisecond)}},
+			opts,
+		).Decode(&doc)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, fromDeliveryDoc(doc))
+	}
+	return claimed, nil
+}
+
+func (r *MongoRepository) UpdateDelivery(ctx context.Context, d *Delivery) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.deliveries.UpdateOne(ctx,
+		bson.M{"_id": d.ID, "tenant_id": tenantID},
+		bson.M{"$set": bson.M{
+			"status":          d.Status,
+			"attempts":        d.Attempts,
+			"next_attempt_at": d.NextAttemptAt,
+			"last_error":      d.LastError,
+			"response_status": d.ResponseStatus,
+			"delivered_at":    d.DeliveredAt,
+		}},
+	)
+	return err
+}
+
+func (r *MongoRepository) ListDeliveries(ctx context.Context, subscriptionID string, limit, offset int) ([]*Delivery, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	return r.findDeliveries(ctx, bson.M{"subscription_id": subscriptionID, "tenant_id": tenantID}, opts)
+}
+
+func (r *MongoRepository) RetryDelivery(ctx context.Context, subscriptionID, id string, at time.Time) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.deliveries.UpdateOne(ctx,
+		bson.M{"_id": id, "subscription_id": subscriptionID, "tenant_id": tenantID, "status": StatusDead},
+		bson.M{"$set": bson.M{"status": StatusPending, "attempts": 0, "next_attempt_at": at}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoRepository) findDeliveries(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]*Delivery, error) {
+	cur, err := r.deliveries.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var docs []deliveryDoc
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*Delivery, 0, len(docs))
+	for _, d := range docs {
+		deliveries = append(deliveries, fromDeliveryDoc(d))
+	}
+	return deliveries, nil
+}
+
+// requireTenant returns the tenant in ctx, by which the repository scopes
+// every query.
+func requireTenant(ctx context.Context) (string, error) {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return "", tenant.ErrMissing
+	}
+	return id, nil
+}
+
+func fromSubscriptionDoc(d subscriptionDoc) *Subscription {
+	return &Subscription{
+		ID:        d.ID,
+		URL:       d.URL,
+		Secret:    d.Secret,
+		Events:    d.Events,
+		CreatedAt: d.CreatedAt,
+		TenantID:  d.TenantID,
+	}
+}
+
+func toDeliveryDoc(d *Delivery) deliveryDoc {
+	return deliveryDoc{
+		ID:             d.ID,
+		SubscriptionID: d.SubscriptionID,
+		EventID:        d.EventID,
+		EventType:      d.EventType,
+		Payload:        string(d.Payload),
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		NextAttemptAt:  d.NextAttemptAt,
+		LastError:      d.LastError,
+		ResponseStatus: d.ResponseStatus,
+		DeliveredAt:    d.DeliveredAt,
+		CreatedAt:      d.CreatedAt,
+		TenantID:       d.TenantID,
+	}
+}
+
+func fromDeliveryDoc(d deliveryDoc) *Delivery {
+	return &Delivery{
+		ID:             d.ID,
+		SubscriptionID: d.SubscriptionID,
+		EventID:        d.EventID,
+		EventType:      d.EventType,
+		Payload:        json.RawMessage(d.Payload),
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		NextAttemptAt:  d.NextAttemptAt,
+		LastError:      d.LastError,
+		ResponseStatus: d.ResponseStatus,
+		DeliveredAt:    d.DeliveredAt,
+		CreatedAt:      d.CreatedAt,
+		TenantID:       d.TenantID,
+	}
+}
@@ -0,0 +1,93 @@
+// Package webhooktest provides a webhook receiver for tests, built on
+// httptest. It verifies signatures like a real subscriber would and records
+// the deliveries it accepts.
+package webhooktest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/user/go-templates/template-mongo/internal/webhook"
+)
+
+// Request is a delivery accepted by a Receiver.
+type Request struct {
+	Header  http.Header
+	Body    []byte
+	Payload webhook.Payload
+}
+
+// Receiver is an HTTP server accepting webhook deliveries. Requests with a
+// missing or invalid signature are answered with 401 and not recorded.
+type Receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	secret   string
+	failNext int
+	requests []Request
+}
+
+// NewReceiver starts a receiver verifying signatures with secret. It is
+// closed when the test ends.
+func NewReceiver(t testing.TB, secret string) *Receiver {
+	rv := &Receiver{secret: secret}
+	rv.Server = httptest.NewServer(http.HandlerFunc(rv.serve))
+	t.Cleanup(rv.Close)
+	return rv
+}
+
+// SetSecret changes the signing secret, for subscriptions whose secret is
+// only known once they are created with the receiver's URL.
+func (rv *Receiver) SetSecret(secret string) {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	rv.secret = secret
+}
+
+// FailNext makes the next n correctly signed deliveries fail with 500.
+func (rv *Receiver) FailNext(n int) {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	rv.failNext = n
+}
+
+// Requests returns the deliveries accepted so far.
+func (rv *Receiver) Requests() []Request {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	return append([]Request(nil), rv.requests...)
+}
+
+func (rv *Receiver) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+
+	if err := webhook.Verify(rv.secret, r.Header, body, 0); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if rv.failNext > 0 {
+		rv.failNext--
+		http.Error(w, "failing as requested", http.StatusInternalServerError)
+		return
+	}
+
+	var payload webhook.Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rv.requests = append(rv.requests, Request{Header: r.Header.Clone(), Body: body, Payload: payload})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+type KeyOptions struct {
+	// JWKS is a URL or file path of a JSON Web Key Set. When set it takes
+	// precedence over the local keys.
+	JWKS        string
+	JWKSRefresh time.Duration
+
+	HMACSecret    string
+	PublicKeyFile string
+	// AllowWeakSecret accepts an HMAC secret that CheckSecret rejects. It is
+	// meant for development only.
+	AllowWeakSecret bool
+}
+
+// MinSecretLength is the shortest HMAC secret CheckSecret accepts, the size
+// of the HS256 digest.
+const MinSecretLength = 32
+
+// placeholderSecret is the value the sample configs used to ship with.
+const placeholderSecret = "change-me"
+
+var ErrWeakSecret = errors.New("HMAC secret is too weak")
+
+// CheckSecret reports whether secret is fit to sign tokens: set, not the
+// placeholder of the sample config and at least MinSecretLength bytes.
+func CheckSecret(secret string) error {
+	switch {
+	case secret == "":
+		return fmt.Errorf("%w: empty", ErrWeakSecret)
+	case secret == placeholderSecret:
+		return fmt.Errorf("%w: still the %q placeholder", ErrWeakSecret, placeholderSecret)
+	case len(secret) < MinSecretLength:
+		return fmt.Errorf("%w: %d bytes, need at least %d", ErrWeakSecret, len(secret), MinSecretLength)
+	}
+	return nil
+}
+
+// LoadKeySet builds the KeySet described by opts. An HMAC secret that fails
+// CheckSecret is refused unless opts.AllowWeakSecret is set; an empty one
+// leaves HS256 disabled.
+func LoadKeySet(ctx context.Context, opts KeyOptions) (KeySet, error) {
+	if opts.JWKS != "" {
+		return NewJWKS(ctx, opts.JWKS, opts.JWKSRefresh)
+	}
+	if opts.HMACSecret != "" && !opts.AllowWeakSecret {
+		if err := CheckSecret(opts.HMACSecret); err != nil {
+			return nil, err
+		}
+	}
+	return NewStaticKeys(opts.HMACSecret, opts.PublicKeyFile)
+}
+
+// StaticKeys is a KeySet backed by locally configured keys: a shared HMAC
+// secret for HS256 and/or a PEM encoded public key for the asymmetric
+// algorithms. It is meant for development and single-issuer deployments.
+type StaticKeys struct {
+	secret []byte
+	public any
+}
+
+// NewStaticKeys builds a KeySet from an HMAC secret and the path of a PEM
+// public key. Either may be empty.
+func NewStaticKeys(secret, publicKeyFile string) (*StaticKeys, error) {
+	k := &StaticKeys{}
+	if secret != "" {
+		k.secret = []byte(secret)
+	}
+	if publicKeyFile != "" {
+		data, err := os.ReadFile(publicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read public key: %w", err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("public key: no PEM block found")
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse public key: %w", err)
+		}
+		k.public = pub
+	}
+	if k.secret == nil && k.public == nil {
+		return nil, errors.New("no local keys configured")
+	}
+	return k, nil
+}
+
+func (k *StaticKeys) Key(ctx context.Context, kid, alg string) (any, error) {
+	if alg == "HS256" {
+		if k.secret == nil {
+			return nil, errors.New("no HMAC secret configured")
+		}
+		return k.secret, nil
+	}
+	if k.public == nil || !keyMatchesAlg(k.public, alg) {
+		return nil, fmt.Errorf("no key for algorithm %s", alg)
+	}
+	return k.public, nil
+}
@@ -0,0 +1,69 @@
+// Package bodylimit caps the size of request bodies, per route.
+package bodylimit
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Options configures the middleware.
+type Options struct {
+	// Default applies to routes without an entry in Routes. Zero disables
+	// the limit.
+	Default int64
+	// Routes maps chi route patterns to limits in bytes. Keys may be prefixed
+	// with a method: "POST /api/v1/users" takes precedence over
+	// "/api/v1/users".
+	Routes map[string]int64
+}
+
+func (o Options) limit(r *http.Request) int64 {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		pattern := rctx.RoutePattern()
+		if n, ok := o.Routes[r.Method+" "+pattern]; ok {
+			return n
+		}
+		if n, ok := o.Routes[pattern]; ok {
+			return n
+		}
+	}
+	return o.Default
+}
+
+// Middleware limits request bodies. The route is only known once chi has
+// routed the request, so the limit is resolved on the first read of the body;
+// reads past it fail with *http.MaxBytesError, which handlers should answer
+// with 413 (see jsonbody.Status).
+func Middleware(opts Options) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = &body{ReadCloser: r.Body, w: w, r: r, opts: opts}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type body struct {
+	io.ReadCloser
+	w    http.ResponseWriter
+	r    *http.Request
+	opts Options
+
+	once    sync.Once
+	limited io.ReadCloser
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	b.once.Do(func() {
+		b.limited = b.ReadCloser
+		if n := b.opts.limit(b.r); n > 0 {
+			b.limited = http.MaxBytesReader(b.w, b.ReadCloser, n)
+		}
+	})
+	return b.limited.Read(p)
+}
@@ -0,0 +1,133 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+)
+
+// drain returns the data of the events queued on s without blocking.
+func drain(s *Subscription[string]) []string {
+	var got []string
+	for {
+		select {
+		case e, ok := <-s.Events():
+			if !ok {
+				return got
+			}
+			got = append(got, e.Data)
+		default:
+			return got
+		}
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBroker_Publish(t *testing.T) {
+	b := New[string](Options{Buffer: 4})
+	s1 := b.Subscribe(0)
+	s2 := b.Subscribe(0)
+	defer s1.Close()
+	defer s2.Close()
+
+	b.Publish("a")
+	b.Publish("b")
+
+	for _, s := range []*Subscription[string]{s1, s2} {
+		if got := drain(s); !equal(got, []string{"a", "b"}) {
+			t.Errorf("expected [a b], got %v", got)
+		}
+	}
+}
+
+func TestBroker_Resume(t *testing.T) {
+	tests := []struct {
+		name        string
+		lastID      uint64
+		expected    []string
+		expectedGap bool
+	}{
+		{name: "New", lastID: 0, expected: nil},
+		{name: "UpToDate", lastID: 5, expected: nil},
+		{name: "Retained", lastID: 3, expected: []string{"4", "5"}},
+		{name: "OldestRetained", lastID: 2, expected: []string{"3", "4", "5"}},
+		{name: "Expired", lastID: 1, expected: []string{"3", "4", "5"}, expectedGap: true},
+		{name: "Unknown", lastID: 42, expected: []string{"3", "4", "5"}, expectedGap: true},
+	}
+
+	b := New[string](Options{History: 3, Buffer: 1})
+	for _, v := range []string{"1", "2", "3", "4", "5"} {
+		b.Publish(v)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := b.Subscribe(tt.lastID)
+			defer s.Close()
+
+			if got := drain(s); !equal(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+			if s.Gap != tt.expectedGap {
+				t.Errorf("expected gap %v, got %v", tt.expectedGap, s.Gap)
+			}
+		})
+	}
+}
+
+func TestBroker_Lagged(t *testing.T) {
+	b := New[string](Options{Buffer: 2})
+	slow := b.Subscribe(0)
+	fast := b.Subscribe(0)
+	defer fast.Close()
+
+	b.Publish("a")
+	b.Publish("b")
+	drain(fast)
+	b.Publish("c")
+
+	if got := drain(slow); !equal(got, []string{"a", "b"}) {
+		t.Errorf("expected [a b] before disconnect, got %v", got)
+	}
+	if _, ok := <-slow.Events(); ok {
+		t.Fatal("expected slow subscription to be closed")
+	}
+	if !errors.Is(slow.Err(), ErrLagged) {
+		t.Errorf("expected ErrLagged, got %v", slow.Err())
+	}
+	if got := drain(fast); !equal(got, []string{"c"}) {
+		t.Errorf("expected fast subscriber to keep receiving, got %v", got)
+	}
+	slow.Close()
+}
+
+func TestBroker_Close(t *testing.T) {
+	b := New[string](Options{History: 1})
+	s := b.Subscribe(0)
+
+	b.Close()
+	b.Publish("ignored")
+
+	if _, ok := <-s.Events(); ok {
+		t.Fatal("expected subscription to be closed")
+	}
+	if !errors.Is(s.Err(), ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", s.Err())
+	}
+	s.Close()
+
+	late := b.Subscribe(0)
+	if _, ok := <-late.Events(); ok || !errors.Is(late.Err(), ErrClosed) {
+		t.Errorf("expected subscription on a closed broker to end immediately, got %v", late.Err())
+	}
+}
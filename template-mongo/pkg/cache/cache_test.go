@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// testCache is a Cache whose clock a test can advance.
+type testCache struct {
+	Cache
+	advance func(d time.Duration)
+}
+
+func newTestLRU(t *testing.T) testCache {
+	c := NewLRU(LRUOptions{})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	return testCache{Cache: c, advance: func(d time.Duration) { now = now.Add(d) }}
+}
+
+// newTestRedis returns a Redis cache backed by an in-process fake server.
+func newTestRedis(t *testing.T) testCache {
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return testCache{Cache: NewRedis(client, "test:"), advance: srv.FastForward}
+}
+
+func TestCache(t *testing.T) {
+	caches := map[string]func(t *testing.T) testCache{
+		"LRU":   newTestLRU,
+		"Redis": newTestRedis,
+	}
+
+	for name, newCache := range caches {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			c := newCache(t)
+			get := func(key string) (string, bool) {
+				t.Helper()
+				value, ok, err := c.Get(ctx, key)
+				if err != nil {
+					t.Fatalf("Get: %v", err)
+				}
+				return string(value), ok
+			}
+
+			if _, ok := get("a"); ok {
+				t.Fatal("expected a miss before Set")
+			}
+			if err := c.Set(ctx, "a", []byte("1"), time.Minute); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+			if err := c.Set(ctx, "b", []byte("2"), 0); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+			if err := c.Set(ctx, "empty", []byte{}, time.Minute); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+			if v, ok := get("a"); !ok || v != "1" {
+				t.Errorf("expected 1, got %q (%v)", v, ok)
+			}
+			if v, ok := get("empty"); !ok || v != "" {
+				t.Errorf("expected an empty value, got %q (%v)", v, ok)
+			}
+
+			c.advance(2 * time.Minute)
+			if _, ok := get("a"); ok {
+				t.Error("expected a to have expired")
+			}
+			if v, ok := get("b"); !ok || v != "2" {
+				t.Errorf("expected b to be kept without a ttl, got %q (%v)", v, ok)
+			}
+
+			if err := c.Delete(ctx, "b"); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, ok := get("b"); ok {
+				t.Error("expected b to be deleted")
+			}
+			if err := c.Delete(ctx, "missing"); err != nil {
+				t.Errorf("expected deleting a missing key to succeed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLRU_Eviction(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(LRUOptions{MaxEntries: 3})
+	for i := range 3 {
+		c.Set(ctx, fmt.Sprint(i), []byte{byte(i)}, 0)
+	}
+	// Reading 0 makes 1 the least recently used.
+	c.Get(ctx, "0")
+	c.Set(ctx, "3", []byte{3}, 0)
+
+	if c.Len() != 3 {
+		t.Errorf("expected 3 entries, got %d", c.Len())
+	}
+	if _, ok, _ := c.Get(ctx, "1"); ok {
+		t.Error("expected 1 to be evicted")
+	}
+	for _, key := range []string{"0", "2", "3"} {
+		if _, ok, _ := c.Get(ctx, key); !ok {
+			t.Errorf("expected %s to be kept", key)
+		}
+	}
+}
+
+func TestRedis_Prefix(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	defer client.Close()
+
+	if err := NewRedis(client, "users:").Set(ctx, "1", []byte("x"), time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if v, err := srv.Get("users:1"); err != nil || v != "x" {
+		t.Errorf("expected the value under users:1, got %q (%v)", v, err)
+	}
+	if _, ok, _ := NewRedis(client, "keys:").Get(ctx, "1"); ok {
+		t.Error("expected caches with other prefixes not to see the value")
+	}
+}
@@ -0,0 +1,133 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{header: "", expected: ""},
+		{header: "gzip", expected: "gzip"},
+		{header: "gzip, deflate, br, zstd", expected: "zstd"},
+		{header: "zstd;q=0.5, gzip", expected: "gzip"},
+		{header: "gzip;q=0, zstd;q=0", expected: ""},
+		{header: "*", expected: "zstd"},
+		{header: "*;q=0.1, gzip;q=0.5", expected: "gzip"},
+		{header: "br, identity", expected: ""},
+		{header: "GZIP; q=0.8", expected: "gzip"},
+	}
+
+	for _, tt := range tests {
+		if got := Negotiate(tt.header); got != tt.expected {
+			t.Errorf("Negotiate(%q): expected %q, got %q", tt.header, tt.expected, got)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	large := `{"data":"` + strings.Repeat("a", 4096) + `"}`
+
+	tests := []struct {
+		name             string
+		acceptEncoding   string
+		contentType      string
+		contentEncoding  string
+		body             string
+		expectedEncoding string
+	}{
+		{name: "Gzip", acceptEncoding: "gzip", contentType: "application/json", body: large, expectedEncoding: "gzip"},
+		{name: "Zstd", acceptEncoding: "gzip, zstd", contentType: "application/json", body: large, expectedEncoding: "zstd"},
+		{name: "Sniffed", acceptEncoding: "gzip", body: large, expectedEncoding: "gzip"},
+		{name: "NotAccepted", contentType: "application/json", body: large},
+		{name: "Small", acceptEncoding: "gzip", contentType: "application/json", body: `{"ok":true}`},
+		{name: "Binary", acceptEncoding: "gzip", contentType: "image/png", body: large},
+		{name: "EventStream", acceptEncoding: "gzip", contentType: "text/event-stream", body: large},
+		{name: "AlreadyEncoded", acceptEncoding: "gzip", contentType: "application/json", contentEncoding: "br", body: large, expectedEncoding: "br"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Middleware(Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				if tt.contentEncoding != "" {
+					w.Header().Set("Content-Encoding", tt.contentEncoding)
+				}
+				w.WriteHeader(http.StatusCreated)
+				// Write in chunks to exercise buffering.
+				for i := 0; i < len(tt.body); i += 100 {
+					io.WriteString(w, tt.body[i:min(i+100, len(tt.body))])
+				}
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			if w.Code != http.StatusCreated {
+				t.Errorf("expected status %d, got %d", http.StatusCreated, w.Code)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.expectedEncoding {
+				t.Fatalf("expected Content-Encoding %q, got %q", tt.expectedEncoding, got)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("expected Vary: Accept-Encoding, got %q", got)
+			}
+
+			var body []byte
+			var err error
+			switch tt.expectedEncoding {
+			case "gzip":
+				var zr *gzip.Reader
+				if zr, err = gzip.NewReader(w.Body); err == nil {
+					body, err = io.ReadAll(zr)
+				}
+			case "zstd":
+				var zr *zstd.Decoder
+				if zr, err = zstd.NewReader(w.Body); err == nil {
+					body, err = io.ReadAll(zr)
+					zr.Close()
+				}
+			default:
+				body = w.Body.Bytes()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(body, []byte(tt.body)) {
+				t.Errorf("body mismatch: got %d bytes, expected %d", len(body), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestMiddleware_NoContent(t *testing.T) {
+	h := Middleware(Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest("DELETE", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent || w.Header().Get("Content-Encoding") != "" || w.Body.Len() != 0 {
+		t.Errorf("expected bare 204, got %d %q %d bytes", w.Code, w.Header().Get("Content-Encoding"), w.Body.Len())
+	}
+}
@@ -0,0 +1,51 @@
+// Package jsonbody decodes JSON request bodies strictly.
+package jsonbody
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var (
+	ErrEmpty        = errors.New("body is empty")
+	ErrTrailingData = errors.New("body must contain a single JSON value")
+)
+
+// Decode reads exactly one JSON value from r.Body into v. Unknown object
+// fields and anything but whitespace after the value are rejected. Errors are
+// prefixed with "invalid request body" and suitable for clients; pass them to
+// Status for the response code.
+func Decode(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = ErrEmpty
+		}
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+
+	var extra json.RawMessage
+	if err := dec.Decode(&extra); !errors.Is(err, io.EOF) {
+		var tooLarge *http.MaxBytesError
+		if !errors.As(err, &tooLarge) {
+			err = ErrTrailingData
+		}
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+// Status returns the response code for a Decode error: 413 when the body
+// exceeded its limit, 400 otherwise.
+func Status(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
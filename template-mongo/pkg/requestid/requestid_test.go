@@ -0,0 +1,60 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/user/go-templates/template-mongo/pkg/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{name: "Propagated", incoming: "abc-123", keep: true},
+		{name: "Generated", incoming: "", keep: false},
+		{name: "InvalidReplaced", incoming: "has space", keep: false},
+		{name: "TooLongReplaced", incoming: strings.Repeat("a", maxLen+1), keep: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zap.InfoLevel)
+
+			var ctxID string
+			h := Middleware(zap.New(core))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctxID = FromContext(r.Context())
+				logger.FromContext(r.Context()).Info("handled")
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(Header, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			got := w.Header().Get(Header)
+			if got == "" || got != ctxID {
+				t.Fatalf("expected response header %q to match context ID %q", got, ctxID)
+			}
+			if tt.keep && got != tt.incoming {
+				t.Errorf("expected request ID %q, got %q", tt.incoming, got)
+			}
+			if !tt.keep && got == tt.incoming {
+				t.Errorf("expected a generated request ID, got %q", got)
+			}
+
+			entries := logs.All()
+			if len(entries) != 1 || entries[0].ContextMap()["request_id"] != got {
+				t.Errorf("expected log entry with request_id %q, got %v", got, entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+// Package transaction lets services run several repository calls as one
+// unit of work. A Manager starts a transaction and carries its session in
+// the context passed to the unit of work; the Mongo driver runs every
+// operation made with that context in the transaction, whatever the
+// collection, so repositories need no changes to join it.
+package transaction
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrUnsupported is returned by MongoManager.Check when the server runs
+// standalone, which has no transactions.
+var ErrUnsupported = errors.New("transaction: MongoDB must run as a replica set or sharded cluster")
+
+// ErrNestedFailed is returned by the outermost WithinTx when a nested call
+// failed but the caller carried on. Mongo has no savepoints, so the nested
+// writes cannot be undone alone and the whole transaction is aborted.
+var ErrNestedFailed = errors.New("transaction: a nested unit of work failed")
+
+// Manager runs fn in a transaction, committing if fn returns nil and rolling
+// back otherwise.
+type Manager interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txKey struct{}
+
+// state tracks whether a nested call failed during one transaction attempt
+// and the functions AfterCommit deferred in it.
+type state struct {
+	nestedFailed atomic.Bool
+
+	mu    sync.Mutex
+	hooks []func()
+}
+
+// AfterCommit runs fn once the transaction in ctx has committed, or at once
+// if ctx carries none. fn is dropped when the transaction aborts, including
+// attempts WithinTx retries. Use it for side effects outside the database,
+// such as invalidating a cache, that must not be seen before the writes are.
+func AfterCommit(ctx context.Context, fn func()) {
+	if st, ok := ctx.Value(txKey{}).(*state); ok {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		st.hooks = append(st.hooks, fn)
+		return
+	}
+	fn()
+}
+
+// InTx reports whether ctx carries a transaction started by WithinTx.
+func InTx(ctx context.Context) bool {
+	_, ok := ctx.Value(txKey{}).(*state)
+	return ok
+}
+
+// MongoManager implements Manager with multi-document transactions, which
+// need a replica set or sharded cluster. A WithinTx call inside fn joins the
+// same transaction; if it fails, the outermost call aborts with
+// ErrNestedFailed even when fn handles the error.
+type MongoManager struct {
+	client *mongo.Client
+}
+
+func NewMongoManager(client *mongo.Client) *MongoManager {
+	return &MongoManager{client: client}
+}
+
+// Check returns ErrUnsupported unless the server m connects to can run
+// transactions, so that callers can refuse to start instead of failing
+// every write.
+func (m *MongoManager) Check(ctx context.Context) error {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := m.client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return err
+	}
+	// mongos answers with msg "isdbgrid".
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return ErrUnsupported
+	}
+	return nil
+}
+
+func (m *MongoManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if st, ok := ctx.Value(txKey{}).(*state); ok {
+		err := fn(ctx)
+		if err != nil {
+			st.nestedFailed.Store(true)
+		}
+		return err
+	}
+
+	sess, err := m.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(ctx)
+	// WithTransaction retries fn on transient errors, each time in a fresh
+	// transaction.
+	var st *state
+	_, err = sess.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		st = &state{}
+		if err := fn(context.WithValue(sc, txKey{}, st)); err != nil {
+			return nil, err
+		}
+		if st.nestedFailed.Load() {
+			return nil, ErrNestedFailed
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, fn := range st.hooks {
+		fn()
+	}
+	return nil
+}
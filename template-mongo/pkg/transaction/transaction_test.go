@@ -0,0 +1,189 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errTest = errors.New("test error")
+
+// newTestCollection connects to the replica set at TEST_MONGO_URI and
+// returns an empty collection, dropped after the test. Tests using it are
+// skipped when the variable is not set.
+func newTestCollection(t *testing.T) (*mongo.Client, *mongo.Collection) {
+	t.Helper()
+	uri := os.Getenv("TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGO_URI is not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	coll := client.Database("transaction_test").Collection("items")
+	// Collections cannot be created inside a transaction on older servers.
+	if err := coll.Database().CreateCollection(ctx, coll.Name()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		coll.Database().Drop(ctx)
+		client.Disconnect(ctx)
+	})
+	return client, coll
+}
+
+func TestMongoManager_Check(t *testing.T) {
+	client, _ := newTestCollection(t)
+	if err := NewMongoManager(client).Check(context.Background()); err != nil {
+		t.Errorf("expected the replica set to support transactions, got %v", err)
+	}
+}
+
+func insert(t *testing.T, ctx context.Context, coll *mongo.Collection, name string) {
+	t.Helper()
+	if _, err := coll.InsertOne(ctx, bson.M{"name": name}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func items(t *testing.T, coll *mongo.Collection) []string {
+	t.Helper()
+	ctx := context.Background()
+	cur, err := coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var docs []struct {
+		Name string `bson:"name"`
+	}
+	if err := cur.All(ctx, &docs); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, d := range docs {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+func TestMongoManager_WithinTx(t *testing.T) {
+	tests := []struct {
+		name     string
+		fn       func(t *testing.T, ctx context.Context, m *MongoManager, coll *mongo.Collection) error
+		expected []string
+		err      error
+	}{
+		{
+			name: "Commit",
+			fn: func(t *testing.T, ctx context.Context, m *MongoManager, coll *mongo.Collection) error {
+				insert(t, ctx, coll, "a")
+				insert(t, ctx, coll, "b")
+				return nil
+			},
+			expected: []string{"a", "b"},
+		},
+		{
+			name: "Rollback",
+			fn: func(t *testing.T, ctx context.Context, m *MongoManager, coll *mongo.Collection) error {
+				insert(t, ctx, coll, "a")
+				return errTest
+			},
+			err: errTest,
+		},
+		{
+			name: "NestedCommit",
+			fn: func(t *testing.T, ctx context.Context, m *MongoManager, coll *mongo.Collection) error {
+				insert(t, ctx, coll, "a")
+				return m.WithinTx(ctx, func(ctx context.Context) error {
+					insert(t, ctx, coll, "b")
+					return nil
+				})
+			},
+			expected: []string{"a", "b"},
+		},
+		{
+			name: "NestedFailureHandled",
+			fn: func(t *testing.T, ctx context.Context, m *MongoManager, coll *mongo.Collection) error {
+				insert(t, ctx, coll, "a")
+				err := m.WithinTx(ctx, func(ctx context.Context) error {
+					insert(t, ctx, coll, "b")
+					return errTest
+				})
+				if !errors.Is(err, errTest) {
+					t.Errorf("expected nested error, got %v", err)
+				}
+				return nil
+			},
+			err: ErrNestedFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, coll := newTestCollection(t)
+			m := NewMongoManager(client)
+
+			err := m.WithinTx(context.Background(), func(ctx context.Context) error {
+				return tt.fn(t, ctx, m, coll)
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if got := items(t, coll); !slices.Equal(got, tt.expected) {
+				t.Errorf("expected items %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAfterCommit(t *testing.T) {
+	var ran []string
+	record := func(name string) func() {
+		return func() { ran = append(ran, name) }
+	}
+
+	AfterCommit(context.Background(), record("outside"))
+	if !slices.Equal(ran, []string{"outside"}) {
+		t.Fatalf("expected the hook to run at once outside a transaction, got %v", ran)
+	}
+
+	client, _ := newTestCollection(t)
+	m := NewMongoManager(client)
+	ran = nil
+	err := m.WithinTx(context.Background(), func(ctx context.Context) error {
+		AfterCommit(ctx, record("outer"))
+		if err := m.WithinTx(ctx, func(ctx context.Context) error {
+			AfterCommit(ctx, record("nested"))
+			return nil
+		}); err != nil {
+			return err
+		}
+		if len(ran) != 0 {
+			t.Errorf("expected no hook to run before the commit, got %v", ran)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithinTx: %v", err)
+	}
+	if !slices.Equal(ran, []string{"outer", "nested"}) {
+		t.Errorf("expected the committed hooks to run in order, got %v", ran)
+	}
+
+	ran = nil
+	err = m.WithinTx(context.Background(), func(ctx context.Context) error {
+		AfterCommit(ctx, record("outer"))
+		return errTest
+	})
+	if !errors.Is(err, errTest) || len(ran) != 0 {
+		t.Errorf("expected no hook to run after a rollback, got %v (%v)", ran, err)
+	}
+}
@@ -0,0 +1,5 @@
+CREATE TABLE role_permissions (
+  role VARCHAR(64) NOT NULL,
+  permission VARCHAR(128) NOT NULL,
+  PRIMARY KEY (role, permission)
+);
@@ -0,0 +1 @@
+ALTER TABLE users DROP INDEX users_search_idx;
@@ -0,0 +1,3 @@
+-- InnoDB updates FULLTEXT indexes on commit, so search results follow writes
+-- to the users table without extra bookkeeping.
+ALTER TABLE users ADD FULLTEXT INDEX users_search_idx (name, email);
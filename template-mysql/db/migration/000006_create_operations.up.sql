@@ -0,0 +1,11 @@
+CREATE TABLE operations (
+  id CHAR(36) PRIMARY KEY,
+  kind VARCHAR(64) NOT NULL,
+  owner VARCHAR(255) NOT NULL DEFAULT '',
+  status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  progress INT NOT NULL DEFAULT 0,
+  result TEXT NULL,
+  error TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,19 @@
+CREATE TABLE outbox (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  aggregate_type VARCHAR(64) NOT NULL,
+  aggregate_id VARCHAR(255) NOT NULL,
+  event_type VARCHAR(64) NOT NULL,
+  payload JSON NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The single row names the relay currently publishing the outbox; another
+-- relay takes over once expires_at has passed. Microseconds make every
+-- renewal change the row, so it counts as affected.
+CREATE TABLE outbox_lease (
+  id INT PRIMARY KEY,
+  owner VARCHAR(64) NOT NULL DEFAULT '',
+  expires_at DATETIME(6) NOT NULL DEFAULT '1970-01-01 00:00:00'
+);
+
+INSERT INTO outbox_lease (id) VALUES (1);
@@ -0,0 +1,3 @@
+-- Fails if two tenants share an email.
+ALTER TABLE users DROP INDEX users_tenant_id_email_key, ADD UNIQUE INDEX email (email);
+ALTER TABLE users DROP COLUMN tenant_id;
@@ -0,0 +1,5 @@
+-- Users belong to a tenant, and emails are unique within one. Existing users
+-- move to the default tenant; new ones always name theirs.
+ALTER TABLE users ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default';
+ALTER TABLE users ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE users DROP INDEX email, ADD UNIQUE INDEX users_tenant_id_email_key (tenant_id, email);
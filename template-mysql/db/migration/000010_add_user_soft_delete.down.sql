@@ -0,0 +1,6 @@
+-- Deleted users are removed for good: they could clash with live users'
+-- emails.
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+DROP INDEX users_deleted_at_idx ON users;
+ALTER TABLE users DROP INDEX users_tenant_id_email_key, ADD UNIQUE INDEX users_tenant_id_email_key (tenant_id, email);
+ALTER TABLE users DROP COLUMN live_email, DROP COLUMN deleted_at;
@@ -0,0 +1,9 @@
+-- Deleted users keep their row until purged, so they can be restored. Emails
+-- only need to be unique among the users that are not deleted; MySQL has no
+-- partial indexes, so the unique index covers a generated column that is
+-- NULL for deleted users.
+ALTER TABLE users
+  ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL,
+  ADD COLUMN live_email VARCHAR(255) AS (IF(deleted_at IS NULL, email, NULL)) STORED;
+ALTER TABLE users DROP INDEX users_tenant_id_email_key, ADD UNIQUE INDEX users_tenant_id_email_key (tenant_id, live_email);
+CREATE INDEX users_deleted_at_idx ON users (deleted_at);
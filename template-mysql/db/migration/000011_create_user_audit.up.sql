@@ -0,0 +1,17 @@
+-- The history of changes to users, written by user.Service in the
+-- transaction of each change. before_state and after_state hold the user as
+-- JSON, or JSON null without one: sqlc scans JSON columns into
+-- json.RawMessage, which cannot hold SQL NULL. Entries are kept when their
+-- user is purged.
+CREATE TABLE user_audit (
+  id BIGINT AUTO_INCREMENT PRIMARY KEY,
+  tenant_id VARCHAR(63) NOT NULL,
+  user_id CHAR(36) NOT NULL,
+  action VARCHAR(64) NOT NULL,
+  actor VARCHAR(255) NOT NULL,
+  request_id VARCHAR(255) NOT NULL,
+  before_state JSON NOT NULL,
+  after_state JSON NOT NULL,
+  created_at DATETIME(6) NOT NULL,
+  INDEX user_audit_tenant_id_user_id_idx (tenant_id, user_id, id)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE webhook_deliveries DROP COLUMN tenant_id;
+ALTER TABLE webhook_subscriptions DROP INDEX webhook_subscriptions_tenant_idx, DROP COLUMN tenant_id;
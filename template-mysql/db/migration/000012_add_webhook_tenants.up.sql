@@ -0,0 +1,8 @@
+-- Webhook subscriptions belong to a tenant and receive only its events; each
+-- delivery keeps the tenant of its subscription. Existing rows move to the
+-- default tenant.
+ALTER TABLE webhook_subscriptions ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default',
+  ADD INDEX webhook_subscriptions_tenant_idx (tenant_id, created_at);
+ALTER TABLE webhook_subscriptions ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE webhook_deliveries ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default';
+ALTER TABLE webhook_deliveries ALTER COLUMN tenant_id DROP DEFAULT;
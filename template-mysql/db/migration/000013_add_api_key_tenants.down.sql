@@ -0,0 +1 @@
+ALTER TABLE api_keys DROP INDEX api_keys_tenant_idx, DROP COLUMN tenant_id;
@@ -0,0 +1,5 @@
+-- API keys belong to the tenant they were created in and are rejected on
+-- requests for any other. Existing keys move to the default tenant.
+ALTER TABLE api_keys ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default',
+  ADD INDEX api_keys_tenant_idx (tenant_id, created_at);
+ALTER TABLE api_keys ALTER COLUMN tenant_id DROP DEFAULT;
@@ -0,0 +1 @@
+DROP INDEX webhook_deliveries_event_idx ON webhook_deliveries;
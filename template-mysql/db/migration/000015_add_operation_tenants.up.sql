@@ -0,0 +1,4 @@
+-- Operations belong to the tenant they were started in and are found only
+-- from it. Existing operations move to the default tenant.
+ALTER TABLE operations ADD COLUMN tenant_id VARCHAR(63) NOT NULL DEFAULT 'default';
+ALTER TABLE operations ALTER COLUMN tenant_id DROP DEFAULT;
@@ -0,0 +1,83 @@
+// Package migration embeds the SQL migrations in this directory, which are
+// applied by pkg/migrate.
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/user/go-templates/template-mysql/pkg/migrate"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+// New opens the database at source with driver, "mysql", and returns a
+// Migrator for it. Migrations may hold several statements, so New enables
+// multiStatements on the connection.
+func New(driver, source string) (*migrate.Migrator, error) {
+	cfg, err := mysql.ParseDSN(source)
+	if err != nil {
+		return nil, err
+	}
+	cfg.MultiStatements = true
+	db, err := sql.Open(driver, cfg.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	m, err := migrate.New(db, migrate.MySQL, FS, migrate.Options{})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Up applies all pending migrations to the database at source.
+func Up(ctx context.Context, driver, source string) error {
+	m, err := New(driver, source)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	return m.Up(ctx)
+}
+
+// Verify compares the schema of the database at source with the one the
+// migrations produce, by applying them to a scratch database on the same
+// server that is dropped afterwards; this needs the CREATE and DROP
+// privileges. It returns the differences as migrate.Diff does.
+func Verify(ctx context.Context, driver, source string) ([]string, error) {
+	live, err := New(driver, source)
+	if err != nil {
+		return nil, err
+	}
+	defer live.Close()
+
+	db, err := sql.Open(driver, source)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	name := fmt.Sprintf("migrate_verify_%d", time.Now().UnixNano())
+	if _, err := db.ExecContext(ctx, "CREATE DATABASE "+name); err != nil {
+		return nil, err
+	}
+	defer db.ExecContext(context.WithoutCancel(ctx), "DROP DATABASE "+name)
+
+	cfg, err := mysql.ParseDSN(source)
+	if err != nil {
+		return nil, err
+	}
+	cfg.DBName = name
+	scratch, err := New(driver, cfg.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	defer scratch.Close()
+	return live.Verify(ctx, scratch)
+}
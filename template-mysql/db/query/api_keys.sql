@@ -0,0 +1,25 @@
+-- name: CreateAPIKey :execresult
+INSERT INTO api_keys (
+  id, tenant_id, name, prefix, key_hash, scopes, expires_at
+) VALUES (
+  ?, ?, ?, ?, ?, ?, ?
+);
+
+-- name: GetAPIKeyByHash :one
+SELECT * FROM api_keys
+WHERE key_hash = ? LIMIT 1;
+
+-- name: ListAPIKeys :many
+SELECT * FROM api_keys
+WHERE tenant_id = ?
+ORDER BY created_at DESC;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = ?
+WHERE id = ? AND tenant_id = ? AND revoked_at IS NULL;
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = sqlc.arg(last_used_at)
+WHERE id = sqlc.arg(id) AND (last_used_at IS NULL OR last_used_at < sqlc.arg(last_used_at));
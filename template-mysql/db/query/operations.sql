@@ -0,0 +1,15 @@
+-- name: CreateOperation :execresult
+INSERT INTO operations (
+  id, tenant_id, kind, owner, error
+) VALUES (
+  ?, ?, ?, ?, ''
+);
+
+-- name: GetOperation :one
+SELECT * FROM operations
+WHERE id = ? AND tenant_id = ? LIMIT 1;
+
+-- name: UpdateOperation :execrows
+UPDATE operations
+SET status = ?, progress = ?, result = ?, error = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND tenant_id = ? AND status IN ('pending', 'running');
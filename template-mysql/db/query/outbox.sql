@@ -0,0 +1,25 @@
+-- name: CreateOutboxMessage :execlastid
+INSERT INTO outbox (
+  aggregate_type, aggregate_id, event_type, payload, created_at
+) VALUES (
+  ?, ?, ?, ?, ?
+);
+
+-- name: ListOutboxMessages :many
+SELECT * FROM outbox
+ORDER BY id
+LIMIT ?;
+
+-- name: DeleteOutboxMessage :exec
+DELETE FROM outbox
+WHERE id = ?;
+
+-- name: AcquireOutboxLease :execrows
+UPDATE outbox_lease
+SET owner = sqlc.arg(owner), expires_at = sqlc.arg(expires_at)
+WHERE id = 1 AND (owner = sqlc.arg(owner) OR expires_at < sqlc.arg(now));
+
+-- name: ReleaseOutboxLease :exec
+UPDATE outbox_lease
+SET expires_at = '1970-01-01 00:00:00'
+WHERE id = 1 AND owner = ?;
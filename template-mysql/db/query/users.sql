@@ -1,10 +1,63 @@
 -- name: GetUser :one
 SELECT * FROM users
-WHERE id = ? LIMIT 1;
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL LIMIT 1;
+
+-- name: GetUserForUpdate :one
+SELECT * FROM users
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL
+FOR UPDATE;
 
 -- name: CreateUser :execresult
 INSERT INTO users (
-  id, name, email
+  id, tenant_id, name, email
+) VALUES (
+  ?, ?, ?, ?
+);
+
+-- name: UpdateUser :exec
+UPDATE users
+SET name = ?, email = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL;
+
+-- name: SoftDeleteUser :execrows
+UPDATE users
+SET deleted_at = CURRENT_TIMESTAMP
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL;
+
+-- name: ListDeletedUsers :many
+SELECT * FROM users
+WHERE tenant_id = ? AND deleted_at IS NOT NULL
+ORDER BY deleted_at DESC, id
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: RestoreUser :execrows
+UPDATE users
+SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NOT NULL;
+
+-- name: PurgeUsers :execrows
+DELETE FROM users
+WHERE deleted_at < ?;
+
+-- name: SearchUsers :many
+SELECT * FROM users
+WHERE tenant_id = sqlc.arg(tenant_id)
+  AND deleted_at IS NULL
+  AND (MATCH (name, email) AGAINST (sqlc.arg(terms) IN BOOLEAN MODE)
+       OR name LIKE sqlc.arg(pattern)
+       OR email LIKE sqlc.arg(pattern))
+ORDER BY MATCH (name, email) AGAINST (sqlc.arg(terms) IN BOOLEAN MODE) DESC, created_at DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: CreateUserAuditEntry :execlastid
+INSERT INTO user_audit (
+  tenant_id, user_id, action, actor, request_id, before_state, after_state, created_at
 ) VALUES (
-  ?, ?, ?
+  ?, ?, ?, ?, ?, ?, ?, ?
 );
+
+-- name: ListUserAuditEntries :many
+SELECT * FROM user_audit
+WHERE tenant_id = ? AND user_id = ?
+ORDER BY id DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
@@ -0,0 +1,55 @@
+-- name: CreateWebhookSubscription :execresult
+INSERT INTO webhook_subscriptions (
+  id, tenant_id, url, secret, events
+) VALUES (
+  ?, ?, ?, ?, ?
+);
+
+-- name: GetWebhookSubscription :one
+SELECT * FROM webhook_subscriptions
+WHERE id = ? AND tenant_id = ? LIMIT 1;
+
+-- name: ListWebhookSubscriptions :many
+SELECT * FROM webhook_subscriptions
+WHERE tenant_id = ?
+ORDER BY created_at DESC;
+
+-- name: DeleteWebhookSubscription :execrows
+DELETE FROM webhook_subscriptions
+WHERE id = ? AND tenant_id = ?;
+
+-- name: CreateWebhookDelivery :execresult
+INSERT INTO webhook_deliveries (
+  id, tenant_id, subscription_id, event_id, event_type, payload, next_attempt_at, last_error
+) VALUES (
+  ?, ?, ?, ?, ?, ?, ?, ''
+)
+ON DUPLICATE KEY UPDATE id = id;
+
+-- name: ListDueWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE status = 'pending' AND next_attempt_at <= ?
+ORDER BY next_attempt_at
+LIMIT ?
+FOR UPDATE SKIP LOCKED;
+
+-- name: ClaimWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET next_attempt_at = ?
+WHERE id = ?;
+
+-- name: UpdateWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ?, response_status = ?, delivered_at = ?
+WHERE id = ? AND tenant_id = ?;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE subscription_id = ? AND tenant_id = ?
+ORDER BY created_at DESC
+LIMIT ? OFFSET ?;
+
+-- name: RetryWebhookDelivery :execrows
+UPDATE webhook_deliveries
+SET status = 'pending', attempts = 0, next_attempt_at = ?
+WHERE id = ? AND subscription_id = ? AND tenant_id = ? AND status = 'dead';
@@ -0,0 +1,375 @@
+package apikey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/go-templates/template-mysql/pkg/auth"
+	"github.com/user/go-templates/template-mysql/pkg/authz"
+	"github.com/user/go-templates/template-mysql/pkg/idgen"
+	"github.com/user/go-templates/template-mysql/pkg/tenant"
+)
+
+// --- Mocks ---
+
+type mockRepository struct {
+	mu      sync.Mutex
+	keys    map[string]*APIKey
+	touched map[string]time.Time
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{
+		keys:    make(map[string]*APIKey),
+		touched: make(map[string]time.Time),
+	}
+}
+
+func (m *mockRepository) Create(ctx context.Context, key *APIKey) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	if key.ID == "" {
+		return errors.New("key has no ID")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Name the key after itself so the tests can refer to it.
+	key.ID = "key-" + key.Name
+	key.TenantID = tenantID
+	key.CreatedAt = time.Now()
+	m.keys[key.Hash] = key
+	return nil
+}
+
+func (m *mockRepository) GetByHash(ctx context.Context, hash string) (*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[hash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return key, nil
+}
+
+func (m *mockRepository) List(ctx context.Context) ([]*APIKey, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []*APIKey
+	for _, k := range m.keys {
+		if k.TenantID == tenantID {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
+func (m *mockRepository) Revoke(ctx context.Context, id string, at time.Time) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.keys {
+		if k.ID == id && k.TenantID == tenantID && k.RevokedAt == nil {
+			k.RevokedAt = &at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *mockRepository) Touch(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.touched[id] = at
+	return nil
+}
+
+// acme is the tenant the tests create keys in.
+var acme = tenant.NewContext(context.Background(), "acme")
+
+func newTestService(t *testing.T) (Service, *mockRepository, *UsageRecorder) {
+	t.Helper()
+	repo := newMockRepository()
+	usage := NewUsageRecorder(repo, time.Hour)
+	t.Cleanup(usage.Close)
+	return NewService(repo, idgen.UUIDv7{}, usage), repo, usage
+}
+
+// --- Service Tests ---
+
+func TestService_CreateKey(t *testing.T) {
+	svc, repo, _ := newTestService(t)
+	past := time.Now().Add(-time.Hour)
+
+	if _, _, err := svc.CreateKey(acme, "", nil, nil); err == nil {
+		t.Error("expected error for missing name")
+	}
+	if _, _, err := svc.CreateKey(acme, "ci", nil, &past); err == nil {
+		t.Error("expected error for expiry in the past")
+	}
+	if _, _, err := svc.CreateKey(context.Background(), "ci", nil, nil); !errors.Is(err, tenant.ErrMissing) {
+		t.Errorf("expected tenant.ErrMissing without a tenant, got %v", err)
+	}
+
+	key, plaintext, err := svc.CreateKey(acme, "ci", []string{"users:read"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(plaintext, keyPrefix) || !strings.HasPrefix(plaintext, key.Prefix) {
+		t.Errorf("unexpected plaintext %q for prefix %q", plaintext, key.Prefix)
+	}
+	if key.Hash == plaintext || strings.Contains(key.Hash, plaintext) {
+		t.Error("plaintext key must not be stored")
+	}
+	if _, err := repo.GetByHash(context.Background(), hashKey(plaintext)); err != nil {
+		t.Errorf("expected key to be stored by hash: %v", err)
+	}
+	if key.TenantID != "acme" {
+		t.Errorf("expected key bound to the acme tenant, got %q", key.TenantID)
+	}
+}
+
+func TestService_CreateKeyScopes(t *testing.T) {
+	svc, _, _ := newTestService(t)
+	a := authz.NewAuthorizer(authz.StaticRoles{"keys": {PermissionManage}}, 0)
+	ctx := authz.NewContext(acme, a)
+	ctx = auth.NewContext(ctx, &auth.Claims{Roles: []string{"keys"}, Scope: "users:read"})
+
+	for _, scope := range []string{"*", "users:*", "users:admin"} {
+		if _, _, err := svc.CreateKey(ctx, "ci", []string{scope}, nil); !errors.Is(err, authz.ErrPermissionDenied) {
+			t.Errorf("expected ErrPermissionDenied creating a key with %q, got %v", scope, err)
+		}
+	}
+	if _, _, err := svc.CreateKey(ctx, "ci", []string{"users:read", PermissionManage}, nil); err != nil {
+		t.Errorf("expected a key with the caller's own scopes, got %v", err)
+	}
+}
+
+func TestService_Authenticate(t *testing.T) {
+	svc, repo, usage := newTestService(t)
+	ctx := acme
+
+	_, valid, _ := svc.CreateKey(ctx, "valid", nil, nil)
+
+	expiring := time.Now().Add(time.Hour)
+	expiredKey, expired, _ := svc.CreateKey(ctx, "expired", nil, &expiring)
+	past := time.Now().Add(-time.Minute)
+	expiredKey.ExpiresAt = &past
+
+	revokedKey, revoked, _ := svc.CreateKey(ctx, "revoked", nil, nil)
+	if err := svc.RevokeKey(ctx, revokedKey.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		plaintext string
+		wantErr   error
+	}{
+		{name: "Valid", plaintext: valid},
+		{name: "Expired", plaintext: expired, wantErr: ErrInvalidKey},
+		{name: "Revoked", plaintext: revoked, wantErr: ErrInvalidKey},
+		{name: "Unknown", plaintext: keyPrefix + "deadbeef", wantErr: ErrInvalidKey},
+		{name: "WrongPrefix", plaintext: "nope", wantErr: ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Authenticate(ctx, tt.plaintext)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	usage.Close()
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if _, ok := repo.touched["key-valid"]; !ok || len(repo.touched) != 1 {
+		t.Errorf("expected only the valid key to be touched, got %v", repo.touched)
+	}
+}
+
+// --- Middleware Tests ---
+
+func TestMiddleware(t *testing.T) {
+	svc, _, _ := newTestService(t)
+	_, plaintext, _ := svc.CreateKey(acme, "ci", []string{"users:read", "users:write"}, nil)
+
+	tests := []struct {
+		name           string
+		header         string
+		value          string
+		expectedStatus int
+		expectSubject  string
+	}{
+		{name: "NoKey", expectedStatus: http.StatusOK},
+		{name: "AuthorizationHeader", header: "Authorization", value: "ApiKey " + plaintext, expectedStatus: http.StatusOK, expectSubject: "apikey:key-ci"},
+		{name: "XAPIKeyHeader", header: "X-API-Key", value: plaintext, expectedStatus: http.StatusOK, expectSubject: "apikey:key-ci"},
+		{name: "BearerIgnored", header: "Authorization", value: "Bearer token", expectedStatus: http.StatusOK},
+		{name: "InvalidKey", header: "X-API-Key", value: keyPrefix + "bogus", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var subject string
+			h := Middleware(svc)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if c, ok := auth.FromContext(r.Context()); ok {
+					subject = c.Subject
+					if len(c.Scopes()) != 2 {
+						t.Errorf("expected key scopes in claims, got %q", c.Scope)
+					}
+					if c.TenantID != "acme" {
+						t.Errorf("expected the key's tenant in claims, got %q", c.TenantID)
+					}
+				}
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if subject != tt.expectSubject {
+				t.Errorf("expected subject %q, got %q", tt.expectSubject, subject)
+			}
+		})
+	}
+}
+
+func TestMiddleware_Tenant(t *testing.T) {
+	svc, _, _ := newTestService(t)
+	_, plaintext, _ := svc.CreateKey(acme, "ci", nil, nil)
+
+	tests := []struct {
+		name           string
+		source         string
+		tenant         string
+		expectedStatus int
+		expectTenant   string
+	}{
+		{name: "SameTenant", source: tenant.SourceHeader, tenant: "acme", expectedStatus: http.StatusOK, expectTenant: "acme"},
+		{name: "OtherTenant", source: tenant.SourceHeader, tenant: "globex", expectedStatus: http.StatusForbidden},
+		{name: "Claim", source: tenant.SourceClaim, expectedStatus: http.StatusOK, expectTenant: "acme"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenantMiddleware, err := tenant.Middleware(tenant.Options{Source: tt.source})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var resolved string
+			h := Middleware(svc)(tenantMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				resolved, _ = tenant.FromContext(r.Context())
+			})))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-API-Key", plaintext)
+			if tt.tenant != "" {
+				req.Header.Set(tenant.DefaultHeader, tt.tenant)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if resolved != tt.expectTenant {
+				t.Errorf("expected tenant %q, got %q", tt.expectTenant, resolved)
+			}
+		})
+	}
+}
+
+// --- Handler Tests ---
+
+func TestHandler(t *testing.T) {
+	svc, _, _ := newTestService(t)
+
+	r := chi.NewRouter()
+	r.Use(authz.Middleware(authz.NewAuthorizer(authz.StaticRoles{"admin": {"*"}, "keys": {PermissionManage}}, 0)))
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := &auth.Claims{Roles: r.Header.Values("X-Test-Role")}
+			ctx := auth.NewContext(r.Context(), claims)
+			if id := r.Header.Get(tenant.DefaultHeader); id != "" {
+				ctx = tenant.NewContext(ctx, id)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	NewHandler(svc).RegisterRoutes(r)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		role           string
+		tenant         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "CreateForbidden", method: "POST", path: "/admin/api-keys", body: `{"name":"ci"}`, expectedStatus: http.StatusForbidden},
+		{name: "Create", method: "POST", path: "/admin/api-keys", body: `{"name":"ci","scopes":["users:read"]}`, role: "admin", expectedStatus: http.StatusCreated, expectedBody: `"key":"` + keyPrefix},
+		{name: "CreateInvalid", method: "POST", path: "/admin/api-keys", body: `{"name":`, role: "admin", expectedStatus: http.StatusBadRequest},
+		{name: "CreateWiderScope", method: "POST", path: "/admin/api-keys", body: `{"name":"root","scopes":["*"]}`, role: "keys", expectedStatus: http.StatusForbidden},
+		{name: "CreateOwnScope", method: "POST", path: "/admin/api-keys", body: `{"name":"rotate","scopes":["api_keys:manage"]}`, role: "keys", expectedStatus: http.StatusCreated},
+		{name: "List", method: "GET", path: "/admin/api-keys", role: "admin", expectedStatus: http.StatusOK, expectedBody: `"name":"ci"`},
+		{name: "ListOtherTenant", method: "GET", path: "/admin/api-keys", role: "admin", tenant: "globex", expectedStatus: http.StatusOK, expectedBody: `[]`},
+		{name: "RevokeOtherTenant", method: "DELETE", path: "/admin/api-keys/key-ci", role: "admin", tenant: "globex", expectedStatus: http.StatusNotFound},
+		{name: "MissingTenant", method: "GET", path: "/admin/api-keys", role: "admin", tenant: "-", expectedStatus: http.StatusBadRequest},
+		{name: "Revoke", method: "DELETE", path: "/admin/api-keys/key-ci", role: "admin", expectedStatus: http.StatusNoContent},
+		{name: "RevokeAgain", method: "DELETE", path: "/admin/api-keys/key-ci", role: "admin", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if tt.role != "" {
+				req.Header.Set("X-Test-Role", tt.role)
+			}
+			switch tt.tenant {
+			case "":
+				req.Header.Set(tenant.DefaultHeader, "acme")
+			case "-":
+			default:
+				req.Header.Set(tenant.DefaultHeader, tt.tenant)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedBody != "" && !strings.Contains(w.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedBody, w.Body.String())
+			}
+			if strings.Contains(w.Body.String(), `"Hash"`) {
+				t.Error("key hash must not be serialised")
+			}
+		})
+	}
+}
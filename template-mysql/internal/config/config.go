@@ -2,15 +2,26 @@ package config
 
 import (
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	App    AppConfig    `mapstructure:"app"`
-	Server ServerConfig `mapstructure:"server"`
-	Log    LogConfig    `mapstructure:"log"`
-	DB     DBConfig     `mapstructure:"db"`
+	App        AppConfig        `mapstructure:"app"`
+	Server     ServerConfig     `mapstructure:"server"`
+	Log        LogConfig        `mapstructure:"log"`
+	Events     EventsConfig     `mapstructure:"events"`
+	Webhooks   WebhooksConfig   `mapstructure:"webhooks"`
+	Operations OperationsConfig `mapstructure:"operations"`
+	Outbox     OutboxConfig     `mapstructure:"outbox"`
+	UserCache  UserCacheConfig  `mapstructure:"user_cache"`
+	UserTrash  UserTrashConfig  `mapstructure:"user_trash"`
+	IDs        IDsConfig        `mapstructure:"ids"`
+	Auth       AuthConfig       `mapstructure:"auth"`
+	Authz      AuthzConfig      `mapstructure:"authz"`
+	Tenancy    TenancyConfig    `mapstructure:"tenancy"`
+	DB         DBConfig         `mapstructure:"db"`
 }
 
 type AppConfig struct {
@@ -19,16 +30,231 @@ type AppConfig struct {
 }
 
 type ServerConfig struct {
-	Port string `mapstructure:"port"`
+	Port            string                `mapstructure:"port"`
+	ShutdownTimeout time.Duration         `mapstructure:"shutdown_timeout"`
+	H2C             bool                  `mapstructure:"h2c"`
+	TLS             TLSConfig             `mapstructure:"tls"`
+	CORS            CORSConfig            `mapstructure:"cors"`
+	SecurityHeaders SecurityHeadersConfig `mapstructure:"security_headers"`
+	BodyLimit       BodyLimitConfig       `mapstructure:"body_limit"`
+	Compression     CompressionConfig     `mapstructure:"compression"`
+	Batch           BatchConfig           `mapstructure:"batch"`
+	Cache           CacheConfig           `mapstructure:"cache"`
+}
+
+type TLSConfig struct {
+	// CertFile and KeyFile enable TLS. They are reloaded when they change,
+	// checked at most every ReloadInterval.
+	CertFile       string        `mapstructure:"cert_file"`
+	KeyFile        string        `mapstructure:"key_file"`
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+	// ClientCAFile requires clients to present a certificate signed by one
+	// of its CAs (mutual TLS).
+	ClientCAFile string `mapstructure:"client_ca_file"`
+}
+
+type CORSConfig struct {
+	// AllowedOrigins may contain "*" or wildcard subdomain patterns such as
+	// "https://*.example.com". Leave empty to disable CORS.
+	AllowedOrigins   []string      `mapstructure:"allowed_origins"`
+	AllowedMethods   []string      `mapstructure:"allowed_methods"`
+	AllowedHeaders   []string      `mapstructure:"allowed_headers"`
+	ExposedHeaders   []string      `mapstructure:"exposed_headers"`
+	AllowCredentials bool          `mapstructure:"allow_credentials"`
+	MaxAge           time.Duration `mapstructure:"max_age"`
+}
+
+type SecurityHeadersConfig struct {
+	// HSTSMaxAge enables Strict-Transport-Security when positive.
+	HSTSMaxAge            time.Duration `mapstructure:"hsts_max_age"`
+	HSTSIncludeSubdomains bool          `mapstructure:"hsts_include_subdomains"`
+	ContentSecurityPolicy string        `mapstructure:"content_security_policy"`
+	ReferrerPolicy        string        `mapstructure:"referrer_policy"`
+}
+
+type BodyLimitConfig struct {
+	// Default is the maximum request body size in bytes; zero disables it.
+	Default int64        `mapstructure:"default"`
+	Routes  []RouteLimit `mapstructure:"routes"`
+}
+
+type RouteLimit struct {
+	// Route is a chi route pattern, optionally prefixed with a method, e.g.
+	// "POST /api/v1/users".
+	Route string `mapstructure:"route"`
+	Limit int64  `mapstructure:"limit"`
+}
+
+// Limits returns the per-route limits keyed by route.
+func (c BodyLimitConfig) Limits() map[string]int64 {
+	limits := make(map[string]int64, len(c.Routes))
+	for _, rl := range c.Routes {
+		limits[rl.Route] = rl.Limit
+	}
+	return limits
+}
+
+type CompressionConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MinSize is the smallest response in bytes worth compressing.
+	MinSize int `mapstructure:"min_size"`
+}
+
+type BatchConfig struct {
+	MaxOperations int `mapstructure:"max_operations"`
+	// Concurrency is how many operations of a non-atomic batch run at once.
+	Concurrency int `mapstructure:"concurrency"`
+	// Timeout bounds each operation.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+type CacheConfig struct {
+	// Control is the Cache-Control of successful GET responses on routes
+	// without an entry in Routes; empty sends none.
+	Control string              `mapstructure:"control"`
+	Routes  []RouteCacheControl `mapstructure:"routes"`
+
+	// Enabled turns on the in-memory response cache for user routes.
+	Enabled       bool          `mapstructure:"enabled"`
+	MaxBytes      int64         `mapstructure:"max_bytes"`
+	MaxEntryBytes int64         `mapstructure:"max_entry_bytes"`
+	TTL           time.Duration `mapstructure:"ttl"`
+}
+
+type RouteCacheControl struct {
+	// Route is a chi route pattern, optionally prefixed with a method, e.g.
+	// "GET /api/v1/users/{id}".
+	Route   string `mapstructure:"route"`
+	Control string `mapstructure:"control"`
+}
+
+// Controls returns the per-route Cache-Control values keyed by route.
+func (c CacheConfig) Controls() map[string]string {
+	controls := make(map[string]string, len(c.Routes))
+	for _, rc := range c.Routes {
+		controls[rc.Route] = rc.Control
+	}
+	return controls
 }
 
 type LogConfig struct {
 	Level string `mapstructure:"level"`
 }
 
+type EventsConfig struct {
+	// History is the number of recent user events kept for clients resuming
+	// with Last-Event-ID.
+	History int `mapstructure:"history"`
+	// Buffer is the number of events queued per connection; clients that fall
+	// further behind are disconnected and resume when they reconnect.
+	Buffer    int           `mapstructure:"buffer"`
+	Heartbeat time.Duration `mapstructure:"heartbeat"`
+}
+
+type WebhooksConfig struct {
+	// Interval between polls for due deliveries.
+	Interval time.Duration `mapstructure:"interval"`
+	// MaxAttempts after which a failing delivery is dead-lettered.
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// Backoff is the delay after the first failed attempt; it doubles with
+	// every further attempt up to MaxBackoff.
+	Backoff    time.Duration `mapstructure:"backoff"`
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+}
+
+type OperationsConfig struct {
+	// Workers is the number of background operations run at once.
+	Workers int `mapstructure:"workers"`
+	// Queue is the number of operations that may wait for a worker; starting
+	// more is answered with 503.
+	Queue int `mapstructure:"queue"`
+}
+
+type OutboxConfig struct {
+	// Interval between polls of the outbox for events to publish.
+	Interval  time.Duration `mapstructure:"interval"`
+	BatchSize int           `mapstructure:"batch_size"`
+	// Lease is how long a relay stays the only publisher without renewing;
+	// another instance takes over once it expires.
+	Lease time.Duration `mapstructure:"lease"`
+}
+
+type UserCacheConfig struct {
+	// Backend holding users read by ID: "memory", "redis", or empty to read
+	// every user from the database.
+	Backend string        `mapstructure:"backend"`
+	TTL     time.Duration `mapstructure:"ttl"`
+	// NotFoundTTL is how long an ID without a user is remembered as missing.
+	NotFoundTTL time.Duration `mapstructure:"not_found_ttl"`
+	// MaxEntries bounds the users the memory backend holds.
+	MaxEntries int         `mapstructure:"max_entries"`
+	Redis      RedisConfig `mapstructure:"redis"`
+}
+
+type UserTrashConfig struct {
+	// Retention is how long deleted users can be restored before they are
+	// purged.
+	Retention     time.Duration `mapstructure:"retention"`
+	PurgeInterval time.Duration `mapstructure:"purge_interval"`
+}
+
+type RedisConfig struct {
+	Addr     string `mapstructure:"addr"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+}
+
+type IDsConfig struct {
+	// Strategy generating the IDs of new users: "uuidv7", "uuidv4" or
+	// "ulid". Empty is "uuidv7".
+	Strategy string `mapstructure:"strategy"`
+}
+
+type AuthConfig struct {
+	Issuer    string        `mapstructure:"issuer"`
+	Audience  string        `mapstructure:"audience"`
+	ClockSkew time.Duration `mapstructure:"clock_skew"`
+
+	// JWKS is a URL or file path of a JSON Web Key Set.
+	JWKS        string        `mapstructure:"jwks"`
+	JWKSRefresh time.Duration `mapstructure:"jwks_refresh"`
+
+	// Local keys, used when no JWKS is configured.
+	HMACSecret    string `mapstructure:"hmac_secret"`
+	PublicKeyFile string `mapstructure:"public_key_file"`
+}
+
+type AuthzConfig struct {
+	// Source of the role → permission mapping: "config" uses Roles below,
+	// "database" reads it from the database.
+	Source  string              `mapstructure:"source"`
+	Refresh time.Duration       `mapstructure:"refresh"`
+	Roles   map[string][]string `mapstructure:"roles"`
+}
+
+type TenancyConfig struct {
+	// Source of the tenant of a request: "header", "claim", "subdomain", or
+	// empty to put every request in Default.
+	Source string `mapstructure:"source"`
+	Header string `mapstructure:"header"`
+	// Domain is the parent domain of tenant subdomains.
+	Domain string `mapstructure:"domain"`
+	// Default is the tenant of requests the source names none for; empty
+	// rejects them.
+	Default string `mapstructure:"default"`
+}
+
 type DBConfig struct {
 	Driver string `mapstructure:"driver"`
 	Source string `mapstructure:"source"`
+	// AutoMigrate applies pending migrations at startup.
+	AutoMigrate bool `mapstructure:"auto_migrate"`
+	// Replicas are sources of read replicas of Source, which user reads are
+	// spread over.
+	Replicas []string `mapstructure:"replicas"`
+	// ReplicaHealthInterval between health checks of each replica.
+	ReplicaHealthInterval time.Duration `mapstructure:"replica_health_interval"`
 }
 
 func LoadConfig(path string) (*Config, error) {
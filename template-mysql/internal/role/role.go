@@ -0,0 +1,40 @@
+// Package role loads the role → permission mapping used by pkg/authz from
+// the database, so operators can change grants without a redeploy.
+package role
+
+import (
+	"context"
+	"database/sql"
+
+	repository "github.com/user/go-templates/template-mysql/internal/role/sqlc"
+	"github.com/user/go-templates/template-mysql/pkg/logger"
+)
+
+// --- MySQL Repository ---
+
+// MysqlRepository reads role grants from the role_permissions table. It
+// implements authz.Store.
+type MysqlRepository struct {
+	q *repository.Queries
+}
+
+func NewMysqlRepository(db *sql.DB) *MysqlRepository {
+	return &MysqlRepository{
+		q: repository.New(db),
+	}
+}
+
+func (r *MysqlRepository) RolePermissions(ctx context.Context) (map[string][]string, error) {
+	logger.FromContext(ctx).Debug("querying role permissions")
+
+	rows, err := r.q.ListRolePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string][]string)
+	for _, row := range rows {
+		roles[row.Role] = append(roles[row.Role], row.Permission)
+	}
+	return roles, nil
+}
@@ -5,12 +5,97 @@
 package repository
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
 )
 
+type ApiKey struct {
+	ID         string       `json:"id"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	KeyHash    string       `json:"key_hash"`
+	Scopes     string       `json:"scopes"`
+	ExpiresAt  sql.NullTime `json:"expires_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+type Operation struct {
+	ID        string         `json:"id"`
+	Kind      string         `json:"kind"`
+	Owner     string         `json:"owner"`
+	Status    string         `json:"status"`
+	Progress  int32          `json:"progress"`
+	Result    sql.NullString `json:"result"`
+	Error     string         `json:"error"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+type Outbox struct {
+	ID            int64           `json:"id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	EventType     string          `json:"event_type"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+type OutboxLease struct {
+	ID        int32     `json:"id"`
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type RolePermission struct {
+	Role       string `json:"role"`
+	Permission string `json:"permission"`
+}
+
 type User struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Email     string         `json:"email"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	TenantID  string         `json:"tenant_id"`
+	DeletedAt sql.NullTime   `json:"deleted_at"`
+	LiveEmail sql.NullString `json:"live_email"`
+}
+
+type UserAudit struct {
+	ID          int64           `json:"id"`
+	TenantID    string          `json:"tenant_id"`
+	UserID      string          `json:"user_id"`
+	Action      string          `json:"action"`
+	Actor       string          `json:"actor"`
+	RequestID   string          `json:"request_id"`
+	BeforeState json.RawMessage `json:"before_state"`
+	AfterState  json.RawMessage `json:"after_state"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastError      string          `json:"last_error"`
+	ResponseStatus int32           `json:"response_status"`
+	DeliveredAt    sql.NullTime    `json:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+type WebhookSubscription struct {
 	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
+	Url       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	Events    string    `json:"events"`
 	CreatedAt time.Time `json:"created_at"`
 }
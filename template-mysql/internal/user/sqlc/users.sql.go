@@ -8,39 +8,349 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"time"
 )
 
 const createUser = `-- name: CreateUser :execresult
 INSERT INTO users (
-  id, name, email
+  id, tenant_id, name, email
 ) VALUES (
-  ?, ?, ?
+  ?, ?, ?, ?
 )
 `
 
 type CreateUserParams struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (sql.Result, error) {
-	return q.db.ExecContext(ctx, createUser, arg.ID, arg.Name, arg.Email)
+	return q.db.ExecContext(ctx, createUser,
+		arg.ID,
+		arg.TenantID,
+		arg.Name,
+		arg.Email,
+	)
+}
+
+const createUserAuditEntry = `-- name: CreateUserAuditEntry :execlastid
+INSERT INTO user_audit (
+  tenant_id, user_id, action, actor, request_id, before_state, after_state, created_at
+) VALUES (
+  ?, ?, ?, ?, ?, ?, ?, ?
+)
+`
+
+type CreateUserAuditEntryParams struct {
+	TenantID    string          `json:"tenant_id"`
+	UserID      string          `json:"user_id"`
+	Action      string          `json:"action"`
+	Actor       string          `json:"actor"`
+	RequestID   string          `json:"request_id"`
+	BeforeState json.RawMessage `json:"before_state"`
+	AfterState  json.RawMessage `json:"after_state"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+func (q *Queries) CreateUserAuditEntry(ctx context.Context, arg CreateUserAuditEntryParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createUserAuditEntry,
+		arg.TenantID,
+		arg.UserID,
+		arg.Action,
+		arg.Actor,
+		arg.RequestID,
+		arg.BeforeState,
+		arg.AfterState,
+		arg.CreatedAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, name, email, created_at FROM users
-WHERE id = ? LIMIT 1
+SELECT id, name, email, created_at, updated_at, tenant_id, deleted_at, live_email FROM users
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL LIMIT 1
 `
 
-func (q *Queries) GetUser(ctx context.Context, id string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUser, id)
+type GetUserParams struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+}
+
+func (q *Queries) GetUser(ctx context.Context, arg GetUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUser, arg.ID, arg.TenantID)
 	var i User
 	err := row.Scan(
 		&i.ID,
 		&i.Name,
 		&i.Email,
 		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
+		&i.DeletedAt,
+		&i.LiveEmail,
 	)
 	return i, err
 }
+
+const getUserForUpdate = `-- name: GetUserForUpdate :one
+SELECT id, name, email, created_at, updated_at, tenant_id, deleted_at, live_email FROM users
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL
+FOR UPDATE
+`
+
+type GetUserForUpdateParams struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+}
+
+func (q *Queries) GetUserForUpdate(ctx context.Context, arg GetUserForUpdateParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserForUpdate, arg.ID, arg.TenantID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
+		&i.DeletedAt,
+		&i.LiveEmail,
+	)
+	return i, err
+}
+
+const listDeletedUsers = `-- name: ListDeletedUsers :many
+SELECT id, name, email, created_at, updated_at, tenant_id, deleted_at, live_email FROM users
+WHERE tenant_id = ? AND deleted_at IS NOT NULL
+ORDER BY deleted_at DESC, id
+LIMIT ? OFFSET ?
+`
+
+type ListDeletedUsersParams struct {
+	TenantID  string `json:"tenant_id"`
+	RowLimit  int32  `json:"row_limit"`
+	RowOffset int32  `json:"row_offset"`
+}
+
+func (q *Queries) ListDeletedUsers(ctx context.Context, arg ListDeletedUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listDeletedUsers, arg.TenantID, arg.RowLimit, arg.RowOffset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Email,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.TenantID,
+			&i.DeletedAt,
+			&i.LiveEmail,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserAuditEntries = `-- name: ListUserAuditEntries :many
+SELECT id, tenant_id, user_id, action, actor, request_id, before_state, after_state, created_at FROM user_audit
+WHERE tenant_id = ? AND user_id = ?
+ORDER BY id DESC
+LIMIT ? OFFSET ?
+`
+
+type ListUserAuditEntriesParams struct {
+	TenantID  string `json:"tenant_id"`
+	UserID    string `json:"user_id"`
+	RowLimit  int32  `json:"row_limit"`
+	RowOffset int32  `json:"row_offset"`
+}
+
+func (q *Queries) ListUserAuditEntries(ctx context.Context, arg ListUserAuditEntriesParams) ([]UserAudit, error) {
+	rows, err := q.db.QueryContext(ctx, listUserAuditEntries,
+		arg.TenantID,
+		arg.UserID,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserAudit
+	for rows.Next() {
+		var i UserAudit
+		if err := rows.Scan(
+			&i.ID,
+			&i.TenantID,
+			&i.UserID,
+			&i.Action,
+			&i.Actor,
+			&i.RequestID,
+			&i.BeforeState,
+			&i.AfterState,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeUsers = `-- name: PurgeUsers :execrows
+DELETE FROM users
+WHERE deleted_at < ?
+`
+
+func (q *Queries) PurgeUsers(ctx context.Context, deletedAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeUsers, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreUser = `-- name: RestoreUser :execrows
+UPDATE users
+SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NOT NULL
+`
+
+type RestoreUserParams struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+}
+
+func (q *Queries) RestoreUser(ctx context.Context, arg RestoreUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, restoreUser, arg.ID, arg.TenantID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT id, name, email, created_at, updated_at, tenant_id, deleted_at, live_email FROM users
+WHERE tenant_id = ?
+  AND deleted_at IS NULL
+  AND (MATCH (name, email) AGAINST (? IN BOOLEAN MODE)
+       OR name LIKE ?
+       OR email LIKE ?)
+ORDER BY MATCH (name, email) AGAINST (? IN BOOLEAN MODE) DESC, created_at DESC
+LIMIT ? OFFSET ?
+`
+
+type SearchUsersParams struct {
+	TenantID  string `json:"tenant_id"`
+	Terms     string `json:"terms"`
+	Pattern   string `json:"pattern"`
+	RowLimit  int32  `json:"row_limit"`
+	RowOffset int32  `json:"row_offset"`
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, searchUsers,
+		arg.TenantID,
+		arg.Terms,
+		arg.Pattern,
+		arg.Pattern,
+		arg.Terms,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Email,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.TenantID,
+			&i.DeletedAt,
+			&i.LiveEmail,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const softDeleteUser = `-- name: SoftDeleteUser :execrows
+UPDATE users
+SET deleted_at = CURRENT_TIMESTAMP
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL
+`
+
+type SoftDeleteUserParams struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+}
+
+func (q *Queries) SoftDeleteUser(ctx context.Context, arg SoftDeleteUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, softDeleteUser, arg.ID, arg.TenantID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateUser = `-- name: UpdateUser :exec
+UPDATE users
+SET name = ?, email = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL
+`
+
+type UpdateUserParams struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+}
+
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) error {
+	_, err := q.db.ExecContext(ctx, updateUser,
+		arg.Name,
+		arg.Email,
+		arg.ID,
+		arg.TenantID,
+	)
+	return err
+}
@@ -0,0 +1,242 @@
+// Package stream pushes user change events to clients over Server-Sent Events
+// and WebSocket. Events come from the broker user.Service publishes to; each
+// carries the broker's sequence number so clients can resume after a
+// reconnect. Clients only receive the events of their own tenant.
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/user/go-templates/template-mysql/internal/user"
+	"github.com/user/go-templates/template-mysql/pkg/authz"
+	"github.com/user/go-templates/template-mysql/pkg/broker"
+	"github.com/user/go-templates/template-mysql/pkg/cors"
+	"github.com/user/go-templates/template-mysql/pkg/logger"
+	"github.com/user/go-templates/template-mysql/pkg/tenant"
+	"go.uber.org/zap"
+)
+
+// DefaultHeartbeat is used when Options.Heartbeat is zero.
+const DefaultHeartbeat = 15 * time.Second
+
+// EventReset tells clients that events were missed while they were away and
+// they should reload the users they track.
+const EventReset = "reset"
+
+const writeTimeout = 10 * time.Second
+
+// Options configures the handler.
+type Options struct {
+	// Heartbeat is the interval of SSE comments and WebSocket pings that keep
+	// idle connections open through proxies.
+	Heartbeat time.Duration
+	// AllowedOrigins lists origins that may open WebSocket connections, in
+	// the format of cors.Options.AllowedOrigins. Empty allows same-origin
+	// requests only.
+	AllowedOrigins []string
+}
+
+// Message is the WebSocket representation of an event.
+type Message struct {
+	ID uint64 `json:"id,omitempty"`
+	user.Event
+}
+
+type Handler struct {
+	events    *broker.Broker[user.Event]
+	heartbeat time.Duration
+	upgrader  websocket.Upgrader
+}
+
+func NewHandler(events *broker.Broker[user.Event], opts Options) *Handler {
+	h := &Handler{
+		events:    events,
+		heartbeat: opts.Heartbeat,
+	}
+	if h.heartbeat <= 0 {
+		h.heartbeat = DefaultHeartbeat
+	}
+	if len(opts.AllowedOrigins) > 0 {
+		h.upgrader.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || cors.OriginAllowed(opts.AllowedOrigins, origin)
+		}
+	}
+	return h
+}
+
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(authz.Require(user.PermissionAdmin))
+		r.Get("/users/events", h.ServeSSE)
+		r.Get("/users/events/ws", h.ServeWebSocket)
+	})
+}
+
+// lastEventID reads the resume position from the Last-Event-ID header, which
+// EventSource sends on reconnect, or the last_event_id query parameter.
+func lastEventID(r *http.Request) (uint64, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	if v == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid last event id %q", v)
+	}
+	return id, nil
+}
+
+// ServeSSE streams events as text/event-stream until the client disconnects,
+// falls behind or the server shuts down. Clients that fell behind reconnect
+// and resume from their Last-Event-ID.
+func (h *Handler) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	lastID, err := lastEventID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tenantID, _ := tenant.FromContext(r.Context())
+	sub := h.events.Subscribe(lastID)
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", 3*time.Second/time.Millisecond)
+	if sub.Gap {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", EventReset)
+	}
+	if err := rc.Flush(); err != nil {
+		logger.FromContext(r.Context()).Error("event stream not supported", zap.Error(err))
+		return
+	}
+
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				logger.FromContext(r.Context()).Debug("event stream ended", zap.Error(sub.Err()))
+				return
+			}
+			if e.Data.User.TenantID != tenantID {
+				continue
+			}
+			data, err := json.Marshal(e.Data)
+			if err != nil {
+				logger.FromContext(r.Context()).Error("encoding event", zap.Error(err))
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Data.Type, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// ServeWebSocket streams events as JSON text messages. Messages from the
+// client are ignored apart from control frames. The connection is closed with
+// 1013 (try again later) when the client falls behind and 1001 (going away)
+// on shutdown.
+func (h *Handler) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	lastID, err := lastEventID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Subscribe first so no event published after the handshake is missed.
+	tenantID, _ := tenant.FromContext(r.Context())
+	sub := h.events.Subscribe(lastID)
+	defer sub.Close()
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied to the client.
+		return
+	}
+	defer conn.Close()
+
+	// Reading is required to process pings, pongs and close frames; a client
+	// that stops answering pings is dropped once the read deadline passes.
+	closed := make(chan struct{})
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(2 * h.heartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * h.heartbeat))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(m Message) error {
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		return conn.WriteJSON(m)
+	}
+
+	if sub.Gap {
+		if err := write(Message{Event: user.Event{Type: EventReset}}); err != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				code, text := websocket.CloseGoingAway, "server shutting down"
+				if errors.Is(sub.Err(), broker.ErrLagged) {
+					code, text = websocket.CloseTryAgainLater, "client fell behind"
+				}
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(writeTimeout))
+				return
+			}
+			if e.Data.User.TenantID != tenantID {
+				continue
+			}
+			if err := write(Message{ID: e.ID, Event: e.Data}); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
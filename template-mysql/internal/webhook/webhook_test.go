@@ -0,0 +1,592 @@
+package webhook_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/go-templates/template-mysql/internal/user"
+	"github.com/user/go-templates/template-mysql/internal/webhook"
+	"github.com/user/go-templates/template-mysql/internal/webhook/webhooktest"
+	"github.com/user/go-templates/template-mysql/pkg/auth"
+	"github.com/user/go-templates/template-mysql/pkg/authz"
+	"github.com/user/go-templates/template-mysql/pkg/idgen"
+	"github.com/user/go-templates/template-mysql/pkg/tenant"
+)
+
+// --- Mocks ---
+
+type mockRepository struct {
+	mu         sync.Mutex
+	seq        int
+	subs       map[string]*webhook.Subscription
+	deliveries []*webhook.Delivery
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{subs: make(map[string]*webhook.Subscription)}
+}
+
+// acme is the tenant the tests act for unless they say otherwise.
+var acme = tenant.NewContext(context.Background(), "acme")
+
+func requireTenant(ctx context.Context) (string, error) {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return "", tenant.ErrMissing
+	}
+	return id, nil
+}
+
+// nextID numbers what the mock stores so the tests can refer to it.
+func (m *mockRepository) nextID(prefix string) string {
+	m.seq++
+	return prefix + strconv.Itoa(m.seq)
+}
+
+func (m *mockRepository) CreateSubscription(ctx context.Context, sub *webhook.Subscription) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub.ID = m.nextID("sub-")
+	sub.TenantID = tenantID
+	sub.CreatedAt = time.Now()
+	c := *sub
+	m.subs[sub.ID] = &c
+	return nil
+}
+
+func (m *mockRepository) GetSubscription(ctx context.Context, id string) (*webhook.Subscription, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub, ok := m.subs[id]
+	if !ok || sub.TenantID != tenantID {
+		return nil, webhook.ErrNotFound
+	}
+	c := *sub
+	return &c, nil
+}
+
+func (m *mockRepository) ListSubscriptions(ctx context.Context) ([]*webhook.Subscription, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var subs []*webhook.Subscription
+	for _, sub := range m.subs {
+		if sub.TenantID != tenantID {
+			continue
+		}
+		c := *sub
+		subs = append(subs, &c)
+	}
+	return subs, nil
+}
+
+func (m *mockRepository) DeleteSubscription(ctx context.Context, id string) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if sub, ok := m.subs[id]; !ok || sub.TenantID != tenantID {
+		return webhook.ErrNotFound
+	}
+	delete(m.subs, id)
+	return nil
+}
+
+func (m *mockRepository) CreateDelivery(ctx context.Context, d *webhook.Delivery) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.deliveries {
+		if existing.SubscriptionID == d.SubscriptionID && existing.EventID == d.EventID {
+			return nil
+		}
+	}
+	d.ID = m.nextID("dlv-")
+	d.TenantID = tenantID
+	d.CreatedAt = time.Now()
+	c := *d
+	m.deliveries = append(m.deliveries, &c)
+	return nil
+}
+
+func (m *mockRepository) ClaimDueDeliveries(ctx context.Context, now, until time.Time, limit int) ([]*webhook.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []*webhook.Delivery
+	for _, d := range m.deliveries {
+		if d.Status == webhook.StatusPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	claimed := make([]*webhook.Delivery, 0, len(due))
+	for _, d := range due {
+		d.NextAttemptAt = until
+		c := *d
+		claimed = append(claimed, &c)
+	}
+	return claimed, nil
+}
+
+func (m *mockRepository) UpdateDelivery(ctx context.Context, d *webhook.Delivery) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, existing := range m.deliveries {
+		if existing.ID == d.ID && existing.TenantID == tenantID {
+			c := *d
+			m.deliveries[i] = &c
+			return nil
+		}
+	}
+	return webhook.ErrNotFound
+}
+
+func (m *mockRepository) ListDeliveries(ctx context.Context, subscriptionID string, limit, offset int) ([]*webhook.Delivery, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []*webhook.Delivery
+	for i := len(m.deliveries) - 1; i >= 0; i-- {
+		if d := m.deliveries[i]; d.SubscriptionID == subscriptionID && d.TenantID == tenantID {
+			c := *d
+			list = append(list, &c)
+		}
+	}
+	if offset >= len(list) {
+		return nil, nil
+	}
+	list = list[offset:]
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (m *mockRepository) RetryDelivery(ctx context.Context, subscriptionID, id string, at time.Time) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.deliveries {
+		if d.ID == id && d.SubscriptionID == subscriptionID && d.TenantID == tenantID && d.Status == webhook.StatusDead {
+			d.Status = webhook.StatusPending
+			d.Attempts = 0
+			d.NextAttemptAt = at
+			return nil
+		}
+	}
+	return webhook.ErrNotFound
+}
+
+// delivery returns the stored state of the delivery with the given index.
+func (m *mockRepository) delivery(i int) webhook.Delivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.deliveries[i]
+}
+
+// makeDue moves every pending delivery's next attempt into the past.
+func (m *mockRepository) makeDue() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.deliveries {
+		d.NextAttemptAt = time.Now().Add(-time.Second)
+	}
+}
+
+// newWorker returns a worker that only runs when ProcessDue is called.
+func newWorker(t *testing.T, repo webhook.Repository, opts webhook.WorkerOptions) *webhook.Worker {
+	t.Helper()
+	opts.Interval = time.Hour
+	w := webhook.NewWorker(repo, nil, opts)
+	t.Cleanup(w.Close)
+	return w
+}
+
+func subscribe(t *testing.T, ctx context.Context, repo *mockRepository, url string, events ...string) *webhook.Subscription {
+	t.Helper()
+	sub := &webhook.Subscription{URL: url, Secret: "whsec_test", Events: events}
+	if err := repo.CreateSubscription(ctx, sub); err != nil {
+		t.Fatal(err)
+	}
+	return sub
+}
+
+// --- Signing Tests ---
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"evt_1"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      []byte
+		expectErr bool
+	}{
+		{name: "Valid", secret: "s", timestamp: now, signature: webhook.Sign("s", now, body), body: body},
+		{name: "WrongSecret", secret: "other", timestamp: now, signature: webhook.Sign("s", now, body), body: body, expectErr: true},
+		{name: "TamperedBody", secret: "s", timestamp: now, signature: webhook.Sign("s", now, body), body: []byte(`{"id":"evt_2"}`), expectErr: true},
+		{name: "TamperedTimestamp", secret: "s", timestamp: old, signature: webhook.Sign("s", now, body), body: body, expectErr: true},
+		{name: "Expired", secret: "s", timestamp: old, signature: webhook.Sign("s", old, body), body: body, expectErr: true},
+		{name: "MissingTimestamp", secret: "s", signature: webhook.Sign("s", "", body), body: body, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(webhook.HeaderTimestamp, tt.timestamp)
+			header.Set(webhook.HeaderSignature, tt.signature)
+
+			err := webhook.Verify(tt.secret, header, tt.body, 5*time.Minute)
+			if tt.expectErr && !errors.Is(err, webhook.ErrInvalidSignature) {
+				t.Errorf("expected ErrInvalidSignature, got %v", err)
+			}
+			if !tt.expectErr && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+// --- Service Tests ---
+
+func TestService_CreateSubscription(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		events    []string
+		expectErr bool
+	}{
+		{name: "Valid", url: "https://example.com/hooks", events: []string{user.EventCreated}},
+		{name: "All", url: "http://localhost:9000", events: []string{webhook.EventAll}},
+		{name: "RelativeURL", url: "/hooks", events: []string{user.EventCreated}, expectErr: true},
+		{name: "UnsupportedScheme", url: "ftp://example.com", events: []string{user.EventCreated}, expectErr: true},
+		{name: "NoEvents", url: "https://example.com/hooks", expectErr: true},
+		{name: "UnknownEvent", url: "https://example.com/hooks", events: []string{"user.renamed"}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := webhook.NewService(newMockRepository(), idgen.UUIDv7{})
+
+			sub, err := svc.CreateSubscription(acme, tt.url, tt.events)
+			if tt.expectErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if sub.ID == "" || !strings.HasPrefix(sub.Secret, "whsec_") {
+				t.Errorf("expected stored subscription with a secret, got %+v", sub)
+			}
+		})
+	}
+}
+
+// --- Delivery Tests ---
+
+func TestDispatcher_Publish(t *testing.T) {
+	repo := newMockRepository()
+	rv := webhooktest.NewReceiver(t, "whsec_test")
+	subscribe(t, acme, repo, rv.URL, user.EventCreated)
+	subscribe(t, acme, repo, rv.URL, webhook.EventAll)
+	subscribe(t, acme, repo, rv.URL, user.EventDeleted)
+
+	var events user.Publisher = webhook.NewDispatcher(repo, idgen.UUIDv7{})
+	events.Publish(user.Event{Type: user.EventCreated, User: user.User{ID: "1", Name: "Ada", TenantID: "acme"}, Time: time.Now()})
+
+	w := newWorker(t, repo, webhook.WorkerOptions{})
+	n, err := w.ProcessDue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 deliveries, got %d", n)
+	}
+
+	reqs := rv.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(reqs))
+	}
+	for _, req := range reqs {
+		if req.Payload.Type != user.EventCreated || req.Payload.Data.Name != "Ada" {
+			t.Errorf("unexpected payload %+v", req.Payload)
+		}
+		if id := req.Header.Get(webhook.HeaderID); id == "" || id != req.Payload.ID {
+			t.Errorf("expected %s header to match payload id %q, got %q", webhook.HeaderID, req.Payload.ID, id)
+		}
+	}
+	for i := range 2 {
+		if d := repo.delivery(i); d.Status != webhook.StatusSucceeded || d.Attempts != 1 || d.DeliveredAt == nil {
+			t.Errorf("expected delivery %d to succeed on the first attempt, got %+v", i, d)
+		}
+	}
+}
+
+func TestDispatcher_Tenants(t *testing.T) {
+	repo := newMockRepository()
+	rv := webhooktest.NewReceiver(t, "whsec_test")
+	globex := tenant.NewContext(context.Background(), "globex")
+	mine := subscribe(t, acme, repo, rv.URL, webhook.EventAll)
+	theirs := subscribe(t, globex, repo, rv.URL, webhook.EventAll)
+
+	webhook.NewDispatcher(repo, idgen.UUIDv7{}).Publish(user.Event{Type: user.EventCreated, User: user.User{ID: "1", TenantID: "acme"}, Time: time.Now()})
+	if n, err := newWorker(t, repo, webhook.WorkerOptions{}).ProcessDue(context.Background()); err != nil || n != 1 {
+		t.Fatalf("expected 1 delivery, got %d, %v", n, err)
+	}
+	if d := repo.delivery(0); d.SubscriptionID != mine.ID || d.TenantID != "acme" || d.Status != webhook.StatusSucceeded {
+		t.Errorf("expected a successful delivery to the acme subscription only, got %+v", d)
+	}
+
+	svc := webhook.NewService(repo, idgen.UUIDv7{})
+	if subs, err := svc.ListSubscriptions(globex); err != nil || len(subs) != 1 || subs[0].ID != theirs.ID {
+		t.Errorf("expected globex to list only its subscription, got %v, %v", subs, err)
+	}
+	if _, err := svc.ListDeliveries(globex, mine.ID, 10, 0); !errors.Is(err, webhook.ErrNotFound) {
+		t.Errorf("expected ErrNotFound listing deliveries of another tenant, got %v", err)
+	}
+	if err := svc.DeleteSubscription(globex, mine.ID); !errors.Is(err, webhook.ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting a subscription of another tenant, got %v", err)
+	}
+	if _, err := svc.ListSubscriptions(context.Background()); !errors.Is(err, tenant.ErrMissing) {
+		t.Errorf("expected tenant.ErrMissing without a tenant, got %v", err)
+	}
+}
+
+func TestDispatcher_EnqueueAgain(t *testing.T) {
+	repo := newMockRepository()
+	subscribe(t, acme, repo, "https://example.com/hooks", webhook.EventAll)
+	dispatcher := webhook.NewDispatcher(repo, idgen.UUIDv7{})
+
+	// The outbox relay enqueues an event again when enqueueing it failed.
+	e := user.Event{ID: "1", Type: user.EventCreated, User: user.User{ID: "1", TenantID: "acme"}, Time: time.Now()}
+	for range 2 {
+		if err := dispatcher.Enqueue(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo.mu.Lock()
+	n := len(repo.deliveries)
+	repo.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("expected 1 delivery, got %d", n)
+	}
+	if d := repo.delivery(0); d.EventID != "evt_1" {
+		t.Errorf("expected the event ID derived from the user event's, got %q", d.EventID)
+	}
+}
+
+func TestWorker_Claims(t *testing.T) {
+	repo := newMockRepository()
+	rv := webhooktest.NewReceiver(t, "whsec_test")
+	subscribe(t, acme, repo, rv.URL, webhook.EventAll)
+	webhook.NewDispatcher(repo, idgen.UUIDv7{}).Publish(user.Event{Type: user.EventCreated, User: user.User{ID: "1", TenantID: "acme"}, Time: time.Now()})
+
+	// Another instance's worker claimed the delivery and has not sent it yet.
+	if due, err := repo.ClaimDueDeliveries(context.Background(), time.Now(), time.Now().Add(time.Minute), 10); err != nil || len(due) != 1 {
+		t.Fatalf("expected to claim 1 delivery, got %d, %v", len(due), err)
+	}
+	if n, err := newWorker(t, repo, webhook.WorkerOptions{}).ProcessDue(context.Background()); err != nil || n != 0 {
+		t.Errorf("expected the claimed delivery to be skipped, got %d, %v", n, err)
+	}
+}
+
+func TestWorker_RetryAndDeadLetter(t *testing.T) {
+	repo := newMockRepository()
+	rv := webhooktest.NewReceiver(t, "whsec_test")
+	sub := subscribe(t, acme, repo, rv.URL, webhook.EventAll)
+
+	webhook.NewDispatcher(repo, idgen.UUIDv7{}).Publish(user.Event{Type: user.EventUpdated, User: user.User{ID: "1", TenantID: "acme"}, Time: time.Now()})
+	w := newWorker(t, repo, webhook.WorkerOptions{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: 90 * time.Second})
+	rv.FailNext(3)
+
+	expectedBackoff := []time.Duration{time.Minute, 90 * time.Second}
+	for i, backoff := range expectedBackoff {
+		start := time.Now()
+		if _, err := w.ProcessDue(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		d := repo.delivery(0)
+		if d.Status != webhook.StatusPending || d.Attempts != i+1 || d.ResponseStatus != http.StatusInternalServerError {
+			t.Fatalf("attempt %d: unexpected delivery %+v", i+1, d)
+		}
+		if wait := d.NextAttemptAt.Sub(start); wait < backoff || wait > backoff+time.Second {
+			t.Errorf("attempt %d: expected backoff of %v, got %v", i+1, backoff, wait)
+		}
+		if n, _ := w.ProcessDue(context.Background()); n != 0 {
+			t.Errorf("attempt %d: expected no delivery due during backoff, got %d", i+1, n)
+		}
+		repo.makeDue()
+	}
+
+	if _, err := w.ProcessDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d := repo.delivery(0)
+	if d.Status != webhook.StatusDead || d.Attempts != 3 || d.LastError == "" {
+		t.Fatalf("expected dead delivery after 3 attempts, got %+v", d)
+	}
+
+	svc := webhook.NewService(repo, idgen.UUIDv7{})
+	if err := svc.RetryDelivery(acme, sub.ID, d.ID); err != nil {
+		t.Fatalf("retrying dead delivery: %v", err)
+	}
+	if err := svc.RetryDelivery(acme, sub.ID, d.ID); !errors.Is(err, webhook.ErrNotFound) {
+		t.Errorf("expected ErrNotFound retrying a pending delivery, got %v", err)
+	}
+	if _, err := w.ProcessDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := repo.delivery(0); d.Status != webhook.StatusSucceeded || d.Attempts != 1 {
+		t.Errorf("expected redelivery to succeed, got %+v", d)
+	}
+	if len(rv.Requests()) != 1 {
+		t.Errorf("expected 1 accepted request, got %d", len(rv.Requests()))
+	}
+}
+
+func TestWorker_DeletedSubscription(t *testing.T) {
+	repo := newMockRepository()
+	sub := subscribe(t, acme, repo, "http://127.0.0.1:1", webhook.EventAll)
+	webhook.NewDispatcher(repo, idgen.UUIDv7{}).Publish(user.Event{Type: user.EventCreated, User: user.User{TenantID: "acme"}, Time: time.Now()})
+	repo.DeleteSubscription(acme, sub.ID)
+
+	w := newWorker(t, repo, webhook.WorkerOptions{})
+	if _, err := w.ProcessDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := repo.delivery(0); d.Status != webhook.StatusDead {
+		t.Errorf("expected delivery to a deleted subscription to be dead, got %+v", d)
+	}
+}
+
+// --- Handler Tests ---
+
+func TestHandler(t *testing.T) {
+	repo := newMockRepository()
+	sub := subscribe(t, acme, repo, "https://example.com/hooks", webhook.EventAll)
+	for i := range 3 {
+		repo.CreateDelivery(acme, &webhook.Delivery{
+			SubscriptionID: sub.ID,
+			EventID:        fmt.Sprintf("evt_%d", i),
+			Payload:        []byte(`{}`),
+			Status:         webhook.StatusDead,
+		})
+	}
+
+	r := chi.NewRouter()
+	r.Use(authz.Middleware(authz.NewAuthorizer(authz.StaticRoles{"admin": {"*"}}, 0)))
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := &auth.Claims{Roles: r.Header.Values("X-Test-Role")}
+			ctx := auth.NewContext(r.Context(), claims)
+			if id := r.Header.Get(tenant.DefaultHeader); id != "" {
+				ctx = tenant.NewContext(ctx, id)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	webhook.NewHandler(webhook.NewService(repo, idgen.UUIDv7{})).RegisterRoutes(r)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		role           string
+		tenant         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "CreateForbidden", method: "POST", path: "/admin/webhooks", body: `{"url":"https://example.com","events":["*"]}`, expectedStatus: http.StatusForbidden},
+		{name: "Create", method: "POST", path: "/admin/webhooks", body: `{"url":"https://example.com","events":["user.created"]}`, role: "admin", expectedStatus: http.StatusCreated, expectedBody: `"secret":"whsec_`},
+		{name: "CreateInvalid", method: "POST", path: "/admin/webhooks", body: `{"url":"example.com","events":["user.created"]}`, role: "admin", expectedStatus: http.StatusBadRequest},
+		{name: "List", method: "GET", path: "/admin/webhooks", role: "admin", expectedStatus: http.StatusOK, expectedBody: `"url":"https://example.com/hooks"`},
+		{name: "Deliveries", method: "GET", path: "/admin/webhooks/" + sub.ID + "/deliveries?limit=1&offset=1", role: "admin", expectedStatus: http.StatusOK, expectedBody: `[{"id":"dlv-3","subscription_id":"` + sub.ID + `","event_id":"evt_1"`},
+		{name: "DeliveriesBadLimit", method: "GET", path: "/admin/webhooks/" + sub.ID + "/deliveries?limit=500", role: "admin", expectedStatus: http.StatusBadRequest},
+		{name: "DeliveriesUnknown", method: "GET", path: "/admin/webhooks/sub-404/deliveries", role: "admin", expectedStatus: http.StatusNotFound},
+		{name: "ListOtherTenant", method: "GET", path: "/admin/webhooks", role: "admin", tenant: "globex", expectedStatus: http.StatusOK, expectedBody: `[]`},
+		{name: "DeliveriesOtherTenant", method: "GET", path: "/admin/webhooks/" + sub.ID + "/deliveries", role: "admin", tenant: "globex", expectedStatus: http.StatusNotFound},
+		{name: "RetryOtherTenant", method: "POST", path: "/admin/webhooks/" + sub.ID + "/deliveries/dlv-2/retry", role: "admin", tenant: "globex", expectedStatus: http.StatusNotFound},
+		{name: "DeleteOtherTenant", method: "DELETE", path: "/admin/webhooks/" + sub.ID, role: "admin", tenant: "globex", expectedStatus: http.StatusNotFound},
+		{name: "MissingTenant", method: "GET", path: "/admin/webhooks", role: "admin", tenant: "-", expectedStatus: http.StatusBadRequest},
+		{name: "Retry", method: "POST", path: "/admin/webhooks/" + sub.ID + "/deliveries/dlv-2/retry", role: "admin", expectedStatus: http.StatusAccepted},
+		{name: "RetryPending", method: "POST", path: "/admin/webhooks/" + sub.ID + "/deliveries/dlv-2/retry", role: "admin", expectedStatus: http.StatusNotFound},
+		{name: "Delete", method: "DELETE", path: "/admin/webhooks/" + sub.ID, role: "admin", expectedStatus: http.StatusNoContent},
+		{name: "DeleteAgain", method: "DELETE", path: "/admin/webhooks/" + sub.ID, role: "admin", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if tt.role != "" {
+				req.Header.Set("X-Test-Role", tt.role)
+			}
+			switch tt.tenant {
+			case "":
+				req.Header.Set(tenant.DefaultHeader, "acme")
+			case "-":
+			default:
+				req.Header.Set(tenant.DefaultHeader, tt.tenant)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedBody != "" && !strings.Contains(w.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedBody, w.Body.String())
+			}
+			if tt.method == "GET" && strings.Contains(w.Body.String(), "whsec_test") {
+				t.Error("secret must only be returned on creation")
+			}
+		})
+	}
+}
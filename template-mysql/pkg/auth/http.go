@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/user/go-templates/template-mysql/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Middleware authenticates requests carrying an "Authorization: Bearer" token
+// and stores the validated claims in the request context. Requests without a
+// token pass through anonymously so public routes keep working; use Required
+// to protect a route. Invalid tokens are always rejected with 401.
+func Middleware(v *Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := bearerToken(r)
+			if errors.Is(err, ErrMissingToken) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err != nil {
+				unauthorized(w, err)
+				return
+			}
+
+			claims, err := v.Verify(r.Context(), token)
+			if err != nil {
+				logger.FromContext(r.Context()).Info("rejected bearer token", zap.Error(err))
+				unauthorized(w, ErrInvalidToken)
+				return
+			}
+
+			ctx := NewContext(r.Context(), claims)
+			ctx = logger.NewContext(ctx, logger.FromContext(ctx).With(zap.String("subject", claims.Subject)))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Required rejects requests that were not authenticated by Middleware.
+func Required(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := FromContext(r.Context()); !ok {
+			unauthorized(w, ErrMissingToken)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func bearerToken(r *http.Request) (string, error) {
+	h := r.Header.Get("Authorization")
+	if h == "" {
+		return "", ErrMissingToken
+	}
+	scheme, token, ok := strings.Cut(h, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		// Other schemes are left to other authenticators.
+		return "", ErrMissingToken
+	}
+	token = strings.TrimSpace(token)
+	if !ok || token == "" {
+		return "", ErrInvalidToken
+	}
+	return token, nil
+}
+
+func unauthorized(w http.ResponseWriter, err error) {
+	challenge := "Bearer"
+	if !errors.Is(err, ErrMissingToken) {
+		challenge = `Bearer error="invalid_token"`
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+}
@@ -0,0 +1,33 @@
+package authz
+
+import (
+	"net/http"
+
+	"github.com/user/go-templates/template-mysql/pkg/auth"
+	"github.com/user/go-templates/template-mysql/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Middleware makes a available to Require and Check for the rest of the chain.
+func Middleware(a *Authorizer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), a)))
+		})
+	}
+}
+
+// Require rejects anonymous requests with 401 and requests whose caller lacks
+// any of perms with 403. It implies auth.Required.
+func Require(perms ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return auth.Required(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := Check(r.Context(), perms...); err != nil {
+				logger.FromContext(r.Context()).Info("permission denied", zap.Strings("permissions", perms))
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
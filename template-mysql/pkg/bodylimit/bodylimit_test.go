@@ -0,0 +1,67 @@
+package bodylimit
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestMiddleware(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Middleware(Options{
+		Default: 16,
+		Routes: map[string]int64{
+			"POST /uploads":  64,
+			"/uploads/{id}":  32,
+			"PUT /unlimited": 0,
+		},
+	}))
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}
+	r.Post("/users", handler)
+	r.Post("/uploads", handler)
+	r.Put("/uploads/{id}", handler)
+	r.Put("/unlimited", handler)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		size           int
+		expectedStatus int
+	}{
+		{name: "DefaultWithin", method: "POST", path: "/users", size: 16, expectedStatus: http.StatusOK},
+		{name: "DefaultExceeded", method: "POST", path: "/users", size: 17, expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "MethodRouteWithin", method: "POST", path: "/uploads", size: 64, expectedStatus: http.StatusOK},
+		{name: "MethodRouteExceeded", method: "POST", path: "/uploads", size: 65, expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "PatternWithin", method: "PUT", path: "/uploads/7", size: 32, expectedStatus: http.StatusOK},
+		{name: "PatternExceeded", method: "PUT", path: "/uploads/7", size: 33, expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "Unlimited", method: "PUT", path: "/unlimited", size: 1 << 16, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(strings.Repeat("x", tt.size)))
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// Package broker fans events out to in-process subscribers. It keeps a
+// bounded history so subscribers that reconnect can resume where they left
+// off, and disconnects subscribers that fall behind instead of blocking
+// publishers.
+package broker
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrClosed ends subscriptions when the broker is closed.
+	ErrClosed = errors.New("broker closed")
+	// ErrLagged ends a subscription whose buffer filled up.
+	ErrLagged = errors.New("subscriber fell behind")
+)
+
+// Event is a published value with its sequence number. IDs start at 1 and
+// increase by one per event.
+type Event[T any] struct {
+	ID   uint64
+	Data T
+}
+
+// Options configures a Broker.
+type Options struct {
+	// History is the number of recent events kept for resuming subscribers.
+	History int
+	// Buffer is the number of events queued per subscriber. A subscriber
+	// whose queue is full is disconnected with ErrLagged.
+	Buffer int
+}
+
+type Broker[T any] struct {
+	opts Options
+
+	mu      sync.Mutex
+	seq     uint64
+	history []Event[T]
+	subs    map[*Subscription[T]]struct{}
+	closed  bool
+}
+
+func New[T any](opts Options) *Broker[T] {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 1
+	}
+	return &Broker[T]{
+		opts: opts,
+		subs: make(map[*Subscription[T]]struct{}),
+	}
+}
+
+// Publish sends data to every subscriber without blocking. Publishing to a
+// closed broker is a no-op.
+func (b *Broker[T]) Publish(data T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.seq++
+	e := Event[T]{ID: b.seq, Data: data}
+
+	if b.opts.History > 0 {
+		if len(b.history) == b.opts.History {
+			copy(b.history, b.history[1:])
+			b.history = b.history[:len(b.history)-1]
+		}
+		b.history = append(b.history, e)
+	}
+
+	for s := range b.subs {
+		select {
+		case s.ch <- e:
+		default:
+			b.drop(s, ErrLagged)
+		}
+	}
+}
+
+// Subscribe returns a subscription to events published after lastID; zero
+// means only new events. Retained events after lastID are replayed first.
+// Gap is set on the subscription when some of them are no longer retained,
+// or lastID is unknown (for instance it came from before a restart).
+func (b *Broker[T]) Subscribe(lastID uint64) *Subscription[T] {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var replay []Event[T]
+	s := &Subscription[T]{b: b}
+	if lastID > 0 {
+		switch {
+		case lastID > b.seq:
+			s.Gap = true
+			replay = b.history
+		case len(b.history) == 0 || lastID < b.history[0].ID-1:
+			s.Gap = lastID < b.seq
+			replay = b.history
+		default:
+			replay = b.history[lastID-b.history[0].ID+1:]
+		}
+	}
+
+	s.ch = make(chan Event[T], b.opts.Buffer+len(replay))
+	for _, e := range replay {
+		s.ch <- e
+	}
+
+	if b.closed {
+		s.err = ErrClosed
+		close(s.ch)
+		return s
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Close ends all subscriptions with ErrClosed and stops accepting events.
+func (b *Broker[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for s := range b.subs {
+		b.drop(s, ErrClosed)
+	}
+}
+
+// drop must be called with b.mu held.
+func (b *Broker[T]) drop(s *Subscription[T], err error) {
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+	delete(b.subs, s)
+	s.err = err
+	close(s.ch)
+}
+
+// Subscription receives events until it is closed, it falls behind or the
+// broker closes.
+type Subscription[T any] struct {
+	// Gap reports that events between the requested lastID and the first
+	// replayed event were lost; consumers should reload their state.
+	Gap bool
+
+	b   *Broker[T]
+	ch  chan Event[T]
+	err error
+}
+
+// Events returns the channel events are delivered on. It is closed when the
+// subscription ends; Err then reports why.
+func (s *Subscription[T]) Events() <-chan Event[T] {
+	return s.ch
+}
+
+// Err returns ErrLagged or ErrClosed once the events channel is closed, and
+// nil before that or after Close.
+func (s *Subscription[T]) Err() error {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	return s.err
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *Subscription[T]) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	if _, ok := s.b.subs[s]; ok {
+		delete(s.b.subs, s)
+		close(s.ch)
+	}
+}
@@ -0,0 +1,149 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Schema describes the tables, columns, indexes, constraints and triggers of
+// the database, one sorted line per item, leaving out the version and lock
+// tables. Two databases with the same schema describe it identically.
+func (m *Migrator) Schema(ctx context.Context) ([]string, error) {
+	var (
+		lines []string
+		err   error
+	)
+	switch m.dialect {
+	case Postgres:
+		lines, err = queryLines(ctx, m.db, postgresSchema)
+	case MySQL:
+		lines, err = m.mysqlSchema(ctx)
+	default:
+		lines, err = queryLines(ctx, m.db, sqliteSchema)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read schema: %w", err)
+	}
+	slices.Sort(lines)
+	return lines, nil
+}
+
+// Verify migrates scratch, an empty database, to the version applied to m
+// and compares their schemas; see Diff for the result.
+func (m *Migrator) Verify(ctx context.Context, scratch *Migrator) ([]string, error) {
+	st, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if st.Dirty {
+		return nil, &DirtyError{Version: st.Version}
+	}
+	if err := scratch.Goto(ctx, st.Version); err != nil {
+		return nil, err
+	}
+
+	expected, err := scratch.Schema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	actual, err := m.Schema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(expected, actual), nil
+}
+
+// Diff compares two schemas as returned by Schema. Lines of expected missing
+// from actual are prefixed with "- ", lines only in actual with "+ ".
+func Diff(expected, actual []string) []string {
+	var diff []string
+	for _, line := range expected {
+		if !slices.Contains(actual, line) {
+			diff = append(diff, "- "+line)
+		}
+	}
+	for _, line := range actual {
+		if !slices.Contains(expected, line) {
+			diff = append(diff, "+ "+line)
+		}
+	}
+	return diff
+}
+
+// postgresSchema describes the current schema. Ordinal positions are left
+// out because dropped columns keep theirs, and index definitions lose their
+// schema qualifier so a scratch schema compares equal.
+const postgresSchema = `
+SELECT 'column ' || table_name || '.' || column_name || ' ' || udt_name
+  || CASE WHEN is_nullable = 'NO' THEN ' NOT NULL' ELSE '' END
+  || COALESCE(' DEFAULT ' || column_default, '')
+FROM information_schema.columns
+WHERE table_schema = current_schema() AND table_name NOT LIKE 'schema\_migrations%'
+UNION ALL
+SELECT 'index ' || indexname || ' ' || replace(indexdef, current_schema() || '.', '')
+FROM pg_indexes
+WHERE schemaname = current_schema() AND tablename NOT LIKE 'schema\_migrations%'
+UNION ALL
+SELECT 'constraint ' || c.relname || '.' || con.conname || ' ' || pg_get_constraintdef(con.oid)
+FROM pg_constraint con JOIN pg_class c ON c.oid = con.conrelid
+WHERE con.connamespace = current_schema()::regnamespace AND c.relname NOT LIKE 'schema\_migrations%'
+UNION ALL
+SELECT 'trigger ' || event_object_table || '.' || trigger_name || ' ' || event_manipulation || ' ' || action_statement
+FROM information_schema.triggers
+WHERE trigger_schema = current_schema()`
+
+// sqliteSchema describes every table, index, view and trigger by the SQL
+// that created it, as rewritten by ALTER TABLE.
+const sqliteSchema = `
+SELECT type || ' ' || name || ' ' || COALESCE(sql, '')
+FROM sqlite_master
+WHERE name NOT LIKE 'sqlite\_%' ESCAPE '\' AND name NOT LIKE 'schema\_migrations%' ESCAPE '\'`
+
+var autoIncrement = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
+
+// mysqlSchema describes each table by the lines of SHOW CREATE TABLE.
+func (m *Migrator) mysqlSchema(ctx context.Context) ([]string, error) {
+	tables, err := queryLines(ctx, m.db, `
+SELECT table_name FROM information_schema.tables
+WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' AND table_name NOT LIKE 'schema\_migrations%'`)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, table := range tables {
+		var name, create string
+		if err := m.db.QueryRowContext(ctx, "SHOW CREATE TABLE `"+table+"`").Scan(&name, &create); err != nil {
+			return nil, err
+		}
+		create = autoIncrement.ReplaceAllString(create, "")
+		for _, line := range strings.Split(create, "\n") {
+			lines = append(lines, "table "+table+" "+strings.TrimSuffix(strings.TrimSpace(line), ","))
+		}
+	}
+	return lines, nil
+}
+
+// queryLines returns the first column of every row, with whitespace
+// collapsed so multi-line definitions fit on one line.
+func queryLines(ctx context.Context, db *sql.DB, query string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		lines = append(lines, strings.Join(strings.Fields(line), " "))
+	}
+	return lines, rows.Err()
+}
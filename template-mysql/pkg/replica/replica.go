@@ -0,0 +1,191 @@
+// Package replica routes database reads to read replicas and writes to the
+// primary. A Router hands out replicas round robin, skipping those failing
+// their health check, and falls back to the primary when none is healthy.
+//
+// Replicas lag behind the primary, so a request that has written reads its
+// own writes from the primary for the rest of the request: Middleware starts
+// a session per request, and Write marks it.
+package replica
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Options configures a Router. Zero values use the defaults noted.
+type Options struct {
+	// HealthInterval between health checks of each replica (5s).
+	HealthInterval time.Duration
+	// HealthTimeout bounds one health check (1s).
+	HealthTimeout time.Duration
+}
+
+// Router routes to a primary of type DB and its replicas; DB is a connection
+// pool such as *pgxpool.Pool or *sql.DB.
+type Router[DB any] struct {
+	primary  DB
+	replicas []*member[DB]
+	ping     func(DB, context.Context) error
+	opts     Options
+	next     atomic.Uint64
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type member[DB any] struct {
+	db      DB
+	index   int
+	healthy atomic.Bool
+}
+
+// New returns a Router over primary and replicas. ping checks a replica's
+// health, e.g. (*pgxpool.Pool).Ping or (*sql.DB).PingContext; replicas are
+// assumed healthy until their first check. Without replicas every call
+// returns the primary and ping may be nil.
+func New[DB any](primary DB, replicas []DB, ping func(DB, context.Context) error, opts Options) *Router[DB] {
+	if opts.HealthInterval <= 0 {
+		opts.HealthInterval = 5 * time.Second
+	}
+	if opts.HealthTimeout <= 0 {
+		opts.HealthTimeout = time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Router[DB]{
+		primary: primary,
+		ping:    ping,
+		opts:    opts,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	for i, db := range replicas {
+		m := &member[DB]{db: db, index: i}
+		m.healthy.Store(true)
+		r.replicas = append(r.replicas, m)
+	}
+	if len(r.replicas) == 0 {
+		close(r.done)
+		return r
+	}
+	go r.run(ctx)
+	return r
+}
+
+// Close stops the health checks. It does not close the pools.
+func (r *Router[DB]) Close() {
+	r.cancel()
+	<-r.done
+}
+
+// Write returns the primary and marks the session in ctx, if any, as having
+// written, so its later reads go to the primary too.
+func (r *Router[DB]) Write(ctx context.Context) DB {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		s.wrote.Store(true)
+	}
+	return r.primary
+}
+
+// Read returns the next healthy replica, or the primary when the session in
+// ctx has written or no replica is healthy.
+func (r *Router[DB]) Read(ctx context.Context) DB {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok && s.wrote.Load() {
+		return r.primary
+	}
+	n := uint64(len(r.replicas))
+	if n == 0 {
+		return r.primary
+	}
+	start := r.next.Add(1)
+	for i := range n {
+		if m := r.replicas[(start+i)%n]; m.healthy.Load() {
+			return m.db
+		}
+	}
+	return r.primary
+}
+
+func (r *Router[DB]) run(ctx context.Context) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.opts.HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		r.CheckHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckHealth pings every replica concurrently and records which answered.
+// The Router calls it every HealthInterval.
+func (r *Router[DB]) CheckHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, m := range r.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pingCtx, cancel := context.WithTimeout(ctx, r.opts.HealthTimeout)
+			defer cancel()
+			err := r.ping(m.db, pingCtx)
+			// A check cut short by Close says nothing about the replica.
+			if ctx.Err() != nil {
+				return
+			}
+			healthy := err == nil
+			if m.healthy.Swap(healthy) != healthy {
+				if healthy {
+					zap.L().Info("replica recovered", zap.Int("replica", m.index))
+				} else {
+					zap.L().Warn("replica unhealthy", zap.Int("replica", m.index), zap.Error(err))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// --- Sessions ---
+
+type sessionKey struct{}
+
+// session records whether a request has written.
+type session struct {
+	wrote atomic.Bool
+}
+
+// WithSession returns ctx carrying a new read-your-writes session, or ctx
+// itself if it already carries one.
+func WithSession(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(sessionKey{}).(*session); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+// WithPrimary returns ctx in a session that reads from the primary, for
+// reads that must not be stale, such as loads into a cache.
+func WithPrimary(ctx context.Context) context.Context {
+	s := &session{}
+	s.wrote.Store(true)
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// Middleware runs each request in its own session, so that once it has
+// written it reads from the primary. Requests dispatched with a context that
+// already carries a session, such as the operations of a batch, share it.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithSession(r.Context())))
+	})
+}
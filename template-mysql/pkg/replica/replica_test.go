@@ -0,0 +1,129 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeDB is a pool whose health a test switches.
+type fakeDB struct {
+	name string
+	down atomic.Bool
+}
+
+func pingFake(db *fakeDB, ctx context.Context) error {
+	if db.down.Load() {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+// newTestRouter returns a Router whose health is only checked when the test
+// calls CheckHealth.
+func newTestRouter(t *testing.T, primary *fakeDB, replicas ...*fakeDB) *Router[*fakeDB] {
+	t.Helper()
+	r := New(primary, replicas, pingFake, Options{HealthInterval: time.Hour})
+	t.Cleanup(r.Close)
+	return r
+}
+
+func reads(r *Router[*fakeDB], ctx context.Context, n int) []string {
+	var names []string
+	for range n {
+		names = append(names, r.Read(ctx).name)
+	}
+	return names
+}
+
+func TestRouter_Read(t *testing.T) {
+	ctx := context.Background()
+	primary := &fakeDB{name: "primary"}
+	a, b := &fakeDB{name: "a"}, &fakeDB{name: "b"}
+	r := newTestRouter(t, primary, a, b)
+
+	got := reads(r, ctx, 4)
+	if got[0] == got[1] || got[0] != got[2] || got[1] != got[3] || got[0] == "primary" || got[1] == "primary" {
+		t.Errorf("expected reads to alternate between the replicas, got %v", got)
+	}
+
+	a.down.Store(true)
+	r.CheckHealth(ctx)
+	for _, name := range reads(r, ctx, 3) {
+		if name != "b" {
+			t.Errorf("expected reads to skip the unhealthy replica, got %s", name)
+		}
+	}
+
+	b.down.Store(true)
+	r.CheckHealth(ctx)
+	if name := r.Read(ctx).name; name != "primary" {
+		t.Errorf("expected the primary without healthy replicas, got %s", name)
+	}
+
+	a.down.Store(false)
+	r.CheckHealth(ctx)
+	if name := r.Read(ctx).name; name != "a" {
+		t.Errorf("expected the recovered replica, got %s", name)
+	}
+}
+
+func TestRouter_NoReplicas(t *testing.T) {
+	primary := &fakeDB{name: "primary"}
+	r := New(primary, nil, nil, Options{})
+	defer r.Close()
+
+	if r.Read(context.Background()) != primary || r.Write(context.Background()) != primary {
+		t.Error("expected every call to return the primary")
+	}
+}
+
+func TestRouter_ReadYourWrites(t *testing.T) {
+	primary := &fakeDB{name: "primary"}
+	r := newTestRouter(t, primary, &fakeDB{name: "replica"})
+
+	ctx := WithSession(context.Background())
+	if name := r.Read(ctx).name; name != "replica" {
+		t.Fatalf("expected a replica before writing, got %s", name)
+	}
+	if name := r.Write(ctx).name; name != "primary" {
+		t.Fatalf("expected writes to go to the primary, got %s", name)
+	}
+	if name := r.Read(ctx).name; name != "primary" {
+		t.Errorf("expected reads after a write to go to the primary, got %s", name)
+	}
+	if name := r.Read(WithSession(ctx)).name; name != "primary" {
+		t.Errorf("expected WithSession to keep the existing session, got %s", name)
+	}
+
+	if name := r.Read(WithPrimary(context.Background())).name; name != "primary" {
+		t.Errorf("expected WithPrimary to read from the primary, got %s", name)
+	}
+
+	// Without a session writes are not remembered.
+	r.Write(context.Background())
+	if name := r.Read(context.Background()).name; name != "replica" {
+		t.Errorf("expected a replica outside a session, got %s", name)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	r := newTestRouter(t, &fakeDB{name: "primary"}, &fakeDB{name: "replica"})
+	var got []string
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPost {
+			r.Write(req.Context())
+		}
+		got = append(got, r.Read(req.Context()).name)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got[0] != "primary" || got[1] != "replica" {
+		t.Errorf("expected stickiness to last for one request, got %v", got)
+	}
+}
@@ -0,0 +1,73 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/user/go-templates/template-mysql/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Header is the HTTP header used to accept and return the request ID.
+const Header = "X-Request-ID"
+
+// maxLen bounds the size of caller supplied IDs so they cannot bloat logs.
+const maxLen = 128
+
+type ctxKey struct{}
+
+// New returns a random 128-bit request ID encoded as hex.
+func New() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// NewContext returns a copy of ctx that carries id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, or "" if there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Middleware accepts the caller's X-Request-ID (or generates one), echoes it
+// in the response and stores it, together with a logger annotated with it,
+// in the request context.
+func Middleware(log *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(Header)
+			if !valid(id) {
+				id = New()
+			}
+			w.Header().Set(Header, id)
+
+			ctx := NewContext(r.Context(), id)
+			// Let chi's request logger print the same ID.
+			ctx = context.WithValue(ctx, middleware.RequestIDKey, id)
+			ctx = logger.NewContext(ctx, log.With(zap.String("request_id", id)))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
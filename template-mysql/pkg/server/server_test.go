@@ -0,0 +1,347 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_H2C(t *testing.T) {
+	tests := []struct {
+		name        string
+		h2c         bool
+		http2       bool
+		contentType string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "HTTP1", h2c: true, contentType: "application/json", expected: "http HTTP/1.1"},
+		{name: "HTTP2", h2c: true, http2: true, contentType: "application/json", expected: "http HTTP/2.0"},
+		{name: "GRPC", h2c: true, http2: true, contentType: "application/grpc+proto", expected: "grpc HTTP/2.0"},
+		{name: "GRPCOverHTTP1", h2c: true, contentType: "application/grpc", expected: "http HTTP/1.1"},
+		{name: "Disabled", http2: true, contentType: "application/grpc", expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := New(Options{Handler: echo("http"), GRPC: echo("grpc"), H2C: tt.h2c})
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			addr := serve(t, srv)
+
+			protocols := new(http.Protocols)
+			if tt.http2 {
+				protocols.SetUnencryptedHTTP2(true)
+			} else {
+				protocols.SetHTTP1(true)
+			}
+			client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+
+			body, err := post(client, "http://"+addr, tt.contentType)
+			if tt.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error, got response %q", body)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			if body != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, body)
+			}
+		})
+	}
+}
+
+func TestServer_TLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "test ca")
+	certFile, keyFile := ca.writeLeaf(t, dir, "server", "server one")
+	var errorLog bytes.Buffer
+
+	srv, err := New(Options{
+		Handler:  echo("http"),
+		GRPC:     echo("grpc"),
+		TLS:      TLSOptions{CertFile: certFile, KeyFile: keyFile, ReloadInterval: time.Nanosecond},
+		ErrorLog: log.New(&errorLog, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	addr := serve(t, srv)
+
+	t.Run("HTTP2", func(t *testing.T) {
+		body, err := post(ca.client(nil), "https://"+addr, "application/grpc")
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		if body != "grpc HTTP/2.0" {
+			t.Errorf("expected %q, got %q", "grpc HTTP/2.0", body)
+		}
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		ca.writeLeaf(t, dir, "server", "server two")
+		later := time.Now().Add(time.Minute)
+		for _, name := range []string{certFile, keyFile} {
+			if err := os.Chtimes(name, later, later); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if cn := peerCommonName(t, ca, addr); cn != "server two" {
+			t.Errorf("expected reloaded certificate, got %q", cn)
+		}
+	})
+
+	t.Run("ReloadFailure", func(t *testing.T) {
+		if err := os.WriteFile(keyFile, []byte("garbage"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if cn := peerCommonName(t, ca, addr); cn != "server two" {
+			t.Errorf("expected previous certificate to be kept, got %q", cn)
+		}
+		if !strings.Contains(errorLog.String(), "load tls certificate") {
+			t.Errorf("expected reload error to be logged, got %q", errorLog.String())
+		}
+	})
+}
+
+func TestServer_ClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "test ca")
+	certFile, keyFile := ca.writeLeaf(t, dir, "server", "server")
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, ca.certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := New(Options{
+		Handler:  echo("http"),
+		TLS:      TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile},
+		ErrorLog: log.New(io.Discard, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	addr := serve(t, srv)
+
+	if _, err := post(ca.client(nil), "https://"+addr, "application/json"); err == nil {
+		t.Error("expected request without client certificate to fail")
+	}
+
+	other := newCA(t, "other ca")
+	untrusted := other.leaf(t, "client")
+	if _, err := post(ca.client(&untrusted), "https://"+addr, "application/json"); err == nil {
+		t.Error("expected request with untrusted client certificate to fail")
+	}
+
+	trusted := ca.leaf(t, "client")
+	body, err := post(ca.client(&trusted), "https://"+addr, "application/json")
+	if err != nil {
+		t.Fatalf("request with client certificate: %v", err)
+	}
+	if body != "http HTTP/2.0" {
+		t.Errorf("expected %q, got %q", "http HTTP/2.0", body)
+	}
+}
+
+func TestNew_InvalidTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "test ca")
+	certFile, keyFile := ca.writeLeaf(t, dir, "server", "server")
+
+	tests := []struct {
+		name string
+		opts TLSOptions
+	}{
+		{name: "MissingKey", opts: TLSOptions{CertFile: certFile}},
+		{name: "MissingFile", opts: TLSOptions{CertFile: filepath.Join(dir, "missing.pem"), KeyFile: keyFile}},
+		{name: "MismatchedKey", opts: TLSOptions{CertFile: certFile, KeyFile: certFile}},
+		{name: "InvalidClientCA", opts: TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: keyFile}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(Options{TLS: tt.opts}); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+// echo answers with name and the protocol of the request.
+func echo(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name+" "+r.Proto)
+	})
+}
+
+func serve(t *testing.T, srv *Server) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(l) }()
+	t.Cleanup(func() {
+		srv.Shutdown(context.Background())
+		if err := <-done; !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return l.Addr().String()
+}
+
+func post(client *http.Client, url, contentType string) (string, error) {
+	defer client.CloseIdleConnections()
+	resp, err := client.Post(url, contentType, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func peerCommonName(t *testing.T, ca *testCA, addr string) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: ca.pool})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+type testCA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	pool    *x509.CertPool
+}
+
+func newCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key := newKey(t)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pool:    pool,
+	}
+}
+
+// leaf issues a certificate for localhost usable by servers and clients.
+func (ca *testCA) leaf(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, name)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// writeLeaf issues a certificate like leaf and writes it to dir as
+// prefix.pem and prefix-key.pem.
+func (ca *testCA) writeLeaf(t *testing.T, dir, prefix, name string) (certFile, keyFile string) {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, name)
+	certFile = filepath.Join(dir, prefix+".pem")
+	keyFile = filepath.Join(dir, prefix+"-key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func (ca *testCA) issue(t *testing.T, name string) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key := newKey(t)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// client returns an HTTP/2 client trusting ca and presenting cert, if any.
+func (ca *testCA) client(cert *tls.Certificate) *http.Client {
+	cfg := &tls.Config{RootCAs: ca.pool}
+	if cert != nil {
+		cfg.Certificates = []tls.Certificate{*cert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg, ForceAttemptHTTP2: true}}
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
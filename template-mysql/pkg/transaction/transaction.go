@@ -0,0 +1,119 @@
+// Package transaction lets services run several repository calls as one
+// unit of work. A Manager starts a transaction and carries it in the context
+// passed to the unit of work; repositories look it up with FromContext, so
+// every call made with that context joins the transaction without the
+// service knowing which database is behind it.
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Manager runs fn in a transaction, committing if fn returns nil and rolling
+// back otherwise. A WithinTx call inside fn runs in a savepoint of the same
+// transaction: its error rolls back only its own writes, which the caller
+// may handle and carry on.
+type Manager interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txKey struct{}
+
+// state is the transaction in a context, how many savepoints deep it is and
+// the functions AfterCommit deferred at that depth.
+type state struct {
+	tx    *sql.Tx
+	depth int
+	hooks []func()
+}
+
+// FromContext returns the transaction started by WithinTx, if ctx carries
+// one.
+func FromContext(ctx context.Context) (*sql.Tx, bool) {
+	st, ok := ctx.Value(txKey{}).(*state)
+	if !ok {
+		return nil, false
+	}
+	return st.tx, true
+}
+
+// AfterCommit runs fn once the transaction in ctx has committed, or at once
+// if ctx carries none. fn is dropped when the transaction, or the savepoint
+// it was deferred in, rolls back. Use it for side effects outside the
+// database, such as invalidating a cache, that must not be seen before the
+// writes are.
+func AfterCommit(ctx context.Context, fn func()) {
+	if st, ok := ctx.Value(txKey{}).(*state); ok {
+		st.hooks = append(st.hooks, fn)
+		return
+	}
+	fn()
+}
+
+// InTx reports whether ctx carries a transaction started by WithinTx.
+func InTx(ctx context.Context) bool {
+	_, ok := FromContext(ctx)
+	return ok
+}
+
+// MysqlManager implements Manager with database/sql transactions. MySQL
+// commits DDL implicitly, so only data changes are rolled back.
+type MysqlManager struct {
+	db *sql.DB
+}
+
+func NewMysqlManager(db *sql.DB) *MysqlManager {
+	return &MysqlManager{db: db}
+}
+
+func (m *MysqlManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if st, ok := ctx.Value(txKey{}).(*state); ok {
+		return savepoint(ctx, st, fn)
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	st := &state{tx: tx}
+	if err := fn(context.WithValue(ctx, txKey{}, st)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, fn := range st.hooks {
+		fn()
+	}
+	return nil
+}
+
+// savepoint runs fn in a savepoint of st's transaction, named after its
+// depth so nested savepoints do not collide.
+func savepoint(ctx context.Context, st *state, fn func(ctx context.Context) error) error {
+	nested := &state{tx: st.tx, depth: st.depth + 1}
+	name := fmt.Sprintf("sp_%d", nested.depth)
+	if _, err := st.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+	if err := fn(context.WithValue(ctx, txKey{}, nested)); err != nil {
+		// Roll back even when ctx is done, so the outer transaction can go on.
+		ctx := context.WithoutCancel(ctx)
+		if _, rbErr := st.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rbErr != nil {
+			return errors.Join(err, rbErr)
+		}
+		if _, rbErr := st.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name); rbErr != nil {
+			return errors.Join(err, rbErr)
+		}
+		return err
+	}
+	if _, err := st.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name); err != nil {
+		return err
+	}
+	// The savepoint's hooks wait for the enclosing transaction.
+	st.hooks = append(st.hooks, nested.hooks...)
+	return nil
+}
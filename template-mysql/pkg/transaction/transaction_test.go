@@ -0,0 +1,219 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+var errTest = errors.New("test error")
+
+// newTestDB connects to TEST_MYSQL_SOURCE and creates an empty
+// transaction_test_items table, dropped after the test. Tests using it are
+// skipped when the variable is not set.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	source := os.Getenv("TEST_MYSQL_SOURCE")
+	if source == "" {
+		t.Skip("TEST_MYSQL_SOURCE is not set")
+	}
+	db, err := sql.Open("mysql", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE transaction_test_items (name VARCHAR(255) NOT NULL) ENGINE=InnoDB"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE transaction_test_items")
+		db.Close()
+	})
+	return db
+}
+
+// insert adds name to the table in the transaction in ctx, if any.
+func insert(t *testing.T, ctx context.Context, db *sql.DB, name string) {
+	t.Helper()
+	var err error
+	if tx, ok := FromContext(ctx); ok {
+		_, err = tx.ExecContext(ctx, "INSERT INTO transaction_test_items (name) VALUES (?)", name)
+	} else {
+		_, err = db.ExecContext(ctx, "INSERT INTO transaction_test_items (name) VALUES (?)", name)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func items(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT name FROM transaction_test_items ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestMysqlManager_WithinTx(t *testing.T) {
+	tests := []struct {
+		name     string
+		fn       func(t *testing.T, ctx context.Context, m *MysqlManager, db *sql.DB) error
+		expected []string
+		err      error
+	}{
+		{
+			name: "Commit",
+			fn: func(t *testing.T, ctx context.Context, m *MysqlManager, db *sql.DB) error {
+				insert(t, ctx, db, "a")
+				insert(t, ctx, db, "b")
+				return nil
+			},
+			expected: []string{"a", "b"},
+		},
+		{
+			name: "Rollback",
+			fn: func(t *testing.T, ctx context.Context, m *MysqlManager, db *sql.DB) error {
+				insert(t, ctx, db, "a")
+				return errTest
+			},
+			err: errTest,
+		},
+		{
+			name: "NestedCommit",
+			fn: func(t *testing.T, ctx context.Context, m *MysqlManager, db *sql.DB) error {
+				insert(t, ctx, db, "a")
+				return m.WithinTx(ctx, func(ctx context.Context) error {
+					insert(t, ctx, db, "b")
+					return nil
+				})
+			},
+			expected: []string{"a", "b"},
+		},
+		{
+			name: "NestedRollbackHandled",
+			fn: func(t *testing.T, ctx context.Context, m *MysqlManager, db *sql.DB) error {
+				insert(t, ctx, db, "a")
+				err := m.WithinTx(ctx, func(ctx context.Context) error {
+					insert(t, ctx, db, "b")
+					return m.WithinTx(ctx, func(ctx context.Context) error {
+						insert(t, ctx, db, "c")
+						return errTest
+					})
+				})
+				if !errors.Is(err, errTest) {
+					t.Errorf("expected nested error, got %v", err)
+				}
+				insert(t, ctx, db, "d")
+				return nil
+			},
+			expected: []string{"a", "d"},
+		},
+		{
+			name: "NestedRollbackPropagated",
+			fn: func(t *testing.T, ctx context.Context, m *MysqlManager, db *sql.DB) error {
+				insert(t, ctx, db, "a")
+				return m.WithinTx(ctx, func(ctx context.Context) error {
+					insert(t, ctx, db, "b")
+					return errTest
+				})
+			},
+			err: errTest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			m := NewMysqlManager(db)
+
+			err := m.WithinTx(context.Background(), func(ctx context.Context) error {
+				return tt.fn(t, ctx, m, db)
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if got := items(t, db); !slices.Equal(got, tt.expected) {
+				t.Errorf("expected items %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("expected no transaction outside WithinTx")
+	}
+
+	db := newTestDB(t)
+	err := NewMysqlManager(db).WithinTx(context.Background(), func(ctx context.Context) error {
+		if _, ok := FromContext(ctx); !ok {
+			t.Error("expected a transaction inside WithinTx")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithinTx: %v", err)
+	}
+}
+
+func TestAfterCommit(t *testing.T) {
+	var ran []string
+	record := func(name string) func() {
+		return func() { ran = append(ran, name) }
+	}
+
+	AfterCommit(context.Background(), record("outside"))
+	if !slices.Equal(ran, []string{"outside"}) {
+		t.Fatalf("expected the hook to run at once outside a transaction, got %v", ran)
+	}
+
+	m := NewMysqlManager(newTestDB(t))
+	ran = nil
+	err := m.WithinTx(context.Background(), func(ctx context.Context) error {
+		AfterCommit(ctx, record("outer"))
+		if err := m.WithinTx(ctx, func(ctx context.Context) error {
+			AfterCommit(ctx, record("nested"))
+			return nil
+		}); err != nil {
+			return err
+		}
+		// A hook deferred in a savepoint that rolls back is dropped.
+		_ = m.WithinTx(ctx, func(ctx context.Context) error {
+			AfterCommit(ctx, record("rolled back"))
+			return errTest
+		})
+		if len(ran) != 0 {
+			t.Errorf("expected no hook to run before the commit, got %v", ran)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithinTx: %v", err)
+	}
+	if !slices.Equal(ran, []string{"outer", "nested"}) {
+		t.Errorf("expected the committed hooks to run in order, got %v", ran)
+	}
+
+	ran = nil
+	err = m.WithinTx(context.Background(), func(ctx context.Context) error {
+		AfterCommit(ctx, record("outer"))
+		return errTest
+	})
+	if !errors.Is(err, errTest) || len(ran) != 0 {
+		t.Errorf("expected no hook to run after a rollback, got %v (%v)", ran, err)
+	}
+}
@@ -2,15 +2,33 @@ package main
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	chiadapter "github.com/awslabs/aws-lambda-go-api-proxy/chi"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/user/go-templates/template-nodbm/internal/apikey"
 	"github.com/user/go-templates/template-nodbm/internal/config"
+	"github.com/user/go-templates/template-nodbm/internal/operation"
 	"github.com/user/go-templates/template-nodbm/internal/user"
+	userv1 "github.com/user/go-templates/template-nodbm/internal/user/v1"
+	userv2 "github.com/user/go-templates/template-nodbm/internal/user/v2"
+	"github.com/user/go-templates/template-nodbm/internal/webhook"
+	"github.com/user/go-templates/template-nodbm/pkg/auth"
+	"github.com/user/go-templates/template-nodbm/pkg/authz"
+	"github.com/user/go-templates/template-nodbm/pkg/batch"
+	"github.com/user/go-templates/template-nodbm/pkg/bodylimit"
+	"github.com/user/go-templates/template-nodbm/pkg/compress"
+	"github.com/user/go-templates/template-nodbm/pkg/cors"
+	"github.com/user/go-templates/template-nodbm/pkg/httpcache"
+	"github.com/user/go-templates/template-nodbm/pkg/idgen"
 	"github.com/user/go-templates/template-nodbm/pkg/logger"
+	"github.com/user/go-templates/template-nodbm/pkg/requestid"
+	"github.com/user/go-templates/template-nodbm/pkg/secureheaders"
+	"go.uber.org/zap"
 )
 
 var chiLambda *chiadapter.ChiLambda
@@ -24,19 +42,134 @@ func init() {
 
 	// Initialize Logger
 	log, _ := logger.New(cfg.Log.Level)
+	zap.ReplaceGlobals(log)
 
 	// Initialize Layers
+	// The worker only runs while the function is thawed, so deliveries are
+	// sent during later invocations rather than immediately.
+	webhookRepo := webhook.NewMemoryRepository()
+	webhookDispatcher := webhook.NewDispatcher(webhookRepo)
+	_ = webhook.NewWorker(webhookRepo, &http.Client{Timeout: cfg.Webhooks.Timeout}, webhook.WorkerOptions{
+		Interval:    cfg.Webhooks.Interval,
+		MaxAttempts: cfg.Webhooks.MaxAttempts,
+		Backoff:     cfg.Webhooks.Backoff,
+		MaxBackoff:  cfg.Webhooks.MaxBackoff,
+		Timeout:     cfg.Webhooks.Timeout,
+	})
+	webhookHandler := webhook.NewHandler(webhook.NewService(webhookRepo))
+
+	// Operations only progress while the function is thawed, so they may take
+	// far longer than on a server.
+	operations := operation.NewManager(operation.NewMemoryRepository(), operation.ManagerOptions{
+		Workers: cfg.Operations.Workers,
+		Queue:   cfg.Operations.Queue,
+	})
+	operationHandler := operation.NewHandler(operations)
+
+	// The user service gives new users IDs of the configured strategy and
+	// rejects IDs written any other way.
+	ids, err := idgen.New(cfg.IDs.Strategy)
+	if err != nil {
+		log.Fatal("invalid id strategy", zap.Error(err))
+	}
 	userRepo := user.NewMemoryRepository()
-	userService := user.NewService(userRepo, log)
-	userHandler := user.NewHandler(userService)
+	// Lambda cannot hold event streams open, so user events only feed webhooks.
+	userService := user.NewService(userRepo, ids, webhookDispatcher)
+	userV1Handler := userv1.NewHandler(userService)
+	userV2Handler := userv2.NewHandler(userService, operations)
+	// Responses to user reads are cached per caller; writes through the user
+	// routes purge the cache.
+	userCache := httpcache.New(httpcache.Options{
+		MaxBytes:      cfg.Server.Cache.MaxBytes,
+		MaxEntryBytes: cfg.Server.Cache.MaxEntryBytes,
+		TTL:           cfg.Server.Cache.TTL,
+	})
+
+	apiKeyRepo := apikey.NewMemoryRepository()
+	apiKeyUsage := apikey.NewUsageRecorder(apiKeyRepo, 30*time.Second)
+	apiKeyService := apikey.NewService(apiKeyRepo, apiKeyUsage)
+	apiKeyHandler := apikey.NewHandler(apiKeyService)
+
+	// Authentication
+	authKeys, err := auth.LoadKeySet(context.Background(), auth.KeyOptions{
+		JWKS:            cfg.Auth.JWKS,
+		JWKSRefresh:     cfg.Auth.JWKSRefresh,
+		HMACSecret:      cfg.Auth.HMACSecret,
+		PublicKeyFile:   cfg.Auth.PublicKeyFile,
+		AllowWeakSecret: cfg.App.Env == "dev",
+	})
+	if err != nil {
+		// handle error
+	}
+	verifier := auth.NewVerifier(authKeys, auth.Options{
+		Issuer:    cfg.Auth.Issuer,
+		Audience:  cfg.Auth.Audience,
+		ClockSkew: cfg.Auth.ClockSkew,
+	})
+
+	// Authorization
+	authorizer := authz.NewAuthorizer(authz.StaticRoles(cfg.Authz.Roles), 0)
 
 	// Router Setup
 	r := chi.NewRouter()
+	r.Use(requestid.Middleware(log))
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(secureheaders.Middleware(secureheaders.Options{
+		HSTSMaxAge:            cfg.Server.SecurityHeaders.HSTSMaxAge,
+		HSTSIncludeSubdomains: cfg.Server.SecurityHeaders.HSTSIncludeSubdomains,
+		ContentSecurityPolicy: cfg.Server.SecurityHeaders.ContentSecurityPolicy,
+		ReferrerPolicy:        cfg.Server.SecurityHeaders.ReferrerPolicy,
+	}))
+	// CORS runs before authentication so preflight requests need no credentials.
+	r.Use(cors.Middleware(cors.Options{
+		AllowedOrigins:   cfg.Server.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.Server.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.Server.CORS.AllowedHeaders,
+		ExposedHeaders:   cfg.Server.CORS.ExposedHeaders,
+		AllowCredentials: cfg.Server.CORS.AllowCredentials,
+		MaxAge:           cfg.Server.CORS.MaxAge,
+	}))
+	if cfg.Server.Compression.Enabled {
+		r.Use(compress.Middleware(compress.Options{MinSize: cfg.Server.Compression.MinSize}))
+	}
+	r.Use(bodylimit.Middleware(bodylimit.Options{
+		Default: cfg.Server.BodyLimit.Default,
+		Routes:  cfg.Server.BodyLimit.Limits(),
+	}))
+	r.Use(httpcache.Control(httpcache.ControlOptions{
+		Default: cfg.Server.Cache.Control,
+		Routes:  cfg.Server.Cache.Controls(),
+	}))
+	r.Use(auth.Middleware(verifier))
+	r.Use(apikey.Middleware(apiKeyService))
+	r.Use(authz.Middleware(authorizer))
+
+	// Batch operations are dispatched through r itself. The memory repository
+	// has no transactions, so atomic batches are answered with 501.
+	batchHandler := batch.NewHandler(r, batch.Options{
+		MaxOperations: cfg.Server.Batch.MaxOperations,
+		Concurrency:   cfg.Server.Batch.Concurrency,
+		Timeout:       cfg.Server.Batch.Timeout,
+	})
 
 	r.Route("/api/v1", func(r chi.Router) {
-		userHandler.RegisterRoutes(r)
+		r.Group(func(r chi.Router) {
+			if cfg.Server.Cache.Enabled {
+				r.Use(userCache.Middleware)
+			}
+			userV1Handler.RegisterRoutes(r)
+		})
+		apiKeyHandler.RegisterRoutes(r)
+		webhookHandler.RegisterRoutes(r)
+		operationHandler.RegisterRoutes(r)
+		batchHandler.RegisterRoutes(r)
+	})
+	r.Route("/api/v2", func(r chi.Router) {
+		if cfg.Server.Cache.Enabled {
+			r.Use(userCache.Middleware)
+		}
+		userV2Handler.RegisterRoutes(r)
 	})
 
 	chiLambda = chiadapter.New(r)
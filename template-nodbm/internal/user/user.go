@@ -2,93 +2,299 @@ package user
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"net/http"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
-	"github.com/go-chi/chi/v5"
+	"github.com/user/go-templates/template-nodbm/pkg/auth"
+	"github.com/user/go-templates/template-nodbm/pkg/authz"
+	"github.com/user/go-templates/template-nodbm/pkg/fieldmask"
+	"github.com/user/go-templates/template-nodbm/pkg/idgen"
+	"github.com/user/go-templates/template-nodbm/pkg/logger"
 	"go.uber.org/zap"
 )
 
 // --- Domain ---
 
+// Permissions guarding user operations.
+const (
+	PermissionRead  = "users:read"
+	PermissionWrite = "users:write"
+	// PermissionAdmin lets a caller act on any user, not only themselves.
+	PermissionAdmin = "users:admin"
+	// PermissionSearch lets a caller search across all users.
+	PermissionSearch = "users:search"
+)
+
+var ErrNotFound = errors.New("user not found")
+
+// ErrInvalidID reports an ID that is not written in the format of the
+// service's idgen.Generator.
+var ErrInvalidID = errors.New("invalid user id")
+
+// Search limits. Queries shorter than MinSearchLength match too much to be
+// useful.
+const (
+	MinSearchLength    = 3
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// MaxImportUsers caps the users created by one ImportUsers call.
+const MaxImportUsers = 1000
+
+var (
+	ErrSearchQueryTooShort = fmt.Errorf("search query must be at least %d characters", MinSearchLength)
+	ErrSearchUnsupported   = errors.New("user search is not supported by this repository")
+)
+
+// User is the domain entity. Its wire formats live in the versioned handler
+// packages (v1, v2), so fields can be added here without breaking clients.
 type User struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// LastModified is when the user was last written, for Last-Modified headers.
+// It is zero if neither timestamp was loaded.
+func (u *User) LastModified() time.Time {
+	if u.UpdatedAt.After(u.CreatedAt) {
+		return u.UpdatedAt
+	}
+	return u.CreatedAt
 }
 
+// Fields are the user attributes that can be selected with a fieldmask.Mask.
+var Fields = []string{"id", "name", "email", "created_at", "updated_at"}
+
 type Repository interface {
-	Get(ctx context.Context, id string) (*User, error)
+	// Get loads only the fields selected by fields, leaving the others zero;
+	// an empty mask loads every field.
+	Get(ctx context.Context, id string, fields fieldmask.Mask) (*User, error)
+	// Create stores user under the ID the service generated for it.
 	Create(ctx context.Context, user *User) error
+	// Update replaces name and email and fills in the stored CreatedAt and
+	// UpdatedAt. It returns ErrNotFound when no user has the ID.
+	Update(ctx context.Context, user *User) error
+	Delete(ctx context.Context, id string) error
+}
+
+// Searcher is implemented by repositories that can search users by name or
+// email. Results are ordered by relevance, best match first, with newer
+// users first among equal matches.
+type Searcher interface {
+	Search(ctx context.Context, query string, limit, offset int) ([]*User, error)
+}
+
+// ImportResult reports a bulk import. Failed holds the reason each user that
+// was not created failed, keyed by its index in the input.
+type ImportResult struct {
+	Created int
+	Failed  map[int]error
 }
 
 type Service interface {
-	GetUser(ctx context.Context, id string) (*User, error)
+	// GetUser returns fieldmask.ErrUnknownField when fields selects an
+	// attribute outside Fields. It and the other methods taking an ID return
+	// ErrInvalidID for IDs the service's idgen.Generator cannot parse.
+	GetUser(ctx context.Context, id string, fields fieldmask.Mask) (*User, error)
+	// CreateUser gives user a new ID, replacing any it had.
 	CreateUser(ctx context.Context, user *User) error
+	UpdateUser(ctx context.Context, user *User) error
+	DeleteUser(ctx context.Context, id string) error
+	// SearchUsers returns ErrSearchQueryTooShort for short queries and
+	// ErrSearchUnsupported when the repository is not a Searcher. limit is
+	// clamped to MaxSearchLimit and defaults to DefaultSearchLimit.
+	SearchUsers(ctx context.Context, query string, limit, offset int) ([]*User, error)
+	// ImportUsers creates users in order and calls progress, if not nil,
+	// with the number handled after each one. A user that cannot be created
+	// is recorded in the result and does not stop the import. It requires
+	// PermissionAdmin, and returns the partial result with ctx's error once
+	// ctx is cancelled.
+	ImportUsers(ctx context.Context, users []*User, progress func(done int)) (*ImportResult, error)
+}
+
+// --- Events ---
+
+// Event types published after successful writes.
+const (
+	EventCreated = "user.created"
+	EventUpdated = "user.updated"
+	EventDeleted = "user.deleted"
+)
+
+// Event describes a change to a user. Deletions only carry User.ID.
+type Event struct {
+	Type string    `json:"type"`
+	User User      `json:"user"`
+	Time time.Time `json:"time"`
+}
+
+// Publisher receives the service's events; *broker.Broker[Event] implements
+// it. Publish is called synchronously after each write and should return
+// quickly.
+type Publisher interface {
+	Publish(e Event)
+}
+
+// Publishers fans events out to several publishers in order.
+type Publishers []Publisher
+
+func (p Publishers) Publish(e Event) {
+	for _, pub := range p {
+		pub.Publish(e)
+	}
 }
 
 // --- Service Implementation ---
 
 type userService struct {
 	repo   Repository
-	logger *zap.Logger
+	ids    idgen.Generator
+	events Publisher
 }
 
-func NewService(repo Repository, logger *zap.Logger) Service {
+// NewService returns the user service. ids generates the IDs of new users
+// and parses the IDs callers send. events may be nil when nothing consumes
+// user events.
+func NewService(repo Repository, ids idgen.Generator, events Publisher) Service {
 	return &userService{
 		repo:   repo,
-		logger: logger,
+		ids:    ids,
+		events: events,
 	}
 }
 
-func (s *userService) GetUser(ctx context.Context, id string) (*User, error) {
-	s.logger.Info("fetching user", zap.String("id", id))
-	return s.repo.Get(ctx, id)
+func (s *userService) GetUser(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+	logger.FromContext(ctx).Info("fetching user", zap.String("id", id))
+	if err := fields.Validate(Fields); err != nil {
+		return nil, err
+	}
+	id, err := s.parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeAccess(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.Get(ctx, id, fields)
 }
 
 func (s *userService) CreateUser(ctx context.Context, user *User) error {
-	s.logger.Info("creating user", zap.String("email", user.Email))
-	return s.repo.Create(ctx, user)
+	logger.FromContext(ctx).Info("creating user", zap.String("email", user.Email))
+	user.ID = s.ids.New()
+	if err := s.repo.Create(ctx, user); err != nil {
+		return err
+	}
+	s.publish(EventCreated, *user)
+	return nil
 }
 
-// --- Handler ---
+func (s *userService) UpdateUser(ctx context.Context, user *User) error {
+	logger.FromContext(ctx).Info("updating user", zap.String("id", user.ID))
+	id, err := s.parseID(user.ID)
+	if err != nil {
+		return err
+	}
+	user.ID = id
+	if err := authorizeAccess(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := s.repo.Update(ctx, user); err != nil {
+		return err
+	}
+	s.publish(EventUpdated, *user)
+	return nil
+}
 
-type Handler struct {
-	svc Service
+func (s *userService) DeleteUser(ctx context.Context, id string) error {
+	logger.FromContext(ctx).Info("deleting user", zap.String("id", id))
+	id, err := s.parseID(id)
+	if err != nil {
+		return err
+	}
+	if err := authorizeAccess(ctx, id); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.publish(EventDeleted, User{ID: id})
+	return nil
 }
 
-func NewHandler(svc Service) *Handler {
-	return &Handler{svc: svc}
+func (s *userService) SearchUsers(ctx context.Context, query string, limit, offset int) ([]*User, error) {
+	logger.FromContext(ctx).Info("searching users", zap.String("query", query))
+	query = strings.TrimSpace(query)
+	if utf8.RuneCountInString(query) < MinSearchLength {
+		return nil, ErrSearchQueryTooShort
+	}
+	searcher, ok := s.repo.(Searcher)
+	if !ok {
+		return nil, ErrSearchUnsupported
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	limit = min(limit, MaxSearchLimit)
+	offset = max(offset, 0)
+	return searcher.Search(ctx, query, limit, offset)
 }
 
-func (h *Handler) RegisterRoutes(r chi.Router) {
-	r.Get("/users/{id}", h.GetUser)
-	r.Post("/users", h.CreateUser)
+func (s *userService) ImportUsers(ctx context.Context, users []*User, progress func(done int)) (*ImportResult, error) {
+	logger.FromContext(ctx).Info("importing users", zap.Int("count", len(users)))
+	if err := authz.Check(ctx, PermissionAdmin); err != nil {
+		return nil, err
+	}
+
+	res := &ImportResult{Failed: make(map[int]error)}
+	for i, u := range users {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		if err := s.CreateUser(ctx, u); err != nil {
+			res.Failed[i] = err
+		} else {
+			res.Created++
+		}
+		if progress != nil {
+			progress(i + 1)
+		}
+	}
+	return res, nil
 }
 
-func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	user, err := h.svc.GetUser(r.Context(), id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+func (s *userService) publish(eventType string, user User) {
+	if s.events == nil {
 		return
 	}
-	json.NewEncoder(w).Encode(user)
+	s.events.Publish(Event{Type: eventType, User: user, Time: time.Now().UTC()})
 }
 
-func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	var user User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
-		return
+// parseID validates an ID sent by a caller and returns it in the canonical
+// form IDs are stored in, so that every way of writing it finds the user.
+func (s *userService) parseID(id string) (string, error) {
+	b, err := s.ids.Parse(id)
+	if err != nil {
+		return "", ErrInvalidID
 	}
-	if err := h.svc.CreateUser(r.Context(), &user); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	return s.ids.Format(b), nil
+}
+
+// authorizeAccess lets callers access their own record; any other record
+// requires PermissionAdmin.
+func authorizeAccess(ctx context.Context, id string) error {
+	if claims, ok := auth.FromContext(ctx); ok && claims.Subject == id {
+		return nil
 	}
-	w.WriteHeader(http.StatusCreated)
+	return authz.Check(ctx, PermissionAdmin)
 }
 
 // --- Memory Repository ---
@@ -104,24 +310,126 @@ func NewMemoryRepository() *MemoryRepository {
 	}
 }
 
-func (r *MemoryRepository) Get(ctx context.Context, id string) (*User, error) {
+func (r *MemoryRepository) Get(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+	logger.FromContext(ctx).Debug("querying user", zap.String("id", id))
+
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	user, ok := r.users[id]
 	if !ok {
-		return nil, errors.New("user not found")
+		return nil, ErrNotFound
+	}
+	if len(fields) == 0 {
+		return user, nil
+	}
+
+	selected := &User{}
+	if fields.Has("id") {
+		selected.ID = user.ID
 	}
-	return user, nil
+	if fields.Has("name") {
+		selected.Name = user.Name
+	}
+	if fields.Has("email") {
+		selected.Email = user.Email
+	}
+	if fields.Has("created_at") {
+		selected.CreatedAt = user.CreatedAt
+	}
+	return selected, nil
 }
 
 func (r *MemoryRepository) Create(ctx context.Context, user *User) error {
+	logger.FromContext(ctx).Debug("inserting user", zap.String("email", user.Email))
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	if _, ok := r.users[user.ID]; ok {
 		return errors.New("user already exists")
 	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now().UTC()
+	}
+	user.UpdatedAt = user.CreatedAt
 	r.users[user.ID] = user
 	return nil
 }
+
+func (r *MemoryRepository) Update(ctx context.Context, user *User) error {
+	logger.FromContext(ctx).Debug("updating user", zap.String("id", user.ID))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.users[user.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	user.CreatedAt = existing.CreatedAt
+	user.UpdatedAt = time.Now().UTC()
+	r.users[user.ID] = user
+	return nil
+}
+
+func (r *MemoryRepository) Delete(ctx context.Context, id string) error {
+	logger.FromContext(ctx).Debug("deleting user", zap.String("id", id))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.users, id)
+	return nil
+}
+
+// Search scans every user, matching the query as a case-insensitive
+// substring of name or email. Exact matches rank above prefixes and prefixes
+// above other substrings; name matches weigh twice as much as email matches.
+func (r *MemoryRepository) Search(ctx context.Context, query string, limit, offset int) ([]*User, error) {
+	logger.FromContext(ctx).Debug("searching users", zap.String("query", query))
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type match struct {
+		user  *User
+		score int
+	}
+	query = strings.ToLower(query)
+	var matches []match
+	for _, user := range r.users {
+		score := max(2*matchScore(strings.ToLower(user.Name), query), matchScore(strings.ToLower(user.Email), query))
+		if score > 0 {
+			matches = append(matches, match{user: user, score: score})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].user.CreatedAt.After(matches[j].user.CreatedAt)
+	})
+
+	users := []*User{}
+	for _, m := range matches[min(offset, len(matches)):min(offset+limit, len(matches))] {
+		users = append(users, m.user)
+	}
+	return users, nil
+}
+
+func matchScore(s, query string) int {
+	switch {
+	case s == query:
+		return 3
+	case strings.HasPrefix(s, query):
+		return 2
+	case strings.Contains(s, query):
+		return 1
+	default:
+		return 0
+	}
+}
@@ -1,28 +1,38 @@
 package user
 
 import (
-	"bytes"
 	"context"
 	"errors"
-	"net/http"
-	"net/http/httptest"
+	"fmt"
+	"slices"
 	"strings"
 	"testing"
 
-	"github.com/go-chi/chi/v5"
-	"go.uber.org/zap"
+	"github.com/user/go-templates/template-nodbm/pkg/auth"
+	"github.com/user/go-templates/template-nodbm/pkg/authz"
+	"github.com/user/go-templates/template-nodbm/pkg/fieldmask"
+	"github.com/user/go-templates/template-nodbm/pkg/idgen"
 )
 
 // --- Mocks ---
 
+// IDs of the users the service tests act on, written the way idgen.UUIDv7
+// writes them.
+const (
+	testUserID  = "0190a0b4-3f1c-7c2a-9b1e-5d2f8a4c6e01"
+	otherUserID = "0190a0b4-3f1c-7c2a-9b1e-5d2f8a4c6e02"
+)
+
 type mockRepository struct {
-	GetFunc    func(ctx context.Context, id string) (*User, error)
+	GetFunc    func(ctx context.Context, id string, fields fieldmask.Mask) (*User, error)
 	CreateFunc func(ctx context.Context, user *User) error
+	UpdateFunc func(ctx context.Context, user *User) error
+	DeleteFunc func(ctx context.Context, id string) error
 }
 
-func (m *mockRepository) Get(ctx context.Context, id string) (*User, error) {
+func (m *mockRepository) Get(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
 	if m.GetFunc != nil {
-		return m.GetFunc(ctx, id)
+		return m.GetFunc(ctx, id, fields)
 	}
 	return nil, errors.New("unimplemented")
 }
@@ -34,30 +44,44 @@ func (m *mockRepository) Create(ctx context.Context, user *User) error {
 	return errors.New("unimplemented")
 }
 
-type mockService struct {
-	GetUserFunc    func(ctx context.Context, id string) (*User, error)
-	CreateUserFunc func(ctx context.Context, user *User) error
+func (m *mockRepository) Update(ctx context.Context, user *User) error {
+	if m.UpdateFunc != nil {
+		return m.UpdateFunc(ctx, user)
+	}
+	return errors.New("unimplemented")
 }
 
-func (m *mockService) GetUser(ctx context.Context, id string) (*User, error) {
-	if m.GetUserFunc != nil {
-		return m.GetUserFunc(ctx, id)
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	if m.DeleteFunc != nil {
+		return m.DeleteFunc(ctx, id)
 	}
-	return nil, errors.New("unimplemented")
+	return errors.New("unimplemented")
+}
+
+// searchRepository is a mockRepository that also implements Searcher.
+type searchRepository struct {
+	mockRepository
+	SearchFunc func(ctx context.Context, query string, limit, offset int) ([]*User, error)
 }
 
-func (m *mockService) CreateUser(ctx context.Context, user *User) error {
-	if m.CreateUserFunc != nil {
-		return m.CreateUserFunc(ctx, user)
+func (m *searchRepository) Search(ctx context.Context, query string, limit, offset int) ([]*User, error) {
+	if m.SearchFunc != nil {
+		return m.SearchFunc(ctx, query, limit, offset)
 	}
-	return errors.New("unimplemented")
+	return nil, errors.New("unimplemented")
+}
+
+type recordingPublisher struct {
+	events []Event
+}
+
+func (p *recordingPublisher) Publish(e Event) {
+	p.events = append(p.events, e)
 }
 
 // --- Service Tests ---
 
 func TestUserService_GetUser(t *testing.T) {
-	logger := zap.NewNop()
-
 	tests := []struct {
 		name          string
 		userID        string
@@ -67,22 +91,22 @@ func TestUserService_GetUser(t *testing.T) {
 	}{
 		{
 			name:   "Success",
-			userID: "123",
+			userID: testUserID,
 			mockBehavior: func(m *mockRepository) {
-				m.GetFunc = func(ctx context.Context, id string) (*User, error) {
-					if id != "123" {
+				m.GetFunc = func(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+					if id != testUserID {
 						return nil, errors.New("unexpected id")
 					}
-					return &User{ID: "123", Name: "John Doe", Email: "john@example.com"}, nil
+					return &User{ID: testUserID, Name: "John Doe", Email: "john@example.com"}, nil
 				}
 			},
-			expectedUser: &User{ID: "123", Name: "John Doe", Email: "john@example.com"},
+			expectedUser: &User{ID: testUserID, Name: "John Doe", Email: "john@example.com"},
 		},
 		{
 			name:   "NotFound",
-			userID: "999",
+			userID: otherUserID,
 			mockBehavior: func(m *mockRepository) {
-				m.GetFunc = func(ctx context.Context, id string) (*User, error) {
+				m.GetFunc = func(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
 					return nil, errors.New("user not found")
 				}
 			},
@@ -95,8 +119,8 @@ func TestUserService_GetUser(t *testing.T) {
 			mockRepo := &mockRepository{}
 			tt.mockBehavior(mockRepo)
 
-			svc := NewService(mockRepo, logger)
-			user, err := svc.GetUser(context.Background(), tt.userID)
+			svc := NewService(mockRepo, idgen.UUIDv7{}, nil)
+			user, err := svc.GetUser(context.Background(), tt.userID, nil)
 
 			if tt.expectedError != "" {
 				if err == nil || err.Error() != tt.expectedError {
@@ -114,9 +138,47 @@ func TestUserService_GetUser(t *testing.T) {
 	}
 }
 
-func TestUserService_CreateUser(t *testing.T) {
-	logger := zap.NewNop()
+func TestUserService_IDs(t *testing.T) {
+	var got string
+	repo := &mockRepository{
+		GetFunc: func(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+			got = id
+			return &User{ID: id}, nil
+		},
+	}
+	svc := NewService(repo, idgen.UUIDv7{}, nil)
+	ctx := context.Background()
+
+	// IDs reach the repository in canonical form.
+	if _, err := svc.GetUser(ctx, strings.ToUpper(testUserID), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got != testUserID {
+		t.Errorf("expected %q, got %q", testUserID, got)
+	}
 
+	calls := map[string]func(id string) error{
+		"GetUser": func(id string) error {
+			_, err := svc.GetUser(ctx, id, nil)
+			return err
+		},
+		"UpdateUser": func(id string) error {
+			return svc.UpdateUser(ctx, &User{ID: id, Name: "Jane"})
+		},
+		"DeleteUser": func(id string) error {
+			return svc.DeleteUser(ctx, id)
+		},
+	}
+	for name, call := range calls {
+		for _, id := range []string{"", "123", testUserID + "0", "01ARYZ6S41TSV4RRFFQ69G5FAV"} {
+			if err := call(id); !errors.Is(err, ErrInvalidID) {
+				t.Errorf("%s(%q): expected ErrInvalidID, got %v", name, id, err)
+			}
+		}
+	}
+}
+
+func TestUserService_CreateUser(t *testing.T) {
 	tests := []struct {
 		name          string
 		inputUser     *User
@@ -128,7 +190,9 @@ func TestUserService_CreateUser(t *testing.T) {
 			inputUser: &User{Name: "Jane Doe", Email: "jane@example.com"},
 			mockBehavior: func(m *mockRepository) {
 				m.CreateFunc = func(ctx context.Context, user *User) error {
-					user.ID = "generated-id"
+					if _, err := (idgen.UUIDv7{}).Parse(user.ID); err != nil {
+						return fmt.Errorf("expected a generated ID, got %q", user.ID)
+					}
 					return nil
 				}
 			},
@@ -150,7 +214,7 @@ func TestUserService_CreateUser(t *testing.T) {
 			mockRepo := &mockRepository{}
 			tt.mockBehavior(mockRepo)
 
-			svc := NewService(mockRepo, logger)
+			svc := NewService(mockRepo, idgen.UUIDv7{}, nil)
 			err := svc.CreateUser(context.Background(), tt.inputUser)
 
 			if tt.expectedError != "" {
@@ -166,123 +230,263 @@ func TestUserService_CreateUser(t *testing.T) {
 	}
 }
 
-// --- Handler Tests ---
+func TestUserService_CreateUser_MemoryRepository(t *testing.T) {
+	svc := NewService(NewMemoryRepository(), idgen.UUIDv7{}, nil)
+	ctx := context.Background()
+
+	users := []*User{
+		{Name: "Ada", Email: "ada@example.com"},
+		{Name: "Alan", Email: "alan@example.com"},
+	}
+	for _, u := range users {
+		if err := svc.CreateUser(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if users[0].ID == users[1].ID {
+		t.Fatalf("expected distinct IDs, got %q twice", users[0].ID)
+	}
+	for _, u := range users {
+		got, err := svc.GetUser(ctx, u.ID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Email != u.Email {
+			t.Errorf("expected %q under %q, got %q", u.Email, u.ID, got.Email)
+		}
+	}
+}
+
+func TestUserService_GetUser_Authorization(t *testing.T) {
+	repo := &mockRepository{
+		GetFunc: func(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+			return &User{ID: id}, nil
+		},
+	}
+	svc := NewService(repo, idgen.UUIDv7{}, nil)
+	authorizer := authz.NewAuthorizer(authz.StaticRoles{
+		"admin": {"*"},
+		"user":  {PermissionRead},
+	}, 0)
 
-func TestHandler_GetUser(t *testing.T) {
 	tests := []struct {
-		name           string
-		userID         string
-		mockBehavior   func(m *mockService)
-		expectedStatus int
-		expectedBody   string
+		name          string
+		claims        *auth.Claims
+		userID        string
+		expectedError error
 	}{
-		{
-			name:   "Success",
-			userID: "123",
-			mockBehavior: func(m *mockService) {
-				m.GetUserFunc = func(ctx context.Context, id string) (*User, error) {
-					return &User{ID: "123", Name: "John", Email: "john@example.com"}, nil
-				}
-			},
-			expectedStatus: http.StatusOK,
-			expectedBody:   `{"id":"123","name":"John","email":"john@example.com"}`,
-		},
-		{
-			name:   "NotFound",
-			userID: "999",
-			mockBehavior: func(m *mockService) {
-				m.GetUserFunc = func(ctx context.Context, id string) (*User, error) {
-					return nil, errors.New("not found")
-				}
-			},
-			expectedStatus: http.StatusNotFound,
-			expectedBody:   "not found",
-		},
+		{name: "Internal", userID: testUserID},
+		{name: "Self", claims: &auth.Claims{Roles: []string{"user"}}, userID: testUserID},
+		{name: "Other", claims: &auth.Claims{Roles: []string{"user"}}, userID: otherUserID, expectedError: authz.ErrPermissionDenied},
+		{name: "Admin", claims: &auth.Claims{Roles: []string{"admin"}}, userID: otherUserID},
+		{name: "AdminScope", claims: &auth.Claims{Scope: PermissionAdmin}, userID: otherUserID},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockSvc := &mockService{}
-			tt.mockBehavior(mockSvc)
-
-			handler := NewHandler(mockSvc)
-			r := chi.NewRouter()
-			r.Get("/users/{id}", handler.GetUser)
-
-			req := httptest.NewRequest("GET", "/users/"+tt.userID, nil)
-			w := httptest.NewRecorder()
-
-			r.ServeHTTP(w, req)
-
-			if w.Code != tt.expectedStatus {
-				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			ctx := authz.NewContext(context.Background(), authorizer)
+			if tt.claims != nil {
+				tt.claims.Subject = testUserID
+				ctx = auth.NewContext(ctx, tt.claims)
 			}
-			if tt.expectedBody != "" {
-				body := strings.TrimSpace(w.Body.String())
-				if !strings.Contains(body, tt.expectedBody) {
-					// Relaxed check for JSON formatting differences
-					if body != tt.expectedBody && !strings.Contains(body, `"id":"123"`) {
-						t.Errorf("expected body to contain %q, got %q", tt.expectedBody, body)
-					}
-				}
+
+			_, err := svc.GetUser(ctx, tt.userID, nil)
+			if !errors.Is(err, tt.expectedError) {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
 			}
 		})
 	}
 }
 
-func TestHandler_CreateUser(t *testing.T) {
-	tests := []struct {
-		name           string
-		inputBody      string
-		mockBehavior   func(m *mockService)
-		expectedStatus int
-	}{
-		{
-			name:      "Success",
-			inputBody: `{"name":"John","email":"john@example.com"}`,
-			mockBehavior: func(m *mockService) {
-				m.CreateUserFunc = func(ctx context.Context, user *User) error {
-					return nil
-				}
-			},
-			expectedStatus: http.StatusCreated,
+func TestUserService_Events(t *testing.T) {
+	failing := errors.New("db error")
+	repo := &mockRepository{
+		CreateFunc: func(ctx context.Context, user *User) error {
+			if user.Email == "" {
+				return failing
+			}
+			user.ID = testUserID
+			return nil
 		},
-		{
-			name:      "InvalidJSON",
-			inputBody: `{"name":`,
-			mockBehavior: func(m *mockService) {
-			},
-			expectedStatus: http.StatusBadRequest,
+		UpdateFunc: func(ctx context.Context, user *User) error {
+			if user.ID != testUserID {
+				return ErrNotFound
+			}
+			return nil
 		},
-		{
-			name:      "InternalError",
-			inputBody: `{"name":"John"}`,
-			mockBehavior: func(m *mockService) {
-				m.CreateUserFunc = func(ctx context.Context, user *User) error {
-					return errors.New("internal error")
-				}
-			},
-			expectedStatus: http.StatusInternalServerError,
+		DeleteFunc: func(ctx context.Context, id string) error {
+			return nil
+		},
+	}
+	events := &recordingPublisher{}
+	svc := NewService(repo, idgen.UUIDv7{}, events)
+	ctx := context.Background()
+
+	if err := svc.CreateUser(ctx, &User{Name: "Jane", Email: "jane@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CreateUser(ctx, &User{Name: "Jane"}); !errors.Is(err, failing) {
+		t.Fatalf("expected %v, got %v", failing, err)
+	}
+	if err := svc.UpdateUser(ctx, &User{ID: testUserID, Name: "Jane Doe"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.UpdateUser(ctx, &User{ID: otherUserID}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+	// Denied writes must not publish either.
+	claims := &auth.Claims{}
+	claims.Subject = otherUserID
+	denied := auth.NewContext(authz.NewContext(ctx, authz.NewAuthorizer(authz.StaticRoles{}, 0)), claims)
+	if err := svc.DeleteUser(denied, testUserID); !errors.Is(err, authz.ErrPermissionDenied) {
+		t.Fatalf("expected %v, got %v", authz.ErrPermissionDenied, err)
+	}
+	if err := svc.DeleteUser(ctx, testUserID); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Event{
+		{Type: EventCreated, User: User{ID: testUserID, Name: "Jane", Email: "jane@example.com"}},
+		{Type: EventUpdated, User: User{ID: testUserID, Name: "Jane Doe"}},
+		{Type: EventDeleted, User: User{ID: testUserID}},
+	}
+	if len(events.events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), events.events)
+	}
+	for i, e := range events.events {
+		if e.Type != expected[i].Type || e.User != expected[i].User || e.Time.IsZero() {
+			t.Errorf("event %d: expected %+v, got %+v", i, expected[i], e)
+		}
+	}
+}
+
+func TestUserService_SearchUsers(t *testing.T) {
+	type page struct {
+		query         string
+		limit, offset int
+	}
+	var got page
+	repo := &searchRepository{
+		SearchFunc: func(ctx context.Context, query string, limit, offset int) ([]*User, error) {
+			got = page{query, limit, offset}
+			return []*User{{ID: testUserID, Name: "Ada Lovelace"}}, nil
 		},
 	}
+	svc := NewService(repo, idgen.UUIDv7{}, nil)
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		in            page
+		expected      page
+		expectedError error
+	}{
+		{name: "Success", in: page{"ada", 5, 10}, expected: page{"ada", 5, 10}},
+		{name: "Trimmed", in: page{"  ada  ", 5, 0}, expected: page{"ada", 5, 0}},
+		{name: "DefaultLimit", in: page{"ada", 0, -1}, expected: page{"ada", DefaultSearchLimit, 0}},
+		{name: "MaxLimit", in: page{"ada", 1000, 0}, expected: page{"ada", MaxSearchLimit, 0}},
+		{name: "TooShort", in: page{" ad ", 5, 0}, expectedError: ErrSearchQueryTooShort},
+	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockSvc := &mockService{}
-			tt.mockBehavior(mockSvc)
+			got = page{}
+			users, err := svc.SearchUsers(ctx, tt.in.query, tt.in.limit, tt.in.offset)
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("expected error %v, got %v", tt.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			if got != tt.expected {
+				t.Errorf("expected search %+v, got %+v", tt.expected, got)
+			}
+			if len(users) != 1 || users[0].ID != testUserID {
+				t.Errorf("unexpected users %+v", users)
+			}
+		})
+	}
 
-			handler := NewHandler(mockSvc)
-			r := chi.NewRouter()
-			r.Post("/users", handler.CreateUser)
+	t.Run("Unsupported", func(t *testing.T) {
+		svc := NewService(&mockRepository{}, idgen.UUIDv7{}, nil)
+		if _, err := svc.SearchUsers(ctx, "ada", 5, 0); !errors.Is(err, ErrSearchUnsupported) {
+			t.Errorf("expected error %v, got %v", ErrSearchUnsupported, err)
+		}
+	})
+}
 
-			req := httptest.NewRequest("POST", "/users", bytes.NewBufferString(tt.inputBody))
-			w := httptest.NewRecorder()
+func TestUserService_GetUser_Fields(t *testing.T) {
+	var got fieldmask.Mask
+	repo := &mockRepository{
+		GetFunc: func(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+			got = fields
+			return &User{ID: id}, nil
+		},
+	}
+	svc := NewService(repo, idgen.UUIDv7{}, nil)
 
-			r.ServeHTTP(w, req)
+	if _, err := svc.GetUser(context.Background(), testUserID, fieldmask.Mask{"id", "name"}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, fieldmask.Mask{"id", "name"}) {
+		t.Errorf("expected fields to reach the repository, got %v", got)
+	}
 
-			if w.Code != tt.expectedStatus {
-				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+	got = nil
+	if _, err := svc.GetUser(context.Background(), testUserID, fieldmask.Mask{"password"}); !errors.Is(err, fieldmask.ErrUnknownField) {
+		t.Errorf("expected error %v, got %v", fieldmask.ErrUnknownField, err)
+	}
+	if got != nil {
+		t.Error("unknown fields must not reach the repository")
+	}
+}
+
+func TestUserService_ImportUsers(t *testing.T) {
+	repo := &mockRepository{
+		CreateFunc: func(ctx context.Context, user *User) error {
+			if user.Email == "taken@example.com" {
+				return errors.New("duplicate email")
 			}
-		})
+			user.ID = "id-" + user.Name
+			return nil
+		},
 	}
+	pub := &recordingPublisher{}
+	svc := NewService(repo, idgen.UUIDv7{}, pub)
+	users := []*User{
+		{Name: "Ada", Email: "ada@example.com"},
+		{Name: "Taken", Email: "taken@example.com"},
+		{Name: "Alan", Email: "alan@example.com"},
+	}
+
+	var progress []int
+	res, err := svc.ImportUsers(context.Background(), users, func(done int) { progress = append(progress, done) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Created != 2 || len(res.Failed) != 1 || res.Failed[1] == nil {
+		t.Errorf("expected 2 created and user 1 failed, got %+v", res)
+	}
+	if !slices.Equal(progress, []int{1, 2, 3}) {
+		t.Errorf("expected progress after every user, got %v", progress)
+	}
+	if len(pub.events) != 2 {
+		t.Errorf("expected an event per created user, got %d", len(pub.events))
+	}
+
+	t.Run("Forbidden", func(t *testing.T) {
+		ctx := authz.NewContext(context.Background(), authz.NewAuthorizer(authz.StaticRoles{"user": {PermissionWrite}}, 0))
+		ctx = auth.NewContext(ctx, &auth.Claims{Roles: []string{"user"}})
+		if _, err := svc.ImportUsers(ctx, users, nil); !errors.Is(err, authz.ErrPermissionDenied) {
+			t.Errorf("expected error %v, got %v", authz.ErrPermissionDenied, err)
+		}
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		res, err := svc.ImportUsers(ctx, users, func(done int) { cancel() })
+		if !errors.Is(err, context.Canceled) || res.Created != 1 {
+			t.Errorf("expected the import to stop after one user, got %+v, %v", res, err)
+		}
+	})
 }
@@ -0,0 +1,773 @@
+// Package webhook delivers user lifecycle events to subscriber URLs. Events
+// are stored as pending deliveries when the user service publishes them and
+// sent by a background worker, which retries failures with exponential
+// backoff and dead-letters deliveries that keep failing. Delivery is at least
+// once; receivers should deduplicate on the Webhook-Id header.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/go-templates/template-nodbm/internal/user"
+	"github.com/user/go-templates/template-nodbm/pkg/authz"
+	"github.com/user/go-templates/template-nodbm/pkg/jsonbody"
+	"github.com/user/go-templates/template-nodbm/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// PermissionManage is required to manage subscriptions and inspect deliveries.
+const PermissionManage = "webhooks:manage"
+
+// EventAll subscribes to every event type.
+const EventAll = "*"
+
+// secretPrefix marks signing secrets so they are easy to recognise in secret scanners.
+const secretPrefix = "whsec_"
+
+// Headers sent with every delivery.
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+)
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+var (
+	ErrNotFound         = errors.New("webhook not found")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// eventTypes are the events a subscription may list besides EventAll.
+var eventTypes = map[string]bool{
+	user.EventCreated: true,
+	user.EventUpdated: true,
+	user.EventDeleted: true,
+}
+
+// --- Domain ---
+
+// Subscription receives the listed event types at URL. Secret signs the
+// payloads; it is returned once, on creation.
+type Subscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Matches reports whether the subscription wants events of the given type.
+func (s *Subscription) Matches(eventType string) bool {
+	for _, e := range s.Events {
+		if e == EventAll || e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is one event sent, or to be sent, to one subscription.
+type Delivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastError      string          `json:"last_error,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      user.User `json:"data"`
+}
+
+type Repository interface {
+	CreateSubscription(ctx context.Context, sub *Subscription) error
+	GetSubscription(ctx context.Context, id string) (*Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]*Subscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	CreateDelivery(ctx context.Context, d *Delivery) error
+	// ListDueDeliveries returns up to limit pending deliveries whose next
+	// attempt is at or before now, oldest first.
+	ListDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*Delivery, error)
+	UpdateDelivery(ctx context.Context, d *Delivery) error
+	// ListDeliveries returns a subscription's deliveries, newest first.
+	ListDeliveries(ctx context.Context, subscriptionID string, limit, offset int) ([]*Delivery, error)
+	// RetryDelivery makes a dead delivery pending again with its attempts
+	// reset. It returns ErrNotFound unless the delivery exists and is dead.
+	RetryDelivery(ctx context.Context, subscriptionID, id string, at time.Time) error
+}
+
+type Service interface {
+	CreateSubscription(ctx context.Context, url string, events []string) (*Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]*Subscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	ListDeliveries(ctx context.Context, subscriptionID string, limit, offset int) ([]*Delivery, error)
+	RetryDelivery(ctx context.Context, subscriptionID, id string) error
+}
+
+// --- Signing ---
+
+// Sign returns the Webhook-Signature value for body sent at timestamp, the
+// Webhook-Timestamp value in Unix seconds: "sha256=" followed by the hex
+// HMAC-SHA256 of timestamp + "." + body.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature headers of a received delivery. Deliveries
+// whose timestamp is further than tolerance from now are rejected to limit
+// replays; zero disables the check.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp := header.Get(HeaderTimestamp)
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 {
+		if skew := time.Since(time.Unix(sec, 0)); skew > tolerance || skew < -tolerance {
+			return ErrInvalidSignature
+		}
+	}
+	if !hmac.Equal([]byte(header.Get(HeaderSignature)), []byte(Sign(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// --- Service Implementation ---
+
+type webhookService struct {
+	repo Repository
+}
+
+func NewService(repo Repository) Service {
+	return &webhookService{repo: repo}
+}
+
+func (s *webhookService) CreateSubscription(ctx context.Context, rawURL string, events []string) (*Subscription, error) {
+	logger.FromContext(ctx).Info("creating webhook subscription", zap.String("url", rawURL))
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("events is required")
+	}
+	for _, e := range events {
+		if e != EventAll && !eventTypes[e] {
+			return nil, fmt.Errorf("unknown event type %q", e)
+		}
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	sub := &Subscription{
+		URL:    rawURL,
+		Secret: secretPrefix + secret,
+		Events: events,
+	}
+	if err := s.repo.CreateSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (s *webhookService) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	return s.repo.ListSubscriptions(ctx)
+}
+
+func (s *webhookService) DeleteSubscription(ctx context.Context, id string) error {
+	logger.FromContext(ctx).Info("deleting webhook subscription", zap.String("id", id))
+	return s.repo.DeleteSubscription(ctx, id)
+}
+
+func (s *webhookService) ListDeliveries(ctx context.Context, subscriptionID string, limit, offset int) ([]*Delivery, error) {
+	if _, err := s.repo.GetSubscription(ctx, subscriptionID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListDeliveries(ctx, subscriptionID, limit, offset)
+}
+
+func (s *webhookService) RetryDelivery(ctx context.Context, subscriptionID, id string) error {
+	logger.FromContext(ctx).Info("retrying webhook delivery", zap.String("id", id))
+	return s.repo.RetryDelivery(ctx, subscriptionID, id, time.Now())
+}
+
+// --- Dispatcher ---
+
+// Dispatcher turns user events into pending deliveries. It implements
+// user.Publisher.
+type Dispatcher struct {
+	repo Repository
+}
+
+func NewDispatcher(repo Repository) *Dispatcher {
+	return &Dispatcher{repo: repo}
+}
+
+// Publish enqueues e. The user write has already succeeded, so failures are
+// logged rather than returned.
+func (d *Dispatcher) Publish(e user.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Enqueue(ctx, e); err != nil {
+		zap.L().Error("cannot enqueue webhook deliveries", zap.String("event", e.Type), zap.Error(err))
+	}
+}
+
+// Enqueue stores a pending delivery of e for every matching subscription.
+// All deliveries of one event share its Webhook-Id.
+func (d *Dispatcher) Enqueue(ctx context.Context, e user.Event) error {
+	subs, err := d.repo.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	var eventID string
+	for _, sub := range subs {
+		if !sub.Matches(e.Type) {
+			continue
+		}
+		if body == nil {
+			id, err := randomHex(16)
+			if err != nil {
+				return err
+			}
+			eventID = "evt_" + id
+			body, err = json.Marshal(Payload{ID: eventID, Type: e.Type, CreatedAt: e.Time, Data: e.User})
+			if err != nil {
+				return err
+			}
+		}
+		err := d.repo.CreateDelivery(ctx, &Delivery{
+			SubscriptionID: sub.ID,
+			EventID:        eventID,
+			EventType:      e.Type,
+			Payload:        body,
+			Status:         StatusPending,
+			NextAttemptAt:  e.Time,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- Worker ---
+
+// WorkerOptions configures a Worker. Zero values use the defaults noted.
+type WorkerOptions struct {
+	// Interval between polls for due deliveries (5s).
+	Interval time.Duration
+	// MaxAttempts after which a failing delivery is dead-lettered (8).
+	MaxAttempts int
+	// Backoff is the delay after the first failed attempt; it doubles with
+	// every further attempt up to MaxBackoff (30s, 1h).
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds each request to a subscriber (10s).
+	Timeout time.Duration
+	// BatchSize is the number of deliveries attempted per poll (100).
+	BatchSize int
+}
+
+// Worker sends due deliveries in the background until it is closed. A
+// delivery succeeds when the subscriber answers with a 2xx status.
+type Worker struct {
+	repo   Repository
+	client *http.Client
+	opts   WorkerOptions
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewWorker(repo Repository, client *http.Client, opts WorkerOptions) *Worker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 8
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 30 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Hour
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Worker{
+		repo:   repo,
+		client: client,
+		opts:   opts,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go w.run(ctx)
+	return w
+}
+
+// Close stops the worker, abandoning in-flight requests, and waits for it to
+// exit. Abandoned deliveries stay pending and are retried on the next start.
+func (w *Worker) Close() {
+	w.cancel()
+	<-w.done
+}
+
+func (w *Worker) run(ctx context.Context) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := w.ProcessDue(ctx); err != nil && ctx.Err() == nil {
+			zap.L().Error("cannot process webhook deliveries", zap.Error(err))
+		}
+	}
+}
+
+// ProcessDue attempts one batch of due deliveries and returns how many were
+// attempted.
+func (w *Worker) ProcessDue(ctx context.Context) (int, error) {
+	due, err := w.repo.ListDueDeliveries(ctx, time.Now(), w.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	subs := make(map[string]*Subscription)
+	for i, d := range due {
+		sub, ok := subs[d.SubscriptionID]
+		if !ok {
+			sub, err = w.repo.GetSubscription(ctx, d.SubscriptionID)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return i, err
+			}
+			subs[d.SubscriptionID] = sub
+		}
+		if err := w.attempt(ctx, sub, d); err != nil {
+			return i, err
+		}
+	}
+	return len(due), nil
+}
+
+// attempt sends d to sub, which is nil when the subscription no longer
+// exists, and records the outcome.
+func (w *Worker) attempt(ctx context.Context, sub *Subscription, d *Delivery) error {
+	status, err := 0, ErrNotFound
+	if sub != nil {
+		status, err = w.send(ctx, sub, d)
+	}
+	if ctx.Err() != nil {
+		// Shutting down; the attempt does not count.
+		return ctx.Err()
+	}
+
+	now := time.Now()
+	d.Attempts++
+	d.ResponseStatus = status
+	switch {
+	case err == nil:
+		d.Status = StatusSucceeded
+		d.LastError = ""
+		d.DeliveredAt = &now
+	case sub == nil || d.Attempts >= w.opts.MaxAttempts:
+		d.Status = StatusDead
+		d.LastError = err.Error()
+	default:
+		d.LastError = err.Error()
+		d.NextAttemptAt = now.Add(w.backoff(d.Attempts))
+	}
+
+	if d.Status == StatusDead {
+		zap.L().Warn("webhook delivery dead-lettered",
+			zap.String("id", d.ID),
+			zap.String("subscription_id", d.SubscriptionID),
+			zap.Int("attempts", d.Attempts),
+			zap.String("error", d.LastError),
+		)
+	}
+	return w.repo.UpdateDelivery(ctx, d)
+}
+
+func (w *Worker) send(ctx context.Context, sub *Subscription, d *Delivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, w.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, d.EventID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, d.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay after the given number of failed attempts.
+func (w *Worker) backoff(attempts int) time.Duration {
+	d := w.opts.Backoff
+	for i := 1; i < attempts && d < w.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, w.opts.MaxBackoff)
+}
+
+// --- Handler ---
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 200
+)
+
+type Handler struct {
+	svc Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(authz.Require(PermissionManage))
+		r.Get("/admin/webhooks", h.ListSubscriptions)
+		r.Post("/admin/webhooks", h.CreateSubscription)
+		r.Delete("/admin/webhooks/{id}", h.DeleteSubscription)
+		r.Get("/admin/webhooks/{id}/deliveries", h.ListDeliveries)
+		r.Post("/admin/webhooks/{id}/deliveries/{deliveryID}/retry", h.RetryDelivery)
+	})
+}
+
+type createSubscriptionRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type createSubscriptionResponse struct {
+	*Subscription
+	// Secret signs deliveries. It is only ever returned here.
+	Secret string `json:"secret"`
+}
+
+func (h *Handler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	var req createSubscriptionRequest
+	if err := jsonbody.Decode(r, &req); err != nil {
+		http.Error(w, err.Error(), jsonbody.Status(err))
+		return
+	}
+	sub, err := h.svc.CreateSubscription(r.Context(), req.URL, req.Events)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createSubscriptionResponse{Subscription: sub, Secret: sub.Secret})
+}
+
+func (h *Handler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.svc.ListSubscriptions(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if subs == nil {
+		subs = []*Subscription{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subs)
+}
+
+func (h *Handler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.DeleteSubscription(r.Context(), chi.URLParam(r, "id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries returns the delivery log of a subscription, newest first,
+// paginated with the limit (default 50, at most 200) and offset parameters.
+func (h *Handler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", defaultDeliveryLimit)
+	if err != nil || limit < 1 || limit > maxDeliveryLimit {
+		http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxDeliveryLimit), http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "offset must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := h.svc.ListDeliveries(r.Context(), chi.URLParam(r, "id"), limit, offset)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*Delivery{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// RetryDelivery schedules a dead delivery for immediate redelivery.
+func (h *Handler) RetryDelivery(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.RetryDelivery(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "deliveryID")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// --- Memory Repository ---
+
+type MemoryRepository struct {
+	mu            sync.RWMutex
+	subscriptions map[string]*Subscription
+	// deliveries are kept in creation order.
+	deliveries []*Delivery
+	seq        int
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		subscriptions: make(map[string]*Subscription),
+	}
+}
+
+func (r *MemoryRepository) CreateSubscription(ctx context.Context, sub *Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	sub.ID = fmt.Sprintf("%d", r.seq)
+	sub.CreatedAt = time.Now()
+
+	stored := *sub
+	r.subscriptions[sub.ID] = &stored
+	return nil
+}
+
+func (r *MemoryRepository) GetSubscription(ctx context.Context, id string) (*Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.subscriptions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	sub := *s
+	return &sub, nil
+}
+
+func (r *MemoryRepository) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subs := make([]*Subscription, 0, len(r.subscriptions))
+	for _, s := range r.subscriptions {
+		sub := *s
+		subs = append(subs, &sub)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].CreatedAt.After(subs[j].CreatedAt)
+	})
+	return subs, nil
+}
+
+func (r *MemoryRepository) DeleteSubscription(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.subscriptions[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.subscriptions, id)
+
+	kept := r.deliveries[:0]
+	for _, d := range r.deliveries {
+		if d.SubscriptionID != id {
+			kept = append(kept, d)
+		}
+	}
+	clear(r.deliveries[len(kept):])
+	r.deliveries = kept
+	return nil
+}
+
+func (r *MemoryRepository) CreateDelivery(ctx context.Context, d *Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	d.ID = fmt.Sprintf("%d", r.seq)
+	d.Status = StatusPending
+	d.CreatedAt = time.Now()
+
+	stored := *d
+	r.deliveries = append(r.deliveries, &stored)
+	return nil
+}
+
+func (r *MemoryRepository) ListDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*Delivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var due []*Delivery
+	for _, d := range r.deliveries {
+		if d.Status == StatusPending && !d.NextAttemptAt.After(now) {
+			delivery := *d
+			due = append(due, &delivery)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (r *MemoryRepository) UpdateDelivery(ctx context.Context, d *Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.deliveries {
+		if existing.ID == d.ID {
+			stored := *d
+			r.deliveries[i] = &stored
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) ListDeliveries(ctx context.Context, subscriptionID string, limit, offset int) ([]*Delivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var deliveries []*Delivery
+	for i := len(r.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if d := r.deliveries[i]; d.SubscriptionID == subscriptionID {
+			if offset > 0 {
+				offset--
+				continue
+			}
+			delivery := *d
+			deliveries = append(deliveries, &delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (r *MemoryRepository) RetryDelivery(ctx context.Context, subscriptionID, id string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, d := range r.deliveries {
+		if d.ID == id && d.SubscriptionID == subscriptionID && d.Status == StatusDead {
+			d.Status = StatusPending
+			d.Attempts = 0
+			d.NextAttemptAt = at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
@@ -0,0 +1,446 @@
+package webhook_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/go-templates/template-nodbm/internal/user"
+	"github.com/user/go-templates/template-nodbm/internal/webhook"
+	"github.com/user/go-templates/template-nodbm/internal/webhook/webhooktest"
+	"github.com/user/go-templates/template-nodbm/pkg/auth"
+	"github.com/user/go-templates/template-nodbm/pkg/authz"
+)
+
+// --- Mocks ---
+
+type mockRepository struct {
+	mu         sync.Mutex
+	seq        int
+	subs       map[string]*webhook.Subscription
+	deliveries []*webhook.Delivery
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{subs: make(map[string]*webhook.Subscription)}
+}
+
+func (m *mockRepository) nextID(prefix string) string {
+	m.seq++
+	return prefix + strconv.Itoa(m.seq)
+}
+
+func (m *mockRepository) CreateSubscription(ctx context.Context, sub *webhook.Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub.ID = m.nextID("sub-")
+	sub.CreatedAt = time.Now()
+	c := *sub
+	m.subs[sub.ID] = &c
+	return nil
+}
+
+func (m *mockRepository) GetSubscription(ctx context.Context, id string) (*webhook.Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub, ok := m.subs[id]
+	if !ok {
+		return nil, webhook.ErrNotFound
+	}
+	c := *sub
+	return &c, nil
+}
+
+func (m *mockRepository) ListSubscriptions(ctx context.Context) ([]*webhook.Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var subs []*webhook.Subscription
+	for _, sub := range m.subs {
+		c := *sub
+		subs = append(subs, &c)
+	}
+	return subs, nil
+}
+
+func (m *mockRepository) DeleteSubscription(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.subs[id]; !ok {
+		return webhook.ErrNotFound
+	}
+	delete(m.subs, id)
+	return nil
+}
+
+func (m *mockRepository) CreateDelivery(ctx context.Context, d *webhook.Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d.ID = m.nextID("dlv-")
+	d.CreatedAt = time.Now()
+	c := *d
+	m.deliveries = append(m.deliveries, &c)
+	return nil
+}
+
+func (m *mockRepository) ListDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*webhook.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var due []*webhook.Delivery
+	for _, d := range m.deliveries {
+		if d.Status == webhook.StatusPending && !d.NextAttemptAt.After(now) {
+			c := *d
+			due = append(due, &c)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (m *mockRepository) UpdateDelivery(ctx context.Context, d *webhook.Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, existing := range m.deliveries {
+		if existing.ID == d.ID {
+			c := *d
+			m.deliveries[i] = &c
+			return nil
+		}
+	}
+	return webhook.ErrNotFound
+}
+
+func (m *mockRepository) ListDeliveries(ctx context.Context, subscriptionID string, limit, offset int) ([]*webhook.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []*webhook.Delivery
+	for i := len(m.deliveries) - 1; i >= 0; i-- {
+		if d := m.deliveries[i]; d.SubscriptionID == subscriptionID {
+			c := *d
+			list = append(list, &c)
+		}
+	}
+	if offset >= len(list) {
+		return nil, nil
+	}
+	list = list[offset:]
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (m *mockRepository) RetryDelivery(ctx context.Context, subscriptionID, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.deliveries {
+		if d.ID == id && d.SubscriptionID == subscriptionID && d.Status == webhook.StatusDead {
+			d.Status = webhook.StatusPending
+			d.Attempts = 0
+			d.NextAttemptAt = at
+			return nil
+		}
+	}
+	return webhook.ErrNotFound
+}
+
+// delivery returns the stored state of the delivery with the given index.
+func (m *mockRepository) delivery(i int) webhook.Delivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.deliveries[i]
+}
+
+// makeDue moves every pending delivery's next attempt into the past.
+func (m *mockRepository) makeDue() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.deliveries {
+		d.NextAttemptAt = time.Now().Add(-time.Second)
+	}
+}
+
+// newWorker returns a worker that only runs when ProcessDue is called.
+func newWorker(t *testing.T, repo webhook.Repository, opts webhook.WorkerOptions) *webhook.Worker {
+	t.Helper()
+	opts.Interval = time.Hour
+	w := webhook.NewWorker(repo, nil, opts)
+	t.Cleanup(w.Close)
+	return w
+}
+
+func subscribe(t *testing.T, repo *mockRepository, url string, events ...string) *webhook.Subscription {
+	t.Helper()
+	sub := &webhook.Subscription{URL: url, Secret: "whsec_test", Events: events}
+	if err := repo.CreateSubscription(context.Background(), sub); err != nil {
+		t.Fatal(err)
+	}
+	return sub
+}
+
+// --- Signing Tests ---
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"evt_1"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      []byte
+		expectErr bool
+	}{
+		{name: "Valid", secret: "s", timestamp: now, signature: webhook.Sign("s", now, body), body: body},
+		{name: "WrongSecret", secret: "other", timestamp: now, signature: webhook.Sign("s", now, body), body: body, expectErr: true},
+		{name: "TamperedBody", secret: "s", timestamp: now, signature: webhook.Sign("s", now, body), body: []byte(`{"id":"evt_2"}`), expectErr: true},
+		{name: "TamperedTimestamp", secret: "s", timestamp: old, signature: webhook.Sign("s", now, body), body: body, expectErr: true},
+		{name: "Expired", secret: "s", timestamp: old, signature: webhook.Sign("s", old, body), body: body, expectErr: true},
+		{name: "MissingTimestamp", secret: "s", signature: webhook.Sign("s", "", body), body: body, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(webhook.HeaderTimestamp, tt.timestamp)
+			header.Set(webhook.HeaderSignature, tt.signature)
+
+			err := webhook.Verify(tt.secret, header, tt.body, 5*time.Minute)
+			if tt.expectErr && !errors.Is(err, webhook.ErrInvalidSignature) {
+				t.Errorf("expected ErrInvalidSignature, got %v", err)
+			}
+			if !tt.expectErr && err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+// --- Service Tests ---
+
+func TestService_CreateSubscription(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		events    []string
+		expectErr bool
+	}{
+		{name: "Valid", url: "https://example.com/hooks", events: []string{user.EventCreated}},
+		{name: "All", url: "http://localhost:9000", events: []string{webhook.EventAll}},
+		{name: "RelativeURL", url: "/hooks", events: []string{user.EventCreated}, expectErr: true},
+		{name: "UnsupportedScheme", url: "ftp://example.com", events: []string{user.EventCreated}, expectErr: true},
+		{name: "NoEvents", url: "https://example.com/hooks", expectErr: true},
+		{name: "UnknownEvent", url: "https://example.com/hooks", events: []string{"user.renamed"}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := webhook.NewService(newMockRepository())
+
+			sub, err := svc.CreateSubscription(context.Background(), tt.url, tt.events)
+			if tt.expectErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if sub.ID == "" || !strings.HasPrefix(sub.Secret, "whsec_") {
+				t.Errorf("expected stored subscription with a secret, got %+v", sub)
+			}
+		})
+	}
+}
+
+// --- Delivery Tests ---
+
+func TestDispatcher_Publish(t *testing.T) {
+	repo := newMockRepository()
+	rv := webhooktest.NewReceiver(t, "whsec_test")
+	subscribe(t, repo, rv.URL, user.EventCreated)
+	subscribe(t, repo, rv.URL, webhook.EventAll)
+	subscribe(t, repo, rv.URL, user.EventDeleted)
+
+	var events user.Publisher = webhook.NewDispatcher(repo)
+	events.Publish(user.Event{Type: user.EventCreated, User: user.User{ID: "1", Name: "Ada"}, Time: time.Now()})
+
+	w := newWorker(t, repo, webhook.WorkerOptions{})
+	n, err := w.ProcessDue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 deliveries, got %d", n)
+	}
+
+	reqs := rv.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(reqs))
+	}
+	for _, req := range reqs {
+		if req.Payload.Type != user.EventCreated || req.Payload.Data.Name != "Ada" {
+			t.Errorf("unexpected payload %+v", req.Payload)
+		}
+		if id := req.Header.Get(webhook.HeaderID); id == "" || id != req.Payload.ID {
+			t.Errorf("expected %s header to match payload id %q, got %q", webhook.HeaderID, req.Payload.ID, id)
+		}
+	}
+	for i := range 2 {
+		if d := repo.delivery(i); d.Status != webhook.StatusSucceeded || d.Attempts != 1 || d.DeliveredAt == nil {
+			t.Errorf("expected delivery %d to succeed on the first attempt, got %+v", i, d)
+		}
+	}
+}
+
+func TestWorker_RetryAndDeadLetter(t *testing.T) {
+	repo := newMockRepository()
+	rv := webhooktest.NewReceiver(t, "whsec_test")
+	sub := subscribe(t, repo, rv.URL, webhook.EventAll)
+
+	webhook.NewDispatcher(repo).Publish(user.Event{Type: user.EventUpdated, User: user.User{ID: "1"}, Time: time.Now()})
+	w := newWorker(t, repo, webhook.WorkerOptions{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: 90 * time.Second})
+	rv.FailNext(3)
+
+	expectedBackoff := []time.Duration{time.Minute, 90 * time.Second}
+	for i, backoff := range expectedBackoff {
+		start := time.Now()
+		if _, err := w.ProcessDue(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		d := repo.delivery(0)
+		if d.Status != webhook.StatusPending || d.Attempts != i+1 || d.ResponseStatus != http.StatusInternalServerError {
+			t.Fatalf("attempt %d: unexpected delivery %+v", i+1, d)
+		}
+		if wait := d.NextAttemptAt.Sub(start); wait < backoff || wait > backoff+time.Second {
+			t.Errorf("attempt %d: expected backoff of %v, got %v", i+1, backoff, wait)
+		}
+		if n, _ := w.ProcessDue(context.Background()); n != 0 {
+			t.Errorf("attempt %d: expected no delivery due during backoff, got %d", i+1, n)
+		}
+		repo.makeDue()
+	}
+
+	if _, err := w.ProcessDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d := repo.delivery(0)
+	if d.Status != webhook.StatusDead || d.Attempts != 3 || d.LastError == "" {
+		t.Fatalf("expected dead delivery after 3 attempts, got %+v", d)
+	}
+
+	svc := webhook.NewService(repo)
+	if err := svc.RetryDelivery(context.Background(), sub.ID, d.ID); err != nil {
+		t.Fatalf("retrying dead delivery: %v", err)
+	}
+	if err := svc.RetryDelivery(context.Background(), sub.ID, d.ID); !errors.Is(err, webhook.ErrNotFound) {
+		t.Errorf("expected ErrNotFound retrying a pending delivery, got %v", err)
+	}
+	if _, err := w.ProcessDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := repo.delivery(0); d.Status != webhook.StatusSucceeded || d.Attempts != 1 {
+		t.Errorf("expected redelivery to succeed, got %+v", d)
+	}
+	if len(rv.Requests()) != 1 {
+		t.Errorf("expected 1 accepted request, got %d", len(rv.Requests()))
+	}
+}
+
+func TestWorker_DeletedSubscription(t *testing.T) {
+	repo := newMockRepository()
+	sub := subscribe(t, repo, "http://127.0.0.1:1", webhook.EventAll)
+	webhook.NewDispatcher(repo).Publish(user.Event{Type: user.EventCreated, Time: time.Now()})
+	repo.DeleteSubscription(context.Background(), sub.ID)
+
+	w := newWorker(t, repo, webhook.WorkerOptions{})
+	if _, err := w.ProcessDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := repo.delivery(0); d.Status != webhook.StatusDead {
+		t.Errorf("expected delivery to a deleted subscription to be dead, got %+v", d)
+	}
+}
+
+// --- Handler Tests ---
+
+func TestHandler(t *testing.T) {
+	repo := newMockRepository()
+	sub := subscribe(t, repo, "https://example.com/hooks", webhook.EventAll)
+	for i := range 3 {
+		repo.CreateDelivery(context.Background(), &webhook.Delivery{
+			SubscriptionID: sub.ID,
+			EventID:        fmt.Sprintf("evt_%d", i),
+			Payload:        []byte(`{}`),
+			Status:         webhook.StatusDead,
+		})
+	}
+
+	r := chi.NewRouter()
+	r.Use(authz.Middleware(authz.NewAuthorizer(authz.StaticRoles{"admin": {"*"}}, 0)))
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := &auth.Claims{Roles: r.Header.Values("X-Test-Role")}
+			next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), claims)))
+		})
+	})
+	webhook.NewHandler(webhook.NewService(repo)).RegisterRoutes(r)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		role           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "CreateForbidden", method: "POST", path: "/admin/webhooks", body: `{"url":"https://example.com","events":["*"]}`, expectedStatus: http.StatusForbidden},
+		{name: "Create", method: "POST", path: "/admin/webhooks", body: `{"url":"https://example.com","events":["user.created"]}`, role: "admin", expectedStatus: http.StatusCreated, expectedBody: `"secret":"whsec_`},
+		{name: "CreateInvalid", method: "POST", path: "/admin/webhooks", body: `{"url":"example.com","events":["user.created"]}`, role: "admin", expectedStatus: http.StatusBadRequest},
+		{name: "List", method: "GET", path: "/admin/webhooks", role: "admin", expectedStatus: http.StatusOK, expectedBody: `"url":"https://example.com/hooks"`},
+		{name: "Deliveries", method: "GET", path: "/admin/webhooks/" + sub.ID + "/deliveries?limit=1&offset=1", role: "admin", expectedStatus: http.StatusOK, expectedBody: `[{"id":"dlv-3","subscription_id":"` + sub.ID + `","event_id":"evt_1"`},
+		{name: "DeliveriesBadLimit", method: "GET", path: "/admin/webhooks/" + sub.ID + "/deliveries?limit=500", role: "admin", expectedStatus: http.StatusBadRequest},
+		{name: "DeliveriesUnknown", method: "GET", path: "/admin/webhooks/sub-404/deliveries", role: "admin", expectedStatus: http.StatusNotFound},
+		{name: "Retry", method: "POST", path: "/admin/webhooks/" + sub.ID + "/deliveries/dlv-2/retry", role: "admin", expectedStatus: http.StatusAccepted},
+		{name: "RetryPending", method: "POST", path: "/admin/webhooks/" + sub.ID + "/deliveries/dlv-2/retry", role: "admin", expectedStatus: http.StatusNotFound},
+		{name: "Delete", method: "DELETE", path: "/admin/webhooks/" + sub.ID, role: "admin", expectedStatus: http.StatusNoContent},
+		{name: "DeleteAgain", method: "DELETE", path: "/admin/webhooks/" + sub.ID, role: "admin", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if tt.role != "" {
+				req.Header.Set("X-Test-Role", tt.role)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedBody != "" && !strings.Contains(w.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.expectedBody, w.Body.String())
+			}
+			if tt.method == "GET" && strings.Contains(w.Body.String(), "whsec_test") {
+				t.Error("secret must only be returned on creation")
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+// Package apiversion holds helpers shared by versioned HTTP handlers.
+package apiversion
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Deprecated marks every response as coming from a deprecated API version: it
+// sets Deprecation (RFC 9745) to since, Sunset (RFC 8594) to sunset and a
+// successor-version Link pointing at successor.
+func Deprecated(since, sunset time.Time, successor string) func(http.Handler) http.Handler {
+	deprecation := "@" + strconv.FormatInt(since.Unix(), 10)
+	sunsetValue := sunset.UTC().Format(http.TimeFormat)
+	link := "<" + successor + `>; rel="successor-version"`
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("Deprecation", deprecation)
+			h.Set("Sunset", sunsetValue)
+			h.Add("Link", link)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,317 @@
+// Package batch serves POST /batch, which runs several API calls in one HTTP
+// request. Each operation is dispatched in-process through the application
+// router, so it passes the same middleware, authentication and authorization
+// as a standalone call.
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/go-templates/template-nodbm/pkg/jsonbody"
+)
+
+// Defaults for zero Options fields.
+const (
+	DefaultMaxOperations = 20
+	DefaultConcurrency   = 4
+	DefaultTimeout       = 10 * time.Second
+)
+
+// Transactor runs fn inside a transaction. Repositories that recognize the
+// context passed to fn join the transaction; if fn returns an error it is
+// rolled back.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Options configures the handler.
+type Options struct {
+	// MaxOperations caps the operations in one batch.
+	MaxOperations int
+	// Concurrency caps how many operations of a non-atomic batch run at once.
+	Concurrency int
+	// Timeout bounds each operation.
+	Timeout time.Duration
+	// Tx runs atomic batches. Without it atomic batches are answered with
+	// 501.
+	Tx Transactor
+}
+
+// Operation is one sub-request. Path is relative to the server root and may
+// carry a query string.
+type Operation struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// Request is the batch request body.
+type Request struct {
+	// Atomic runs the operations in order inside one transaction. The first
+	// operation answered with 4xx or 5xx rolls it back and the remaining
+	// operations are skipped.
+	Atomic     bool        `json:"atomic"`
+	Operations []Operation `json:"operations"`
+}
+
+// Result is the response to one operation. Body holds the JSON response
+// body, or the text of a non-JSON one as a JSON string.
+type Result struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// Response is the batch response body; Results are in operation order.
+type Response struct {
+	Results []Result `json:"results"`
+	// RolledBack reports that an atomic batch failed and none of its
+	// changes were kept.
+	RolledBack bool `json:"rolled_back,omitempty"`
+}
+
+var (
+	ErrNoOperations   = errors.New("batch has no operations")
+	ErrTooManyOps     = errors.New("batch has too many operations")
+	ErrInvalidMethod  = errors.New("unsupported method")
+	ErrInvalidPath    = errors.New("path must be absolute")
+	ErrNestedBatch    = errors.New("batches cannot be nested")
+	ErrAtomicDisabled = errors.New("atomic batches are not supported by this server")
+)
+
+var methods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// resultHeaders are the sub-response headers copied into a Result.
+var resultHeaders = []string{"Content-Type", "Location", "ETag", "Last-Modified"}
+
+// errRollback aborts an atomic batch after a failed operation.
+var errRollback = errors.New("batch operation failed")
+
+type Handler struct {
+	router http.Handler
+	opts   Options
+}
+
+// NewHandler returns a handler dispatching operations to router, which is
+// normally the router the handler itself is mounted on.
+func NewHandler(router http.Handler, opts Options) *Handler {
+	if opts.MaxOperations <= 0 {
+		opts.MaxOperations = DefaultMaxOperations
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	return &Handler{router: router, opts: opts}
+}
+
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.Post("/batch", h.Batch)
+}
+
+func (h *Handler) Batch(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := jsonbody.Decode(r, &req); err != nil {
+		http.Error(w, err.Error(), jsonbody.Status(err))
+		return
+	}
+	if err := h.validate(req, r.URL.Path); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var resp Response
+	if req.Atomic {
+		if h.opts.Tx == nil {
+			http.Error(w, ErrAtomicDisabled.Error(), http.StatusNotImplemented)
+			return
+		}
+		var err error
+		if resp, err = h.runAtomic(r, req.Operations); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		resp.Results = h.runConcurrent(r, req.Operations)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// validate rejects the whole batch if any operation is malformed, so no
+// operation runs when another could not.
+func (h *Handler) validate(req Request, self string) error {
+	if len(req.Operations) == 0 {
+		return ErrNoOperations
+	}
+	if len(req.Operations) > h.opts.MaxOperations {
+		return fmt.Errorf("%w: %d exceeds %d", ErrTooManyOps, len(req.Operations), h.opts.MaxOperations)
+	}
+	for i, op := range req.Operations {
+		if !methods[op.Method] {
+			return fmt.Errorf("operation %d: %w %q", i, ErrInvalidMethod, op.Method)
+		}
+		u, err := url.Parse(op.Path)
+		if err != nil || !strings.HasPrefix(op.Path, "/") || u.Host != "" {
+			return fmt.Errorf("operation %d: %w", i, ErrInvalidPath)
+		}
+		if strings.TrimSuffix(u.Path, "/") == strings.TrimSuffix(self, "/") {
+			return fmt.Errorf("operation %d: %w", i, ErrNestedBatch)
+		}
+	}
+	return nil
+}
+
+func (h *Handler) runConcurrent(r *http.Request, ops []Operation) []Result {
+	results := make([]Result, len(ops))
+	sem := make(chan struct{}, h.opts.Concurrency)
+	var wg sync.WaitGroup
+	for i, op := range ops {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = h.dispatch(r.Context(), r, op, false)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// runAtomic runs ops one at a time inside a transaction. Operations after a
+// failed one are answered with 424 without running. The error is non-nil
+// only when the transaction itself failed.
+func (h *Handler) runAtomic(r *http.Request, ops []Operation) (Response, error) {
+	results := make([]Result, len(ops))
+	failed := -1
+	err := h.opts.Tx.WithinTx(r.Context(), func(ctx context.Context) error {
+		for i, op := range ops {
+			results[i] = h.dispatch(ctx, r, op, true)
+			if results[i].Status >= http.StatusBadRequest {
+				failed = i
+				return errRollback
+			}
+		}
+		return nil
+	})
+	if failed >= 0 {
+		for i := failed + 1; i < len(ops); i++ {
+			results[i] = Result{Status: http.StatusFailedDependency}
+		}
+		return Response{Results: results, RolledBack: true}, nil
+	}
+	if err != nil {
+		return Response{}, fmt.Errorf("batch transaction failed: %w", err)
+	}
+	return Response{Results: results}, nil
+}
+
+// dispatch serves op through the router as if it had arrived on its own,
+// carrying the headers of the batch request. Operations of an atomic batch
+// ask for no-store, so response caches neither answer them nor keep data from
+// a transaction that may be rolled back.
+func (h *Handler) dispatch(ctx context.Context, outer *http.Request, op Operation, atomic bool) Result {
+	ctx, cancel := context.WithTimeout(ctx, h.opts.Timeout)
+	defer cancel()
+	// Drop the batch route's routing state so the router starts afresh.
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, nil)
+
+	var body io.Reader = http.NoBody
+	if len(op.Body) > 0 {
+		body = bytes.NewReader(op.Body)
+	}
+	sub, err := http.NewRequestWithContext(ctx, op.Method, op.Path, body)
+	if err != nil {
+		return textResult(http.StatusBadRequest, err.Error())
+	}
+	sub.Host = outer.Host
+	sub.RemoteAddr = outer.RemoteAddr
+	sub.RequestURI = op.Path
+	sub.Header = outer.Header.Clone()
+	sub.Header.Del("Content-Length")
+	// The batch response is compressed as a whole, if at all.
+	sub.Header.Del("Accept-Encoding")
+	if atomic {
+		sub.Header.Set("Cache-Control", "no-store")
+	}
+	if len(op.Body) > 0 {
+		sub.Header.Set("Content-Type", "application/json")
+	} else {
+		sub.Header.Del("Content-Type")
+	}
+
+	rec := &recorder{header: make(http.Header)}
+	h.router.ServeHTTP(rec, sub)
+	return rec.result()
+}
+
+// recorder buffers a sub-response.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) Header() http.Header { return rec.header }
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(b)
+}
+
+func (rec *recorder) result() Result {
+	res := textResult(rec.status, rec.body.String())
+	if res.Status == 0 {
+		res.Status = http.StatusOK
+	}
+	for _, k := range resultHeaders {
+		if v := rec.header.Get(k); v != "" {
+			if res.Headers == nil {
+				res.Headers = make(map[string]string)
+			}
+			res.Headers[k] = v
+		}
+	}
+	return res
+}
+
+// textResult embeds body as JSON if it is JSON and as a string otherwise.
+func textResult(status int, body string) Result {
+	res := Result{Status: status}
+	body = strings.TrimSpace(body)
+	switch {
+	case body == "":
+	case json.Valid([]byte(body)):
+		res.Body = json.RawMessage(body)
+	default:
+		res.Body, _ = json.Marshal(body)
+	}
+	return res
+}
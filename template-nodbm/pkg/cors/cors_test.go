@@ -0,0 +1,182 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	opts := Options{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.preview.example.com"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := Middleware(opts)(next)
+
+	tests := []struct {
+		name           string
+		method         string
+		headers        map[string]string
+		expectedStatus int
+		expected       map[string]string
+	}{
+		{
+			name:           "NoOrigin",
+			method:         "GET",
+			expectedStatus: http.StatusOK,
+			expected:       map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:           "AllowedOrigin",
+			method:         "GET",
+			headers:        map[string]string{"Origin": "https://app.example.com"},
+			expectedStatus: http.StatusOK,
+			expected: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Request-ID",
+			},
+		},
+		{
+			name:           "WildcardSubdomain",
+			method:         "GET",
+			headers:        map[string]string{"Origin": "https://pr-42.preview.example.com"},
+			expectedStatus: http.StatusOK,
+			expected:       map[string]string{"Access-Control-Allow-Origin": "https://pr-42.preview.example.com"},
+		},
+		{
+			name:           "WildcardDoesNotMatchApex",
+			method:         "GET",
+			headers:        map[string]string{"Origin": "https://preview.example.com"},
+			expectedStatus: http.StatusOK,
+			expected:       map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:           "WildcardSchemeMismatch",
+			method:         "GET",
+			headers:        map[string]string{"Origin": "http://pr-42.preview.example.com"},
+			expectedStatus: http.StatusOK,
+			expected:       map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:           "DisallowedOrigin",
+			method:         "GET",
+			headers:        map[string]string{"Origin": "https://evil.example.org"},
+			expectedStatus: http.StatusOK,
+			expected:       map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:   "Preflight",
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "authorization, content-type",
+			},
+			expectedStatus: http.StatusNoContent,
+			expected: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": "GET, HEAD, POST, PUT, PATCH, DELETE",
+				"Access-Control-Allow-Headers": "authorization, content-type",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name: "PreflightDisallowedHeader",
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "X-Debug",
+			},
+			method:         "OPTIONS",
+			expectedStatus: http.StatusForbidden,
+			expected:       map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name: "PreflightDisallowedMethod",
+			headers: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "TRACE",
+			},
+			method:         "OPTIONS",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "PreflightDisallowedOrigin",
+			headers: map[string]string{
+				"Origin":                        "https://evil.example.org",
+				"Access-Control-Request-Method": "GET",
+			},
+			method:         "OPTIONS",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/users", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			for k, v := range tt.expected {
+				if got := w.Header().Get(k); got != v {
+					t.Errorf("expected %s %q, got %q", k, v, got)
+				}
+			}
+			if w.Header().Get("Vary") != "Origin" {
+				t.Errorf("expected Vary: Origin, got %q", w.Header().Values("Vary"))
+			}
+		})
+	}
+}
+
+func TestMiddleware_WildcardCredentials(t *testing.T) {
+	h := Middleware(Options{
+		AllowedOrigins:   []string{"*", "https://app.example.com"},
+		AllowCredentials: true,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for origin, credentials := range map[string]string{
+		"https://app.example.com":  "true",
+		"https://evil.example.org": "",
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("%s: expected origin to be allowed, got %q", origin, got)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != credentials {
+			t.Errorf("%s: expected credentials %q, got %q", origin, credentials, got)
+		}
+	}
+}
+
+func TestMiddleware_Disabled(t *testing.T) {
+	h := Middleware(Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected no CORS headers, got %q", got)
+	}
+}
@@ -0,0 +1,112 @@
+// Package fieldmask parses sparse fieldset selections such as
+// ?fields=id,name and validates them against a resource's allow-list.
+package fieldmask
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrUnknownField = errors.New("unknown field")
+
+// Mask is a selection of field names. An empty Mask selects every field.
+type Mask []string
+
+// Parse parses a comma-separated field list. Every name must be in allowed;
+// the returned Mask follows the order of allowed without duplicates.
+func Parse(s string, allowed []string) (Mask, error) {
+	var m Mask
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			m = append(m, f)
+		}
+	}
+	if err := m.Validate(allowed); err != nil {
+		return nil, err
+	}
+
+	var ordered Mask
+	for _, f := range allowed {
+		if slices.Contains(m, f) {
+			ordered = append(ordered, f)
+		}
+	}
+	return ordered, nil
+}
+
+// Validate returns ErrUnknownField, naming the field, if m selects a field
+// not in allowed.
+func (m Mask) Validate(allowed []string) error {
+	for _, f := range m {
+		if !slices.Contains(allowed, f) {
+			return fmt.Errorf("%w %q", ErrUnknownField, f)
+		}
+	}
+	return nil
+}
+
+// Has reports whether m selects field.
+func (m Mask) Has(field string) bool {
+	return len(m) == 0 || slices.Contains(m, field)
+}
+
+// With returns m extended by fields it does not select yet, for loading
+// attributes a handler needs besides the ones it returns. An empty Mask
+// already selects every field and is returned unchanged.
+func (m Mask) With(fields ...string) Mask {
+	if len(m) == 0 {
+		return m
+	}
+	out := slices.Clone(m)
+	for _, f := range fields {
+		if !slices.Contains(out, f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// Select returns a json.Marshaler encoding v, which must encode as a JSON
+// object, with only the members selected by m, in the order of m.
+func Select(v any, m Mask) json.Marshaler {
+	return selection{v: v, m: m}
+}
+
+type selection struct {
+	v any
+	m Mask
+}
+
+func (s selection) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(s.v)
+	if err != nil || len(s.m) == 0 {
+		return b, err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(b, &members); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for _, f := range s.m {
+		raw, ok := members[f]
+		if !ok {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(raw)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,446 @@
+// Package httpcache implements HTTP caching: Last-Modified and conditional
+// GETs for handlers, Cache-Control headers per route, and an in-memory,
+// size-bounded response cache that route groups opt into.
+package httpcache
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha256"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Defaults for zero Options fields.
+const (
+	DefaultMaxBytes      = 16 << 20
+	DefaultMaxEntryBytes = 1 << 20
+	DefaultTTL           = time.Minute
+)
+
+// DefaultVary are the request headers that identify a caller.
+var DefaultVary = []string{"Authorization", "X-API-Key"}
+
+// LastModified sets the Last-Modified header to t and reports whether the
+// request's If-Modified-Since shows the client's copy is current. If so it
+// has answered 304 Not Modified and the handler must not write a body. A zero
+// t leaves the response unchanged.
+func LastModified(w http.ResponseWriter, r *http.Request, t time.Time) bool {
+	if t.IsZero() {
+		return false
+	}
+	t = t.UTC().Truncate(time.Second)
+	w.Header().Set("Last-Modified", t.Format(http.TimeFormat))
+	if !notModified(r, t) {
+		return false
+	}
+	writeNotModified(w)
+	return true
+}
+
+// notModified evaluates If-Modified-Since against t. It is ignored on
+// methods other than GET and HEAD and, as RFC 9110 requires, when the
+// request carries If-None-Match.
+func notModified(r *http.Request, t time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || r.Header.Get("If-None-Match") != "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	return err == nil && !t.After(since)
+}
+
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// --- Cache-Control ---
+
+// ControlOptions configures the Control middleware.
+type ControlOptions struct {
+	// Default applies to routes without an entry in Routes. Empty sends no
+	// Cache-Control.
+	Default string
+	// Routes maps chi route patterns to Cache-Control values. Keys may be
+	// prefixed with a method: "GET /api/v1/users/{id}" takes precedence over
+	// "/api/v1/users/{id}".
+	Routes map[string]string
+}
+
+func (o ControlOptions) value(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		pattern := rctx.RoutePattern()
+		if v, ok := o.Routes[r.Method+" "+pattern]; ok {
+			return v
+		}
+		if v, ok := o.Routes[pattern]; ok {
+			return v
+		}
+	}
+	return o.Default
+}
+
+// Control sets Cache-Control on successful and 304 responses to GET and HEAD
+// requests that do not set one themselves. The route is only known once chi
+// has routed the request, so the value is resolved when the response header
+// is written.
+func Control(opts ControlOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(&controlWriter{ResponseWriter: w, r: r, opts: opts}, r)
+		})
+	}
+}
+
+type controlWriter struct {
+	http.ResponseWriter
+	r    *http.Request
+	opts ControlOptions
+
+	wroteHeader bool
+}
+
+func (w *controlWriter) WriteHeader(code int) {
+	if !w.wroteHeader && code >= http.StatusOK {
+		w.wroteHeader = true
+		h := w.Header()
+		cacheable := code < http.StatusMultipleChoices || code == http.StatusNotModified
+		if cacheable && h.Get("Cache-Control") == "" {
+			if v := w.opts.value(w.r); v != "" {
+				h.Set("Cache-Control", v)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *controlWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *controlWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *controlWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *controlWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// --- Response Cache ---
+
+// Options configures a Cache.
+type Options struct {
+	// MaxBytes bounds the memory held by cached responses; the least
+	// recently used are evicted first.
+	MaxBytes int64
+	// MaxEntryBytes is the largest response body that is cached.
+	MaxEntryBytes int64
+	// TTL is how long a response is served from the cache.
+	TTL time.Duration
+	// Vary lists the request headers responses are cached separately for,
+	// so one caller is never served another's response. Defaults to
+	// DefaultVary.
+	Vary []string
+}
+
+// Cache is an in-memory response cache shared by the route groups that use
+// its Middleware.
+type Cache struct {
+	opts Options
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	lru     *list.List
+	size    int64
+	// gen counts purges, so a response read before a purge is not stored
+	// after it.
+	gen uint64
+}
+
+type entry struct {
+	key     [sha256.Size]byte
+	header  http.Header
+	body    []byte
+	stored  time.Time
+	expires time.Time
+	size    int64
+}
+
+func New(opts Options) *Cache {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultMaxBytes
+	}
+	if opts.MaxEntryBytes <= 0 {
+		opts.MaxEntryBytes = DefaultMaxEntryBytes
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultTTL
+	}
+	if opts.Vary == nil {
+		opts.Vary = DefaultVary
+	}
+	return &Cache{
+		opts:    opts,
+		now:     time.Now,
+		entries: make(map[[sha256.Size]byte]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Middleware serves GET requests from the cache and caches 200 responses,
+// keyed by URL and the Vary headers. Responses carrying Set-Cookie or
+// Cache-Control: no-store are not cached, and requests with Cache-Control:
+// no-cache or no-store bypass the cache. A successful request with any other
+// method purges the whole cache, so callers read their own writes.
+func (c *Cache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			if r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			if sw.status < http.StatusBadRequest {
+				c.Purge()
+			}
+			return
+		}
+
+		directives := r.Header.Get("Cache-Control")
+		noStore := hasDirective(directives, "no-store")
+		key := c.key(r)
+		if !noStore && !hasDirective(directives, "no-cache") {
+			if e, ok := c.get(key); ok {
+				c.serve(w, r, e)
+				return
+			}
+		}
+
+		gen := c.generation()
+		rec := &recorder{statusWriter: statusWriter{ResponseWriter: w}, before: w.Header().Clone(), max: c.opts.MaxEntryBytes}
+		next.ServeHTTP(rec, r)
+		if noStore || !rec.cacheable() {
+			return
+		}
+		if rec.header.Get("Set-Cookie") != "" || hasDirective(w.Header().Get("Cache-Control"), "no-store") {
+			return
+		}
+		c.put(key, gen, rec.header, rec.body)
+	})
+}
+
+// Purge removes every cached response.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	c.lru.Init()
+	c.size = 0
+	c.gen++
+}
+
+func (c *Cache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+func (c *Cache) key(r *http.Request) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte(r.URL.RequestURI()))
+	for _, name := range c.opts.Vary {
+		h.Write([]byte{0})
+		h.Write([]byte(strings.Join(r.Header.Values(name), ",")))
+	}
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	return key
+}
+
+func (c *Cache) get(key [sha256.Size]byte) (*entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if !c.now().Before(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e, true
+}
+
+func (c *Cache) put(key [sha256.Size]byte, gen uint64, header http.Header, body []byte) {
+	now := c.now()
+	e := &entry{key: key, header: header, body: body, stored: now, expires: now.Add(c.opts.TTL)}
+	e.size = int64(len(body)) + sha256.Size
+	for k, vs := range header {
+		for _, v := range vs {
+			e.size += int64(len(k) + len(v))
+		}
+	}
+	if e.size > c.opts.MaxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	c.size += e.size
+	for c.size > c.opts.MaxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove must be called with c.mu held.
+func (c *Cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
+
+func (c *Cache) serve(w http.ResponseWriter, r *http.Request, e *entry) {
+	h := w.Header()
+	for k, vs := range e.header {
+		h[k] = append([]string(nil), vs...)
+	}
+	h.Set("Age", strconv.Itoa(int(c.now().Sub(e.stored).Seconds())))
+	if lm, err := http.ParseTime(e.header.Get("Last-Modified")); err == nil && notModified(r, lm) {
+		writeNotModified(w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(e.body)
+}
+
+// added returns the headers in after that are not in before, i.e. those set
+// by the cached handler rather than by middleware outside the cache, such as
+// request IDs and CORS headers, which differ between requests.
+func added(before, after http.Header) http.Header {
+	h := make(http.Header)
+	for k, vs := range after {
+		if old, ok := before[k]; ok && strings.Join(old, "\x00") == strings.Join(vs, "\x00") {
+			continue
+		}
+		h[k] = append([]string(nil), vs...)
+	}
+	return h
+}
+
+func hasDirective(header, directive string) bool {
+	for _, d := range strings.Split(header, ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(d), "=")
+		if strings.EqualFold(name, directive) {
+			return true
+		}
+	}
+	return false
+}
+
+// statusWriter records the response status.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 && code >= http.StatusOK {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// recorder passes a response through while keeping a copy of its body, up to
+// max bytes, and of the headers the handler set. Those are captured when the
+// status is written, before middleware outside the cache, such as
+// compression, adds its own.
+type recorder struct {
+	statusWriter
+	before http.Header
+	max    int64
+
+	header   http.Header
+	body     []byte
+	tooLarge bool
+	flushed  bool
+}
+
+func (w *recorder) WriteHeader(code int) {
+	if w.header == nil && code >= http.StatusOK {
+		w.header = added(w.before, w.Header())
+	}
+	w.statusWriter.WriteHeader(code)
+}
+
+func (w *recorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.tooLarge {
+		if int64(len(w.body)+len(p)) > w.max {
+			w.tooLarge = true
+			w.body = nil
+		} else {
+			w.body = append(w.body, p...)
+		}
+	}
+	return w.statusWriter.Write(p)
+}
+
+// Flush marks the response as a stream, which is never cached.
+func (w *recorder) Flush() {
+	w.flushed = true
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *recorder) cacheable() bool {
+	return w.status == http.StatusOK && !w.tooLarge && !w.flushed
+}
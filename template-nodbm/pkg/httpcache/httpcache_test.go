@@ -0,0 +1,312 @@
+package httpcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/go-templates/template-nodbm/pkg/compress"
+)
+
+func TestLastModified(t *testing.T) {
+	modified := time.Date(2026, time.March, 1, 12, 0, 0, 500, time.UTC)
+	httpDate := "Sun, 01 Mar 2026 12:00:00 GMT"
+
+	tests := []struct {
+		name             string
+		method           string
+		header           map[string]string
+		unknown          bool
+		expectedStatus   int
+		expectedModified string
+	}{
+		{name: "Unconditional", expectedStatus: http.StatusOK, expectedModified: httpDate},
+		{name: "Unmodified", header: map[string]string{"If-Modified-Since": httpDate}, expectedStatus: http.StatusNotModified, expectedModified: httpDate},
+		{name: "UnmodifiedSinceLater", header: map[string]string{"If-Modified-Since": "Mon, 02 Mar 2026 12:00:00 GMT"}, expectedStatus: http.StatusNotModified, expectedModified: httpDate},
+		{name: "Modified", header: map[string]string{"If-Modified-Since": "Sun, 01 Mar 2026 11:59:59 GMT"}, expectedStatus: http.StatusOK, expectedModified: httpDate},
+		{name: "InvalidDate", header: map[string]string{"If-Modified-Since": "yesterday"}, expectedStatus: http.StatusOK, expectedModified: httpDate},
+		{name: "IfNoneMatch", header: map[string]string{"If-Modified-Since": httpDate, "If-None-Match": `"abc"`}, expectedStatus: http.StatusOK, expectedModified: httpDate},
+		{name: "Post", method: http.MethodPost, header: map[string]string{"If-Modified-Since": httpDate}, expectedStatus: http.StatusOK, expectedModified: httpDate},
+		{name: "Unknown", unknown: true, header: map[string]string{"If-Modified-Since": httpDate}, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			lm := modified
+			if tt.unknown {
+				lm = time.Time{}
+			}
+
+			req := httptest.NewRequest(method, "/users/1", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			w.Header().Set("Content-Type", "application/json")
+			if !LastModified(w, req, lm) {
+				w.WriteHeader(http.StatusOK)
+			}
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if got := w.Header().Get("Last-Modified"); got != tt.expectedModified {
+				t.Errorf("expected Last-Modified %q, got %q", tt.expectedModified, got)
+			}
+			if w.Code == http.StatusNotModified && w.Header().Get("Content-Type") != "" {
+				t.Error("expected no Content-Type on 304")
+			}
+		})
+	}
+}
+
+func TestControl(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Control(ControlOptions{
+		Default: "no-store",
+		Routes:  map[string]string{"GET /users/{id}": "private, max-age=30"},
+	}))
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch chi.URLParam(r, "id") {
+		case "missing":
+			http.Error(w, "user not found", http.StatusNotFound)
+		case "own":
+			w.Header().Set("Cache-Control", "public, max-age=5")
+			w.Write([]byte("{}"))
+		default:
+			w.Write([]byte("{}"))
+		}
+	})
+	r.Get("/users/search", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	})
+	r.Post("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	})
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		expected string
+	}{
+		{name: "Route", method: http.MethodGet, path: "/users/1", expected: "private, max-age=30"},
+		{name: "Default", method: http.MethodGet, path: "/users/search", expected: "no-store"},
+		{name: "Error", method: http.MethodGet, path: "/users/missing", expected: ""},
+		{name: "HandlerValue", method: http.MethodGet, path: "/users/own", expected: "public, max-age=5"},
+		{name: "Post", method: http.MethodPost, path: "/users/1", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if got := w.Header().Get("Cache-Control"); got != tt.expected {
+				t.Errorf("expected Cache-Control %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// newCachedRouter serves /users/{id} behind c, counting handler calls. An
+// outer middleware sets a per-request header that must not be cached.
+func newCachedRouter(c *Cache) (chi.Router, *atomic.Int32) {
+	var calls atomic.Int32
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(c.Middleware)
+		r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+			n := calls.Add(1)
+			switch chi.URLParam(r, "id") {
+			case "missing":
+				http.Error(w, "user not found", http.StatusNotFound)
+				return
+			case "cookie":
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+			case "nostore":
+				w.Header().Set("Cache-Control", "no-store")
+			case "large":
+				w.Write([]byte(strings.Repeat("a", 100)))
+				return
+			}
+			if LastModified(w, r, time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)) {
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"` + chi.URLParam(r, "id") + `","call":` + strconv.Itoa(int(n)) + `}`))
+		})
+		r.Put("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+			if chi.URLParam(r, "id") == "missing" {
+				http.Error(w, "user not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+	return r, &calls
+}
+
+func get(r http.Handler, path string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCache(t *testing.T) {
+	t.Run("Hit", func(t *testing.T) {
+		r, calls := newCachedRouter(New(Options{}))
+		first := get(r, "/users/1", map[string]string{"X-Request-ID": "a"})
+		second := get(r, "/users/1", map[string]string{"X-Request-ID": "b"})
+
+		if calls.Load() != 1 {
+			t.Fatalf("expected 1 handler call, got %d", calls.Load())
+		}
+		if second.Code != http.StatusOK || second.Body.String() != first.Body.String() {
+			t.Errorf("expected cached body %q, got %d %q", first.Body.String(), second.Code, second.Body.String())
+		}
+		if got := second.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("expected cached Content-Type, got %q", got)
+		}
+		if got := second.Header().Get("X-Request-ID"); got != "b" {
+			t.Errorf("expected the outer header of the second request, got %q", got)
+		}
+		if second.Header().Get("Age") == "" {
+			t.Error("expected Age on a cached response")
+		}
+	})
+
+	t.Run("Compressed", func(t *testing.T) {
+		// Compression runs outside the cache and adds Content-Encoding after
+		// the handler; cached responses must be stored uncompressed.
+		c := New(Options{})
+		r := chi.NewRouter()
+		r.Use(compress.Middleware(compress.Options{MinSize: 1}))
+		r.With(c.Middleware).Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"1"}`))
+		})
+
+		get(r, "/users/1", map[string]string{"Accept-Encoding": "gzip"})
+		w := get(r, "/users/1", nil)
+		if w.Header().Get("Content-Encoding") != "" || w.Body.String() != `{"id":"1"}` {
+			t.Errorf("expected an uncompressed cached response, got %v %q", w.Header(), w.Body.String())
+		}
+	})
+
+	t.Run("Vary", func(t *testing.T) {
+		r, calls := newCachedRouter(New(Options{}))
+		get(r, "/users/1", map[string]string{"Authorization": "Bearer a"})
+		get(r, "/users/1", map[string]string{"Authorization": "Bearer b"})
+		get(r, "/users/1?fields=id", map[string]string{"Authorization": "Bearer a"})
+		if calls.Load() != 3 {
+			t.Errorf("expected a handler call per caller and URL, got %d", calls.Load())
+		}
+	})
+
+	t.Run("NotModified", func(t *testing.T) {
+		r, _ := newCachedRouter(New(Options{}))
+		get(r, "/users/1", nil)
+		w := get(r, "/users/1", map[string]string{"If-Modified-Since": "Sun, 01 Mar 2026 12:00:00 GMT"})
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("expected 304 from the cache, got %d %q", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("Uncacheable", func(t *testing.T) {
+		for _, id := range []string{"missing", "cookie", "nostore", "large"} {
+			r, calls := newCachedRouter(New(Options{MaxEntryBytes: 64}))
+			get(r, "/users/"+id, nil)
+			get(r, "/users/"+id, nil)
+			if calls.Load() != 2 {
+				t.Errorf("%s: expected the response not to be cached, got %d handler calls", id, calls.Load())
+			}
+		}
+	})
+
+	t.Run("RequestNoCache", func(t *testing.T) {
+		r, calls := newCachedRouter(New(Options{}))
+		get(r, "/users/1", nil)
+		get(r, "/users/1", map[string]string{"Cache-Control": "no-cache"})
+		get(r, "/users/1", map[string]string{"Cache-Control": "no-store"})
+		if calls.Load() != 3 {
+			t.Errorf("expected no-cache and no-store to bypass the cache, got %d handler calls", calls.Load())
+		}
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		r, calls := newCachedRouter(New(Options{}))
+		get(r, "/users/1", nil)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/users/missing", nil))
+		get(r, "/users/1", nil)
+		if calls.Load() != 1 {
+			t.Errorf("expected a failed write to keep the cache, got %d handler calls", calls.Load())
+		}
+
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/users/1", nil))
+		get(r, "/users/1", nil)
+		if calls.Load() != 2 {
+			t.Errorf("expected a write to purge the cache, got %d handler calls", calls.Load())
+		}
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		c := New(Options{TTL: time.Minute})
+		now := time.Now()
+		c.now = func() time.Time { return now }
+		r, calls := newCachedRouter(c)
+
+		get(r, "/users/1", nil)
+		now = now.Add(59 * time.Second)
+		if w := get(r, "/users/1", nil); w.Header().Get("Age") != "59" {
+			t.Errorf("expected Age 59, got %q", w.Header().Get("Age"))
+		}
+		now = now.Add(time.Second)
+		get(r, "/users/1", nil)
+		if calls.Load() != 2 {
+			t.Errorf("expected the entry to expire, got %d handler calls", calls.Load())
+		}
+	})
+
+	t.Run("Eviction", func(t *testing.T) {
+		c := New(Options{MaxBytes: 300})
+		r, calls := newCachedRouter(c)
+		get(r, "/users/1", nil)
+		get(r, "/users/2", nil)
+		get(r, "/users/1", nil) // 2 is now least recently used
+		get(r, "/users/3", nil)
+		if c.size > 300 {
+			t.Errorf("expected at most 300 bytes cached, got %d", c.size)
+		}
+
+		before := calls.Load()
+		get(r, "/users/1", nil)
+		if calls.Load() != before {
+			t.Error("expected the recently used entry to stay cached")
+		}
+		get(r, "/users/2", nil)
+		if calls.Load() != before+1 {
+			t.Error("expected the least recently used entry to be evicted")
+		}
+	})
+}
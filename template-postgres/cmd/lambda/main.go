@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -9,9 +11,33 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"github.com/user/go-templates/template-postgres/db/migration"
+	"github.com/user/go-templates/template-postgres/internal/apikey"
 	"github.com/user/go-templates/template-postgres/internal/config"
+	"github.com/user/go-templates/template-postgres/internal/operation"
+	"github.com/user/go-templates/template-postgres/internal/outbox"
+	"github.com/user/go-templates/template-postgres/internal/role"
 	"github.com/user/go-templates/template-postgres/internal/user"
+	userv1 "github.com/user/go-templates/template-postgres/internal/user/v1"
+	userv2 "github.com/user/go-templates/template-postgres/internal/user/v2"
+	"github.com/user/go-templates/template-postgres/internal/webhook"
+	"github.com/user/go-templates/template-postgres/pkg/auth"
+	"github.com/user/go-templates/template-postgres/pkg/authz"
+	"github.com/user/go-templates/template-postgres/pkg/batch"
+	"github.com/user/go-templates/template-postgres/pkg/bodylimit"
+	"github.com/user/go-templates/template-postgres/pkg/cache"
+	"github.com/user/go-templates/template-postgres/pkg/compress"
+	"github.com/user/go-templates/template-postgres/pkg/cors"
+	"github.com/user/go-templates/template-postgres/pkg/httpcache"
+	"github.com/user/go-templates/template-postgres/pkg/idgen"
 	"github.com/user/go-templates/template-postgres/pkg/logger"
+	"github.com/user/go-templates/template-postgres/pkg/replica"
+	"github.com/user/go-templates/template-postgres/pkg/requestid"
+	"github.com/user/go-templates/template-postgres/pkg/secureheaders"
+	"github.com/user/go-templates/template-postgres/pkg/tenant"
+	"github.com/user/go-templates/template-postgres/pkg/transaction"
+	"go.uber.org/zap"
 )
 
 var chiLambda *chiadapter.ChiLambda
@@ -25,29 +51,242 @@ func init() {
 
 	// Initialize Logger
 	log, _ := logger.New(cfg.Log.Level)
+	zap.ReplaceGlobals(log)
+
+	// Apply Migrations
+	// Lambda has no separate deploy step, so cold starts can migrate.
+	if cfg.DB.AutoMigrate {
+		if err := migration.Up(context.Background(), cfg.DB.Driver, cfg.DB.Source); err != nil {
+			log.Fatal("cannot migrate db", zap.Error(err))
+		}
+	}
 
 	// Connect to Database
+	// With row-level security every connection is scoped to the tenant of
+	// the context it is taken in.
+	newPool := func(source string) (*pgxpool.Pool, error) {
+		poolConfig, err := pgxpool.ParseConfig(source)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Tenancy.RowLevelSecurity {
+			tenant.RowLevelSecurity(poolConfig)
+		}
+		return pgxpool.NewWithConfig(context.Background(), poolConfig)
+	}
 	// In Lambda, connection pooling needs care.
 	// We'll initialize it here (Cold Start).
-	dbPool, err := pgxpool.New(context.Background(), cfg.DB.Source)
+	dbPool, err := newPool(cfg.DB.Source)
 	if err != nil {
 		// handle error
 	}
 	// Note: We don't defer close here because init runs once per cold start.
 	// The connection stays open for warm invocations.
 
+	// Read Replicas
+	// User reads go to the replicas round robin; writes, transactions and
+	// reads after a write in the same request go to the primary.
+	replicas := make([]*pgxpool.Pool, 0, len(cfg.DB.Replicas))
+	for _, source := range cfg.DB.Replicas {
+		pool, err := newPool(source)
+		if err != nil {
+			log.Fatal("cannot connect to replica", zap.Error(err))
+		}
+		replicas = append(replicas, pool)
+	}
+	dbRouter := replica.New(dbPool, replicas, (*pgxpool.Pool).Ping, replica.Options{
+		HealthInterval: cfg.DB.ReplicaHealthInterval,
+	})
+
 	// Initialize Layers
-	userRepo := user.NewPostgresRepository(dbPool)
-	userService := user.NewService(userRepo, log)
-	userHandler := user.NewHandler(userService)
+	// Services give new users, webhook subscriptions and deliveries,
+	// operations and API keys IDs of the configured strategy; the user
+	// service also rejects IDs written any other way.
+	ids, err := idgen.New(cfg.IDs.Strategy)
+	if err != nil {
+		log.Fatal("invalid id strategy", zap.Error(err))
+	}
+
+	// The worker only runs while the function is thawed, so deliveries are
+	// sent during later invocations rather than immediately.
+	webhookRepo := webhook.NewPostgresRepository(dbPool, ids)
+	webhookDispatcher := webhook.NewDispatcher(webhookRepo, ids)
+	_ = webhook.NewWorker(webhookRepo, &http.Client{Timeout: cfg.Webhooks.Timeout}, webhook.WorkerOptions{
+		Interval:    cfg.Webhooks.Interval,
+		MaxAttempts: cfg.Webhooks.MaxAttempts,
+		Backoff:     cfg.Webhooks.Backoff,
+		MaxBackoff:  cfg.Webhooks.MaxBackoff,
+		Timeout:     cfg.Webhooks.Timeout,
+	})
+	webhookHandler := webhook.NewHandler(webhook.NewService(webhookRepo, ids))
+
+	// Operations only progress while the function is thawed, so they may take
+	// far longer than on a server.
+	operations := operation.NewManager(operation.NewPostgresRepository(dbPool, ids), ids, operation.ManagerOptions{
+		Workers: cfg.Operations.Workers,
+		Queue:   cfg.Operations.Queue,
+	})
+	operationHandler := operation.NewHandler(operations)
+
+	txManager := transaction.NewPostgresManager(dbPool)
+	userRepo := user.NewRoutedPostgresRepository(dbRouter, ids)
+	// Users read by ID are cached in front of the database; writes remove
+	// them from the cache once they commit.
+	var users user.Repository = userRepo
+	var usersCache cache.Cache
+	switch cfg.UserCache.Backend {
+	case "":
+	case "memory":
+		usersCache = cache.NewLRU(cache.LRUOptions{MaxEntries: cfg.UserCache.MaxEntries})
+	case "redis":
+		redisClient := redis.NewClient(&redis.Options{
+			Addr:     cfg.UserCache.Redis.Addr,
+			Password: cfg.UserCache.Redis.Password,
+			DB:       cfg.UserCache.Redis.DB,
+		})
+		usersCache = cache.NewRedis(redisClient, cfg.App.Name+":")
+	default:
+		log.Fatal("unknown user cache backend", zap.String("backend", cfg.UserCache.Backend))
+	}
+	if usersCache != nil {
+		users = user.NewCachingRepository(userRepo, usersCache, user.CacheOptions{
+			TTL:         cfg.UserCache.TTL,
+			NotFoundTTL: cfg.UserCache.NotFoundTTL,
+		})
+	}
+	// User events are written to the outbox with each change and published
+	// by the relay, so none is lost if the process stops in between.
+	outboxRepo := outbox.NewPostgresRepository(dbPool)
+	// Lambda cannot hold event streams open, so user events only feed
+	// webhooks. Like the webhook worker, the relay only runs while the
+	// function is thawed.
+	userService := user.NewTransactionalService(users, ids, txManager, outboxRepo)
+	_ = outbox.NewRelay(outboxRepo, user.NewOutboxPublisher(webhookDispatcher), outbox.RelayOptions{
+		Interval:  cfg.Outbox.Interval,
+		BatchSize: cfg.Outbox.BatchSize,
+		Lease:     cfg.Outbox.Lease,
+	})
+	// Deleted users can be restored until the purger removes them. Like the
+	// relay, it only runs while the function is thawed.
+	_ = user.NewPurger(userRepo, user.PurgeOptions{
+		Retention: cfg.UserTrash.Retention,
+		Interval:  cfg.UserTrash.PurgeInterval,
+	})
+	userV1Handler := userv1.NewHandler(userService)
+	userV2Handler := userv2.NewHandler(userService, operations)
+	// Responses to user reads are cached per caller; writes through the user
+	// routes purge the cache.
+	userCache := httpcache.New(httpcache.Options{
+		MaxBytes:      cfg.Server.Cache.MaxBytes,
+		MaxEntryBytes: cfg.Server.Cache.MaxEntryBytes,
+		TTL:           cfg.Server.Cache.TTL,
+	})
+
+	apiKeyRepo := apikey.NewPostgresRepository(dbPool, ids)
+	apiKeyUsage := apikey.NewUsageRecorder(apiKeyRepo, 30*time.Second)
+	apiKeyService := apikey.NewService(apiKeyRepo, ids, apiKeyUsage)
+	apiKeyHandler := apikey.NewHandler(apiKeyService)
+
+	// Authentication
+	authKeys, err := auth.LoadKeySet(context.Background(), auth.KeyOptions{
+		JWKS:            cfg.Auth.JWKS,
+		JWKSRefresh:     cfg.Auth.JWKSRefresh,
+		HMACSecret:      cfg.Auth.HMACSecret,
+		PublicKeyFile:   cfg.Auth.PublicKeyFile,
+		AllowWeakSecret: cfg.App.Env == "dev",
+	})
+	if err != nil {
+		// handle error
+	}
+	verifier := auth.NewVerifier(authKeys, auth.Options{
+		Issuer:    cfg.Auth.Issuer,
+		Audience:  cfg.Auth.Audience,
+		ClockSkew: cfg.Auth.ClockSkew,
+	})
+
+	// Authorization
+	var roleStore authz.Store = authz.StaticRoles(cfg.Authz.Roles)
+	if cfg.Authz.Source == "database" {
+		roleStore = role.NewPostgresRepository(dbPool)
+	}
+	authorizer := authz.NewAuthorizer(roleStore, cfg.Authz.Refresh)
+
+	// Tenancy
+	// Every request acts for one tenant, which scopes the user and webhook
+	// queries.
+	tenantMiddleware, err := tenant.Middleware(tenant.Options{
+		Source:  cfg.Tenancy.Source,
+		Header:  cfg.Tenancy.Header,
+		Domain:  cfg.Tenancy.Domain,
+		Default: cfg.Tenancy.Default,
+	})
+	if err != nil {
+		log.Fatal("invalid tenancy config", zap.Error(err))
+	}
 
 	// Router Setup
 	r := chi.NewRouter()
+	r.Use(requestid.Middleware(log))
+	r.Use(replica.Middleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(secureheaders.Middleware(secureheaders.Options{
+		HSTSMaxAge:            cfg.Server.SecurityHeaders.HSTSMaxAge,
+		HSTSIncludeSubdomains: cfg.Server.SecurityHeaders.HSTSIncludeSubdomains,
+		ContentSecurityPolicy: cfg.Server.SecurityHeaders.ContentSecurityPolicy,
+		ReferrerPolicy:        cfg.Server.SecurityHeaders.ReferrerPolicy,
+	}))
+	// CORS runs before authentication so preflight requests need no credentials.
+	r.Use(cors.Middleware(cors.Options{
+		AllowedOrigins:   cfg.Server.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.Server.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.Server.CORS.AllowedHeaders,
+		ExposedHeaders:   cfg.Server.CORS.ExposedHeaders,
+		AllowCredentials: cfg.Server.CORS.AllowCredentials,
+		MaxAge:           cfg.Server.CORS.MaxAge,
+	}))
+	if cfg.Server.Compression.Enabled {
+		r.Use(compress.Middleware(compress.Options{MinSize: cfg.Server.Compression.MinSize}))
+	}
+	r.Use(bodylimit.Middleware(bodylimit.Options{
+		Default: cfg.Server.BodyLimit.Default,
+		Routes:  cfg.Server.BodyLimit.Limits(),
+	}))
+	r.Use(httpcache.Control(httpcache.ControlOptions{
+		Default: cfg.Server.Cache.Control,
+		Routes:  cfg.Server.Cache.Controls(),
+	}))
+	r.Use(auth.Middleware(verifier))
+	r.Use(apikey.Middleware(apiKeyService))
+	r.Use(authz.Middleware(authorizer))
+	r.Use(tenantMiddleware)
+
+	// Batch operations are dispatched through r itself; atomic batches run
+	// their writes in one transaction.
+	batchHandler := batch.NewHandler(r, batch.Options{
+		MaxOperations: cfg.Server.Batch.MaxOperations,
+		Concurrency:   cfg.Server.Batch.Concurrency,
+		Timeout:       cfg.Server.Batch.Timeout,
+		Tx:            txManager,
+	})
 
 	r.Route("/api/v1", func(r chi.Router) {
-		userHandler.RegisterRoutes(r)
+		r.Group(func(r chi.Router) {
+			if cfg.Server.Cache.Enabled {
+				r.Use(userCache.Middleware)
+			}
+			userV1Handler.RegisterRoutes(r)
+		})
+		apiKeyHandler.RegisterRoutes(r)
+		webhookHandler.RegisterRoutes(r)
+		operationHandler.RegisterRoutes(r)
+		batchHandler.RegisterRoutes(r)
+	})
+	r.Route("/api/v2", func(r chi.Router) {
+		if cfg.Server.Cache.Enabled {
+			r.Use(userCache.Middleware)
+		}
+		userV2Handler.RegisterRoutes(r)
 	})
 
 	chiLambda = chiadapter.New(r)
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/user/go-templates/template-postgres/db/migration"
+	"github.com/user/go-templates/template-postgres/internal/config"
+	"github.com/user/go-templates/template-postgres/pkg/migrate"
+)
+
+const migrateUsage = "usage: server migrate up | down | status | verify | goto VERSION | force VERSION"
+
+// runMigrate implements the migrate subcommand:
+//
+//	up             apply all pending migrations
+//	down           revert the latest migration
+//	status         list migrations and the applied version
+//	verify         compare the schema with the one the migrations produce
+//	goto VERSION   migrate up or down to VERSION; 0 reverts everything
+//	force VERSION  record VERSION as applied after repairing a failed migration
+func runMigrate(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	var version uint64
+	switch args[0] {
+	case "up", "down", "status", "verify":
+		if len(args) != 1 {
+			return errors.New(migrateUsage)
+		}
+	case "goto", "force":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		v, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		version = v
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	if args[0] == "verify" {
+		diff, err := migration.Verify(ctx, cfg.DB.Driver, cfg.DB.Source)
+		if err != nil {
+			return err
+		}
+		for _, line := range diff {
+			fmt.Println(line)
+		}
+		if len(diff) > 0 {
+			return errors.New("schema differs from the migrations")
+		}
+		return nil
+	}
+
+	m, err := migration.New(cfg.DB.Driver, cfg.DB.Source)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch args[0] {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		return m.Down(ctx)
+	case "goto":
+		return m.Goto(ctx, version)
+	case "force":
+		return m.Force(ctx, version)
+	}
+	st, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	return printStatus(os.Stdout, st)
+}
+
+func printStatus(w io.Writer, st migrate.Status) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, mig := range st.Migrations {
+		state := "applied"
+		switch {
+		case mig.Version > st.Version:
+			state = "pending"
+		case mig.Version == st.Version && st.Dirty:
+			state = "dirty"
+		}
+		fmt.Fprintf(tw, "%06d\t%s\t%s\n", mig.Version, mig.Name, state)
+	}
+	fmt.Fprintf(tw, "version\t%d\t\n", st.Version)
+	return tw.Flush()
+}
@@ -0,0 +1,5 @@
+CREATE TABLE role_permissions (
+  role text NOT NULL,
+  permission text NOT NULL,
+  PRIMARY KEY (role, permission)
+);
@@ -0,0 +1,4 @@
+-- pg_trgm stays installed; other schemas may use it.
+DROP INDEX users_email_trgm_idx;
+DROP INDEX users_name_trgm_idx;
+DROP INDEX users_search_idx;
@@ -0,0 +1,7 @@
+-- Expression and trigram indexes are maintained by Postgres on every write,
+-- so search results never lag behind the users table.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX users_search_idx ON users USING GIN (to_tsvector('simple', name || ' ' || email));
+CREATE INDEX users_name_trgm_idx ON users USING GIN (name gin_trgm_ops);
+CREATE INDEX users_email_trgm_idx ON users USING GIN (email gin_trgm_ops);
@@ -0,0 +1,11 @@
+CREATE TABLE operations (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  kind varchar NOT NULL,
+  owner varchar NOT NULL DEFAULT '',
+  status varchar NOT NULL DEFAULT 'pending',
+  progress integer NOT NULL DEFAULT 0,
+  result jsonb,
+  error text NOT NULL DEFAULT '',
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now()
+);
@@ -0,0 +1,4 @@
+-- updated_at drives Last-Modified on user responses. Existing users count as
+-- last modified when they were created.
+ALTER TABLE users ADD COLUMN updated_at timestamptz NOT NULL DEFAULT now();
+UPDATE users SET updated_at = created_at;
@@ -0,0 +1,18 @@
+CREATE TABLE outbox (
+  id bigserial PRIMARY KEY,
+  aggregate_type varchar NOT NULL,
+  aggregate_id varchar NOT NULL,
+  event_type varchar NOT NULL,
+  payload jsonb NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- The single row names the relay currently publishing the outbox; another
+-- relay takes over once expires_at has passed.
+CREATE TABLE outbox_lease (
+  id integer PRIMARY KEY CHECK (id = 1),
+  owner varchar NOT NULL DEFAULT '',
+  expires_at timestamptz NOT NULL DEFAULT '1970-01-01 00:00:00+00'
+);
+
+INSERT INTO outbox_lease (id) VALUES (1);
@@ -0,0 +1,15 @@
+-- Users belong to a tenant, and emails are unique within one. Existing users
+-- move to the default tenant; new ones always name theirs.
+ALTER TABLE users ADD COLUMN tenant_id varchar NOT NULL DEFAULT 'default';
+ALTER TABLE users ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE users DROP CONSTRAINT users_email_key;
+ALTER TABLE users ADD CONSTRAINT users_tenant_id_email_key UNIQUE (tenant_id, email);
+
+-- Row-level security backs up the tenant_id conditions of the queries. It
+-- binds roles other than the table owner, so it takes effect once the
+-- service connects as such a role with tenancy.row_level_security set, which
+-- makes every connection set app.tenant_id to the tenant it acts for.
+ALTER TABLE users ENABLE ROW LEVEL SECURITY;
+CREATE POLICY users_tenant_isolation ON users
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
@@ -0,0 +1,9 @@
+DROP POLICY users_purge_delete ON users;
+DROP POLICY users_purge_select ON users;
+-- Deleted users are removed for good: they could clash with live users'
+-- emails.
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+DROP INDEX users_deleted_at_idx;
+DROP INDEX users_tenant_id_email_key;
+ALTER TABLE users ADD CONSTRAINT users_tenant_id_email_key UNIQUE (tenant_id, email);
+ALTER TABLE users DROP COLUMN deleted_at;
@@ -0,0 +1,13 @@
+-- Deleted users keep their row until purged, so they can be restored. Emails
+-- only need to be unique among the users that are not deleted.
+ALTER TABLE users ADD COLUMN deleted_at timestamptz;
+ALTER TABLE users DROP CONSTRAINT users_tenant_id_email_key;
+CREATE UNIQUE INDEX users_tenant_id_email_key ON users (tenant_id, email) WHERE deleted_at IS NULL;
+CREATE INDEX users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- The purge job acts for no tenant. These policies let it see and delete
+-- deleted users of every tenant in transactions that set app.purge.
+CREATE POLICY users_purge_select ON users FOR SELECT
+  USING (deleted_at IS NOT NULL AND current_setting('app.purge', true) = 'on');
+CREATE POLICY users_purge_delete ON users FOR DELETE
+  USING (deleted_at IS NOT NULL AND current_setting('app.purge', true) = 'on');
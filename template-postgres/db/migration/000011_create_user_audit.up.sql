@@ -0,0 +1,22 @@
+-- The history of changes to users, written by user.Service in the
+-- transaction of each change. before_state and after_state hold the user as
+-- JSON. Entries are kept when their user is purged.
+CREATE TABLE user_audit (
+  id bigserial PRIMARY KEY,
+  tenant_id varchar NOT NULL,
+  user_id uuid NOT NULL,
+  action varchar NOT NULL,
+  actor varchar NOT NULL,
+  request_id varchar NOT NULL,
+  before_state jsonb,
+  after_state jsonb,
+  created_at timestamptz NOT NULL
+);
+
+CREATE INDEX user_audit_tenant_id_user_id_idx ON user_audit (tenant_id, user_id, id);
+
+-- Entries are isolated by tenant like users; see 000009_add_user_tenants.
+ALTER TABLE user_audit ENABLE ROW LEVEL SECURITY;
+CREATE POLICY user_audit_tenant_isolation ON user_audit
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
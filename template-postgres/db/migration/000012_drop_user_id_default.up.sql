@@ -0,0 +1,3 @@
+-- The user service generates user IDs with the configured strategy, which
+-- may not be random UUIDs, so the database no longer does.
+ALTER TABLE users ALTER COLUMN id DROP DEFAULT;
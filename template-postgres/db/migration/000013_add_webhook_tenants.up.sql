@@ -0,0 +1,10 @@
+-- Webhook subscriptions belong to a tenant and receive only its events; each
+-- delivery keeps the tenant of its subscription. Existing rows move to the
+-- default tenant. The worker sends due deliveries of every tenant, so these
+-- tables have no row-level security policy.
+ALTER TABLE webhook_subscriptions ADD COLUMN tenant_id varchar NOT NULL DEFAULT 'default';
+ALTER TABLE webhook_subscriptions ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE webhook_deliveries ADD COLUMN tenant_id varchar NOT NULL DEFAULT 'default';
+ALTER TABLE webhook_deliveries ALTER COLUMN tenant_id DROP DEFAULT;
+
+CREATE INDEX webhook_subscriptions_tenant_idx ON webhook_subscriptions (tenant_id, created_at DESC);
@@ -0,0 +1,6 @@
+-- API keys belong to the tenant they were created in and are rejected on
+-- requests for any other. Existing keys move to the default tenant.
+ALTER TABLE api_keys ADD COLUMN tenant_id varchar NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ALTER COLUMN tenant_id DROP DEFAULT;
+
+CREATE INDEX api_keys_tenant_idx ON api_keys (tenant_id, created_at DESC);
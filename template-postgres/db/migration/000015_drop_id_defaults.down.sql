@@ -0,0 +1,4 @@
+ALTER TABLE operations ALTER COLUMN id SET DEFAULT gen_random_uuid();
+ALTER TABLE webhook_deliveries ALTER COLUMN id SET DEFAULT gen_random_uuid();
+ALTER TABLE webhook_subscriptions ALTER COLUMN id SET DEFAULT gen_random_uuid();
+ALTER TABLE api_keys ALTER COLUMN id SET DEFAULT gen_random_uuid();
@@ -0,0 +1,6 @@
+-- The webhook, operation and API key services generate IDs with the
+-- configured strategy, like the user service, so the database no longer does.
+ALTER TABLE api_keys ALTER COLUMN id DROP DEFAULT;
+ALTER TABLE webhook_subscriptions ALTER COLUMN id DROP DEFAULT;
+ALTER TABLE webhook_deliveries ALTER COLUMN id DROP DEFAULT;
+ALTER TABLE operations ALTER COLUMN id DROP DEFAULT;
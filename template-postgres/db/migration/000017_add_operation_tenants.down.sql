@@ -0,0 +1,3 @@
+DROP POLICY operations_tenant_isolation ON operations;
+ALTER TABLE operations DISABLE ROW LEVEL SECURITY;
+ALTER TABLE operations DROP COLUMN tenant_id;
@@ -0,0 +1,11 @@
+-- Operations belong to the tenant they were started in and are found only
+-- from it. Existing operations move to the default tenant.
+ALTER TABLE operations ADD COLUMN tenant_id varchar NOT NULL DEFAULT 'default';
+ALTER TABLE operations ALTER COLUMN tenant_id DROP DEFAULT;
+
+-- Runners write progress with the tenant of their operation, so the policy
+-- holds for them as well as for requests.
+ALTER TABLE operations ENABLE ROW LEVEL SECURITY;
+CREATE POLICY operations_tenant_isolation ON operations
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
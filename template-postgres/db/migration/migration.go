@@ -0,0 +1,86 @@
+// Package migration embeds the SQL migrations in this directory, which are
+// applied by pkg/migrate.
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"net/url"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/user/go-templates/template-postgres/pkg/migrate"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+// New opens the database at source with driver, "pgx" for Postgres, and
+// returns a Migrator for it.
+func New(driver, source string) (*migrate.Migrator, error) {
+	db, err := sql.Open(driver, source)
+	if err != nil {
+		return nil, err
+	}
+	m, err := migrate.New(db, migrate.Postgres, FS, migrate.Options{})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Up applies all pending migrations to the database at source.
+func Up(ctx context.Context, driver, source string) error {
+	m, err := New(driver, source)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	return m.Up(ctx)
+}
+
+// Verify compares the schema of the database at source with the one the
+// migrations produce, by applying them to a scratch schema in the same
+// database that is dropped afterwards. It returns the differences as
+// migrate.Diff does.
+func Verify(ctx context.Context, driver, source string) ([]string, error) {
+	live, err := New(driver, source)
+	if err != nil {
+		return nil, err
+	}
+	defer live.Close()
+
+	db, err := sql.Open(driver, source)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	schema := fmt.Sprintf("migrate_verify_%d", time.Now().UnixNano())
+	if _, err := db.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		return nil, err
+	}
+	defer db.ExecContext(context.WithoutCancel(ctx), "DROP SCHEMA "+schema+" CASCADE")
+
+	// Extensions such as pg_trgm live in public.
+	scratch, err := New(driver, withSearchPath(source, schema+",public"))
+	if err != nil {
+		return nil, err
+	}
+	defer scratch.Close()
+	return live.Verify(ctx, scratch)
+}
+
+// withSearchPath adds a search_path run-time parameter to a connection URL or
+// keyword/value connection string.
+func withSearchPath(source, path string) string {
+	if u, err := url.Parse(source); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		q := u.Query()
+		q.Set("search_path", path)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return source + " search_path=" + path
+}
@@ -0,0 +1,16 @@
+-- name: CreateOperation :one
+INSERT INTO operations (
+  id, tenant_id, kind, owner
+) VALUES (
+  $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: GetOperation :one
+SELECT * FROM operations
+WHERE id = $1 AND tenant_id = $2 LIMIT 1;
+
+-- name: UpdateOperation :execrows
+UPDATE operations
+SET status = $3, progress = $4, result = $5, error = $6, updated_at = now()
+WHERE id = $1 AND tenant_id = $2 AND status IN ('pending', 'running');
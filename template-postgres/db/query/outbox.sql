@@ -0,0 +1,26 @@
+-- name: CreateOutboxMessage :one
+INSERT INTO outbox (
+  aggregate_type, aggregate_id, event_type, payload
+) VALUES (
+  $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: ListOutboxMessages :many
+SELECT * FROM outbox
+ORDER BY id
+LIMIT $1;
+
+-- name: DeleteOutboxMessage :exec
+DELETE FROM outbox
+WHERE id = $1;
+
+-- name: AcquireOutboxLease :execrows
+UPDATE outbox_lease
+SET owner = @owner, expires_at = @expires_at
+WHERE id = 1 AND (owner = @owner OR expires_at < @now);
+
+-- name: ReleaseOutboxLease :exec
+UPDATE outbox_lease
+SET expires_at = '1970-01-01 00:00:00+00'
+WHERE id = 1 AND owner = $1;
@@ -1,11 +1,69 @@
 -- name: GetUser :one
 SELECT * FROM users
-WHERE id = $1 LIMIT 1;
+WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL LIMIT 1;
+
+-- name: GetUserForUpdate :one
+SELECT * FROM users
+WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+FOR UPDATE;
 
 -- name: CreateUser :one
 INSERT INTO users (
-  name, email
+  id, tenant_id, name, email
 ) VALUES (
-  $1, $2
+  $1, $2, $3, $4
 )
 RETURNING *;
+
+-- name: UpdateUser :one
+UPDATE users
+SET name = $3, email = $4, updated_at = now()
+WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+RETURNING *;
+
+-- name: SoftDeleteUser :execrows
+UPDATE users
+SET deleted_at = now()
+WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL;
+
+-- name: ListDeletedUsers :many
+SELECT * FROM users
+WHERE tenant_id = $1 AND deleted_at IS NOT NULL
+ORDER BY deleted_at DESC, id
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: RestoreUser :one
+UPDATE users
+SET deleted_at = NULL, updated_at = now()
+WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NOT NULL
+RETURNING *;
+
+-- name: PurgeUsers :execrows
+DELETE FROM users
+WHERE deleted_at < $1;
+
+-- name: SearchUsers :many
+SELECT * FROM users
+WHERE tenant_id = sqlc.arg(tenant_id)
+  AND deleted_at IS NULL
+  AND (to_tsvector('simple', name || ' ' || email) @@ plainto_tsquery('simple', sqlc.arg(query))
+       OR name ILIKE sqlc.arg(pattern)
+       OR email ILIKE sqlc.arg(pattern))
+ORDER BY ts_rank(to_tsvector('simple', name || ' ' || email), plainto_tsquery('simple', sqlc.arg(query)))
+         + greatest(similarity(name, sqlc.arg(query)), similarity(email, sqlc.arg(query))) DESC,
+         created_at DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: CreateUserAuditEntry :one
+INSERT INTO user_audit (
+  tenant_id, user_id, action, actor, request_id, before_state, after_state, created_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8
+)
+RETURNING id;
+
+-- name: ListUserAuditEntries :many
+SELECT * FROM user_audit
+WHERE tenant_id = $1 AND user_id = $2
+ORDER BY id DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
@@ -0,0 +1,552 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	repository "github.com/user/go-templates/template-postgres/internal/apikey/sqlc"
+	"github.com/user/go-templates/template-postgres/pkg/auth"
+	"github.com/user/go-templates/template-postgres/pkg/authz"
+	"github.com/user/go-templates/template-postgres/pkg/idgen"
+	"github.com/user/go-templates/template-postgres/pkg/jsonbody"
+	"github.com/user/go-templates/template-postgres/pkg/logger"
+	"github.com/user/go-templates/template-postgres/pkg/tenant"
+	"github.com/user/go-templates/template-postgres/pkg/transaction"
+	"go.uber.org/zap"
+)
+
+// keyPrefix marks plaintext keys so they are easy to recognise in secret scanners.
+const keyPrefix = "gtk_"
+
+// PermissionManage is required to create, list and revoke keys.
+const PermissionManage = "api_keys:manage"
+
+var (
+	ErrNotFound   = errors.New("api key not found")
+	ErrInvalidKey = errors.New("invalid api key")
+)
+
+// --- Domain ---
+
+// APIKey is a long-lived credential for machine clients. Only a SHA-256 hash
+// of the key is stored; the plaintext is returned once, on creation. A key
+// acts for the tenant it was created in and no other.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	TenantID   string     `json:"-"`
+}
+
+// Repository stores keys. Create, List and Revoke are scoped by the tenant
+// in ctx, see package tenant, and return tenant.ErrMissing without one.
+// GetByHash and Touch are not: keys are authenticated before the tenant of
+// the request is resolved, and checked against it by tenant.Middleware.
+type Repository interface {
+	// Create stores key under the ID the service gave it.
+	Create(ctx context.Context, key *APIKey) error
+	GetByHash(ctx context.Context, hash string) (*APIKey, error)
+	List(ctx context.Context) ([]*APIKey, error)
+	Revoke(ctx context.Context, id string, at time.Time) error
+	Touch(ctx context.Context, id string, at time.Time) error
+}
+
+type Service interface {
+	// CreateKey returns authz.ErrPermissionDenied when scopes grant more
+	// than the caller holds itself.
+	CreateKey(ctx context.Context, name string, scopes []string, expiresAt *time.Time) (*APIKey, string, error)
+	ListKeys(ctx context.Context) ([]*APIKey, error)
+	RevokeKey(ctx context.Context, id string) error
+	Authenticate(ctx context.Context, plaintext string) (*APIKey, error)
+}
+
+func hashKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// --- Service Implementation ---
+
+type apiKeyService struct {
+	repo  Repository
+	ids   idgen.Generator
+	usage *UsageRecorder
+}
+
+// NewService returns the API key service. ids generates the IDs of new keys.
+func NewService(repo Repository, ids idgen.Generator, usage *UsageRecorder) Service {
+	return &apiKeyService{
+		repo:  repo,
+		ids:   ids,
+		usage: usage,
+	}
+}
+
+func (s *apiKeyService) CreateKey(ctx context.Context, name string, scopes []string, expiresAt *time.Time) (*APIKey, string, error) {
+	logger.FromContext(ctx).Info("creating api key", zap.String("name", name))
+
+	if name == "" {
+		return nil, "", fmt.Errorf("name is required")
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", fmt.Errorf("expires_at must be in the future")
+	}
+	// A key may do no more than its creator, or anyone managing keys could
+	// create one with "*".
+	if err := authz.Check(ctx, scopes...); err != nil {
+		return nil, "", err
+	}
+
+	var secret [32]byte
+	if _, err := rand.Read(secret[:]); err != nil {
+		return nil, "", err
+	}
+	plaintext := keyPrefix + hex.EncodeToString(secret[:])
+
+	if scopes == nil {
+		scopes = []string{}
+	}
+	key := &APIKey{
+		ID:        s.ids.New(),
+		Name:      name,
+		Prefix:    plaintext[:len(keyPrefix)+8],
+		Hash:      hashKey(plaintext),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.repo.Create(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, plaintext, nil
+}
+
+func (s *apiKeyService) ListKeys(ctx context.Context) ([]*APIKey, error) {
+	return s.repo.List(ctx)
+}
+
+func (s *apiKeyService) RevokeKey(ctx context.Context, id string) error {
+	logger.FromContext(ctx).Info("revoking api key", zap.String("id", id))
+	return s.repo.Revoke(ctx, id, time.Now())
+}
+
+func (s *apiKeyService) Authenticate(ctx context.Context, plaintext string) (*APIKey, error) {
+	if !strings.HasPrefix(plaintext, keyPrefix) {
+		return nil, ErrInvalidKey
+	}
+
+	key, err := s.repo.GetByHash(ctx, hashKey(plaintext))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrInvalidKey
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)) {
+		return nil, ErrInvalidKey
+	}
+
+	s.usage.Record(key.ID, now)
+	return key, nil
+}
+
+// --- Usage Tracking ---
+
+// UsageRecorder writes last-used timestamps in the background so that
+// authentication never waits on a database write. Updates for the same key are
+// coalesced and flushed periodically; when the buffer is full they are dropped.
+type UsageRecorder struct {
+	repo     Repository
+	interval time.Duration
+	updates  chan usage
+	done     chan struct{}
+	once     sync.Once
+}
+
+type usage struct {
+	id string
+	at time.Time
+}
+
+func NewUsageRecorder(repo Repository, interval time.Duration) *UsageRecorder {
+	u := &UsageRecorder{
+		repo:     repo,
+		interval: interval,
+		updates:  make(chan usage, 1024),
+		done:     make(chan struct{}),
+	}
+	go u.run()
+	return u
+}
+
+// Record notes that key id was used at the given time. It never blocks.
+func (u *UsageRecorder) Record(id string, at time.Time) {
+	select {
+	case u.updates <- usage{id: id, at: at}:
+	default:
+	}
+}
+
+// Close flushes pending updates and stops the background writer.
+func (u *UsageRecorder) Close() {
+	u.once.Do(func() {
+		close(u.updates)
+		<-u.done
+	})
+}
+
+func (u *UsageRecorder) run() {
+	defer close(u.done)
+
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+
+	pending := make(map[string]time.Time)
+	for {
+		select {
+		case up, ok := <-u.updates:
+			if !ok {
+				u.flush(pending)
+				return
+			}
+			if up.at.After(pending[up.id]) {
+				pending[up.id] = up.at
+			}
+		case <-ticker.C:
+			u.flush(pending)
+		}
+	}
+}
+
+func (u *UsageRecorder) flush(pending map[string]time.Time) {
+	for id, at := range pending {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := u.repo.Touch(ctx, id, at); err != nil {
+			zap.L().Warn("cannot record api key usage", zap.String("id", id), zap.Error(err))
+		}
+		cancel()
+		delete(pending, id)
+	}
+}
+
+// --- Middleware ---
+
+// Middleware authenticates requests carrying "Authorization: ApiKey <key>" or
+// "X-API-Key: <key>" and exposes the key to handlers as auth.Claims whose
+// subject is "apikey:<id>", whose scopes are the key's scopes and whose
+// tenant is the key's, so tenant.Middleware, which runs after it, rejects
+// requests for other tenants. Requests without a key pass through untouched.
+func Middleware(svc Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			plaintext := keyFromRequest(r)
+			if plaintext == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key, err := svc.Authenticate(r.Context(), plaintext)
+			if err != nil {
+				if !errors.Is(err, ErrInvalidKey) {
+					logger.FromContext(r.Context()).Error("api key lookup failed", zap.Error(err))
+				}
+				w.Header().Set("WWW-Authenticate", "ApiKey")
+				http.Error(w, ErrInvalidKey.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			claims := &auth.Claims{Scope: strings.Join(key.Scopes, " "), TenantID: key.TenantID}
+			claims.Subject = "apikey:" + key.ID
+			ctx := auth.NewContext(r.Context(), claims)
+			ctx = logger.NewContext(ctx, logger.FromContext(ctx).With(zap.String("subject", claims.Subject)))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func keyFromRequest(r *http.Request) string {
+	if scheme, key, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "ApiKey") {
+		return strings.TrimSpace(key)
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// --- Handler ---
+
+type Handler struct {
+	svc Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(authz.Require(PermissionManage), tenantRequired)
+		r.Get("/admin/api-keys", h.ListKeys)
+		r.Post("/admin/api-keys", h.CreateKey)
+		r.Delete("/admin/api-keys/{id}", h.RevokeKey)
+	})
+}
+
+// tenantRequired rejects requests without a tenant to scope the keys by;
+// tenant.Middleware gives every routed request one.
+func tenantRequired(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := tenant.FromContext(r.Context()); !ok {
+			http.Error(w, tenant.ErrMissing.Error(), http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type createKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type createKeyResponse struct {
+	*APIKey
+	// Key is the plaintext key. It is only ever returned here.
+	Key string `json:"key"`
+}
+
+func (h *Handler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	var req createKeyRequest
+	if err := jsonbody.Decode(r, &req); err != nil {
+		http.Error(w, err.Error(), jsonbody.Status(err))
+		return
+	}
+	key, plaintext, err := h.svc.CreateKey(r.Context(), req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, authz.ErrPermissionDenied) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createKeyResponse{APIKey: key, Key: plaintext})
+}
+
+func (h *Handler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.svc.ListKeys(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if keys == nil {
+		keys = []*APIKey{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+func (h *Handler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.RevokeKey(r.Context(), chi.URLParam(r, "id")); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireTenant returns the tenant in ctx, by which repositories scope the
+// keys they create, list and revoke.
+func requireTenant(ctx context.Context) (string, error) {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return "", tenant.ErrMissing
+	}
+	return id, nil
+}
+
+// --- Postgres Repository ---
+
+// PostgresRepository stores key IDs in uuid columns, which hold the 128 bits
+// of an ID of any idgen strategy. ids converts them from and to the IDs the
+// service uses.
+type PostgresRepository struct {
+	q   *repository.Queries
+	db  *pgxpool.Pool
+	ids idgen.Generator
+}
+
+func NewPostgresRepository(db *pgxpool.Pool, ids idgen.Generator) *PostgresRepository {
+	return &PostgresRepository{
+		q:   repository.New(db),
+		db:  db,
+		ids: ids,
+	}
+}
+
+// queries returns r.q bound to the transaction in ctx, if any.
+func (r *PostgresRepository) queries(ctx context.Context) *repository.Queries {
+	if tx, ok := transaction.FromContext(ctx); ok {
+		return r.q.WithTx(tx)
+	}
+	return r.q
+}
+
+// parseID converts id to a uuid column value, or returns idgen.ErrInvalid.
+func (r *PostgresRepository) parseID(id string) (pgtype.UUID, error) {
+	b, err := r.ids.Parse(id)
+	if err != nil {
+		return pgtype.UUID{}, err
+	}
+	return pgtype.UUID{Bytes: b, Valid: true}, nil
+}
+
+// formatID converts a uuid column value to an ID.
+func (r *PostgresRepository) formatID(id pgtype.UUID) string {
+	return r.ids.Format(id.Bytes)
+}
+
+func (r *PostgresRepository) Create(ctx context.Context, key *APIKey) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	id, err := r.parseID(key.ID)
+	if err != nil {
+		return err
+	}
+
+	model, err := r.queries(ctx).CreateAPIKey(ctx, repository.CreateAPIKeyParams{
+		ID:        id,
+		TenantID:  tenantID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		KeyHash:   key.Hash,
+		Scopes:    key.Scopes,
+		ExpiresAt: toTimestamptz(key.ExpiresAt),
+	})
+	if err != nil {
+		return err
+	}
+
+	*key = *r.fromModel(model)
+	return nil
+}
+
+func (r *PostgresRepository) GetByHash(ctx context.Context, hash string) (*APIKey, error) {
+	model, err := r.queries(ctx).GetAPIKeyByHash(ctx, hash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return r.fromModel(model), nil
+}
+
+func (r *PostgresRepository) List(ctx context.Context) ([]*APIKey, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	models, err := r.queries(ctx).ListAPIKeys(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*APIKey, 0, len(models))
+	for _, m := range models {
+		keys = append(keys, r.fromModel(m))
+	}
+	return keys, nil
+}
+
+func (r *PostgresRepository) Revoke(ctx context.Context, id string, at time.Time) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	uid, err := r.parseID(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	n, err := r.queries(ctx).RevokeAPIKey(ctx, repository.RevokeAPIKeyParams{
+		ID:        uid,
+		TenantID:  tenantID,
+		RevokedAt: toTimestamptz(&at),
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PostgresRepository) Touch(ctx context.Context, id string, at time.Time) error {
+	uid, err := r.parseID(id)
+	if err != nil {
+		return err
+	}
+
+	return r.queries(ctx).TouchAPIKey(ctx, repository.TouchAPIKeyParams{
+		ID:         uid,
+		LastUsedAt: toTimestamptz(&at),
+	})
+}
+
+func (r *PostgresRepository) fromModel(m repository.ApiKey) *APIKey {
+	return &APIKey{
+		ID:         r.formatID(m.ID),
+		Name:       m.Name,
+		Prefix:     m.Prefix,
+		Hash:       m.KeyHash,
+		Scopes:     m.Scopes,
+		ExpiresAt:  fromTimestamptz(m.ExpiresAt),
+		RevokedAt:  fromTimestamptz(m.RevokedAt),
+		LastUsedAt: fromTimestamptz(m.LastUsedAt),
+		CreatedAt:  m.CreatedAt,
+		TenantID:   m.TenantID,
+	}
+}
+
+func toTimestamptz(t *time.Time) pgtype.Timestamptz {
+	if t == nil {
+		return pgtype.Timestamptz{}
+	}
+	return pgtype.Timestamptz{Time: *t, Valid: true}
+}
+
+func fromTimestamptz(t pgtype.Timestamptz) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,550 @@
+// Package operation runs long-running work in the background. A handler
+// starts an operation, answers 202 Accepted with its Location, and clients
+// poll GET /operations/{id} until it succeeds, fails or is cancelled. Status,
+// progress, result and error are stored in the database; the work itself runs
+// on a bounded worker pool in the process that started it. Operations belong
+// to the tenant they were started in and are found only from it.
+package operation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	repository "github.com/user/go-templates/template-postgres/internal/operation/sqlc"
+	"github.com/user/go-templates/template-postgres/pkg/auth"
+	"github.com/user/go-templates/template-postgres/pkg/authz"
+	"github.com/user/go-templates/template-postgres/pkg/idgen"
+	"github.com/user/go-templates/template-postgres/pkg/logger"
+	"github.com/user/go-templates/template-postgres/pkg/tenant"
+	"github.com/user/go-templates/template-postgres/pkg/transaction"
+	"go.uber.org/zap"
+)
+
+// PermissionAdmin lets a caller read and cancel operations started by others.
+const PermissionAdmin = "operations:admin"
+
+// Operation statuses. Succeeded, failed and cancelled are final.
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// BasePath is where Handler is mounted; Location URLs are built from it.
+const BasePath = "/api/v1/operations/"
+
+var (
+	ErrNotFound = errors.New("operation not found")
+	ErrFinished = errors.New("operation already finished")
+	ErrBusy     = errors.New("too many operations queued, try again later")
+)
+
+// errShutdown is recorded for operations interrupted by Manager.Close.
+var errShutdown = errors.New("operation interrupted by server shutdown")
+
+// --- Domain ---
+
+// Operation is the state of one piece of background work. Owner is the
+// subject that started it; Result is the JSON the work returned.
+type Operation struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`
+	Owner     string          `json:"-"`
+	Status    string          `json:"status"`
+	Progress  int             `json:"progress"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	// TenantID is the tenant the operation was started in.
+	TenantID string `json:"-"`
+}
+
+// Done reports whether op has reached a final status.
+func (op *Operation) Done() bool {
+	return op.Status == StatusSucceeded || op.Status == StatusFailed || op.Status == StatusCancelled
+}
+
+// Progress reports the percentage of an operation completed so far.
+type Progress func(percent int)
+
+// Func is the work of an operation. It should return promptly once ctx is
+// cancelled. The result is stored as JSON.
+type Func func(ctx context.Context, progress Progress) (any, error)
+
+// Repository stores operations. Implementations scope every call by the
+// tenant in ctx, see package tenant, and return tenant.ErrMissing without one.
+type Repository interface {
+	// Create stores a pending operation under the ID the manager gave it,
+	// filling in its timestamps.
+	Create(ctx context.Context, op *Operation) error
+	Get(ctx context.Context, id string) (*Operation, error)
+	// Update stores status, progress, result and error. It returns
+	// ErrFinished, changing nothing, once the stored operation is final.
+	Update(ctx context.Context, op *Operation) error
+}
+
+type Service interface {
+	// Start stores a pending operation owned by the caller, in the tenant of
+	// ctx, and queues fn. fn runs with ctx's values, such as the caller's
+	// identity, but not its cancellation. Start returns tenant.ErrMissing
+	// without a tenant and ErrBusy when the queue is full.
+	Start(ctx context.Context, kind string, fn Func) (*Operation, error)
+	// Get returns ErrNotFound for operations the caller may not see,
+	// including those of other tenants.
+	Get(ctx context.Context, id string) (*Operation, error)
+	// Cancel returns ErrFinished when the operation is already final.
+	Cancel(ctx context.Context, id string) (*Operation, error)
+}
+
+// --- Manager ---
+
+// ManagerOptions configures a Manager. Zero values use the defaults noted.
+type ManagerOptions struct {
+	// Workers is the number of operations run at once (4).
+	Workers int
+	// Queue is the number of operations that may wait for a worker (100).
+	Queue int
+}
+
+// Manager implements Service with a pool of workers.
+type Manager struct {
+	repo Repository
+	ids  idgen.Generator
+	jobs chan job
+	ctx  context.Context
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+type job struct {
+	op     Operation
+	ctx    context.Context
+	cancel context.CancelFunc
+	fn     Func
+}
+
+// NewManager returns a manager storing operations in repo and starts its
+// workers. ids generates the IDs of new operations.
+func NewManager(repo Repository, ids idgen.Generator, opts ManagerOptions) *Manager {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.Queue <= 0 {
+		opts.Queue = 100
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	m := &Manager{
+		repo:    repo,
+		ids:     ids,
+		jobs:    make(chan job, opts.Queue),
+		ctx:     ctx,
+		stop:    stop,
+		cancels: make(map[string]context.CancelFunc),
+	}
+	for range opts.Workers {
+		m.wg.Add(1)
+		go m.work()
+	}
+	return m
+}
+
+// Close cancels running operations, waits for the workers to exit and marks
+// every operation they did not finish as failed.
+func (m *Manager) Close() {
+	m.stop()
+	m.mu.Lock()
+	for _, cancel := range m.cancels {
+		cancel()
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+
+	for {
+		select {
+		case j := <-m.jobs:
+			m.finish(&j.op, nil, errShutdown)
+			m.forget(j.op.ID)
+		default:
+			return
+		}
+	}
+}
+
+func (m *Manager) Start(ctx context.Context, kind string, fn Func) (*Operation, error) {
+	logger.FromContext(ctx).Info("starting operation", zap.String("kind", kind))
+
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, tenant.ErrMissing
+	}
+	op := &Operation{ID: m.ids.New(), Kind: kind, Status: StatusPending, TenantID: tenantID}
+	if claims, ok := auth.FromContext(ctx); ok {
+		op.Owner = claims.Subject
+	}
+	if err := m.repo.Create(ctx, op); err != nil {
+		return nil, err
+	}
+
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	m.mu.Lock()
+	m.cancels[op.ID] = cancel
+	m.mu.Unlock()
+
+	select {
+	case m.jobs <- job{op: *op, ctx: jobCtx, cancel: cancel, fn: fn}:
+		return op, nil
+	default:
+		m.forget(op.ID)
+		m.finish(op, nil, ErrBusy)
+		return nil, ErrBusy
+	}
+}
+
+func (m *Manager) Get(ctx context.Context, id string) (*Operation, error) {
+	op, err := m.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeAccess(ctx, op); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// Cancel marks the operation cancelled and, if this process is running it,
+// cancels its context. Operations running elsewhere notice at their next
+// progress report.
+func (m *Manager) Cancel(ctx context.Context, id string) (*Operation, error) {
+	logger.FromContext(ctx).Info("cancelling operation", zap.String("id", id))
+
+	op, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if op.Done() {
+		return nil, ErrFinished
+	}
+	op.Status = StatusCancelled
+	if err := m.repo.Update(ctx, op); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	if cancel, ok := m.cancels[id]; ok {
+		cancel()
+	}
+	m.mu.Unlock()
+	return op, nil
+}
+
+func (m *Manager) work() {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case j := <-m.jobs:
+			m.run(j)
+		}
+	}
+}
+
+func (m *Manager) run(j job) {
+	defer m.forget(j.op.ID)
+	defer j.cancel()
+
+	op := &j.op
+	if m.ctx.Err() != nil {
+		m.finish(op, nil, errShutdown)
+		return
+	}
+	op.Status = StatusRunning
+	if errors.Is(m.update(op), ErrFinished) {
+		// Cancelled while queued.
+		return
+	}
+
+	progress := func(percent int) {
+		percent = min(max(percent, 0), 100)
+		if percent == op.Progress {
+			return
+		}
+		op.Progress = percent
+		if errors.Is(m.update(op), ErrFinished) {
+			// Cancelled by another process.
+			j.cancel()
+		}
+	}
+	result, err := call(j.ctx, j.fn, progress)
+	if err != nil && m.ctx.Err() != nil {
+		err = errShutdown
+	}
+	m.finish(op, result, err)
+}
+
+// call runs fn, turning a panic into an error.
+func call(ctx context.Context, fn Func, progress Progress) (result any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("operation panicked: %v", p)
+		}
+	}()
+	return fn(ctx, progress)
+}
+
+// finish records the outcome of op. Cancelled operations stay cancelled.
+func (m *Manager) finish(op *Operation, result any, err error) {
+	if err == nil && result != nil {
+		op.Result, err = json.Marshal(result)
+	}
+	if err != nil {
+		op.Status = StatusFailed
+		op.Error = err.Error()
+	} else {
+		op.Status = StatusSucceeded
+		op.Progress = 100
+	}
+	m.update(op)
+}
+
+// update stores op in its tenant, logging failures other than ErrFinished.
+func (m *Manager) update(op *Operation) error {
+	ctx := tenant.NewContext(context.Background(), op.TenantID)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	err := m.repo.Update(ctx, op)
+	if err != nil && !errors.Is(err, ErrFinished) {
+		zap.L().Error("cannot update operation", zap.String("id", op.ID), zap.Error(err))
+	}
+	return err
+}
+
+func (m *Manager) forget(id string) {
+	m.mu.Lock()
+	delete(m.cancels, id)
+	m.mu.Unlock()
+}
+
+// authorizeAccess lets callers see their own operations; others' require
+// PermissionAdmin. Operations the caller may not see are reported as missing.
+func authorizeAccess(ctx context.Context, op *Operation) error {
+	if claims, ok := auth.FromContext(ctx); ok && claims.Subject == op.Owner {
+		return nil
+	}
+	if authz.Check(ctx, PermissionAdmin) != nil {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// --- Handler ---
+
+// Accepted answers a request that started op with 202, pointing Location at
+// the operation.
+func Accepted(w http.ResponseWriter, op *Operation) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", BasePath+op.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(op)
+}
+
+// WriteError answers a failed Service call.
+func WriteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, tenant.ErrMissing):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrFinished):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrBusy):
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+type Handler struct {
+	svc Service
+}
+
+func NewHandler(svc Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.Group(func(r chi.Router) {
+		r.Use(auth.Required)
+		r.Get("/operations/{id}", h.GetOperation)
+		r.Post("/operations/{id}/cancel", h.CancelOperation)
+	})
+}
+
+func (h *Handler) GetOperation(w http.ResponseWriter, r *http.Request) {
+	op, err := h.svc.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(op)
+}
+
+func (h *Handler) CancelOperation(w http.ResponseWriter, r *http.Request) {
+	op, err := h.svc.Cancel(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(op)
+}
+
+// --- Postgres Repository ---
+
+// PostgresRepository stores operation IDs in uuid columns, which hold the
+// 128 bits of an ID of any idgen strategy. ids converts them from and to the
+// IDs the manager uses.
+type PostgresRepository struct {
+	q   *repository.Queries
+	ids idgen.Generator
+}
+
+func NewPostgresRepository(db *pgxpool.Pool, ids idgen.Generator) *PostgresRepository {
+	return &PostgresRepository{q: repository.New(db), ids: ids}
+}
+
+// queries returns r.q bound to the transaction in ctx, if any.
+func (r *PostgresRepository) queries(ctx context.Context) *repository.Queries {
+	if tx, ok := transaction.FromContext(ctx); ok {
+		return r.q.WithTx(tx)
+	}
+	return r.q
+}
+
+// parseID converts id to a uuid column value, or returns idgen.ErrInvalid.
+func (r *PostgresRepository) parseID(id string) (pgtype.UUID, error) {
+	b, err := r.ids.Parse(id)
+	if err != nil {
+		return pgtype.UUID{}, err
+	}
+	return pgtype.UUID{Bytes: b, Valid: true}, nil
+}
+
+// formatID converts a uuid column value to an ID.
+func (r *PostgresRepository) formatID(id pgtype.UUID) string {
+	return r.ids.Format(id.Bytes)
+}
+
+func (r *PostgresRepository) Create(ctx context.Context, op *Operation) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	id, err := r.parseID(op.ID)
+	if err != nil {
+		return err
+	}
+
+	model, err := r.queries(ctx).CreateOperation(ctx, repository.CreateOperationParams{
+		ID:       id,
+		TenantID: tenantID,
+		Kind:     op.Kind,
+		Owner:    op.Owner,
+	})
+	if err != nil {
+		return err
+	}
+
+	*op = *r.fromModel(model)
+	return nil
+}
+
+func (r *PostgresRepository) Get(ctx context.Context, id string) (*Operation, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := r.parseID(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	model, err := r.queries(ctx).GetOperation(ctx, repository.GetOperationParams{ID: uid, TenantID: tenantID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return r.fromModel(model), nil
+}
+
+func (r *PostgresRepository) Update(ctx context.Context, op *Operation) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	uid, err := r.parseID(op.ID)
+	if err != nil {
+		return err
+	}
+
+	n, err := r.queries(ctx).UpdateOperation(ctx, repository.UpdateOperationParams{
+		ID:       uid,
+		TenantID: tenantID,
+		Status:   op.Status,
+		Progress: int32(op.Progress),
+		Result:   op.Result,
+		Error:    op.Error,
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrFinished
+	}
+	return nil
+}
+
+func (r *PostgresRepository) fromModel(m repository.Operation) *Operation {
+	return &Operation{
+		ID:        r.formatID(m.ID),
+		Kind:      m.Kind,
+		Owner:     m.Owner,
+		Status:    m.Status,
+		Progress:  int(m.Progress),
+		Result:    m.Result,
+		Error:     m.Error,
+		CreatedAt: m.CreatedAt,
+		UpdatedAt: m.UpdatedAt,
+		TenantID:  m.TenantID,
+	}
+}
+
+// requireTenant returns the tenant in ctx, by which the repository scopes
+// every query.
+func requireTenant(ctx context.Context) (string, error) {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return "", tenant.ErrMissing
+	}
+	return id, nil
+}
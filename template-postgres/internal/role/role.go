@@ -0,0 +1,40 @@
+// Package role loads the role → permission mapping used by pkg/authz from
+// the database, so operators can change grants without a redeploy.
+package role
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	repository "github.com/user/go-templates/template-postgres/internal/role/sqlc"
+	"github.com/user/go-templates/template-postgres/pkg/logger"
+)
+
+// --- Postgres Repository ---
+
+// PostgresRepository reads role grants from the role_permissions table. It
+// implements authz.Store.
+type PostgresRepository struct {
+	q *repository.Queries
+}
+
+func NewPostgresRepository(db *pgxpool.Pool) *PostgresRepository {
+	return &PostgresRepository{
+		q: repository.New(db),
+	}
+}
+
+func (r *PostgresRepository) RolePermissions(ctx context.Context) (map[string][]string, error) {
+	logger.FromContext(ctx).Debug("querying role permissions")
+
+	rows, err := r.q.ListRolePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string][]string)
+	for _, row := range rows {
+		roles[row.Role] = append(roles[row.Role], row.Permission)
+	}
+	return roles, nil
+}
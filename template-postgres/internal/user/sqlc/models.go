@@ -10,9 +10,91 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type ApiKey struct {
+	ID         pgtype.UUID        `json:"id"`
+	Name       string             `json:"name"`
+	Prefix     string             `json:"prefix"`
+	KeyHash    string             `json:"key_hash"`
+	Scopes     []string           `json:"scopes"`
+	ExpiresAt  pgtype.Timestamptz `json:"expires_at"`
+	RevokedAt  pgtype.Timestamptz `json:"revoked_at"`
+	LastUsedAt pgtype.Timestamptz `json:"last_used_at"`
+	CreatedAt  time.Time          `json:"created_at"`
+}
+
+type Operation struct {
+	ID        pgtype.UUID `json:"id"`
+	Kind      string      `json:"kind"`
+	Owner     string      `json:"owner"`
+	Status    string      `json:"status"`
+	Progress  int32       `json:"progress"`
+	Result    []byte      `json:"result"`
+	Error     string      `json:"error"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+type Outbox struct {
+	ID            int64     `json:"id"`
+	AggregateType string    `json:"aggregate_type"`
+	AggregateID   string    `json:"aggregate_id"`
+	EventType     string    `json:"event_type"`
+	Payload       []byte    `json:"payload"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type OutboxLease struct {
+	ID        int32     `json:"id"`
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type RolePermission struct {
+	Role       string `json:"role"`
+	Permission string `json:"permission"`
+}
+
 type User struct {
+	ID        pgtype.UUID        `json:"id"`
+	Name      string             `json:"name"`
+	Email     string             `json:"email"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+	TenantID  string             `json:"tenant_id"`
+	DeletedAt pgtype.Timestamptz `json:"deleted_at"`
+}
+
+type UserAudit struct {
+	ID          int64       `json:"id"`
+	TenantID    string      `json:"tenant_id"`
+	UserID      pgtype.UUID `json:"user_id"`
+	Action      string      `json:"action"`
+	Actor       string      `json:"actor"`
+	RequestID   string      `json:"request_id"`
+	BeforeState []byte      `json:"before_state"`
+	AfterState  []byte      `json:"after_state"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             pgtype.UUID        `json:"id"`
+	SubscriptionID pgtype.UUID        `json:"subscription_id"`
+	EventID        string             `json:"event_id"`
+	EventType      string             `json:"event_type"`
+	Payload        []byte             `json:"payload"`
+	Status         string             `json:"status"`
+	Attempts       int32              `json:"attempts"`
+	NextAttemptAt  time.Time          `json:"next_attempt_at"`
+	LastError      string             `json:"last_error"`
+	ResponseStatus int32              `json:"response_status"`
+	DeliveredAt    pgtype.Timestamptz `json:"delivered_at"`
+	CreatedAt      time.Time          `json:"created_at"`
+}
+
+type WebhookSubscription struct {
 	ID        pgtype.UUID `json:"id"`
-	Name      string      `json:"name"`
-	Email     string      `json:"email"`
+	Url       string      `json:"url"`
+	Secret    string      `json:"secret"`
+	Events    []string    `json:"events"`
 	CreatedAt time.Time   `json:"created_at"`
 }
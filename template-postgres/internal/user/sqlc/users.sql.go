@@ -7,47 +7,368 @@ package repository
 
 import (
 	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
-  name, email
+  id, tenant_id, name, email
 ) VALUES (
-  $1, $2
+  $1, $2, $3, $4
 )
-RETURNING id, name, email, created_at
+RETURNING id, name, email, created_at, updated_at, tenant_id, deleted_at
 `
 
 type CreateUserParams struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID       pgtype.UUID `json:"id"`
+	TenantID string      `json:"tenant_id"`
+	Name     string      `json:"name"`
+	Email    string      `json:"email"`
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRow(ctx, createUser, arg.Name, arg.Email)
+	row := q.db.QueryRow(ctx, createUser,
+		arg.ID,
+		arg.TenantID,
+		arg.Name,
+		arg.Email,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
 		&i.Name,
 		&i.Email,
 		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
+const createUserAuditEntry = `-- name: CreateUserAuditEntry :one
+INSERT INTO user_audit (
+  tenant_id, user_id, action, actor, request_id, before_state, after_state, created_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8
+)
+RETURNING id
+`
+
+type CreateUserAuditEntryParams struct {
+	TenantID    string      `json:"tenant_id"`
+	UserID      pgtype.UUID `json:"user_id"`
+	Action      string      `json:"action"`
+	Actor       string      `json:"actor"`
+	RequestID   string      `json:"request_id"`
+	BeforeState []byte      `json:"before_state"`
+	AfterState  []byte      `json:"after_state"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+func (q *Queries) CreateUserAuditEntry(ctx context.Context, arg CreateUserAuditEntryParams) (int64, error) {
+	row := q.db.QueryRow(ctx, createUserAuditEntry,
+		arg.TenantID,
+		arg.UserID,
+		arg.Action,
+		arg.Actor,
+		arg.RequestID,
+		arg.BeforeState,
+		arg.AfterState,
+		arg.CreatedAt,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
 const getUser = `-- name: GetUser :one
-SELECT id, name, email, created_at FROM users
-WHERE id = $1 LIMIT 1
+SELECT id, name, email, created_at, updated_at, tenant_id, deleted_at FROM users
+WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL LIMIT 1
+`
+
+type GetUserParams struct {
+	ID       interface{} `json:"id"`
+	TenantID string      `json:"tenant_id"`
+}
+
+func (q *Queries) GetUser(ctx context.Context, arg GetUserParams) (User, error) {
+	row := q.db.QueryRow(ctx, getUser, arg.ID, arg.TenantID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getUserForUpdate = `-- name: GetUserForUpdate :one
+SELECT id, name, email, created_at, updated_at, tenant_id, deleted_at FROM users
+WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+FOR UPDATE
+`
+
+type GetUserForUpdateParams struct {
+	ID       interface{} `json:"id"`
+	TenantID string      `json:"tenant_id"`
+}
+
+func (q *Queries) GetUserForUpdate(ctx context.Context, arg GetUserForUpdateParams) (User, error) {
+	row := q.db.QueryRow(ctx, getUserForUpdate, arg.ID, arg.TenantID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const listDeletedUsers = `-- name: ListDeletedUsers :many
+SELECT id, name, email, created_at, updated_at, tenant_id, deleted_at FROM users
+WHERE tenant_id = $1 AND deleted_at IS NOT NULL
+ORDER BY deleted_at DESC, id
+LIMIT $2 OFFSET $3
+`
+
+type ListDeletedUsersParams struct {
+	TenantID  string `json:"tenant_id"`
+	RowLimit  int32  `json:"row_limit"`
+	RowOffset int32  `json:"row_offset"`
+}
+
+func (q *Queries) ListDeletedUsers(ctx context.Context, arg ListDeletedUsersParams) ([]User, error) {
+	rows, err := q.db.Query(ctx, listDeletedUsers, arg.TenantID, arg.RowLimit, arg.RowOffset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Email,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.TenantID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserAuditEntries = `-- name: ListUserAuditEntries :many
+SELECT id, tenant_id, user_id, action, actor, request_id, before_state, after_state, created_at FROM user_audit
+WHERE tenant_id = $1 AND user_id = $2
+ORDER BY id DESC
+LIMIT $3 OFFSET $4
+`
+
+type ListUserAuditEntriesParams struct {
+	TenantID  string      `json:"tenant_id"`
+	UserID    pgtype.UUID `json:"user_id"`
+	RowLimit  int32       `json:"row_limit"`
+	RowOffset int32       `json:"row_offset"`
+}
+
+func (q *Queries) ListUserAuditEntries(ctx context.Context, arg ListUserAuditEntriesParams) ([]UserAudit, error) {
+	rows, err := q.db.Query(ctx, listUserAuditEntries,
+		arg.TenantID,
+		arg.UserID,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserAudit
+	for rows.Next() {
+		var i UserAudit
+		if err := rows.Scan(
+			&i.ID,
+			&i.TenantID,
+			&i.UserID,
+			&i.Action,
+			&i.Actor,
+			&i.RequestID,
+			&i.BeforeState,
+			&i.AfterState,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeUsers = `-- name: PurgeUsers :execrows
+DELETE FROM users
+WHERE deleted_at < $1
+`
+
+func (q *Queries) PurgeUsers(ctx context.Context, deletedAt pgtype.Timestamptz) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeUsers, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const restoreUser = `-- name: RestoreUser :one
+UPDATE users
+SET deleted_at = NULL, updated_at = now()
+WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NOT NULL
+RETURNING id, name, email, created_at, updated_at, tenant_id, deleted_at
 `
 
-func (q *Queries) GetUser(ctx context.Context, id interface{}) (User, error) {
-	row := q.db.QueryRow(ctx, getUser, id)
+type RestoreUserParams struct {
+	ID       interface{} `json:"id"`
+	TenantID string      `json:"tenant_id"`
+}
+
+func (q *Queries) RestoreUser(ctx context.Context, arg RestoreUserParams) (User, error) {
+	row := q.db.QueryRow(ctx, restoreUser, arg.ID, arg.TenantID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT id, name, email, created_at, updated_at, tenant_id, deleted_at FROM users
+WHERE tenant_id = $1
+  AND deleted_at IS NULL
+  AND (to_tsvector('simple', name || ' ' || email) @@ plainto_tsquery('simple', $2)
+       OR name ILIKE $3
+       OR email ILIKE $3)
+ORDER BY ts_rank(to_tsvector('simple', name || ' ' || email), plainto_tsquery('simple', $2))
+         + greatest(similarity(name, $2), similarity(email, $2)) DESC,
+         created_at DESC
+LIMIT $4 OFFSET $5
+`
+
+type SearchUsersParams struct {
+	TenantID  string `json:"tenant_id"`
+	Query     string `json:"query"`
+	Pattern   string `json:"pattern"`
+	RowLimit  int32  `json:"row_limit"`
+	RowOffset int32  `json:"row_offset"`
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error) {
+	rows, err := q.db.Query(ctx, searchUsers,
+		arg.TenantID,
+		arg.Query,
+		arg.Pattern,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Email,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.TenantID,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const softDeleteUser = `-- name: SoftDeleteUser :execrows
+UPDATE users
+SET deleted_at = now()
+WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+`
+
+type SoftDeleteUserParams struct {
+	ID       interface{} `json:"id"`
+	TenantID string      `json:"tenant_id"`
+}
+
+func (q *Queries) SoftDeleteUser(ctx context.Context, arg SoftDeleteUserParams) (int64, error) {
+	result, err := q.db.Exec(ctx, softDeleteUser, arg.ID, arg.TenantID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+SET name = $3, email = $4, updated_at = now()
+WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL
+RETURNING id, name, email, created_at, updated_at, tenant_id, deleted_at
+`
+
+type UpdateUserParams struct {
+	ID       interface{} `json:"id"`
+	TenantID string      `json:"tenant_id"`
+	Name     string      `json:"name"`
+	Email    string      `json:"email"`
+}
+
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUser,
+		arg.ID,
+		arg.TenantID,
+		arg.Name,
+		arg.Email,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
 		&i.Name,
 		&i.Email,
 		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TenantID,
+		&i.DeletedAt,
 	)
 	return i, err
 }
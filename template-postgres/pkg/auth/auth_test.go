@@ -0,0 +1,421 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// --- Helpers ---
+
+type testKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	jwk     map[string]string
+}
+
+func newRSAKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, method: jwt.SigningMethodRS256, private: k, jwk: map[string]string{
+		"kty": "RSA", "kid": kid, "alg": "RS256", "use": "sig",
+		"n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes()),
+	}}
+}
+
+func newECKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, method: jwt.SigningMethodES256, private: k, jwk: map[string]string{
+		"kty": "EC", "kid": kid, "crv": "P-256",
+		"x": b64(k.X.FillBytes(make([]byte, 32))), "y": b64(k.Y.FillBytes(make([]byte, 32))),
+	}}
+}
+
+func newEdKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, method: jwt.SigningMethodEdDSA, private: priv, jwk: map[string]string{
+		"kty": "OKP", "kid": kid, "crv": "Ed25519", "x": b64(pub),
+	}}
+}
+
+func newHMACKey(kid string, secret []byte) testKey {
+	return testKey{kid: kid, method: jwt.SigningMethodHS256, private: secret, jwk: map[string]string{
+		"kty": "oct", "kid": kid, "k": b64(secret),
+	}}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (k testKey) sign(t *testing.T, claims Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(k.method, claims)
+	if k.kid != "" {
+		token.Header["kid"] = k.kid
+	}
+	s, err := token.SignedString(k.private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func writeJWKS(t *testing.T, path string, keys ...testKey) {
+	t.Helper()
+	doc := struct {
+		Keys []map[string]string `json:"keys"`
+	}{}
+	for _, k := range keys {
+		doc.Keys = append(doc.Keys, k.jwk)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func validClaims() Claims {
+	now := time.Now()
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			Issuer:    "test-issuer",
+			Audience:  jwt.ClaimStrings{"test-api"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+		Scope: "users:read users:write",
+	}
+}
+
+var testOptions = Options{Issuer: "test-issuer", Audience: "test-api", ClockSkew: 30 * time.Second}
+
+// --- Verifier Tests ---
+
+func TestVerifier_JWKS(t *testing.T) {
+	rsaKey := newRSAKey(t, "rsa-1")
+	ecKey := newECKey(t, "ec-1")
+	edKey := newEdKey(t, "ed-1")
+	hmacKey := newHMACKey("oct-1", []byte("0123456789abcdef0123456789abcdef"))
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaKey, ecKey, edKey, hmacKey)
+
+	keys, err := NewJWKS(context.Background(), path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := NewVerifier(keys, testOptions)
+
+	expired := validClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+
+	withinSkew := validClaims()
+	withinSkew.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-10 * time.Second))
+
+	wrongIssuer := validClaims()
+	wrongIssuer.Issuer = "someone-else"
+
+	wrongAudience := validClaims()
+	wrongAudience.Audience = jwt.ClaimStrings{"other-api"}
+
+	noExpiry := validClaims()
+	noExpiry.ExpiresAt = nil
+
+	// An RSA key served under an HS256 token must never be used as a secret.
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+	confused.Header["kid"] = "rsa-1"
+	confusedToken, _ := confused.SignedString(x509.MarshalPKCS1PublicKey(&rsaKey.private.(*rsa.PrivateKey).PublicKey))
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "RS256", token: rsaKey.sign(t, validClaims())},
+		{name: "ES256", token: ecKey.sign(t, validClaims())},
+		{name: "EdDSA", token: edKey.sign(t, validClaims())},
+		{name: "HS256", token: hmacKey.sign(t, validClaims())},
+		{name: "ExpiredWithinSkew", token: rsaKey.sign(t, withinSkew)},
+		{name: "Expired", token: rsaKey.sign(t, expired), wantErr: true},
+		{name: "NoExpiry", token: rsaKey.sign(t, noExpiry), wantErr: true},
+		{name: "WrongIssuer", token: rsaKey.sign(t, wrongIssuer), wantErr: true},
+		{name: "WrongAudience", token: rsaKey.sign(t, wrongAudience), wantErr: true},
+		{name: "UnknownKey", token: newRSAKey(t, "rsa-unknown").sign(t, validClaims()), wantErr: true},
+		{name: "AlgorithmConfusion", token: confusedToken, wantErr: true},
+		{name: "Garbage", token: "not.a.jwt", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(context.Background(), tt.token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("expected ErrInvalidToken, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if claims.Subject != "user-1" || len(claims.Scopes()) != 2 {
+				t.Errorf("unexpected claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestJWKS_Rotation(t *testing.T) {
+	oldKey := newRSAKey(t, "old")
+	newKey := newECKey(t, "new")
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, oldKey)
+
+	keys, err := NewJWKS(context.Background(), path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := NewVerifier(keys, testOptions)
+
+	if _, err := v.Verify(context.Background(), oldKey.sign(t, validClaims())); err != nil {
+		t.Fatalf("old key: %v", err)
+	}
+
+	// The issuer rotates keys; pretend the rate limit window has passed.
+	writeJWKS(t, path, newKey)
+	keys.triedAt = time.Now().Add(-time.Hour)
+
+	if _, err := v.Verify(context.Background(), newKey.sign(t, validClaims())); err != nil {
+		t.Fatalf("new key after rotation: %v", err)
+	}
+	if _, err := v.Verify(context.Background(), oldKey.sign(t, validClaims())); err == nil {
+		t.Error("expected retired key to be rejected")
+	}
+}
+
+func TestJWKS_URL(t *testing.T) {
+	key := newEdKey(t, "ed")
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, key)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, path)
+	}))
+	defer srv.Close()
+
+	keys, err := NewJWKS(context.Background(), srv.URL, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVerifier(keys, testOptions).Verify(context.Background(), key.sign(t, validClaims())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestJWKS_RefreshBackoff(t *testing.T) {
+	key := newEdKey(t, "ed")
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, key)
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) > 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeFile(w, r, path)
+	}))
+	defer srv.Close()
+
+	keys, err := NewJWKS(context.Background(), srv.URL, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := NewVerifier(keys, testOptions)
+	wait := func() {
+		keys.mu.Lock()
+		done := keys.loading
+		keys.mu.Unlock()
+		if done != nil {
+			<-done
+		}
+	}
+
+	// The keys are due for a refresh, which fails.
+	keys.mu.Lock()
+	keys.fetchedAt = time.Now().Add(-2 * time.Hour)
+	keys.triedAt = keys.fetchedAt
+	keys.mu.Unlock()
+
+	for range 2 {
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// The cached keys are served while the refresh fails.
+				if _, err := v.Verify(context.Background(), key.sign(t, validClaims())); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		wait()
+	}
+	if _, err := v.Verify(context.Background(), newEdKey(t, "unknown").sign(t, validClaims())); err == nil {
+		t.Error("expected unknown key to be rejected")
+	}
+	wait()
+
+	// One refresh was tried, and the failure backs off further ones.
+	if n := hits.Load(); n != 2 {
+		t.Errorf("expected 2 fetches, got %d", n)
+	}
+	if keys.backoff <= minRefreshInterval {
+		t.Errorf("expected backoff to grow after a failure, got %v", keys.backoff)
+	}
+}
+
+func TestStaticKeys(t *testing.T) {
+	ecKey := newECKey(t, "")
+	der, err := x509.MarshalPKIXPublicKey(&ecKey.private.(*ecdsa.PrivateKey).PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "public.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := []byte("local-secret-of-at-least-32-bytes")
+	keys, err := LoadKeySet(context.Background(), KeyOptions{HMACSecret: string(secret), PublicKeyFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := NewVerifier(keys, testOptions)
+
+	if _, err := v.Verify(context.Background(), ecKey.sign(t, validClaims())); err != nil {
+		t.Errorf("ES256: unexpected error: %v", err)
+	}
+	if _, err := v.Verify(context.Background(), newHMACKey("", secret).sign(t, validClaims())); err != nil {
+		t.Errorf("HS256: unexpected error: %v", err)
+	}
+	if _, err := v.Verify(context.Background(), newRSAKey(t, "").sign(t, validClaims())); err == nil {
+		t.Error("RS256: expected error without an RSA key")
+	}
+}
+
+func TestLoadKeySet_WeakSecret(t *testing.T) {
+	tests := []struct {
+		name        string
+		secret      string
+		allowWeak   bool
+		expectedErr error
+	}{
+		{name: "Placeholder", secret: "change-me", expectedErr: ErrWeakSecret},
+		{name: "Short", secret: "local-secret", expectedErr: ErrWeakSecret},
+		{name: "Long", secret: "local-secret-of-at-least-32-bytes"},
+		{name: "AllowWeak", secret: "change-me", allowWeak: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadKeySet(context.Background(), KeyOptions{HMACSecret: tt.secret, AllowWeakSecret: tt.allowWeak})
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("expected error %v, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+// --- Middleware Tests ---
+
+func TestMiddleware(t *testing.T) {
+	key := newHMACKey("", []byte("local-secret"))
+	keys, err := NewStaticKeys("local-secret", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := NewVerifier(keys, testOptions)
+
+	tests := []struct {
+		name           string
+		authorization  string
+		protected      bool
+		expectedStatus int
+	}{
+		{name: "PublicAnonymous", expectedStatus: http.StatusOK},
+		{name: "ProtectedAnonymous", protected: true, expectedStatus: http.StatusUnauthorized},
+		{name: "ProtectedValid", protected: true, authorization: "Bearer " + key.sign(t, validClaims()), expectedStatus: http.StatusOK},
+		{name: "PublicInvalid", authorization: "Bearer nope", expectedStatus: http.StatusUnauthorized},
+		{name: "EmptyBearer", authorization: "Bearer ", expectedStatus: http.StatusUnauthorized},
+		{name: "OtherScheme", authorization: "Basic dXNlcjpwYXNz", protected: true, expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.protected {
+					if c, ok := FromContext(r.Context()); !ok || c.Subject != "user-1" {
+						t.Errorf("expected claims in context, got %+v", c)
+					}
+				}
+			})
+			if tt.protected {
+				h = Required(h)
+			}
+			h = Middleware(v)(h)
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate challenge")
+			}
+		})
+	}
+}
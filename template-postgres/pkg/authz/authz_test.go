@@ -0,0 +1,133 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/user/go-templates/template-postgres/pkg/auth"
+)
+
+type storeFunc func(ctx context.Context) (map[string][]string, error)
+
+func (f storeFunc) RolePermissions(ctx context.Context) (map[string][]string, error) {
+	return f(ctx)
+}
+
+func TestAuthorizer_Allowed(t *testing.T) {
+	a := NewAuthorizer(StaticRoles{
+		"admin":  {"*"},
+		"editor": {"users:*"},
+		"viewer": {"users:read"},
+	}, 0)
+
+	tests := []struct {
+		name     string
+		claims   *auth.Claims
+		perms    []string
+		expected bool
+	}{
+		{name: "Anonymous", perms: []string{"users:read"}, expected: false},
+		{name: "NoGrants", claims: &auth.Claims{}, perms: []string{"users:read"}, expected: false},
+		{name: "Role", claims: &auth.Claims{Roles: []string{"viewer"}}, perms: []string{"users:read"}, expected: true},
+		{name: "RoleMissingPermission", claims: &auth.Claims{Roles: []string{"viewer"}}, perms: []string{"users:write"}, expected: false},
+		{name: "PrefixWildcard", claims: &auth.Claims{Roles: []string{"editor"}}, perms: []string{"users:read", "users:write"}, expected: true},
+		{name: "PrefixWildcardOtherResource", claims: &auth.Claims{Roles: []string{"editor"}}, perms: []string{"api_keys:manage"}, expected: false},
+		{name: "Wildcard", claims: &auth.Claims{Roles: []string{"admin"}}, perms: []string{"api_keys:manage"}, expected: true},
+		{name: "Scope", claims: &auth.Claims{Scope: "users:read users:write"}, perms: []string{"users:write"}, expected: true},
+		{name: "UnknownRole", claims: &auth.Claims{Roles: []string{"ghost"}}, perms: []string{"users:read"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.Allowed(context.Background(), tt.claims, tt.perms...); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAuthorizer_Refresh(t *testing.T) {
+	roles := map[string][]string{"viewer": {"users:read"}}
+	var fail bool
+	a := NewAuthorizer(storeFunc(func(ctx context.Context) (map[string][]string, error) {
+		if fail {
+			return nil, errors.New("database unavailable")
+		}
+		return roles, nil
+	}), time.Millisecond)
+	claims := &auth.Claims{Roles: []string{"viewer"}}
+
+	if !a.Allowed(context.Background(), claims, "users:read") {
+		t.Fatal("expected initial mapping to allow users:read")
+	}
+
+	roles = map[string][]string{"viewer": {"users:read", "users:write"}}
+	time.Sleep(2 * time.Millisecond)
+	if !a.Allowed(context.Background(), claims, "users:write") {
+		t.Fatal("expected reloaded mapping to allow users:write")
+	}
+
+	fail = true
+	time.Sleep(2 * time.Millisecond)
+	if !a.Allowed(context.Background(), claims, "users:write") {
+		t.Fatal("expected failed reload to keep the previous mapping")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	a := NewAuthorizer(StaticRoles{"viewer": {"users:read"}}, 0)
+	claims := &auth.Claims{Roles: []string{"viewer"}}
+
+	if err := Check(context.Background(), "users:write"); err != nil {
+		t.Errorf("expected internal caller to be allowed, got %v", err)
+	}
+	if err := Check(auth.NewContext(context.Background(), claims), "users:read"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("expected denial without an authorizer, got %v", err)
+	}
+
+	ctx := NewContext(auth.NewContext(context.Background(), claims), a)
+	if err := Check(ctx, "users:read"); err != nil {
+		t.Errorf("expected users:read to be allowed, got %v", err)
+	}
+	if err := Check(ctx, "users:write"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("expected users:write to be denied, got %v", err)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	a := NewAuthorizer(StaticRoles{"viewer": {"users:read"}}, 0)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := Middleware(a)(Require("users:read")(next))
+
+	tests := []struct {
+		name           string
+		claims         *auth.Claims
+		expectedStatus int
+	}{
+		{name: "Anonymous", expectedStatus: http.StatusUnauthorized},
+		{name: "Forbidden", claims: &auth.Claims{}, expectedStatus: http.StatusForbidden},
+		{name: "Allowed", claims: &auth.Claims{Roles: []string{"viewer"}}, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.claims != nil {
+				req = req.WithContext(auth.NewContext(req.Context(), tt.claims))
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+// Package compress compresses responses with gzip or zstd, negotiated via
+// the Accept-Encoding request header.
+package compress
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultMinSize is used when Options.MinSize is zero. Smaller responses are
+// sent uncompressed; the framing overhead outweighs the savings.
+const DefaultMinSize = 1024
+
+// Options configures the middleware.
+type Options struct {
+	MinSize int
+}
+
+// encodings lists supported codings in order of preference.
+var encodings = []string{"zstd", "gzip"}
+
+var (
+	gzipPool = sync.Pool{New: func() any {
+		return gzip.NewWriter(io.Discard)
+	}}
+	zstdPool = sync.Pool{New: func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return enc
+	}}
+)
+
+// Middleware compresses compressible responses (JSON, text, XML) of at least
+// MinSize bytes. Responses that already carry a Content-Encoding, streams
+// such as text/event-stream and bodies flushed before MinSize are sent as is.
+func Middleware(opts Options) func(http.Handler) http.Handler {
+	minSize := opts.MinSize
+	if minSize <= 0 {
+		minSize = DefaultMinSize
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := Negotiate(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &responseWriter{ResponseWriter: w, encoding: encoding, minSize: minSize, status: http.StatusOK}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// Negotiate picks the preferred supported coding from an Accept-Encoding
+// header, honouring q-values. It returns "" when the client accepts none.
+func Negotiate(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	q := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		weight := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				weight = f
+			}
+		}
+		q[name] = weight
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range encodings {
+		w, ok := q[enc]
+		if !ok {
+			w, ok = q["*"]
+		}
+		if ok && w > bestQ {
+			best, bestQ = enc, w
+		}
+	}
+	return best
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json",
+		mediaType == "application/xml",
+		mediaType == "application/javascript",
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	return false
+}
+
+// responseWriter buffers the start of the body until it can decide whether
+// compressing is worthwhile.
+type responseWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status  int
+	decided bool
+	buf     []byte
+	enc     io.WriteCloser
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.decided || code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		w.passthrough()
+	}
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.minSize {
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// decide starts compressing when the response allows it and flushes the
+// buffered bytes either way.
+func (w *responseWriter) decide() error {
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if h.Get("Content-Encoding") != "" || len(w.buf) < w.minSize || !compressible(h.Get("Content-Type")) {
+		return w.passthrough()
+	}
+
+	w.decided = true
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", w.encoding)
+	w.ResponseWriter.WriteHeader(w.status)
+
+	switch w.encoding {
+	case "zstd":
+		enc := zstdPool.Get().(*zstd.Encoder)
+		enc.Reset(w.ResponseWriter)
+		w.enc = enc
+	default:
+		enc := gzipPool.Get().(*gzip.Writer)
+		enc.Reset(w.ResponseWriter)
+		w.enc = enc
+	}
+
+	buf := w.buf
+	w.buf = nil
+	_, err := w.enc.Write(buf)
+	return err
+}
+
+func (w *responseWriter) passthrough() error {
+	w.decided = true
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+func (w *responseWriter) close() {
+	if !w.decided {
+		w.passthrough()
+		return
+	}
+	if w.enc == nil {
+		return
+	}
+
+	w.enc.Close()
+	switch enc := w.enc.(type) {
+	case *zstd.Encoder:
+		enc.Reset(nil)
+		zstdPool.Put(enc)
+	case *gzip.Writer:
+		enc.Reset(io.Discard)
+		gzipPool.Put(enc)
+	}
+	w.enc = nil
+}
+
+// Flush sends buffered data to the client. A response flushed before the
+// compression decision is made is sent uncompressed.
+func (w *responseWriter) Flush() {
+	if !w.decided {
+		w.passthrough()
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
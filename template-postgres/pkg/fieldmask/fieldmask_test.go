@@ -0,0 +1,95 @@
+package fieldmask
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+)
+
+var allowed = []string{"id", "name", "email"}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name          string
+		in            string
+		expected      Mask
+		expectedError error
+	}{
+		{name: "Empty", in: "", expected: nil},
+		{name: "Blank", in: " , ", expected: nil},
+		{name: "Single", in: "name", expected: Mask{"name"}},
+		{name: "AllowListOrder", in: "email, id", expected: Mask{"id", "email"}},
+		{name: "Duplicates", in: "name,name,id", expected: Mask{"id", "name"}},
+		{name: "Unknown", in: "id,password", expectedError: ErrUnknownField},
+		{name: "CaseSensitive", in: "Name", expectedError: ErrUnknownField},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(tt.in, allowed)
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("expected error %v, got %v", tt.expectedError, err)
+			}
+			if !slices.Equal(m, tt.expected) {
+				t.Errorf("expected %#v, got %#v", tt.expected, m)
+			}
+		})
+	}
+}
+
+func TestMask_Has(t *testing.T) {
+	if !Mask(nil).Has("email") {
+		t.Error("empty mask should select every field")
+	}
+	m := Mask{"id"}
+	if !m.Has("id") || m.Has("email") {
+		t.Errorf("unexpected selection for %v", m)
+	}
+}
+
+func TestMask_With(t *testing.T) {
+	if m := Mask(nil).With("id"); len(m) != 0 {
+		t.Errorf("expected empty mask to stay empty, got %v", m)
+	}
+	m := Mask{"id", "name"}
+	if got := m.With("name", "created_at"); !slices.Equal(got, Mask{"id", "name", "created_at"}) {
+		t.Errorf("unexpected mask %v", got)
+	}
+	if len(m) != 2 {
+		t.Errorf("expected the receiver to be unchanged, got %v", m)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	type name struct {
+		Given string `json:"given"`
+	}
+	v := struct {
+		ID    string `json:"id"`
+		Name  name   `json:"name"`
+		Email string `json:"email"`
+	}{ID: "123", Name: name{Given: "Ada"}, Email: "ada@example.com"}
+
+	tests := []struct {
+		name     string
+		mask     Mask
+		expected string
+	}{
+		{name: "All", mask: nil, expected: `{"id":"123","name":{"given":"Ada"},"email":"ada@example.com"}`},
+		{name: "Subset", mask: Mask{"name", "id"}, expected: `{"name":{"given":"Ada"},"id":"123"}`},
+		{name: "Missing", mask: Mask{"created_at"}, expected: `{}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(Select(v, tt.mask))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, b)
+			}
+		})
+	}
+}
@@ -0,0 +1,483 @@
+// Package migrate applies versioned SQL migrations to Postgres, MySQL and
+// SQLite. The current version is kept in a schema_migrations table laid out
+// like the one of the migrate CLI, so databases migrated with either can be
+// taken over by the other.
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/go-templates/template-postgres/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// DefaultLockTimeout is used when Options.LockTimeout is zero.
+const DefaultLockTimeout = time.Minute
+
+// lockID keys the Postgres advisory lock and the MySQL named lock.
+const lockID = 4106153278
+
+var (
+	// ErrNoDownMigration is returned when a migration has to be reverted but
+	// has no down file.
+	ErrNoDownMigration = errors.New("migrate: no down migration")
+	// ErrUnknownVersion is returned by Goto and Force for versions that have
+	// no migration.
+	ErrUnknownVersion = errors.New("migrate: unknown version")
+)
+
+// DirtyError is returned when a previous migration failed halfway. The
+// database has to be repaired by hand and the version set with Force.
+type DirtyError struct {
+	Version uint64
+}
+
+func (e *DirtyError) Error() string {
+	return fmt.Sprintf("migrate: database is dirty at version %d; repair it and force a version", e.Version)
+}
+
+// Dialect selects the SQL used for the version table and locking.
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	MySQL    Dialect = "mysql"
+	SQLite   Dialect = "sqlite"
+)
+
+// Migration is one version, read from {version}_{name}.up.sql and the
+// optional {version}_{name}.down.sql.
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Load reads the migrations in the root of fsys, ordered by version. Other
+// files are ignored.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	byVersion := make(map[uint64]*Migration)
+	for _, e := range entries {
+		match := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("migrate: invalid version in %s", e.Name())
+		}
+		data, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %w", err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d has names %q and %q", version, m.Name, match[2])
+		}
+		body := &m.Up
+		if match[3] == "down" {
+			body = &m.Down
+		}
+		*body = string(data)
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrate: version %d has no up migration", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return migrations, nil
+}
+
+// Options configures a Migrator.
+type Options struct {
+	// LockTimeout bounds the wait for another process migrating the same
+	// database.
+	LockTimeout time.Duration
+}
+
+// Status describes the state of the database.
+type Status struct {
+	// Version is the last applied migration, zero if none.
+	Version uint64
+	// Dirty is set when the migration to Version failed halfway.
+	Dirty      bool
+	Migrations []Migration
+}
+
+// Pending returns the migrations newer than Version.
+func (s Status) Pending() []Migration {
+	for i, m := range s.Migrations {
+		if m.Version > s.Version {
+			return s.Migrations[i:]
+		}
+	}
+	return nil
+}
+
+// Migrator applies migrations to one database. Only one Migrator works on a
+// database at a time; others wait for up to Options.LockTimeout.
+type Migrator struct {
+	db          *sql.DB
+	dialect     Dialect
+	migrations  []Migration
+	lockTimeout time.Duration
+}
+
+// New creates a Migrator for the migrations in fsys. It takes ownership of
+// db, which Close closes.
+func New(db *sql.DB, dialect Dialect, fsys fs.FS, opts Options) (*Migrator, error) {
+	switch dialect {
+	case Postgres, MySQL, SQLite:
+	default:
+		return nil, fmt.Errorf("migrate: unsupported dialect %q", dialect)
+	}
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	lockTimeout := opts.LockTimeout
+	if lockTimeout <= 0 {
+		lockTimeout = DefaultLockTimeout
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations, lockTimeout: lockTimeout}, nil
+}
+
+// Close closes the database.
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// Status reports the applied version.
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	var st Status
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		var err error
+		st.Version, st.Dirty, err = m.version(ctx, conn)
+		return err
+	})
+	st.Migrations = m.migrations
+	return st, err
+}
+
+// Up applies all pending migrations. A database at a version newer than the
+// latest migration, migrated by a newer release, is left alone.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		current, err := m.clean(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if mig.Version <= current {
+				continue
+			}
+			if err := m.up(ctx, conn, mig); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the latest applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		current, err := m.clean(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if current == 0 {
+			return nil
+		}
+		i := m.index(current)
+		if i < 0 {
+			return fmt.Errorf("%w %d applied to the database", ErrUnknownVersion, current)
+		}
+		return m.down(ctx, conn, i)
+	})
+}
+
+// Goto migrates up or down to version; zero reverts every migration.
+func (m *Migrator) Goto(ctx context.Context, version uint64) error {
+	target := m.index(version)
+	if version != 0 && target < 0 {
+		return fmt.Errorf("%w %d", ErrUnknownVersion, version)
+	}
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		current, err := m.clean(ctx, conn)
+		if err != nil {
+			return err
+		}
+		i := m.index(current)
+		if current != 0 && i < 0 {
+			return fmt.Errorf("%w %d applied to the database", ErrUnknownVersion, current)
+		}
+		for ; i > target; i-- {
+			if err := m.down(ctx, conn, i); err != nil {
+				return err
+			}
+		}
+		for i++; i <= target; i++ {
+			if err := m.up(ctx, conn, m.migrations[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Force records version as applied and clears the dirty flag without
+// running any migration, after a failed migration was repaired by hand.
+func (m *Migrator) Force(ctx context.Context, version uint64) error {
+	if version != 0 && m.index(version) < 0 {
+		return fmt.Errorf("%w %d", ErrUnknownVersion, version)
+	}
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		return m.setVersion(ctx, conn, version, false)
+	})
+}
+
+// index returns the position of version in m.migrations, or -1.
+func (m *Migrator) index(version uint64) int {
+	for i, mig := range m.migrations {
+		if mig.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Migrator) up(ctx context.Context, conn *sql.Conn, mig Migration) error {
+	if err := m.apply(ctx, conn, mig.Up, mig.Version, mig.Version); err != nil {
+		return fmt.Errorf("migrate: %d_%s up: %w", mig.Version, mig.Name, err)
+	}
+	logger.FromContext(ctx).Info("applied migration", zap.Uint64("version", mig.Version), zap.String("name", mig.Name))
+	return nil
+}
+
+// down reverts m.migrations[i].
+func (m *Migrator) down(ctx context.Context, conn *sql.Conn, i int) error {
+	mig := m.migrations[i]
+	if mig.Down == "" {
+		return fmt.Errorf("%w for %d_%s", ErrNoDownMigration, mig.Version, mig.Name)
+	}
+	var previous uint64
+	if i > 0 {
+		previous = m.migrations[i-1].Version
+	}
+	if err := m.apply(ctx, conn, mig.Down, previous, previous); err != nil {
+		return fmt.Errorf("migrate: %d_%s down: %w", mig.Version, mig.Name, err)
+	}
+	logger.FromContext(ctx).Info("reverted migration", zap.Uint64("version", mig.Version), zap.String("name", mig.Name))
+	return nil
+}
+
+// apply runs script and records version. Postgres and SQLite run both in one
+// transaction. MySQL commits DDL statements implicitly, so the version is
+// first recorded as dirtyVersion and marked dirty until script succeeds.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, script string, version, dirtyVersion uint64) error {
+	if m.dialect == MySQL {
+		if err := m.setVersion(ctx, conn, dirtyVersion, true); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, script); err != nil {
+			return err
+		}
+		return m.setVersion(ctx, conn, version, false)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if err := m.setVersion(ctx, tx, version, false); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// clean returns the current version, failing if it is dirty.
+func (m *Migrator) clean(ctx context.Context, conn *sql.Conn) (uint64, error) {
+	version, dirty, err := m.version(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, &DirtyError{Version: version}
+	}
+	return version, nil
+}
+
+func (m *Migrator) version(ctx context.Context, conn *sql.Conn) (uint64, bool, error) {
+	var (
+		version int64
+		dirty   bool
+	)
+	err := conn.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("migrate: read version: %w", err)
+	}
+	return uint64(version), dirty, nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// setVersion replaces the single row of schema_migrations; version zero
+// leaves it empty.
+func (m *Migrator) setVersion(ctx context.Context, db execer, version uint64, dirty bool) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM schema_migrations"); err != nil {
+		return fmt.Errorf("migrate: write version: %w", err)
+	}
+	if version == 0 {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx, m.rebind("INSERT INTO schema_migrations (version, dirty) VALUES (?, ?)"), int64(version), dirty); err != nil {
+		return fmt.Errorf("migrate: write version: %w", err)
+	}
+	return nil
+}
+
+// locked runs fn on a connection holding the migration lock, creating the
+// version table first.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	defer conn.Close()
+
+	unlock, err := m.lock(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := conn.ExecContext(ctx, m.createTable()); err != nil {
+		return fmt.Errorf("migrate: create version table: %w", err)
+	}
+	return fn(conn)
+}
+
+// lock takes a Postgres advisory lock or a MySQL named lock, both held by
+// the session, or a row in a lock table for SQLite.
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) (unlock func(), err error) {
+	lockCtx, cancel := context.WithTimeout(ctx, m.lockTimeout)
+	defer cancel()
+
+	switch m.dialect {
+	case Postgres:
+		if _, err := conn.ExecContext(lockCtx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+			return nil, fmt.Errorf("migrate: lock: %w", err)
+		}
+		return func() {
+			conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", lockID)
+		}, nil
+
+	case MySQL:
+		name := "schema_migrations:" + strconv.Itoa(lockID)
+		var acquired sql.NullInt64
+		err := conn.QueryRowContext(lockCtx, "SELECT GET_LOCK(?, ?)", name, int(m.lockTimeout.Seconds())).Scan(&acquired)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: lock: %w", err)
+		}
+		if acquired.Int64 != 1 {
+			return nil, errors.New("migrate: lock: timed out waiting for another migration")
+		}
+		return func() {
+			conn.ExecContext(context.WithoutCancel(ctx), "SELECT RELEASE_LOCK(?)", name)
+		}, nil
+
+	default:
+		const create = `CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+  id INTEGER NOT NULL PRIMARY KEY CHECK (id = 1),
+  locked_at DATETIME NOT NULL
+)`
+		// Waiting for SQLite's own write lock keeps concurrent migrators from
+		// failing with SQLITE_BUSY.
+		timeout := fmt.Sprintf("PRAGMA busy_timeout = %d", m.lockTimeout.Milliseconds())
+		if _, err := conn.ExecContext(lockCtx, timeout); err != nil {
+			return nil, fmt.Errorf("migrate: lock: %w", err)
+		}
+		for {
+			_, err := conn.ExecContext(lockCtx, create)
+			if err == nil {
+				_, err = conn.ExecContext(lockCtx, "INSERT INTO schema_migrations_lock (id, locked_at) VALUES (1, ?)", time.Now().UTC())
+			}
+			if err == nil {
+				break
+			}
+			select {
+			case <-lockCtx.Done():
+				return nil, fmt.Errorf("migrate: lock: timed out waiting for another migration: %w", err)
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+		return func() {
+			conn.ExecContext(context.WithoutCancel(ctx), "DELETE FROM schema_migrations_lock")
+		}, nil
+	}
+}
+
+func (m *Migrator) createTable() string {
+	if m.dialect == SQLite {
+		return "CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)"
+	}
+	return "CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)"
+}
+
+// rebind replaces ? placeholders with $n for Postgres.
+func (m *Migrator) rebind(query string) string {
+	if m.dialect != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,22 @@
+package tenant
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RowLevelSecurity makes pools built from cfg set the app.tenant_id setting
+// of each connection they hand out to the tenant in the acquiring context, or
+// to "" without one. The users_tenant_isolation policy compares rows with
+// it, so a query that lost its tenant sees no users rather than all of them.
+// It costs a round trip per acquire.
+func RowLevelSecurity(cfg *pgxpool.Config) {
+	cfg.BeforeAcquire = func(ctx context.Context, conn *pgx.Conn) bool {
+		id, _ := FromContext(ctx)
+		_, err := conn.Exec(ctx, "SELECT set_config('app.tenant_id', $1, false)", id)
+		// A connection that cannot be scoped is discarded.
+		return err == nil
+	}
+}
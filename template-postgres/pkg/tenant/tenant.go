@@ -0,0 +1,171 @@
+// Package tenant resolves the tenant a request acts for and carries it in
+// the context. Repositories of tenant-owned data scope every query by the
+// tenant in the context and fail with ErrMissing without one, so no code
+// path reads across tenants by leaving the tenant out.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/user/go-templates/template-postgres/pkg/auth"
+	"github.com/user/go-templates/template-postgres/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// DefaultTenant holds every request when no Source is configured, and the
+// rows that existed before tenancy was introduced.
+const DefaultTenant = "default"
+
+// DefaultHeader is read by SourceHeader when Options.Header is empty.
+const DefaultHeader = "X-Tenant-ID"
+
+// Sources of the tenant of a request.
+const (
+	// SourceHeader reads the tenant from a request header set by a trusted
+	// gateway.
+	SourceHeader = "header"
+	// SourceClaim reads the tenant_id claim of the caller's token.
+	SourceClaim = "claim"
+	// SourceSubdomain reads the tenant from the first label of the host,
+	// e.g. acme in acme.example.com.
+	SourceSubdomain = "subdomain"
+)
+
+var (
+	ErrMissing = errors.New("missing tenant")
+	ErrInvalid = errors.New("invalid tenant")
+	// ErrMismatch reports a token bound to another tenant than the request's.
+	ErrMismatch = errors.New("token is not valid for this tenant")
+)
+
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx that carries the tenant id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the tenant in ctx, if any.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(ctxKey{}).(string)
+	return id, ok
+}
+
+// Valid reports whether id is a tenant id: a DNS label of up to 63
+// lowercase letters, digits and inner hyphens, so any tenant can be a
+// subdomain.
+func Valid(id string) bool {
+	if id == "" || len(id) > 63 || id[0] == '-' || id[len(id)-1] == '-' {
+		return false
+	}
+	for _, c := range id {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// Options configures Middleware.
+type Options struct {
+	// Source is where the tenant of a request is read from: SourceHeader,
+	// SourceClaim or SourceSubdomain. Empty puts every request in Default.
+	Source string
+	// Header names the header read by SourceHeader. Defaults to
+	// DefaultHeader.
+	Header string
+	// Domain is the parent domain of tenant subdomains for SourceSubdomain.
+	Domain string
+	// Default is the tenant of requests the source names none for. Empty
+	// rejects them, unless Source is empty too, when it is DefaultTenant.
+	Default string
+}
+
+// Middleware resolves the tenant of each request as opts describe and stores
+// it in the request context. Requests without a tenant are rejected with
+// 400, as are invalid tenants; a token whose tenant_id claim names another
+// tenant is rejected with 403. Requests dispatched with a context that
+// already carries a tenant, such as the operations of a batch, keep it.
+// Middleware runs after auth.Middleware, which SourceClaim reads.
+func Middleware(opts Options) (func(http.Handler) http.Handler, error) {
+	switch opts.Source {
+	case "":
+		if opts.Default == "" {
+			opts.Default = DefaultTenant
+		}
+	case SourceHeader:
+		if opts.Header == "" {
+			opts.Header = DefaultHeader
+		}
+	case SourceClaim:
+	case SourceSubdomain:
+		if opts.Domain == "" {
+			return nil, errors.New("tenant: subdomain source requires a domain")
+		}
+		opts.Domain = strings.ToLower(strings.Trim(opts.Domain, "."))
+	default:
+		return nil, fmt.Errorf("tenant: unknown source %q", opts.Source)
+	}
+	if opts.Default != "" && !Valid(opts.Default) {
+		return nil, fmt.Errorf("tenant: invalid default %q", opts.Default)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := FromContext(r.Context()); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			id := opts.resolve(r)
+			if id == "" {
+				id = opts.Default
+			}
+			if id == "" {
+				http.Error(w, ErrMissing.Error(), http.StatusBadRequest)
+				return
+			}
+			if !Valid(id) {
+				http.Error(w, ErrInvalid.Error(), http.StatusBadRequest)
+				return
+			}
+			if claims, ok := auth.FromContext(r.Context()); ok && claims.TenantID != "" && claims.TenantID != id {
+				logger.FromContext(r.Context()).Info("rejected token of another tenant",
+					zap.String("tenant", id), zap.String("token_tenant", claims.TenantID))
+				http.Error(w, ErrMismatch.Error(), http.StatusForbidden)
+				return
+			}
+
+			ctx := NewContext(r.Context(), id)
+			ctx = logger.NewContext(ctx, logger.FromContext(ctx).With(zap.String("tenant", id)))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}, nil
+}
+
+// resolve returns the tenant named by the request's source, or "".
+func (o Options) resolve(r *http.Request) string {
+	switch o.Source {
+	case SourceHeader:
+		return r.Header.Get(o.Header)
+	case SourceClaim:
+		if claims, ok := auth.FromContext(r.Context()); ok {
+			return claims.TenantID
+		}
+	case SourceSubdomain:
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		sub, ok := strings.CutSuffix(strings.ToLower(host), "."+o.Domain)
+		if ok && !strings.Contains(sub, ".") {
+			return sub
+		}
+	}
+	return ""
+}
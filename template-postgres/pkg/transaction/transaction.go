@@ -0,0 +1,101 @@
+// Package transaction lets services run several repository calls as one
+// unit of work. A Manager starts a transaction and carries it in the context
+// passed to the unit of work; repositories look it up with FromContext, so
+// every call made with that context joins the transaction without the
+// service knowing which database is behind it.
+package transaction
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Manager runs fn in a transaction, committing if fn returns nil and rolling
+// back otherwise. A WithinTx call inside fn runs in a savepoint of the same
+// transaction: its error rolls back only its own writes, which the caller
+// may handle and carry on.
+type Manager interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type (
+	txKey    struct{}
+	hooksKey struct{}
+)
+
+// hooks are the functions AfterCommit deferred within one WithinTx call.
+type hooks struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+func (h *hooks) add(fns ...func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fns = append(h.fns, fns...)
+}
+
+// AfterCommit runs fn once the transaction in ctx has committed, or at once
+// if ctx carries none. fn is dropped when the transaction, or the savepoint
+// it was deferred in, rolls back. Use it for side effects outside the
+// database, such as invalidating a cache, that must not be seen before the
+// writes are.
+func AfterCommit(ctx context.Context, fn func()) {
+	if h, ok := ctx.Value(hooksKey{}).(*hooks); ok {
+		h.add(fn)
+		return
+	}
+	fn()
+}
+
+// InTx reports whether ctx carries a transaction started by WithinTx.
+func InTx(ctx context.Context) bool {
+	_, ok := FromContext(ctx)
+	return ok
+}
+
+// FromContext returns the transaction started by WithinTx, if ctx carries
+// one. Inside a nested WithinTx it is the savepoint's pgx.Tx.
+func FromContext(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(pgx.Tx)
+	return tx, ok
+}
+
+// PostgresManager implements Manager with pgx transactions.
+type PostgresManager struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresManager(db *pgxpool.Pool) *PostgresManager {
+	return &PostgresManager{db: db}
+}
+
+func (m *PostgresManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	var db interface {
+		Begin(ctx context.Context) (pgx.Tx, error)
+	} = m.db
+	// Begin on a pgx.Tx creates a savepoint.
+	if tx, ok := FromContext(ctx); ok {
+		db = tx
+	}
+	h := &hooks{}
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		ctx := context.WithValue(ctx, txKey{}, tx)
+		return fn(context.WithValue(ctx, hooksKey{}, h))
+	})
+	if err != nil {
+		return err
+	}
+	// A savepoint's hooks wait for the enclosing transaction.
+	if parent, ok := ctx.Value(hooksKey{}).(*hooks); ok {
+		parent.add(h.fns...)
+		return nil
+	}
+	for _, fn := range h.fns {
+		fn()
+	}
+	return nil
+}
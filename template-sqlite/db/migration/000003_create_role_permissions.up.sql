@@ -0,0 +1,5 @@
+CREATE TABLE role_permissions (
+  role TEXT NOT NULL,
+  permission TEXT NOT NULL,
+  PRIMARY KEY (role, permission)
+);
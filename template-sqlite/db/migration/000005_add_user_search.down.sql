@@ -0,0 +1,4 @@
+DROP TRIGGER users_fts_delete;
+DROP TRIGGER users_fts_update;
+DROP TRIGGER users_fts_insert;
+DROP TABLE users_fts;
@@ -0,0 +1,25 @@
+-- users_fts keeps its own copy of the searchable columns, keyed by user id
+-- rather than rowid: users has no INTEGER PRIMARY KEY, so VACUUM may renumber
+-- its rowids. The triggers keep the index in sync with every write.
+CREATE VIRTUAL TABLE users_fts USING fts5(
+  id UNINDEXED,
+  name,
+  email,
+  tokenize = 'trigram'
+);
+
+INSERT INTO users_fts (id, name, email)
+SELECT id, name, email FROM users;
+
+CREATE TRIGGER users_fts_insert AFTER INSERT ON users BEGIN
+  INSERT INTO users_fts (id, name, email) VALUES (new.id, new.name, new.email);
+END;
+
+CREATE TRIGGER users_fts_update AFTER UPDATE OF id, name, email ON users BEGIN
+  DELETE FROM users_fts WHERE id = old.id;
+  INSERT INTO users_fts (id, name, email) VALUES (new.id, new.name, new.email);
+END;
+
+CREATE TRIGGER users_fts_delete AFTER DELETE ON users BEGIN
+  DELETE FROM users_fts WHERE id = old.id;
+END;
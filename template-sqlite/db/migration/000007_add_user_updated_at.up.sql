@@ -0,0 +1,5 @@
+-- updated_at drives Last-Modified on user responses. SQLite cannot add a
+-- column defaulting to CURRENT_TIMESTAMP, so the queries set it on every
+-- write; existing users count as last modified when they were created.
+ALTER TABLE users ADD COLUMN updated_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
+UPDATE users SET updated_at = created_at;
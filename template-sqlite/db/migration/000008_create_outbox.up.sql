@@ -0,0 +1,18 @@
+CREATE TABLE outbox (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  aggregate_type TEXT NOT NULL,
+  aggregate_id TEXT NOT NULL,
+  event_type TEXT NOT NULL,
+  payload TEXT NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The single row names the relay currently publishing the outbox; another
+-- relay takes over once expires_at has passed.
+CREATE TABLE outbox_lease (
+  id INTEGER PRIMARY KEY CHECK (id = 1),
+  owner TEXT NOT NULL DEFAULT '',
+  expires_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00'
+);
+
+INSERT INTO outbox_lease (id) VALUES (1);
@@ -0,0 +1,34 @@
+-- Users belong to a tenant, and emails are unique within one. SQLite cannot
+-- drop the UNIQUE constraint on email, so users is rebuilt; existing users
+-- move to the default tenant. The search index is keyed by user id and
+-- stays as it is.
+ALTER TABLE users RENAME TO users_untenanted;
+
+CREATE TABLE users (
+  id TEXT PRIMARY KEY,
+  tenant_id TEXT NOT NULL,
+  name TEXT NOT NULL,
+  email TEXT NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00',
+  UNIQUE (tenant_id, email)
+);
+
+INSERT INTO users (id, tenant_id, name, email, created_at, updated_at)
+SELECT id, 'default', name, email, created_at, updated_at FROM users_untenanted;
+
+-- Dropping the old table drops its triggers too.
+DROP TABLE users_untenanted;
+
+CREATE TRIGGER users_fts_insert AFTER INSERT ON users BEGIN
+  INSERT INTO users_fts (id, name, email) VALUES (new.id, new.name, new.email);
+END;
+
+CREATE TRIGGER users_fts_update AFTER UPDATE OF id, name, email ON users BEGIN
+  DELETE FROM users_fts WHERE id = old.id;
+  INSERT INTO users_fts (id, name, email) VALUES (new.id, new.name, new.email);
+END;
+
+CREATE TRIGGER users_fts_delete AFTER DELETE ON users BEGIN
+  DELETE FROM users_fts WHERE id = old.id;
+END;
@@ -0,0 +1,35 @@
+-- Deleted users are removed for good: they could clash with live users'
+-- emails. Their trigger removes them from the search index.
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+-- users is rebuilt as 000009 left it.
+ALTER TABLE users RENAME TO users_deletable;
+
+CREATE TABLE users (
+  id TEXT PRIMARY KEY,
+  tenant_id TEXT NOT NULL,
+  name TEXT NOT NULL,
+  email TEXT NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00',
+  UNIQUE (tenant_id, email)
+);
+
+INSERT INTO users (id, tenant_id, name, email, created_at, updated_at)
+SELECT id, tenant_id, name, email, created_at, updated_at FROM users_deletable;
+
+-- Dropping the old table drops its indexes and triggers too.
+DROP TABLE users_deletable;
+
+CREATE TRIGGER users_fts_insert AFTER INSERT ON users BEGIN
+  INSERT INTO users_fts (id, name, email) VALUES (new.id, new.name, new.email);
+END;
+
+CREATE TRIGGER users_fts_update AFTER UPDATE OF id, name, email ON users BEGIN
+  DELETE FROM users_fts WHERE id = old.id;
+  INSERT INTO users_fts (id, name, email) VALUES (new.id, new.name, new.email);
+END;
+
+CREATE TRIGGER users_fts_delete AFTER DELETE ON users BEGIN
+  DELETE FROM users_fts WHERE id = old.id;
+END;
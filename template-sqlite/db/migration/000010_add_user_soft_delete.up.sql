@@ -0,0 +1,37 @@
+-- Deleted users keep their row until purged, so they can be restored. Emails
+-- only need to be unique among the users that are not deleted. SQLite cannot
+-- drop the UNIQUE constraint on (tenant_id, email), so users is rebuilt with
+-- a partial index instead.
+ALTER TABLE users RENAME TO users_undeletable;
+
+CREATE TABLE users (
+  id TEXT PRIMARY KEY,
+  tenant_id TEXT NOT NULL,
+  name TEXT NOT NULL,
+  email TEXT NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00',
+  deleted_at DATETIME
+);
+
+INSERT INTO users (id, tenant_id, name, email, created_at, updated_at)
+SELECT id, tenant_id, name, email, created_at, updated_at FROM users_undeletable;
+
+-- Dropping the old table drops its triggers too.
+DROP TABLE users_undeletable;
+
+CREATE UNIQUE INDEX users_tenant_id_email_key ON users (tenant_id, email) WHERE deleted_at IS NULL;
+CREATE INDEX users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TRIGGER users_fts_insert AFTER INSERT ON users BEGIN
+  INSERT INTO users_fts (id, name, email) VALUES (new.id, new.name, new.email);
+END;
+
+CREATE TRIGGER users_fts_update AFTER UPDATE OF id, name, email ON users BEGIN
+  DELETE FROM users_fts WHERE id = old.id;
+  INSERT INTO users_fts (id, name, email) VALUES (new.id, new.name, new.email);
+END;
+
+CREATE TRIGGER users_fts_delete AFTER DELETE ON users BEGIN
+  DELETE FROM users_fts WHERE id = old.id;
+END;
@@ -0,0 +1,16 @@
+-- The history of changes to users, written by user.Service in the
+-- transaction of each change. before_state and after_state hold the user as
+-- JSON. Entries are kept when their user is purged.
+CREATE TABLE user_audit (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  tenant_id TEXT NOT NULL,
+  user_id TEXT NOT NULL,
+  action TEXT NOT NULL,
+  actor TEXT NOT NULL,
+  request_id TEXT NOT NULL,
+  before_state TEXT,
+  after_state TEXT,
+  created_at DATETIME NOT NULL
+);
+
+CREATE INDEX user_audit_tenant_id_user_id_idx ON user_audit (tenant_id, user_id, id);
@@ -0,0 +1,8 @@
+-- Webhook subscriptions belong to a tenant and receive only its events; each
+-- delivery keeps the tenant of its subscription. Existing rows move to the
+-- default tenant. SQLite cannot drop a column default, so the repository
+-- always names the tenant instead.
+ALTER TABLE webhook_subscriptions ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE webhook_deliveries ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+
+CREATE INDEX webhook_subscriptions_tenant_idx ON webhook_subscriptions (tenant_id, created_at);
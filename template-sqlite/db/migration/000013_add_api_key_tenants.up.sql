@@ -0,0 +1,7 @@
+-- API keys belong to the tenant they were created in and are rejected on
+-- requests for any other. Existing keys move to the default tenant. SQLite
+-- cannot drop a column default, so the repository always names the tenant
+-- instead.
+ALTER TABLE api_keys ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+
+CREATE INDEX api_keys_tenant_idx ON api_keys (tenant_id, created_at);
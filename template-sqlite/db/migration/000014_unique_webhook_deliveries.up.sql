@@ -0,0 +1,3 @@
+-- A subscription gets one delivery of each event, however often the event
+-- is enqueued.
+CREATE UNIQUE INDEX webhook_deliveries_event_idx ON webhook_deliveries (subscription_id, event_id);
@@ -0,0 +1 @@
+ALTER TABLE operations DROP COLUMN tenant_id;
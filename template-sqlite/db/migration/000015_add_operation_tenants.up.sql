@@ -0,0 +1,4 @@
+-- Operations belong to the tenant they were started in and are found only
+-- from it. Existing operations move to the default tenant. SQLite cannot drop
+-- a column default, so the repository always names the tenant instead.
+ALTER TABLE operations ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
@@ -0,0 +1,65 @@
+// Package migration embeds the SQL migrations in this directory, which are
+// applied by pkg/migrate.
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"os"
+	"path/filepath"
+
+	"github.com/user/go-templates/template-sqlite/pkg/migrate"
+	_ "modernc.org/sqlite"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+// New opens the database at source with driver, "sqlite", and
+// returns a Migrator for it.
+func New(driver, source string) (*migrate.Migrator, error) {
+	db, err := sql.Open(driver, source)
+	if err != nil {
+		return nil, err
+	}
+	m, err := migrate.New(db, migrate.SQLite, FS, migrate.Options{})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Up applies all pending migrations to the database at source.
+func Up(ctx context.Context, driver, source string) error {
+	m, err := New(driver, source)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+	return m.Up(ctx)
+}
+
+// Verify compares the schema of the database at source with the one the
+// migrations produce, by applying them to a scratch database in a temporary
+// file. It returns the differences as migrate.Diff does.
+func Verify(ctx context.Context, driver, source string) ([]string, error) {
+	live, err := New(driver, source)
+	if err != nil {
+		return nil, err
+	}
+	defer live.Close()
+
+	dir, err := os.MkdirTemp("", "migrate-verify")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	scratch, err := New(driver, filepath.Join(dir, "scratch.db"))
+	if err != nil {
+		return nil, err
+	}
+	defer scratch.Close()
+	return live.Verify(ctx, scratch)
+}
@@ -0,0 +1,106 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/go-templates/template-sqlite/pkg/migrate"
+)
+
+const (
+	testDriver = "sqlite"
+	textType   = "TEXT"
+)
+
+// testSource returns the path of an empty database file.
+func testSource(t *testing.T) string {
+	return filepath.Join(t.TempDir(), "test.db")
+}
+
+func TestMigrations_UpDownUp(t *testing.T) {
+	ctx := context.Background()
+	m, err := New(testDriver, testSource(t))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer m.Close()
+
+	st, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	schemas := map[uint64][]string{0: nil}
+	for _, mig := range st.Migrations {
+		if err := m.Goto(ctx, mig.Version); err != nil {
+			t.Fatalf("Goto %d: %v", mig.Version, err)
+		}
+		schemas[mig.Version] = schema(t, m)
+	}
+	latest := st.Migrations[len(st.Migrations)-1]
+
+	// Every down migration restores the schema its up migration started from.
+	for i := len(st.Migrations) - 1; i >= 0; i-- {
+		var previous uint64
+		if i > 0 {
+			previous = st.Migrations[i-1].Version
+		}
+		if err := m.Down(ctx); err != nil {
+			t.Fatalf("Down from %d: %v", st.Migrations[i].Version, err)
+		}
+		if diff := migrate.Diff(schemas[previous], schema(t, m)); len(diff) > 0 {
+			t.Errorf("schema after reverting %d differs from version %d:\n%s", st.Migrations[i].Version, previous, strings.Join(diff, "\n"))
+		}
+	}
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if diff := migrate.Diff(schemas[latest.Version], schema(t, m)); len(diff) > 0 {
+		t.Errorf("schema after up, down and up again differs:\n%s", strings.Join(diff, "\n"))
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	source := testSource(t)
+	if err := Up(ctx, testDriver, source); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	diff, err := Verify(ctx, testDriver, source)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(diff) > 0 {
+		t.Errorf("expected no drift, got:\n%s", strings.Join(diff, "\n"))
+	}
+
+	db, err := sql.Open(testDriver, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("ALTER TABLE users ADD COLUMN nickname " + textType); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err = Verify(ctx, testDriver, source)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(diff) == 0 || !strings.Contains(strings.Join(diff, "\n"), "nickname") {
+		t.Errorf("expected the added column to be reported, got %q", diff)
+	}
+}
+
+func schema(t *testing.T, m *migrate.Migrator) []string {
+	t.Helper()
+	lines, err := m.Schema(context.Background())
+	if err != nil {
+		t.Fatalf("Schema: %v", err)
+	}
+	return lines
+}
@@ -0,0 +1,16 @@
+-- name: CreateOperation :one
+INSERT INTO operations (
+  id, tenant_id, kind, owner, created_at, updated_at
+) VALUES (
+  ?, ?, ?, ?, ?, ?
+)
+RETURNING *;
+
+-- name: GetOperation :one
+SELECT * FROM operations
+WHERE id = ? AND tenant_id = ? LIMIT 1;
+
+-- name: UpdateOperation :execrows
+UPDATE operations
+SET status = ?, progress = ?, result = ?, error = ?, updated_at = ?
+WHERE id = ? AND tenant_id = ? AND status IN ('pending', 'running');
@@ -0,0 +1,3 @@
+-- name: ListRolePermissions :many
+SELECT role, permission FROM role_permissions
+ORDER BY role, permission;
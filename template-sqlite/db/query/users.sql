@@ -1,11 +1,59 @@
 -- name: GetUser :one
 SELECT * FROM users
-WHERE id = ? LIMIT 1;
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL LIMIT 1;
 
 -- name: CreateUser :one
 INSERT INTO users (
-  id, name, email
+  id, tenant_id, name, email, updated_at
 ) VALUES (
-  ?, ?, ?
+  ?, ?, ?, ?, CURRENT_TIMESTAMP
 )
 RETURNING *;
+
+-- name: UpdateUser :one
+UPDATE users
+SET name = ?, email = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL
+RETURNING *;
+
+-- name: SoftDeleteUser :execrows
+UPDATE users
+SET deleted_at = CURRENT_TIMESTAMP
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL;
+
+-- name: ListDeletedUsers :many
+SELECT * FROM users
+WHERE tenant_id = ? AND deleted_at IS NOT NULL
+ORDER BY deleted_at DESC, id
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: RestoreUser :one
+UPDATE users
+SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NOT NULL
+RETURNING *;
+
+-- name: PurgeUsers :execrows
+DELETE FROM users
+WHERE deleted_at < ?;
+
+-- name: SearchUsers :many
+SELECT users.id, users.tenant_id, users.name, users.email, users.created_at, users.updated_at, users.deleted_at FROM users_fts
+JOIN users ON users.id = users_fts.id
+WHERE users_fts MATCH sqlc.arg(query) AND users.tenant_id = sqlc.arg(tenant_id) AND users.deleted_at IS NULL
+ORDER BY bm25(users_fts), users.created_at DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: CreateUserAuditEntry :one
+INSERT INTO user_audit (
+  tenant_id, user_id, action, actor, request_id, before_state, after_state, created_at
+) VALUES (
+  ?, ?, ?, ?, ?, ?, ?, ?
+)
+RETURNING id;
+
+-- name: ListUserAuditEntries :many
+SELECT * FROM user_audit
+WHERE tenant_id = ? AND user_id = ?
+ORDER BY id DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
@@ -0,0 +1,60 @@
+-- name: CreateWebhookSubscription :one
+INSERT INTO webhook_subscriptions (
+  id, tenant_id, url, secret, events
+) VALUES (
+  ?, ?, ?, ?, ?
+)
+RETURNING *;
+
+-- name: GetWebhookSubscription :one
+SELECT * FROM webhook_subscriptions
+WHERE id = ? AND tenant_id = ? LIMIT 1;
+
+-- name: ListWebhookSubscriptions :many
+SELECT * FROM webhook_subscriptions
+WHERE tenant_id = ?
+ORDER BY created_at DESC;
+
+-- name: DeleteWebhookSubscription :execrows
+DELETE FROM webhook_subscriptions
+WHERE id = ? AND tenant_id = ?;
+
+-- name: DeleteWebhookDeliveriesBySubscription :exec
+DELETE FROM webhook_deliveries
+WHERE subscription_id = ? AND tenant_id = ?;
+
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (
+  id, tenant_id, subscription_id, event_id, event_type, payload, next_attempt_at, created_at
+) VALUES (
+  ?, ?, ?, ?, ?, ?, ?, ?
+)
+ON CONFLICT (subscription_id, event_id) DO NOTHING
+RETURNING *;
+
+-- name: ClaimDueWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET next_attempt_at = sqlc.arg(until)
+WHERE id IN (
+  SELECT id FROM webhook_deliveries
+  WHERE status = 'pending' AND next_attempt_at <= sqlc.arg(now)
+  ORDER BY next_attempt_at
+  LIMIT sqlc.arg(max)
+)
+RETURNING *;
+
+-- name: UpdateWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ?, response_status = ?, delivered_at = ?
+WHERE id = ? AND tenant_id = ?;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE subscription_id = ? AND tenant_id = ?
+ORDER BY created_at DESC
+LIMIT ? OFFSET ?;
+
+-- name: RetryWebhookDelivery :execrows
+UPDATE webhook_deliveries
+SET status = 'pending', attempts = 0, next_attempt_at = ?
+WHERE id = ? AND subscription_id = ? AND tenant_id = ? AND status = 'dead';
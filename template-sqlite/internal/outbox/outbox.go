@@ -0,0 +1,254 @@
+// Package outbox publishes domain events reliably. A service adds an event
+// to the outbox in the same transaction as the change it describes, so the
+// event is stored if and only if the change commits. A Relay then reads the
+// outbox in order, hands each message to a Publisher and deletes it once
+// published.
+//
+// Delivery is at least once: a relay that stops between publishing and
+// deleting a message publishes it again after a restart. Messages of one
+// aggregate are published in the order they were added; only one relay
+// publishes at a time, holding a lease that others take over once it
+// expires.
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	repository "github.com/user/go-templates/template-sqlite/internal/outbox/sqlc"
+	"github.com/user/go-templates/template-sqlite/pkg/transaction"
+	"go.uber.org/zap"
+)
+
+// --- Domain ---
+
+// Message is an event waiting in the outbox. ID increases in the order
+// messages are added; AggregateType and AggregateID name the entity the
+// event is about.
+type Message struct {
+	ID            int64
+	AggregateType string
+	AggregateID   string
+	EventType     string
+	Payload       json.RawMessage
+	CreatedAt     time.Time
+}
+
+// Writer adds messages to the outbox. Called with a context carrying a
+// transaction, the message commits or rolls back with it.
+type Writer interface {
+	Add(ctx context.Context, m *Message) error
+}
+
+type Repository interface {
+	Writer
+	// List returns up to limit of the oldest messages, oldest first.
+	List(ctx context.Context, limit int) ([]*Message, error)
+	Delete(ctx context.Context, id int64) error
+	// AcquireLease makes owner the publishing relay until expires, unless
+	// another relay holds a lease that has not expired at now. It reports
+	// whether owner holds the lease.
+	AcquireLease(ctx context.Context, owner string, now, expires time.Time) (bool, error)
+	// ReleaseLease gives up owner's lease, if it holds it.
+	ReleaseLease(ctx context.Context, owner string) error
+}
+
+// Publisher delivers messages taken from the outbox. An error leaves the
+// message in the outbox to be published again later.
+type Publisher interface {
+	Publish(ctx context.Context, m *Message) error
+}
+
+// --- Relay ---
+
+// RelayOptions configures a Relay. Zero values use the defaults noted.
+type RelayOptions struct {
+	// Interval between polls of the outbox (1s).
+	Interval time.Duration
+	// BatchSize is the number of messages published per poll (100).
+	BatchSize int
+	// Lease is how long a relay stays the publisher without renewing; it
+	// should comfortably exceed the time a batch takes (30s).
+	Lease time.Duration
+}
+
+// Relay publishes the outbox in the background until it is closed.
+type Relay struct {
+	repo   Repository
+	pub    Publisher
+	opts   RelayOptions
+	owner  string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewRelay(repo Repository, pub Publisher, opts RelayOptions) *Relay {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Relay{
+		repo:   repo,
+		pub:    pub,
+		opts:   opts,
+		owner:  rand.Text(),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go r.run(ctx)
+	return r
+}
+
+// Close stops the relay, waits for it to exit and releases its lease so
+// another relay can take over at once.
+func (r *Relay) Close() {
+	r.cancel()
+	<-r.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.repo.ReleaseLease(ctx, r.owner); err != nil {
+		zap.L().Warn("cannot release outbox lease", zap.Error(err))
+	}
+}
+
+func (r *Relay) run(ctx context.Context) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := r.ProcessBatch(ctx); err != nil && ctx.Err() == nil {
+			zap.L().Error("cannot relay outbox messages", zap.Error(err))
+		}
+	}
+}
+
+// ProcessBatch publishes one batch of the oldest messages, if this relay
+// holds the lease, and returns how many were published. Once a message
+// fails, later messages of the same aggregate are held back so they are not
+// published out of order; all of them are retried on the next poll.
+func (r *Relay) ProcessBatch(ctx context.Context) (int, error) {
+	now := time.Now()
+	ok, err := r.repo.AcquireLease(ctx, r.owner, now, now.Add(r.opts.Lease))
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	msgs, err := r.repo.List(ctx, r.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	blocked := make(map[[2]string]bool)
+	for _, m := range msgs {
+		aggregate := [2]string{m.AggregateType, m.AggregateID}
+		if blocked[aggregate] {
+			continue
+		}
+		if err := r.pub.Publish(ctx, m); err != nil {
+			if ctx.Err() != nil {
+				return published, ctx.Err()
+			}
+			zap.L().Warn("cannot publish outbox message",
+				zap.Int64("id", m.ID),
+				zap.String("event", m.EventType),
+				zap.Error(err),
+			)
+			blocked[aggregate] = true
+			continue
+		}
+		if err := r.repo.Delete(ctx, m.ID); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
+
+// --- SQLite Repository ---
+
+type SqliteRepository struct {
+	q *repository.Queries
+}
+
+func NewSqliteRepository(db *sql.DB) *SqliteRepository {
+	return &SqliteRepository{q: repository.New(db)}
+}
+
+// queries returns r.q bound to the transaction in ctx, if any.
+func (r *SqliteRepository) queries(ctx context.Context) *repository.Queries {
+	if tx, ok := transaction.FromContext(ctx); ok {
+		return r.q.WithTx(tx)
+	}
+	return r.q
+}
+
+func (r *SqliteRepository) Add(ctx context.Context, m *Message) error {
+	model, err := r.queries(ctx).CreateOutboxMessage(ctx, repository.CreateOutboxMessageParams{
+		AggregateType: m.AggregateType,
+		AggregateID:   m.AggregateID,
+		EventType:     m.EventType,
+		Payload:       string(m.Payload),
+		CreatedAt:     time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	m.ID = model.ID
+	m.CreatedAt = model.CreatedAt
+	return nil
+}
+
+func (r *SqliteRepository) List(ctx context.Context, limit int) ([]*Message, error) {
+	models, err := r.queries(ctx).ListOutboxMessages(ctx, int64(limit))
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]*Message, 0, len(models))
+	for _, m := range models {
+		msgs = append(msgs, &Message{
+			ID:            m.ID,
+			AggregateType: m.AggregateType,
+			AggregateID:   m.AggregateID,
+			EventType:     m.EventType,
+			Payload:       json.RawMessage(m.Payload),
+			CreatedAt:     m.CreatedAt,
+		})
+	}
+	return msgs, nil
+}
+
+func (r *SqliteRepository) Delete(ctx context.Context, id int64) error {
+	return r.queries(ctx).DeleteOutboxMessage(ctx, id)
+}
+
+func (r *SqliteRepository) AcquireLease(ctx context.Context, owner string, now, expires time.Time) (bool, error) {
+	n, err := r.queries(ctx).AcquireOutboxLease(ctx, repository.AcquireOutboxLeaseParams{
+		Owner:     owner,
+		ExpiresAt: expires.UTC(),
+		Now:       now.UTC(),
+	})
+	return n == 1, err
+}
+
+func (r *SqliteRepository) ReleaseLease(ctx context.Context, owner string) error {
+	return r.queries(ctx).ReleaseOutboxLease(ctx, owner)
+}
@@ -0,0 +1,253 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/user/go-templates/template-sqlite/db/migration"
+	"github.com/user/go-templates/template-sqlite/pkg/transaction"
+)
+
+// memRepository is an in-memory Repository.
+type memRepository struct {
+	mu       sync.Mutex
+	msgs     []*Message
+	nextID   int64
+	owner    string
+	expires  time.Time
+	released []string
+}
+
+func (r *memRepository) Add(ctx context.Context, m *Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	m.ID = r.nextID
+	r.msgs = append(r.msgs, m)
+	return nil
+}
+
+func (r *memRepository) List(ctx context.Context, limit int) ([]*Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.msgs[:min(limit, len(r.msgs))]), nil
+}
+
+func (r *memRepository) Delete(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = slices.DeleteFunc(r.msgs, func(m *Message) bool { return m.ID == id })
+	return nil
+}
+
+func (r *memRepository) AcquireLease(ctx context.Context, owner string, now, expires time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.owner != owner && !r.expires.Before(now) {
+		return false, nil
+	}
+	r.owner, r.expires = owner, expires
+	return true, nil
+}
+
+func (r *memRepository) ReleaseLease(ctx context.Context, owner string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.owner == owner {
+		r.expires = time.Time{}
+	}
+	r.released = append(r.released, owner)
+	return nil
+}
+
+func (r *memRepository) ids() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []int64
+	for _, m := range r.msgs {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+// recordingPublisher records published message IDs and fails those in fail.
+type recordingPublisher struct {
+	mu        sync.Mutex
+	published []int64
+	fail      map[int64]bool
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, m *Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail[m.ID] {
+		return errors.New("publish failed")
+	}
+	p.published = append(p.published, m.ID)
+	return nil
+}
+
+// newTestRelay returns a Relay that only publishes when ProcessBatch is
+// called.
+func newTestRelay(t *testing.T, repo Repository, pub Publisher, opts RelayOptions) *Relay {
+	t.Helper()
+	opts.Interval = time.Hour
+	r := NewRelay(repo, pub, opts)
+	t.Cleanup(r.Close)
+	return r
+}
+
+func addMessages(t *testing.T, repo Repository, aggregates ...string) {
+	t.Helper()
+	for _, id := range aggregates {
+		if err := repo.Add(context.Background(), &Message{AggregateType: "user", AggregateID: id, EventType: "user.updated"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRelay_ProcessBatch(t *testing.T) {
+	ctx := context.Background()
+	repo := &memRepository{}
+	// Messages 1-5 belong to aggregates a, b, a, c, b.
+	addMessages(t, repo, "a", "b", "a", "c", "b")
+	pub := &recordingPublisher{fail: map[int64]bool{2: true}}
+	relay := newTestRelay(t, repo, pub, RelayOptions{})
+
+	n, err := relay.ProcessBatch(ctx)
+	if err != nil {
+		t.Fatalf("ProcessBatch: %v", err)
+	}
+	// Message 2 failed, so message 5 of the same aggregate waits behind it.
+	if n != 3 || !slices.Equal(pub.published, []int64{1, 3, 4}) {
+		t.Errorf("expected messages 1, 3 and 4 to be published, got %d: %v", n, pub.published)
+	}
+	if got := repo.ids(); !slices.Equal(got, []int64{2, 5}) {
+		t.Errorf("expected messages 2 and 5 to remain, got %v", got)
+	}
+
+	pub.fail = nil
+	if n, err := relay.ProcessBatch(ctx); err != nil || n != 2 {
+		t.Fatalf("expected 2 published, got %d (%v)", n, err)
+	}
+	if !slices.Equal(pub.published, []int64{1, 3, 4, 2, 5}) {
+		t.Errorf("expected messages 2 and 5 in order, got %v", pub.published)
+	}
+	if got := repo.ids(); len(got) != 0 {
+		t.Errorf("expected an empty outbox, got %v", got)
+	}
+}
+
+func TestRelay_ProcessBatch_BatchSize(t *testing.T) {
+	repo := &memRepository{}
+	addMessages(t, repo, "a", "b", "c")
+	pub := &recordingPublisher{}
+	relay := newTestRelay(t, repo, pub, RelayOptions{BatchSize: 2})
+
+	if n, err := relay.ProcessBatch(context.Background()); err != nil || n != 2 {
+		t.Fatalf("expected 2 published, got %d (%v)", n, err)
+	}
+	if got := repo.ids(); !slices.Equal(got, []int64{3}) {
+		t.Errorf("expected message 3 to remain, got %v", got)
+	}
+}
+
+func TestRelay_Lease(t *testing.T) {
+	ctx := context.Background()
+	repo := &memRepository{}
+	addMessages(t, repo, "a")
+	pub := &recordingPublisher{}
+	first := newTestRelay(t, repo, pub, RelayOptions{Lease: time.Minute})
+	second := newTestRelay(t, repo, pub, RelayOptions{Lease: time.Minute})
+
+	if n, err := first.ProcessBatch(ctx); err != nil || n != 1 {
+		t.Fatalf("expected the first relay to publish, got %d (%v)", n, err)
+	}
+	addMessages(t, repo, "a")
+	if n, err := second.ProcessBatch(ctx); err != nil || n != 0 {
+		t.Fatalf("expected the second relay to wait for the lease, got %d (%v)", n, err)
+	}
+
+	// Closing the first relay hands the lease over at once.
+	first.Close()
+	if n, err := second.ProcessBatch(ctx); err != nil || n != 1 {
+		t.Fatalf("expected the second relay to take over, got %d (%v)", n, err)
+	}
+}
+
+func TestSqliteRepository(t *testing.T) {
+	ctx := context.Background()
+	source := filepath.Join(t.TempDir(), "test.db")
+	if err := migration.Up(ctx, "sqlite", source); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	db, err := sql.Open("sqlite", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	repo := NewSqliteRepository(db)
+
+	addMessages(t, repo, "a")
+	// A message added in a transaction that rolls back is never stored.
+	errRollback := errors.New("rollback")
+	err = transaction.NewSqliteManager(db).WithinTx(ctx, func(ctx context.Context) error {
+		if err := repo.Add(ctx, &Message{AggregateType: "user", AggregateID: "b", EventType: "user.created"}); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("expected errRollback, got %v", err)
+	}
+	m := &Message{AggregateType: "user", AggregateID: "c", EventType: "user.created", Payload: json.RawMessage(`{"id":"c"}`)}
+	if err := repo.Add(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := repo.List(ctx, 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].AggregateID != "a" || msgs[1].ID != m.ID || string(msgs[1].Payload) != `{"id":"c"}` {
+		t.Fatalf("expected messages a and c, got %+v", msgs)
+	}
+	if err := repo.Delete(ctx, msgs[0].ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if msgs, err := repo.List(ctx, 10); err != nil || len(msgs) != 1 || msgs[0].ID != m.ID {
+		t.Errorf("expected only message c to remain, got %+v (%v)", msgs, err)
+	}
+
+	now := time.Now()
+	lease := func(owner string, now time.Time) bool {
+		t.Helper()
+		ok, err := repo.AcquireLease(ctx, owner, now, now.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("AcquireLease: %v", err)
+		}
+		return ok
+	}
+	if !lease("first", now) || !lease("first", now.Add(time.Second)) {
+		t.Fatal("expected the first relay to acquire and renew the lease")
+	}
+	if lease("second", now.Add(time.Second)) {
+		t.Fatal("expected the lease to be held by the first relay")
+	}
+	if !lease("second", now.Add(2*time.Minute)) {
+		t.Fatal("expected the second relay to take over the expired lease")
+	}
+	if err := repo.ReleaseLease(ctx, "second"); err != nil {
+		t.Fatalf("ReleaseLease: %v", err)
+	}
+	if !lease("first", now.Add(2*time.Minute)) {
+		t.Error("expected the released lease to be free")
+	}
+}
@@ -0,0 +1,40 @@
+// Package role loads the role → permission mapping used by pkg/authz from
+// the database, so operators can change grants without a redeploy.
+package role
+
+import (
+	"context"
+	"database/sql"
+
+	repository "github.com/user/go-templates/template-sqlite/internal/role/sqlc"
+	"github.com/user/go-templates/template-sqlite/pkg/logger"
+)
+
+// --- SQLite Repository ---
+
+// SqliteRepository reads role grants from the role_permissions table. It
+// implements authz.Store.
+type SqliteRepository struct {
+	q *repository.Queries
+}
+
+func NewSqliteRepository(db *sql.DB) *SqliteRepository {
+	return &SqliteRepository{
+		q: repository.New(db),
+	}
+}
+
+func (r *SqliteRepository) RolePermissions(ctx context.Context) (map[string][]string, error) {
+	logger.FromContext(ctx).Debug("querying role permissions")
+
+	rows, err := r.q.ListRolePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string][]string)
+	for _, row := range rows {
+		roles[row.Role] = append(roles[row.Role], row.Permission)
+	}
+	return roles, nil
+}
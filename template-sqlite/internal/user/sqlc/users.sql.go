@@ -7,48 +7,343 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"time"
 )
 
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
-  id, name, email
+  id, tenant_id, name, email, updated_at
 ) VALUES (
-  ?, ?, ?
+  ?, ?, ?, ?, CURRENT_TIMESTAMP
 )
-RETURNING id, name, email, created_at
+RETURNING id, tenant_id, name, email, created_at, updated_at, deleted_at
 `
 
 type CreateUserParams struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.ID, arg.Name, arg.Email)
+	row := q.db.QueryRowContext(ctx, createUser,
+		arg.ID,
+		arg.TenantID,
+		arg.Name,
+		arg.Email,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
+		&i.TenantID,
 		&i.Name,
 		&i.Email,
 		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
+const createUserAuditEntry = `-- name: CreateUserAuditEntry :one
+INSERT INTO user_audit (
+  tenant_id, user_id, action, actor, request_id, before_state, after_state, created_at
+) VALUES (
+  ?, ?, ?, ?, ?, ?, ?, ?
+)
+RETURNING id
+`
+
+type CreateUserAuditEntryParams struct {
+	TenantID    string         `json:"tenant_id"`
+	UserID      string         `json:"user_id"`
+	Action      string         `json:"action"`
+	Actor       string         `json:"actor"`
+	RequestID   string         `json:"request_id"`
+	BeforeState sql.NullString `json:"before_state"`
+	AfterState  sql.NullString `json:"after_state"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+func (q *Queries) CreateUserAuditEntry(ctx context.Context, arg CreateUserAuditEntryParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, createUserAuditEntry,
+		arg.TenantID,
+		arg.UserID,
+		arg.Action,
+		arg.Actor,
+		arg.RequestID,
+		arg.BeforeState,
+		arg.AfterState,
+		arg.CreatedAt,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
 const getUser = `-- name: GetUser :one
-SELECT id, name, email, created_at FROM users
-WHERE id = ? LIMIT 1
+SELECT id, tenant_id, name, email, created_at, updated_at, deleted_at FROM users
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL LIMIT 1
+`
+
+type GetUserParams struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+}
+
+func (q *Queries) GetUser(ctx context.Context, arg GetUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUser, arg.ID, arg.TenantID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.TenantID,
+		&i.Name,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const listDeletedUsers = `-- name: ListDeletedUsers :many
+SELECT id, tenant_id, name, email, created_at, updated_at, deleted_at FROM users
+WHERE tenant_id = ? AND deleted_at IS NOT NULL
+ORDER BY deleted_at DESC, id
+LIMIT ? OFFSET ?
+`
+
+type ListDeletedUsersParams struct {
+	TenantID  string `json:"tenant_id"`
+	RowLimit  int64  `json:"row_limit"`
+	RowOffset int64  `json:"row_offset"`
+}
+
+func (q *Queries) ListDeletedUsers(ctx context.Context, arg ListDeletedUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listDeletedUsers, arg.TenantID, arg.RowLimit, arg.RowOffset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.TenantID,
+			&i.Name,
+			&i.Email,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserAuditEntries = `-- name: ListUserAuditEntries :many
+SELECT id, tenant_id, user_id, action, actor, request_id, before_state, after_state, created_at FROM user_audit
+WHERE tenant_id = ? AND user_id = ?
+ORDER BY id DESC
+LIMIT ? OFFSET ?
 `
 
-func (q *Queries) GetUser(ctx context.Context, id string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUser, id)
+type ListUserAuditEntriesParams struct {
+	TenantID  string `json:"tenant_id"`
+	UserID    string `json:"user_id"`
+	RowLimit  int64  `json:"row_limit"`
+	RowOffset int64  `json:"row_offset"`
+}
+
+func (q *Queries) ListUserAuditEntries(ctx context.Context, arg ListUserAuditEntriesParams) ([]UserAudit, error) {
+	rows, err := q.db.QueryContext(ctx, listUserAuditEntries,
+		arg.TenantID,
+		arg.UserID,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserAudit
+	for rows.Next() {
+		var i UserAudit
+		if err := rows.Scan(
+			&i.ID,
+			&i.TenantID,
+			&i.UserID,
+			&i.Action,
+			&i.Actor,
+			&i.RequestID,
+			&i.BeforeState,
+			&i.AfterState,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeUsers = `-- name: PurgeUsers :execrows
+DELETE FROM users
+WHERE deleted_at < ?
+`
+
+func (q *Queries) PurgeUsers(ctx context.Context, deletedAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeUsers, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreUser = `-- name: RestoreUser :one
+UPDATE users
+SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NOT NULL
+RETURNING id, tenant_id, name, email, created_at, updated_at, deleted_at
+`
+
+type RestoreUserParams struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+}
+
+func (q *Queries) RestoreUser(ctx context.Context, arg RestoreUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, restoreUser, arg.ID, arg.TenantID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.TenantID,
+		&i.Name,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT users.id, users.tenant_id, users.name, users.email, users.created_at, users.updated_at, users.deleted_at FROM users_fts
+JOIN users ON users.id = users_fts.id
+WHERE users_fts MATCH ? AND users.tenant_id = ? AND users.deleted_at IS NULL
+ORDER BY bm25(users_fts), users.created_at DESC
+LIMIT ? OFFSET ?
+`
+
+type SearchUsersParams struct {
+	Query     string `json:"query"`
+	TenantID  string `json:"tenant_id"`
+	RowLimit  int64  `json:"row_limit"`
+	RowOffset int64  `json:"row_offset"`
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, searchUsers,
+		arg.Query,
+		arg.TenantID,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.TenantID,
+			&i.Name,
+			&i.Email,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const softDeleteUser = `-- name: SoftDeleteUser :execrows
+UPDATE users
+SET deleted_at = CURRENT_TIMESTAMP
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL
+`
+
+type SoftDeleteUserParams struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+}
+
+func (q *Queries) SoftDeleteUser(ctx context.Context, arg SoftDeleteUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, softDeleteUser, arg.ID, arg.TenantID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+SET name = ?, email = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL
+RETURNING id, tenant_id, name, email, created_at, updated_at, deleted_at
+`
+
+type UpdateUserParams struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+}
+
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUser,
+		arg.Name,
+		arg.Email,
+		arg.ID,
+		arg.TenantID,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
+		&i.TenantID,
 		&i.Name,
 		&i.Email,
 		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -0,0 +1,228 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/websocket"
+	"github.com/user/go-templates/template-sqlite/internal/user"
+	"github.com/user/go-templates/template-sqlite/pkg/broker"
+	"github.com/user/go-templates/template-sqlite/pkg/tenant"
+)
+
+func newServer(t *testing.T, events *broker.Broker[user.Event]) *httptest.Server {
+	t.Helper()
+	h := NewHandler(events, Options{Heartbeat: time.Minute})
+	r := chi.NewRouter()
+	r.Get("/users/events", h.ServeSSE)
+	r.Get("/users/events/ws", h.ServeWebSocket)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// readEvent returns the fields of the next SSE event, skipping comments and
+// field-less blocks such as the initial retry.
+func readEvent(t *testing.T, r *bufio.Reader) map[string]string {
+	t.Helper()
+	fields := map[string]string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if fields["event"] != "" {
+				return fields
+			}
+			fields = map[string]string{}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		k, v, _ := strings.Cut(line, ": ")
+		fields[k] = v
+	}
+}
+
+func TestHandler_ServeSSE(t *testing.T) {
+	events := broker.New[user.Event](broker.Options{History: 10, Buffer: 8})
+	srv := newServer(t, events)
+
+	events.Publish(user.Event{Type: user.EventCreated, User: user.User{ID: "1"}})
+	events.Publish(user.Event{Type: user.EventCreated, User: user.User{ID: "2"}})
+
+	req, _ := http.NewRequest("GET", srv.URL+"/users/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %q", ct)
+	}
+	body := bufio.NewReader(resp.Body)
+
+	// Replayed from history.
+	e := readEvent(t, body)
+	if e["id"] != "2" || e["event"] != user.EventCreated {
+		t.Errorf("expected replay of event 2, got %v", e)
+	}
+
+	events.Publish(user.Event{Type: user.EventDeleted, User: user.User{ID: "2"}})
+	e = readEvent(t, body)
+	if e["id"] != "3" || e["event"] != user.EventDeleted {
+		t.Errorf("expected live event 3, got %v", e)
+	}
+	var got user.Event
+	if err := json.Unmarshal([]byte(e["data"]), &got); err != nil || got.User.ID != "2" {
+		t.Errorf("unexpected data %q: %v", e["data"], err)
+	}
+
+	// Closing the broker, as the server does on shutdown, ends the stream.
+	events.Close()
+	done := make(chan struct{})
+	go func() {
+		for {
+			if _, err := body.ReadString('\n'); err != nil {
+				close(done)
+				return
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not end after broker close")
+	}
+}
+
+func TestHandler_ServeSSE_Tenant(t *testing.T) {
+	events := broker.New[user.Event](broker.Options{History: 10, Buffer: 8})
+	mw, err := tenant.Middleware(tenant.Options{Source: tenant.SourceHeader})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(events, Options{Heartbeat: time.Minute})
+	srv := httptest.NewServer(mw(http.HandlerFunc(h.ServeSSE)))
+	t.Cleanup(srv.Close)
+
+	events.Publish(user.Event{Type: user.EventCreated, User: user.User{ID: "1", TenantID: "acme"}})
+	events.Publish(user.Event{Type: user.EventCreated, User: user.User{ID: "2", TenantID: "globex"}})
+	events.Publish(user.Event{Type: user.EventCreated, User: user.User{ID: "3", TenantID: "acme"}})
+	events.Publish(user.Event{Type: user.EventDeleted, User: user.User{ID: "2", TenantID: "globex"}})
+	events.Publish(user.Event{Type: user.EventDeleted, User: user.User{ID: "3", TenantID: "acme"}})
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("Last-Event-ID", "1")
+	req.Header.Set(tenant.DefaultHeader, "acme")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body := bufio.NewReader(resp.Body)
+
+	// Only the events of acme are replayed.
+	if e := readEvent(t, body); e["id"] != "3" || e["event"] != user.EventCreated {
+		t.Errorf("expected event 3, got %v", e)
+	}
+	if e := readEvent(t, body); e["id"] != "5" || e["event"] != user.EventDeleted {
+		t.Errorf("expected event 5, got %v", e)
+	}
+}
+
+func TestHandler_ServeSSE_Gap(t *testing.T) {
+	events := broker.New[user.Event](broker.Options{History: 1, Buffer: 8})
+	srv := newServer(t, events)
+
+	for _, id := range []string{"1", "2", "3"} {
+		events.Publish(user.Event{Type: user.EventCreated, User: user.User{ID: id}})
+	}
+
+	resp, err := http.Get(srv.URL + "/users/events?last_event_id=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body := bufio.NewReader(resp.Body)
+
+	if e := readEvent(t, body); e["event"] != EventReset {
+		t.Errorf("expected reset event, got %v", e)
+	}
+	if e := readEvent(t, body); e["id"] != "3" {
+		t.Errorf("expected oldest retained event 3, got %v", e)
+	}
+}
+
+func TestHandler_ServeSSE_InvalidLastEventID(t *testing.T) {
+	srv := newServer(t, broker.New[user.Event](broker.Options{}))
+
+	resp, err := http.Get(srv.URL + "/users/events?last_event_id=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestHandler_ServeWebSocket(t *testing.T) {
+	events := broker.New[user.Event](broker.Options{History: 10, Buffer: 8})
+	srv := newServer(t, events)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/users/events/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	events.Publish(user.Event{Type: user.EventUpdated, User: user.User{ID: "1", Name: "Ada"}})
+
+	var m Message
+	if err := conn.ReadJSON(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m.ID != 1 || m.Type != user.EventUpdated || m.User.Name != "Ada" {
+		t.Errorf("unexpected message %+v", m)
+	}
+
+	events.Close()
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Errorf("expected close %d, got %v", websocket.CloseGoingAway, err)
+	}
+}
+
+func TestHandler_ServeWebSocket_Origin(t *testing.T) {
+	h := NewHandler(broker.New[user.Event](broker.Options{}), Options{AllowedOrigins: []string{"https://*.example.com"}})
+	srv := httptest.NewServer(http.HandlerFunc(h.ServeWebSocket))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.test"}})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected disallowed origin to be rejected, got %v", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://admin.example.com"}})
+	if err != nil {
+		t.Fatalf("expected allowed origin to connect: %v", err)
+	}
+	conn.Close()
+}
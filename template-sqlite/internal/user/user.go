@@ -6,92 +6,1000 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/google/uuid"
+	"github.com/user/go-templates/template-sqlite/internal/outbox"
 	repository "github.com/user/go-templates/template-sqlite/internal/user/sqlc"
+	"github.com/user/go-templates/template-sqlite/pkg/auth"
+	"github.com/user/go-templates/template-sqlite/pkg/authz"
+	"github.com/user/go-templates/template-sqlite/pkg/cache"
+	"github.com/user/go-templates/template-sqlite/pkg/fieldmask"
+	"github.com/user/go-templates/template-sqlite/pkg/idgen"
+	"github.com/user/go-templates/template-sqlite/pkg/logger"
+	"github.com/user/go-templates/template-sqlite/pkg/requestid"
+	"github.com/user/go-templates/template-sqlite/pkg/tenant"
+	"github.com/user/go-templates/template-sqlite/pkg/transaction"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 // --- Domain ---
 
+// Permissions guarding user operations.
+const (
+	PermissionRead  = "users:read"
+	PermissionWrite = "users:write"
+	// PermissionAdmin lets a caller act on any user, not only themselves.
+	PermissionAdmin = "users:admin"
+	// PermissionSearch lets a caller search across all users.
+	PermissionSearch = "users:search"
+)
+
+var ErrNotFound = errors.New("user not found")
+
+// ErrInvalidID reports an ID that is not written in the format of the
+// service's idgen.Generator.
+var ErrInvalidID = errors.New("invalid user id")
+
+// Search limits. Queries shorter than MinSearchLength match too much to be
+// useful.
+const (
+	MinSearchLength    = 3
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+// MaxImportUsers caps the users created by one ImportUsers call.
+const MaxImportUsers = 1000
+
+var (
+	ErrSearchQueryTooShort = fmt.Errorf("search query must be at least %d characters", MinSearchLength)
+	ErrSearchUnsupported   = errors.New("user search is not supported by this repository")
+	ErrTrashUnsupported    = errors.New("restoring users is not supported by this repository")
+	ErrAuditUnsupported    = errors.New("user history is not supported by this repository")
+	// ErrEmailTaken reports a restore of a user whose email another user has
+	// taken since it was deleted.
+	ErrEmailTaken = errors.New("email is taken by another user")
+)
+
+// Limits of ListDeletedUsers and UserHistory.
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+// User is the domain entity. Its wire formats live in the versioned handler
+// packages (v1, v2), so fields can be added here without breaking clients.
 type User struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// TenantID is the tenant owning the user. Repositories set it from the
+	// context; it is not part of the wire formats, and left out of the JSON
+	// of a User, which webhooks and event streams send.
+	TenantID string `json:"-"`
+	// DeletedAt is set on users listed from a Trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
+// LastModified is when the user was last written, for Last-Modified headers.
+// It is zero if neither timestamp was loaded.
+func (u *User) LastModified() time.Time {
+	if u.UpdatedAt.After(u.CreatedAt) {
+		return u.UpdatedAt
+	}
+	return u.CreatedAt
+}
+
+// Fields are the user attributes that can be selected with a fieldmask.Mask.
+var Fields = []string{"id", "name", "email", "created_at", "updated_at"}
+
+// Repository stores users. Implementations scope every call by the tenant
+// in ctx, see package tenant, and return tenant.ErrMissing without one.
 type Repository interface {
-	Get(ctx context.Context, id string) (*User, error)
+	// Get loads only the fields selected by fields, leaving the others zero;
+	// an empty mask loads every field.
+	Get(ctx context.Context, id string, fields fieldmask.Mask) (*User, error)
+	// Create stores user under the ID the service generated for it.
 	Create(ctx context.Context, user *User) error
+	// Update replaces name and email and fills in the stored CreatedAt and
+	// UpdatedAt. It returns ErrNotFound when no user has the ID.
+	Update(ctx context.Context, user *User) error
+	// Delete hides the user from the other methods, for good unless the
+	// repository is a Trash.
+	Delete(ctx context.Context, id string) error
+}
+
+// Searcher is implemented by repositories that can search users by name or
+// email. Results are ordered by relevance, best match first, with newer
+// users first among equal matches.
+type Searcher interface {
+	Search(ctx context.Context, query string, limit, offset int) ([]*User, error)
+}
+
+// Trash is implemented by repositories that delete users softly, keeping
+// them to be restored until they are purged. Emails only need to be unique
+// among users that are not deleted.
+type Trash interface {
+	// ListDeleted returns the deleted users, most recently deleted first,
+	// with DeletedAt set.
+	ListDeleted(ctx context.Context, limit, offset int) ([]*User, error)
+	// Restore undeletes a user and returns it. It returns ErrNotFound
+	// unless the user is deleted, and ErrEmailTaken when its email is in
+	// use again.
+	Restore(ctx context.Context, id string) (*User, error)
+	// Purge removes the users deleted before before for good, across all
+	// tenants, and returns how many it removed.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// AuditEntry records one change to a user: who made it, in which request,
+// and the user before and after it. Before is nil for creations and
+// restores, After for deletions.
+type AuditEntry struct {
+	ID       int64  `json:"id"`
+	UserID   string `json:"user_id"`
+	TenantID string `json:"tenant_id"`
+	// Action is the type of the event the change published, such as
+	// EventUpdated.
+	Action string `json:"action"`
+	// Actor is the subject of the caller's claims, "" without any.
+	Actor     string    `json:"actor"`
+	RequestID string    `json:"request_id"`
+	Before    *User     `json:"before,omitempty"`
+	After     *User     `json:"after,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Auditor is implemented by repositories that keep the history of changes
+// to users. The service adds an entry for each of its writes in the same
+// transaction as the write. Entries outlive purged users.
+type Auditor interface {
+	// GetForUpdate returns the whole user and locks it until the
+	// transaction in ctx ends, so that it is still the user a write in the
+	// same transaction replaces.
+	GetForUpdate(ctx context.Context, id string) (*User, error)
+	// AddAudit stores entry and sets its ID and TenantID.
+	AddAudit(ctx context.Context, entry *AuditEntry) error
+	// History returns the entries of a user, newest first.
+	History(ctx context.Context, userID string, limit, offset int) ([]*AuditEntry, error)
+}
+
+// ImportResult reports a bulk import. Failed holds the reason each user that
+// was not created failed, keyed by its index in the input.
+type ImportResult struct {
+	Created int
+	Failed  map[int]error
 }
 
 type Service interface {
-	GetUser(ctx context.Context, id string) (*User, error)
+	// GetUser returns fieldmask.ErrUnknownField when fields selects an
+	// attribute outside Fields. It and the other methods taking an ID return
+	// ErrInvalidID for IDs the service's idgen.Generator cannot parse.
+	GetUser(ctx context.Context, id string, fields fieldmask.Mask) (*User, error)
+	// CreateUser gives user a new ID, replacing any it had.
 	CreateUser(ctx context.Context, user *User) error
+	UpdateUser(ctx context.Context, user *User) error
+	DeleteUser(ctx context.Context, id string) error
+	// SearchUsers returns ErrSearchQueryTooShort for short queries and
+	// ErrSearchUnsupported when the repository is not a Searcher. limit is
+	// clamped to MaxSearchLimit and defaults to DefaultSearchLimit.
+	SearchUsers(ctx context.Context, query string, limit, offset int) ([]*User, error)
+	// ImportUsers creates users in order and calls progress, if not nil,
+	// with the number handled after each one. A user that cannot be created
+	// is recorded in the result and does not stop the import. It requires
+	// PermissionAdmin, and returns the partial result with ctx's error once
+	// ctx is cancelled.
+	ImportUsers(ctx context.Context, users []*User, progress func(done int)) (*ImportResult, error)
+	// ListDeletedUsers and RestoreUser require PermissionAdmin and return
+	// ErrTrashUnsupported when the repository is not a Trash. limit is
+	// clamped to MaxListLimit and defaults to DefaultListLimit.
+	ListDeletedUsers(ctx context.Context, limit, offset int) ([]*User, error)
+	RestoreUser(ctx context.Context, id string) (*User, error)
+	// UserHistory requires PermissionAdmin and returns ErrAuditUnsupported
+	// when the repository is not an Auditor. Like ListDeletedUsers, it
+	// clamps limit to MaxListLimit.
+	UserHistory(ctx context.Context, id string, limit, offset int) ([]*AuditEntry, error)
+}
+
+// --- Events ---
+
+// Event types published after successful writes.
+const (
+	EventCreated  = "user.created"
+	EventUpdated  = "user.updated"
+	EventDeleted  = "user.deleted"
+	EventRestored = "user.restored"
+)
+
+// Event describes a change to a user. Deletions only carry User.ID and
+// User.TenantID.
+type Event struct {
+	// ID identifies the event; the outbox relays it with the same ID
+	// however often it retries.
+	ID   string    `json:"id,omitempty"`
+	Type string    `json:"type"`
+	User User      `json:"user"`
+	Time time.Time `json:"time"`
+}
+
+// storedUser is the JSON of a User stored by the service itself, in the
+// outbox and the user cache, which keeps its TenantID.
+type storedUser struct {
+	User
+	TenantID string `json:"tenant_id"`
+}
+
+func newStoredUser(u *User) storedUser {
+	return storedUser{User: *u, TenantID: u.TenantID}
+}
+
+func (s storedUser) user() *User {
+	u := s.User
+	u.TenantID = s.TenantID
+	return &u
+}
+
+// storedEvent is the JSON of an Event in the outbox.
+type storedEvent struct {
+	ID   string     `json:"id"`
+	Type string     `json:"type"`
+	User storedUser `json:"user"`
+	Time time.Time  `json:"time"`
+}
+
+// Publisher receives the service's events; *broker.Broker[Event] implements
+// it. Without an outbox Publish is called synchronously after each write,
+// otherwise by the outbox relay; either way it should return quickly.
+type Publisher interface {
+	Publish(e Event)
+}
+
+// Enqueuer is a Publisher that can report failure, such as
+// webhook.Dispatcher. OutboxPublisher calls Enqueue so that a failure leaves
+// the event in the outbox to be retried.
+type Enqueuer interface {
+	Enqueue(ctx context.Context, e Event) error
+}
+
+// Publishers fans events out to several publishers in order.
+type Publishers []Publisher
+
+func (p Publishers) Publish(e Event) {
+	for _, pub := range p {
+		pub.Publish(e)
+	}
+}
+
+// AggregateType identifies user events in the outbox.
+const AggregateType = "user"
+
+// OutboxPublisher passes user events relayed from the outbox on to a
+// Publisher. It implements outbox.Publisher.
+type OutboxPublisher struct {
+	events Publisher
+}
+
+func NewOutboxPublisher(events Publisher) *OutboxPublisher {
+	return &OutboxPublisher{events: events}
+}
+
+// Publish decodes m and publishes it. A message that cannot be decoded is
+// logged and dropped, since retrying it cannot succeed.
+func (p *OutboxPublisher) Publish(ctx context.Context, m *outbox.Message) error {
+	var e storedEvent
+	if err := json.Unmarshal(m.Payload, &e); err != nil {
+		logger.FromContext(ctx).Error("dropping undecodable outbox message", zap.Int64("id", m.ID), zap.Error(err))
+		return nil
+	}
+	return enqueue(ctx, p.events, Event{ID: e.ID, Type: e.Type, User: *e.User.user(), Time: e.Time})
+}
+
+// enqueue publishes e to pub, through Enqueue where pub supports it. Of
+// several Publishers, those before a failing one receive e again on retry.
+func enqueue(ctx context.Context, pub Publisher, e Event) error {
+	switch pub := pub.(type) {
+	case Publishers:
+		for _, p := range pub {
+			if err := enqueue(ctx, p, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Enqueuer:
+		return pub.Enqueue(ctx, e)
+	default:
+		pub.Publish(e)
+		return nil
+	}
 }
 
 // --- Service Implementation ---
 
 type userService struct {
 	repo   Repository
-	logger *zap.Logger
+	ids    idgen.Generator
+	events Publisher
+	tx     transaction.Manager
+	outbox outbox.Writer
+}
+
+// NewService returns the user service. ids generates the IDs of new users
+// and parses the IDs callers send. events may be nil when nothing consumes
+// user events.
+func NewService(repo Repository, ids idgen.Generator, events Publisher) Service {
+	return &userService{
+		repo:   repo,
+		ids:    ids,
+		events: events,
+	}
 }
 
-func NewService(repo Repository, logger *zap.Logger) Service {
+// NewAuditedService returns the user service making each write and its
+// audit entry, see Auditor, in one transaction of tx and publishing its
+// event to events, which may be nil, once the transaction commits.
+func NewAuditedService(repo Repository, ids idgen.Generator, tx transaction.Manager, events Publisher) Service {
 	return &userService{
 		repo:   repo,
-		logger: logger,
+		ids:    ids,
+		events: events,
+		tx:     tx,
 	}
 }
 
-func (s *userService) GetUser(ctx context.Context, id string) (*User, error) {
-	s.logger.Info("fetching user", zap.String("id", id))
-	return s.repo.Get(ctx, id)
+// NewTransactionalService returns the user service adding its events to
+// events within the transaction of each write, so an event is stored if and
+// only if its write commits. An outbox.Relay publishes them afterwards.
+func NewTransactionalService(repo Repository, ids idgen.Generator, tx transaction.Manager, events outbox.Writer) Service {
+	return &userService{
+		repo:   repo,
+		ids:    ids,
+		tx:     tx,
+		outbox: events,
+	}
+}
+
+func (s *userService) GetUser(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+	logger.FromContext(ctx).Info("fetching user", zap.String("id", id))
+	if err := fields.Validate(Fields); err != nil {
+		return nil, err
+	}
+	id, err := s.parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeAccess(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.Get(ctx, id, fields)
 }
 
 func (s *userService) CreateUser(ctx context.Context, user *User) error {
-	s.logger.Info("creating user", zap.String("email", user.Email))
-	return s.repo.Create(ctx, user)
+	logger.FromContext(ctx).Info("creating user", zap.String("email", user.Email))
+	user.ID = s.ids.New()
+	return s.write(ctx, func(ctx context.Context) (change, error) {
+		if err := s.repo.Create(ctx, user); err != nil {
+			return change{}, err
+		}
+		return change{event: s.newEvent(EventCreated, *user)}, nil
+	})
+}
+
+func (s *userService) UpdateUser(ctx context.Context, user *User) error {
+	logger.FromContext(ctx).Info("updating user", zap.String("id", user.ID))
+	id, err := s.parseID(user.ID)
+	if err != nil {
+		return err
+	}
+	user.ID = id
+	if err := authorizeAccess(ctx, user.ID); err != nil {
+		return err
+	}
+	return s.write(ctx, func(ctx context.Context) (change, error) {
+		before, err := s.snapshot(ctx, user.ID)
+		if err != nil {
+			return change{}, err
+		}
+		if err := s.repo.Update(ctx, user); err != nil {
+			return change{}, err
+		}
+		return change{event: s.newEvent(EventUpdated, *user), before: before}, nil
+	})
+}
+
+func (s *userService) DeleteUser(ctx context.Context, id string) error {
+	logger.FromContext(ctx).Info("deleting user", zap.String("id", id))
+	id, err := s.parseID(id)
+	if err != nil {
+		return err
+	}
+	if err := authorizeAccess(ctx, id); err != nil {
+		return err
+	}
+	return s.write(ctx, func(ctx context.Context) (change, error) {
+		before, err := s.snapshot(ctx, id)
+		if err != nil {
+			return change{}, err
+		}
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return change{}, err
+		}
+		tenantID, _ := tenant.FromContext(ctx)
+		return change{event: s.newEvent(EventDeleted, User{ID: id, TenantID: tenantID}), before: before}, nil
+	})
+}
+
+func (s *userService) SearchUsers(ctx context.Context, query string, limit, offset int) ([]*User, error) {
+	logger.FromContext(ctx).Info("searching users", zap.String("query", query))
+	query = strings.TrimSpace(query)
+	if utf8.RuneCountInString(query) < MinSearchLength {
+		return nil, ErrSearchQueryTooShort
+	}
+	searcher, ok := s.repo.(Searcher)
+	if !ok {
+		return nil, ErrSearchUnsupported
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	limit = min(limit, MaxSearchLimit)
+	offset = max(offset, 0)
+	return searcher.Search(ctx, query, limit, offset)
+}
+
+func (s *userService) ImportUsers(ctx context.Context, users []*User, progress func(done int)) (*ImportResult, error) {
+	logger.FromContext(ctx).Info("importing users", zap.Int("count", len(users)))
+	if err := authz.Check(ctx, PermissionAdmin); err != nil {
+		return nil, err
+	}
+
+	res := &ImportResult{Failed: make(map[int]error)}
+	for i, u := range users {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		if err := s.CreateUser(ctx, u); err != nil {
+			res.Failed[i] = err
+		} else {
+			res.Created++
+		}
+		if progress != nil {
+			progress(i + 1)
+		}
+	}
+	return res, nil
+}
+
+func (s *userService) ListDeletedUsers(ctx context.Context, limit, offset int) ([]*User, error) {
+	logger.FromContext(ctx).Info("listing deleted users")
+	if err := authz.Check(ctx, PermissionAdmin); err != nil {
+		return nil, err
+	}
+	trash, ok := s.repo.(Trash)
+	if !ok {
+		return nil, ErrTrashUnsupported
+	}
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	limit = min(limit, MaxListLimit)
+	offset = max(offset, 0)
+	return trash.ListDeleted(ctx, limit, offset)
+}
+
+func (s *userService) RestoreUser(ctx context.Context, id string) (*User, error) {
+	logger.FromContext(ctx).Info("restoring user", zap.String("id", id))
+	if err := authz.Check(ctx, PermissionAdmin); err != nil {
+		return nil, err
+	}
+	id, err := s.parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	trash, ok := s.repo.(Trash)
+	if !ok {
+		return nil, ErrTrashUnsupported
+	}
+	var user *User
+	err = s.write(ctx, func(ctx context.Context) (change, error) {
+		u, err := trash.Restore(ctx, id)
+		if err != nil {
+			return change{}, err
+		}
+		user = u
+		return change{event: s.newEvent(EventRestored, *u)}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *userService) UserHistory(ctx context.Context, id string, limit, offset int) ([]*AuditEntry, error) {
+	logger.FromContext(ctx).Info("fetching user history", zap.String("id", id))
+	if err := authz.Check(ctx, PermissionAdmin); err != nil {
+		return nil, err
+	}
+	id, err := s.parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	auditor, ok := s.repo.(Auditor)
+	if !ok {
+		return nil, ErrAuditUnsupported
+	}
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	limit = min(limit, MaxListLimit)
+	offset = max(offset, 0)
+	return auditor.History(ctx, id, limit, offset)
+}
+
+// change is a write made by the service: the event describing it and, for
+// the audit history, the user it replaced.
+type change struct {
+	event  Event
+	before *User
+}
+
+// write runs fn, which makes a change and describes it. With a transaction
+// manager the audit entry is added in the same transaction as the change,
+// and with an outbox so is the event; otherwise the event is published once
+// the transaction commits, see transaction.AfterCommit.
+func (s *userService) write(ctx context.Context, fn func(ctx context.Context) (change, error)) error {
+	if s.tx == nil {
+		c, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+		if err := s.audit(ctx, c); err != nil {
+			return err
+		}
+		s.publish(c.event)
+		return nil
+	}
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		c, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+		if err := s.audit(ctx, c); err != nil {
+			return err
+		}
+		if s.outbox == nil {
+			transaction.AfterCommit(ctx, func() { s.publish(c.event) })
+			return nil
+		}
+		e := c.event
+		payload, err := json.Marshal(storedEvent{ID: e.ID, Type: e.Type, User: newStoredUser(&e.User), Time: e.Time})
+		if err != nil {
+			return err
+		}
+		return s.outbox.Add(ctx, &outbox.Message{
+			AggregateType: AggregateType,
+			AggregateID:   e.User.ID,
+			EventType:     e.Type,
+			Payload:       payload,
+		})
+	})
+}
+
+// publish sends e to the service's publisher, if it has one.
+func (s *userService) publish(e Event) {
+	if s.events != nil {
+		s.events.Publish(e)
+	}
+}
+
+// snapshot returns the user as it is before a change, for the audit
+// history, or nil when the repository keeps none.
+func (s *userService) snapshot(ctx context.Context, id string) (*User, error) {
+	auditor, ok := s.repo.(Auditor)
+	if !ok {
+		return nil, nil
+	}
+	user, err := auditor.GetForUpdate(ctx, id)
+	if errors.Is(err, ErrAuditUnsupported) {
+		return nil, nil
+	}
+	return user, err
+}
+
+// audit adds the entry describing c to the history, if the repository keeps
+// one. The actor and request are taken from ctx.
+func (s *userService) audit(ctx context.Context, c change) error {
+	auditor, ok := s.repo.(Auditor)
+	if !ok {
+		return nil
+	}
+	entry := &AuditEntry{
+		UserID:    c.event.User.ID,
+		Action:    c.event.Type,
+		RequestID: requestid.FromContext(ctx),
+		Before:    c.before,
+		Time:      c.event.Time,
+	}
+	if claims, ok := auth.FromContext(ctx); ok {
+		entry.Actor = claims.Subject
+	}
+	if c.event.Type != EventDeleted {
+		after := c.event.User
+		entry.After = &after
+	}
+	err := auditor.AddAudit(ctx, entry)
+	if errors.Is(err, ErrAuditUnsupported) {
+		return nil
+	}
+	return err
+}
+
+func (s *userService) newEvent(eventType string, user User) Event {
+	return Event{ID: s.ids.New(), Type: eventType, User: user, Time: time.Now().UTC()}
+}
+
+// requireTenant returns the tenant in ctx, by which repositories scope every
+// query.
+func requireTenant(ctx context.Context) (string, error) {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return "", tenant.ErrMissing
+	}
+	return id, nil
+}
+
+// parseID validates an ID sent by a caller and returns it in the canonical
+// form IDs are stored in, so that every way of writing it finds the user.
+func (s *userService) parseID(id string) (string, error) {
+	b, err := s.ids.Parse(id)
+	if err != nil {
+		return "", ErrInvalidID
+	}
+	return s.ids.Format(b), nil
+}
+
+// authorizeAccess lets callers access their own record; any other record
+// requires PermissionAdmin.
+func authorizeAccess(ctx context.Context, id string) error {
+	if claims, ok := auth.FromContext(ctx); ok && claims.Subject == id {
+		return nil
+	}
+	return authz.Check(ctx, PermissionAdmin)
+}
+
+// --- Purger ---
+
+// DefaultRetention is how long deleted users can be restored before a
+// Purger removes them.
+const DefaultRetention = 30 * 24 * time.Hour
+
+// PurgeOptions configures a Purger. Zero values use the defaults noted.
+type PurgeOptions struct {
+	// Retention is how long deleted users are kept (DefaultRetention).
+	Retention time.Duration
+	// Interval between purges (1h).
+	Interval time.Duration
+}
+
+// Purger purges the users deleted more than Retention ago in the background
+// until it is closed. A purge is a single delete, so every instance can run
+// one.
+type Purger struct {
+	trash  Trash
+	opts   PurgeOptions
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewPurger(trash Trash, opts PurgeOptions) *Purger {
+	if opts.Retention <= 0 {
+		opts.Retention = DefaultRetention
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Hour
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Purger{
+		trash:  trash,
+		opts:   opts,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go p.run(ctx)
+	return p
+}
+
+// Close stops the purger and waits for it to exit.
+func (p *Purger) Close() {
+	p.cancel()
+	<-p.done
+}
+
+func (p *Purger) run(ctx context.Context) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := p.Purge(ctx); err != nil && ctx.Err() == nil {
+			zap.L().Error("cannot purge deleted users", zap.Error(err))
+		}
+	}
+}
+
+// Purge removes the users deleted more than Retention ago and returns how
+// many it removed.
+func (p *Purger) Purge(ctx context.Context) (int64, error) {
+	n, err := p.trash.Purge(ctx, time.Now().Add(-p.opts.Retention))
+	if n > 0 {
+		zap.L().Info("purged deleted users", zap.Int64("count", n))
+	}
+	return n, err
+}
+
+// --- Caching Repository ---
+
+// Default CacheOptions.
+const (
+	DefaultCacheTTL         = time.Minute
+	DefaultCacheNotFoundTTL = 10 * time.Second
+)
+
+// CacheOptions configures a CachingRepository.
+type CacheOptions struct {
+	// TTL is how long a user is served from the cache.
+	TTL time.Duration
+	// NotFoundTTL is how long an ID without a user is remembered as missing,
+	// sparing the database repeated lookups of it.
+	NotFoundTTL time.Duration
+}
+
+// CacheStats counts the Get calls a CachingRepository answered from the
+// cache (Hits) and from the wrapped repository (Misses).
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// CachingRepository is a Repository serving Get from a cache.Cache in front
+// of another Repository. Concurrent misses for one user share a single load
+// of the whole user, from which each caller's fields are selected. Writes
+// remove the user from the cache once they commit; a load racing a write may
+// still store the old user, which is then served until TTL. Reads inside a
+// transaction skip the cache, so they see the transaction's own writes.
+type CachingRepository struct {
+	repo  Repository
+	cache cache.Cache
+	opts  CacheOptions
+	group singleflight.Group
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func NewCachingRepository(repo Repository, c cache.Cache, opts CacheOptions) *CachingRepository {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultCacheTTL
+	}
+	if opts.NotFoundTTL <= 0 {
+		opts.NotFoundTTL = DefaultCacheNotFoundTTL
+	}
+	return &CachingRepository{repo: repo, cache: c, opts: opts}
+}
+
+// Stats returns the hit and miss counts so far.
+func (r *CachingRepository) Stats() CacheStats {
+	return CacheStats{Hits: r.hits.Load(), Misses: r.misses.Load()}
+}
+
+func (r *CachingRepository) Get(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+	if transaction.InTx(ctx) {
+		return r.repo.Get(ctx, id, fields)
+	}
+
+	key := cacheKey(ctx, id)
+	data, ok, err := r.cache.Get(ctx, key)
+	if err != nil {
+		logger.FromContext(ctx).Warn("cannot read user cache", zap.Error(err))
+	}
+	if ok {
+		r.hits.Add(1)
+		// A user that does not exist is cached as an empty value.
+		if len(data) == 0 {
+			return nil, ErrNotFound
+		}
+		var user storedUser
+		if err := json.Unmarshal(data, &user); err != nil {
+			return nil, err
+		}
+		return selectFields(user.user(), fields), nil
+	}
+
+	r.misses.Add(1)
+	// The load is shared by every caller waiting for it, so one caller
+	// cancelling does not fail the others.
+	v, err, _ := r.group.Do(key, func() (any, error) {
+		return r.load(context.WithoutCancel(ctx), key, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return selectFields(v.(*User), fields), nil
 }
 
-// --- Handler ---
+// load reads the whole user from the wrapped repository and caches it, or
+// caches that it does not exist.
+func (r *CachingRepository) load(ctx context.Context, key, id string) (*User, error) {
+	user, err := r.repo.Get(ctx, id, nil)
+	var data []byte
+	ttl := r.opts.TTL
+	switch {
+	case errors.Is(err, ErrNotFound):
+		data, ttl = []byte{}, r.opts.NotFoundTTL
+	case err != nil:
+		return nil, err
+	default:
+		if data, err = json.Marshal(newStoredUser(user)); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.cache.Set(ctx, key, data, ttl); err != nil {
+		logger.FromContext(ctx).Warn("cannot write user cache", zap.Error(err))
+	}
+	if user == nil {
+		return nil, ErrNotFound
+	}
+	return user, nil
+}
 
-type Handler struct {
-	svc Service
+// Create removes the new ID from the cache, where it may be remembered as
+// missing.
+func (r *CachingRepository) Create(ctx context.Context, user *User) error {
+	if err := r.repo.Create(ctx, user); err != nil {
+		return err
+	}
+	r.invalidate(ctx, user.ID)
+	return nil
 }
 
-func NewHandler(svc Service) *Handler {
-	return &Handler{svc: svc}
+func (r *CachingRepository) Update(ctx context.Context, user *User) error {
+	if err := r.repo.Update(ctx, user); err != nil {
+		return err
+	}
+	r.invalidate(ctx, user.ID)
+	return nil
 }
 
-func (h *Handler) RegisterRoutes(r chi.Router) {
-	r.Get("/users/{id}", h.GetUser)
-	r.Post("/users", h.CreateUser)
+func (r *CachingRepository) Delete(ctx context.Context, id string) error {
+	if err := r.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	r.invalidate(ctx, id)
+	return nil
+}
+
+// Search is not cached; it returns ErrSearchUnsupported unless the wrapped
+// repository is a Searcher.
+func (r *CachingRepository) Search(ctx context.Context, query string, limit, offset int) ([]*User, error) {
+	searcher, ok := r.repo.(Searcher)
+	if !ok {
+		return nil, ErrSearchUnsupported
+	}
+	return searcher.Search(ctx, query, limit, offset)
 }
 
-func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	user, err := h.svc.GetUser(r.Context(), id)
+// ListDeleted is not cached; it returns ErrTrashUnsupported unless the
+// wrapped repository is a Trash.
+func (r *CachingRepository) ListDeleted(ctx context.Context, limit, offset int) ([]*User, error) {
+	trash, ok := r.repo.(Trash)
+	if !ok {
+		return nil, ErrTrashUnsupported
+	}
+	return trash.ListDeleted(ctx, limit, offset)
+}
+
+// Restore removes the user from the cache, where it is remembered as
+// missing.
+func (r *CachingRepository) Restore(ctx context.Context, id string) (*User, error) {
+	trash, ok := r.repo.(Trash)
+	if !ok {
+		return nil, ErrTrashUnsupported
+	}
+	user, err := trash.Restore(ctx, id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
-		return
+		return nil, err
+	}
+	r.invalidate(ctx, id)
+	return user, nil
+}
+
+// Purge only removes deleted users, which are not cached.
+func (r *CachingRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	trash, ok := r.repo.(Trash)
+	if !ok {
+		return 0, ErrTrashUnsupported
 	}
-	json.NewEncoder(w).Encode(user)
+	return trash.Purge(ctx, before)
 }
 
-func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	var user User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
-		return
+// GetForUpdate, AddAudit and History are not cached; they return
+// ErrAuditUnsupported unless the wrapped repository is an Auditor.
+func (r *CachingRepository) GetForUpdate(ctx context.Context, id string) (*User, error) {
+	auditor, ok := r.repo.(Auditor)
+	if !ok {
+		return nil, ErrAuditUnsupported
 	}
-	if err := h.svc.CreateUser(r.Context(), &user); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	return auditor.GetForUpdate(ctx, id)
+}
+
+func (r *CachingRepository) AddAudit(ctx context.Context, entry *AuditEntry) error {
+	auditor, ok := r.repo.(Auditor)
+	if !ok {
+		return ErrAuditUnsupported
+	}
+	return auditor.AddAudit(ctx, entry)
+}
+
+func (r *CachingRepository) History(ctx context.Context, userID string, limit, offset int) ([]*AuditEntry, error) {
+	auditor, ok := r.repo.(Auditor)
+	if !ok {
+		return nil, ErrAuditUnsupported
 	}
-	w.WriteHeader(http.StatusCreated)
+	return auditor.History(ctx, userID, limit, offset)
+}
+
+// invalidate removes the user from the cache once the transaction in ctx, if
+// any, commits.
+func (r *CachingRepository) invalidate(ctx context.Context, id string) {
+	ctx = context.WithoutCancel(ctx)
+	transaction.AfterCommit(ctx, func() {
+		if err := r.cache.Delete(ctx, cacheKey(ctx, id)); err != nil {
+			logger.FromContext(ctx).Warn("cannot invalidate user cache", zap.String("id", id), zap.Error(err))
+		}
+	})
+}
+
+// cacheKey scopes the key by the tenant in ctx. Users of other tenants are
+// never found under it, nor are their IDs remembered as missing.
+func cacheKey(ctx context.Context, id string) string {
+	tenantID, _ := tenant.FromContext(ctx)
+	return "user:" + tenantID + ":" + id
+}
+
+// selectFields returns a copy of user with only the fields in fields set.
+func selectFields(user *User, fields fieldmask.Mask) *User {
+	u := *user
+	if !fields.Has("id") {
+		u.ID = ""
+	}
+	if !fields.Has("name") {
+		u.Name = ""
+	}
+	if !fields.Has("email") {
+		u.Email = ""
+	}
+	if !fields.Has("created_at") {
+		u.CreatedAt = time.Time{}
+	}
+	if !fields.Has("updated_at") {
+		u.UpdatedAt = time.Time{}
+	}
+	return &u
 }
 
 // --- SQLite Repository ---
@@ -108,36 +1016,366 @@ func NewSqliteRepository(db *sql.DB) *SqliteRepository {
 	}
 }
 
-func (r *SqliteRepository) Get(ctx context.Context, id string) (*User, error) {
-	userModel, err := r.q.GetUser(ctx, id)
+// conn returns the transaction in ctx, or the pool outside one.
+func (r *SqliteRepository) conn(ctx context.Context) repository.DBTX {
+	if tx, ok := transaction.FromContext(ctx); ok {
+		return tx
+	}
+	return r.db
+}
+
+// queries returns r.q bound to the transaction in ctx, if any.
+func (r *SqliteRepository) queries(ctx context.Context) *repository.Queries {
+	if tx, ok := transaction.FromContext(ctx); ok {
+		return r.q.WithTx(tx)
+	}
+	return r.q
+}
+
+func (r *SqliteRepository) Get(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+	logger.FromContext(ctx).Debug("querying user", zap.String("id", id))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var userModel repository.User
+	if len(fields) == 0 {
+		userModel, err = r.queries(ctx).GetUser(ctx, repository.GetUserParams{ID: id, TenantID: tenantID})
+	} else {
+		userModel, err = r.getUserFields(ctx, id, tenantID, fields)
+	}
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrNotFound
 		}
 		return nil, err
 	}
 
 	return &User{
-		ID:    userModel.ID,
-		Name:  userModel.Name,
-		Email: userModel.Email,
+		ID:        userModel.ID,
+		Name:      userModel.Name,
+		Email:     userModel.Email,
+		CreatedAt: userModel.CreatedAt,
+		UpdatedAt: userModel.UpdatedAt,
+		TenantID:  tenantID,
 	}, nil
 }
 
+// getUserFields is GetUser selecting only the columns in fields. sqlc cannot
+// generate a variable select list; column names come from userColumns, never
+// from the request.
+func (r *SqliteRepository) getUserFields(ctx context.Context, id, tenantID string, fields fieldmask.Mask) (repository.User, error) {
+	var i repository.User
+	cols, dest := userColumns(&i, fields)
+	err := r.conn(ctx).QueryRowContext(ctx, "SELECT "+strings.Join(cols, ", ")+" FROM users WHERE id = ? AND tenant_id = ? AND deleted_at IS NULL LIMIT 1", id, tenantID).Scan(dest...)
+	return i, err
+}
+
+// userColumns returns the users columns selected by fields with matching
+// scan destinations in i.
+func userColumns(i *repository.User, fields fieldmask.Mask) ([]string, []any) {
+	targets := map[string]any{
+		"id":         &i.ID,
+		"name":       &i.Name,
+		"email":      &i.Email,
+		"created_at": &i.CreatedAt,
+		"updated_at": &i.UpdatedAt,
+	}
+	var cols []string
+	var dest []any
+	for _, f := range fields {
+		if target, ok := targets[f]; ok {
+			cols = append(cols, f)
+			dest = append(dest, target)
+		}
+	}
+	return cols, dest
+}
+
 func (r *SqliteRepository) Create(ctx context.Context, user *User) error {
-	user.ID = uuid.New().String()
+	logger.FromContext(ctx).Debug("inserting user", zap.String("email", user.Email))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
 
 	params := repository.CreateUserParams{
-		ID:    user.ID,
-		Name:  user.Name,
-		Email: user.Email,
+		ID:       user.ID,
+		TenantID: tenantID,
+		Name:     user.Name,
+		Email:    user.Email,
 	}
 
-	userModel, err := r.q.CreateUser(ctx, params)
+	userModel, err := r.queries(ctx).CreateUser(ctx, params)
 	if err != nil {
 		return err
 	}
 
 	user.ID = userModel.ID
+	user.CreatedAt = userModel.CreatedAt
+	user.UpdatedAt = userModel.UpdatedAt
+	user.TenantID = userModel.TenantID
+	return nil
+}
+
+func (r *SqliteRepository) Update(ctx context.Context, user *User) error {
+	logger.FromContext(ctx).Debug("updating user", zap.String("id", user.ID))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	userModel, err := r.queries(ctx).UpdateUser(ctx, repository.UpdateUserParams{
+		Name:     user.Name,
+		Email:    user.Email,
+		ID:       user.ID,
+		TenantID: tenantID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	user.CreatedAt = userModel.CreatedAt
+	user.UpdatedAt = userModel.UpdatedAt
+	user.TenantID = userModel.TenantID
+	return nil
+}
+
+func (r *SqliteRepository) Delete(ctx context.Context, id string) error {
+	logger.FromContext(ctx).Debug("deleting user", zap.String("id", id))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	n, err := r.queries(ctx).SoftDeleteUser(ctx, repository.SoftDeleteUserParams{ID: id, TenantID: tenantID})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SqliteRepository) Search(ctx context.Context, query string, limit, offset int) ([]*User, error) {
+	logger.FromContext(ctx).Debug("searching users", zap.String("query", query))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userModels, err := r.queries(ctx).SearchUsers(ctx, repository.SearchUsersParams{
+		Query:     matchQuery(query),
+		TenantID:  tenantID,
+		RowLimit:  int64(limit),
+		RowOffset: int64(offset),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*User, 0, len(userModels))
+	for _, userModel := range userModels {
+		users = append(users, &User{
+			ID:        userModel.ID,
+			Name:      userModel.Name,
+			Email:     userModel.Email,
+			CreatedAt: userModel.CreatedAt,
+			UpdatedAt: userModel.UpdatedAt,
+			TenantID:  userModel.TenantID,
+		})
+	}
+	return users, nil
+}
+
+func (r *SqliteRepository) ListDeleted(ctx context.Context, limit, offset int) ([]*User, error) {
+	logger.FromContext(ctx).Debug("listing deleted users")
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userModels, err := r.queries(ctx).ListDeletedUsers(ctx, repository.ListDeletedUsersParams{
+		TenantID:  tenantID,
+		RowLimit:  int64(limit),
+		RowOffset: int64(offset),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*User, 0, len(userModels))
+	for _, userModel := range userModels {
+		users = append(users, fromModel(userModel))
+	}
+	return users, nil
+}
+
+func (r *SqliteRepository) Restore(ctx context.Context, id string) (*User, error) {
+	logger.FromContext(ctx).Debug("restoring user", zap.String("id", id))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	userModel, err := r.queries(ctx).RestoreUser(ctx, repository.RestoreUserParams{ID: id, TenantID: tenantID})
+	if err != nil {
+		var sqliteErr *sqlite.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+			return nil, ErrEmailTaken
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return fromModel(userModel), nil
+}
+
+func (r *SqliteRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	logger.FromContext(ctx).Debug("purging deleted users", zap.Time("before", before))
+
+	// deleted_at is stored as UTC text by CURRENT_TIMESTAMP and compared as
+	// text, so before must be in UTC too.
+	return r.queries(ctx).PurgeUsers(ctx, sql.NullTime{Time: before.UTC(), Valid: true})
+}
+
+// GetForUpdate takes no lock: SQLite lets one transaction write at a time
+// and fails a transaction that read before another one wrote, so the user
+// read is the one its write replaces.
+func (r *SqliteRepository) GetForUpdate(ctx context.Context, id string) (*User, error) {
+	return r.Get(ctx, id, nil)
+}
+
+func (r *SqliteRepository) AddAudit(ctx context.Context, entry *AuditEntry) error {
+	logger.FromContext(ctx).Debug("adding user audit entry", zap.String("id", entry.UserID), zap.String("action", entry.Action))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+	before, err := auditState(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := auditState(entry.After)
+	if err != nil {
+		return err
+	}
+	id, err := r.queries(ctx).CreateUserAuditEntry(ctx, repository.CreateUserAuditEntryParams{
+		TenantID:    tenantID,
+		UserID:      entry.UserID,
+		Action:      entry.Action,
+		Actor:       entry.Actor,
+		RequestID:   entry.RequestID,
+		BeforeState: before,
+		AfterState:  after,
+		CreatedAt:   entry.Time.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	entry.ID = id
+	entry.TenantID = tenantID
 	return nil
 }
+
+func (r *SqliteRepository) History(ctx context.Context, userID string, limit, offset int) ([]*AuditEntry, error) {
+	logger.FromContext(ctx).Debug("listing user audit entries", zap.String("id", userID))
+
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	models, err := r.queries(ctx).ListUserAuditEntries(ctx, repository.ListUserAuditEntriesParams{
+		TenantID:  tenantID,
+		UserID:    userID,
+		RowLimit:  int64(limit),
+		RowOffset: int64(offset),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*AuditEntry, 0, len(models))
+	for _, m := range models {
+		entry := &AuditEntry{
+			ID:        m.ID,
+			UserID:    m.UserID,
+			TenantID:  m.TenantID,
+			Action:    m.Action,
+			Actor:     m.Actor,
+			RequestID: m.RequestID,
+			Time:      m.CreatedAt,
+		}
+		if m.BeforeState.Valid {
+			if err := json.Unmarshal([]byte(m.BeforeState.String), &entry.Before); err != nil {
+				return nil, err
+			}
+		}
+		if m.AfterState.Valid {
+			if err := json.Unmarshal([]byte(m.AfterState.String), &entry.After); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// auditState encodes the user stored as the state before or after a
+// change, NULL without one.
+func auditState(user *User) (sql.NullString, error) {
+	if user == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(user)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// fromModel converts a row of users, including DeletedAt.
+func fromModel(userModel repository.User) *User {
+	user := &User{
+		ID:        userModel.ID,
+		Name:      userModel.Name,
+		Email:     userModel.Email,
+		CreatedAt: userModel.CreatedAt,
+		UpdatedAt: userModel.UpdatedAt,
+		TenantID:  userModel.TenantID,
+	}
+	if userModel.DeletedAt.Valid {
+		user.DeletedAt = &userModel.DeletedAt.Time
+	}
+	return user
+}
+
+// matchQuery turns a query into an FTS5 expression requiring every word as a
+// quoted substring, so user input cannot inject FTS5 operators. The trigram
+// tokenizer cannot match words shorter than three characters; they are
+// dropped unless nothing else is left, in which case the whole query is
+// matched as one phrase.
+func matchQuery(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		if utf8.RuneCountInString(word) >= 3 {
+			terms = append(terms, quoteMatch(word))
+		}
+	}
+	if len(terms) == 0 {
+		return quoteMatch(query)
+	}
+	return strings.Join(terms, " ")
+}
+
+func quoteMatch(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
@@ -1,28 +1,50 @@
 package user
 
 import (
-	"bytes"
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
-	"net/http"
-	"net/http/httptest"
+	"fmt"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
-	"github.com/go-chi/chi/v5"
-	"go.uber.org/zap"
+	"github.com/user/go-templates/template-sqlite/db/migration"
+	"github.com/user/go-templates/template-sqlite/internal/outbox"
+	"github.com/user/go-templates/template-sqlite/pkg/auth"
+	"github.com/user/go-templates/template-sqlite/pkg/authz"
+	"github.com/user/go-templates/template-sqlite/pkg/cache"
+	"github.com/user/go-templates/template-sqlite/pkg/fieldmask"
+	"github.com/user/go-templates/template-sqlite/pkg/idgen"
+	"github.com/user/go-templates/template-sqlite/pkg/requestid"
+	"github.com/user/go-templates/template-sqlite/pkg/tenant"
+	"github.com/user/go-templates/template-sqlite/pkg/transaction"
 )
 
 // --- Mocks ---
 
+// IDs of the users the service tests act on, written the way idgen.UUIDv7
+// writes them.
+const (
+	testUserID  = "0190a0b4-3f1c-7c2a-9b1e-5d2f8a4c6e01"
+	otherUserID = "0190a0b4-3f1c-7c2a-9b1e-5d2f8a4c6e02"
+)
+
 type mockRepository struct {
-	GetFunc    func(ctx context.Context, id string) (*User, error)
+	GetFunc    func(ctx context.Context, id string, fields fieldmask.Mask) (*User, error)
 	CreateFunc func(ctx context.Context, user *User) error
+	UpdateFunc func(ctx context.Context, user *User) error
+	DeleteFunc func(ctx context.Context, id string) error
 }
 
-func (m *mockRepository) Get(ctx context.Context, id string) (*User, error) {
+func (m *mockRepository) Get(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
 	if m.GetFunc != nil {
-		return m.GetFunc(ctx, id)
+		return m.GetFunc(ctx, id, fields)
 	}
 	return nil, errors.New("unimplemented")
 }
@@ -34,30 +56,106 @@ func (m *mockRepository) Create(ctx context.Context, user *User) error {
 	return errors.New("unimplemented")
 }
 
-type mockService struct {
-	GetUserFunc    func(ctx context.Context, id string) (*User, error)
-	CreateUserFunc func(ctx context.Context, user *User) error
+func (m *mockRepository) Update(ctx context.Context, user *User) error {
+	if m.UpdateFunc != nil {
+		return m.UpdateFunc(ctx, user)
+	}
+	return errors.New("unimplemented")
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	if m.DeleteFunc != nil {
+		return m.DeleteFunc(ctx, id)
+	}
+	return errors.New("unimplemented")
+}
+
+// searchRepository is a mockRepository that also implements Searcher.
+type searchRepository struct {
+	mockRepository
+	SearchFunc func(ctx context.Context, query string, limit, offset int) ([]*User, error)
 }
 
-func (m *mockService) GetUser(ctx context.Context, id string) (*User, error) {
-	if m.GetUserFunc != nil {
-		return m.GetUserFunc(ctx, id)
+func (m *searchRepository) Search(ctx context.Context, query string, limit, offset int) ([]*User, error) {
+	if m.SearchFunc != nil {
+		return m.SearchFunc(ctx, query, limit, offset)
 	}
 	return nil, errors.New("unimplemented")
 }
 
-func (m *mockService) CreateUser(ctx context.Context, user *User) error {
-	if m.CreateUserFunc != nil {
-		return m.CreateUserFunc(ctx, user)
+// trashRepository is a mockRepository that also implements Trash.
+type trashRepository struct {
+	mockRepository
+	ListDeletedFunc func(ctx context.Context, limit, offset int) ([]*User, error)
+	RestoreFunc     func(ctx context.Context, id string) (*User, error)
+	PurgeFunc       func(ctx context.Context, before time.Time) (int64, error)
+}
+
+func (m *trashRepository) ListDeleted(ctx context.Context, limit, offset int) ([]*User, error) {
+	if m.ListDeletedFunc != nil {
+		return m.ListDeletedFunc(ctx, limit, offset)
 	}
-	return errors.New("unimplemented")
+	return nil, errors.New("unimplemented")
+}
+
+func (m *trashRepository) Restore(ctx context.Context, id string) (*User, error) {
+	if m.RestoreFunc != nil {
+		return m.RestoreFunc(ctx, id)
+	}
+	return nil, errors.New("unimplemented")
+}
+
+func (m *trashRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	if m.PurgeFunc != nil {
+		return m.PurgeFunc(ctx, before)
+	}
+	return 0, errors.New("unimplemented")
+}
+
+// auditRepository is a mockRepository that also implements Auditor,
+// keeping the entries it is given.
+type auditRepository struct {
+	mockRepository
+	GetForUpdateFunc func(ctx context.Context, id string) (*User, error)
+	HistoryFunc      func(ctx context.Context, userID string, limit, offset int) ([]*AuditEntry, error)
+	entries          []*AuditEntry
+	err              error
+}
+
+func (m *auditRepository) GetForUpdate(ctx context.Context, id string) (*User, error) {
+	if m.GetForUpdateFunc != nil {
+		return m.GetForUpdateFunc(ctx, id)
+	}
+	return nil, errors.New("unimplemented")
+}
+
+func (m *auditRepository) AddAudit(ctx context.Context, entry *AuditEntry) error {
+	if m.err != nil {
+		return m.err
+	}
+	entry.ID = int64(len(m.entries) + 1)
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *auditRepository) History(ctx context.Context, userID string, limit, offset int) ([]*AuditEntry, error) {
+	if m.HistoryFunc != nil {
+		return m.HistoryFunc(ctx, userID, limit, offset)
+	}
+	return nil, errors.New("unimplemented")
+}
+
+type recordingPublisher struct {
+	events []Event
+}
+
+func (p *recordingPublisher) Publish(e Event) {
+	p.events = append(p.events, e)
 }
 
 // --- Service Tests ---
 
 func TestUserService_GetUser(t *testing.T) {
-	logger := zap.NewNop()
-
 	tests := []struct {
 		name          string
 		userID        string
@@ -67,22 +165,22 @@ func TestUserService_GetUser(t *testing.T) {
 	}{
 		{
 			name:   "Success",
-			userID: "123",
+			userID: testUserID,
 			mockBehavior: func(m *mockRepository) {
-				m.GetFunc = func(ctx context.Context, id string) (*User, error) {
-					if id != "123" {
+				m.GetFunc = func(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+					if id != testUserID {
 						return nil, errors.New("unexpected id")
 					}
-					return &User{ID: "123", Name: "John Doe", Email: "john@example.com"}, nil
+					return &User{ID: testUserID, Name: "John Doe", Email: "john@example.com"}, nil
 				}
 			},
-			expectedUser: &User{ID: "123", Name: "John Doe", Email: "john@example.com"},
+			expectedUser: &User{ID: testUserID, Name: "John Doe", Email: "john@example.com"},
 		},
 		{
 			name:   "NotFound",
-			userID: "999",
+			userID: otherUserID,
 			mockBehavior: func(m *mockRepository) {
-				m.GetFunc = func(ctx context.Context, id string) (*User, error) {
+				m.GetFunc = func(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
 					return nil, errors.New("user not found")
 				}
 			},
@@ -95,8 +193,8 @@ func TestUserService_GetUser(t *testing.T) {
 			mockRepo := &mockRepository{}
 			tt.mockBehavior(mockRepo)
 
-			svc := NewService(mockRepo, logger)
-			user, err := svc.GetUser(context.Background(), tt.userID)
+			svc := NewService(mockRepo, idgen.UUIDv7{}, nil)
+			user, err := svc.GetUser(context.Background(), tt.userID, nil)
 
 			if tt.expectedError != "" {
 				if err == nil || err.Error() != tt.expectedError {
@@ -114,9 +212,55 @@ func TestUserService_GetUser(t *testing.T) {
 	}
 }
 
-func TestUserService_CreateUser(t *testing.T) {
-	logger := zap.NewNop()
+func TestUserService_IDs(t *testing.T) {
+	var got string
+	repo := &mockRepository{
+		GetFunc: func(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+			got = id
+			return &User{ID: id}, nil
+		},
+	}
+	svc := NewService(repo, idgen.UUIDv7{}, nil)
+	ctx := context.Background()
+
+	// IDs reach the repository in canonical form.
+	if _, err := svc.GetUser(ctx, strings.ToUpper(testUserID), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got != testUserID {
+		t.Errorf("expected %q, got %q", testUserID, got)
+	}
+
+	calls := map[string]func(id string) error{
+		"GetUser": func(id string) error {
+			_, err := svc.GetUser(ctx, id, nil)
+			return err
+		},
+		"UpdateUser": func(id string) error {
+			return svc.UpdateUser(ctx, &User{ID: id, Name: "Jane"})
+		},
+		"DeleteUser": func(id string) error {
+			return svc.DeleteUser(ctx, id)
+		},
+		"RestoreUser": func(id string) error {
+			_, err := svc.RestoreUser(ctx, id)
+			return err
+		},
+		"UserHistory": func(id string) error {
+			_, err := svc.UserHistory(ctx, id, 0, 0)
+			return err
+		},
+	}
+	for name, call := range calls {
+		for _, id := range []string{"", "123", testUserID + "0", "01ARYZ6S41TSV4RRFFQ69G5FAV"} {
+			if err := call(id); !errors.Is(err, ErrInvalidID) {
+				t.Errorf("%s(%q): expected ErrInvalidID, got %v", name, id, err)
+			}
+		}
+	}
+}
 
+func TestUserService_CreateUser(t *testing.T) {
 	tests := []struct {
 		name          string
 		inputUser     *User
@@ -128,7 +272,9 @@ func TestUserService_CreateUser(t *testing.T) {
 			inputUser: &User{Name: "Jane Doe", Email: "jane@example.com"},
 			mockBehavior: func(m *mockRepository) {
 				m.CreateFunc = func(ctx context.Context, user *User) error {
-					user.ID = "generated-id"
+					if _, err := (idgen.UUIDv7{}).Parse(user.ID); err != nil {
+						return fmt.Errorf("expected a generated ID, got %q", user.ID)
+					}
 					return nil
 				}
 			},
@@ -150,7 +296,7 @@ func TestUserService_CreateUser(t *testing.T) {
 			mockRepo := &mockRepository{}
 			tt.mockBehavior(mockRepo)
 
-			svc := NewService(mockRepo, logger)
+			svc := NewService(mockRepo, idgen.UUIDv7{}, nil)
 			err := svc.CreateUser(context.Background(), tt.inputUser)
 
 			if tt.expectedError != "" {
@@ -166,123 +312,1209 @@ func TestUserService_CreateUser(t *testing.T) {
 	}
 }
 
-// --- Handler Tests ---
+func TestUserService_GetUser_Authorization(t *testing.T) {
+	repo := &mockRepository{
+		GetFunc: func(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+			return &User{ID: id}, nil
+		},
+	}
+	svc := NewService(repo, idgen.UUIDv7{}, nil)
+	authorizer := authz.NewAuthorizer(authz.StaticRoles{
+		"admin": {"*"},
+		"user":  {PermissionRead},
+	}, 0)
 
-func TestHandler_GetUser(t *testing.T) {
 	tests := []struct {
-		name           string
-		userID         string
-		mockBehavior   func(m *mockService)
-		expectedStatus int
-		expectedBody   string
+		name          string
+		claims        *auth.Claims
+		userID        string
+		expectedError error
 	}{
-		{
-			name:   "Success",
-			userID: "123",
-			mockBehavior: func(m *mockService) {
-				m.GetUserFunc = func(ctx context.Context, id string) (*User, error) {
-					return &User{ID: "123", Name: "John", Email: "john@example.com"}, nil
-				}
-			},
-			expectedStatus: http.StatusOK,
-			expectedBody:   `{"id":"123","name":"John","email":"john@example.com"}`,
+		{name: "Internal", userID: testUserID},
+		{name: "Self", claims: &auth.Claims{Roles: []string{"user"}}, userID: testUserID},
+		{name: "Other", claims: &auth.Claims{Roles: []string{"user"}}, userID: otherUserID, expectedError: authz.ErrPermissionDenied},
+		{name: "Admin", claims: &auth.Claims{Roles: []string{"admin"}}, userID: otherUserID},
+		{name: "AdminScope", claims: &auth.Claims{Scope: PermissionAdmin}, userID: otherUserID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := authz.NewContext(context.Background(), authorizer)
+			if tt.claims != nil {
+				tt.claims.Subject = testUserID
+				ctx = auth.NewContext(ctx, tt.claims)
+			}
+
+			_, err := svc.GetUser(ctx, tt.userID, nil)
+			if !errors.Is(err, tt.expectedError) {
+				t.Errorf("expected error %v, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestUserService_Events(t *testing.T) {
+	failing := errors.New("db error")
+	repo := &mockRepository{
+		CreateFunc: func(ctx context.Context, user *User) error {
+			if user.Email == "" {
+				return failing
+			}
+			user.ID = testUserID
+			return nil
 		},
-		{
-			name:   "NotFound",
-			userID: "999",
-			mockBehavior: func(m *mockService) {
-				m.GetUserFunc = func(ctx context.Context, id string) (*User, error) {
-					return nil, errors.New("not found")
-				}
-			},
-			expectedStatus: http.StatusNotFound,
-			expectedBody:   "not found",
+		UpdateFunc: func(ctx context.Context, user *User) error {
+			if user.ID != testUserID {
+				return ErrNotFound
+			}
+			return nil
+		},
+		DeleteFunc: func(ctx context.Context, id string) error {
+			return nil
+		},
+	}
+	events := &recordingPublisher{}
+	svc := NewService(repo, idgen.UUIDv7{}, events)
+	ctx := context.Background()
+
+	if err := svc.CreateUser(ctx, &User{Name: "Jane", Email: "jane@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CreateUser(ctx, &User{Name: "Jane"}); !errors.Is(err, failing) {
+		t.Fatalf("expected %v, got %v", failing, err)
+	}
+	if err := svc.UpdateUser(ctx, &User{ID: testUserID, Name: "Jane Doe"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.UpdateUser(ctx, &User{ID: otherUserID}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v, got %v", ErrNotFound, err)
+	}
+	// Denied writes must not publish either.
+	claims := &auth.Claims{}
+	claims.Subject = otherUserID
+	denied := auth.NewContext(authz.NewContext(ctx, authz.NewAuthorizer(authz.StaticRoles{}, 0)), claims)
+	if err := svc.DeleteUser(denied, testUserID); !errors.Is(err, authz.ErrPermissionDenied) {
+		t.Fatalf("expected %v, got %v", authz.ErrPermissionDenied, err)
+	}
+	if err := svc.DeleteUser(ctx, testUserID); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Event{
+		{Type: EventCreated, User: User{ID: testUserID, Name: "Jane", Email: "jane@example.com"}},
+		{Type: EventUpdated, User: User{ID: testUserID, Name: "Jane Doe"}},
+		{Type: EventDeleted, User: User{ID: testUserID}},
+	}
+	if len(events.events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), events.events)
+	}
+	for i, e := range events.events {
+		if e.Type != expected[i].Type || e.User != expected[i].User || e.Time.IsZero() {
+			t.Errorf("event %d: expected %+v, got %+v", i, expected[i], e)
+		}
+	}
+}
+
+// fakeTx counts the units of work WithinTx committed and rolled back.
+type fakeTx struct {
+	committed, rolledBack int
+}
+
+func (tx *fakeTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := fn(ctx); err != nil {
+		tx.rolledBack++
+		return err
+	}
+	tx.committed++
+	return nil
+}
+
+type recordingOutbox struct {
+	msgs []*outbox.Message
+	err  error
+}
+
+func (o *recordingOutbox) Add(ctx context.Context, m *outbox.Message) error {
+	if o.err != nil {
+		return o.err
+	}
+	o.msgs = append(o.msgs, m)
+	return nil
+}
+
+func TestUserService_Outbox(t *testing.T) {
+	failing := errors.New("db error")
+	repo := &mockRepository{
+		CreateFunc: func(ctx context.Context, user *User) error {
+			if user.Email == "" {
+				return failing
+			}
+			user.ID = testUserID
+			user.TenantID = "acme"
+			return nil
 		},
 	}
+	tx := &fakeTx{}
+	events := &recordingOutbox{}
+	svc := NewTransactionalService(repo, idgen.UUIDv7{}, tx, events)
+	ctx := context.Background()
+
+	if err := svc.CreateUser(ctx, &User{Name: "Jane", Email: "jane@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CreateUser(ctx, &User{Name: "Jane"}); !errors.Is(err, failing) {
+		t.Fatalf("expected %v, got %v", failing, err)
+	}
+	if tx.committed != 1 || tx.rolledBack != 1 {
+		t.Errorf("expected 1 commit and 1 rollback, got %d and %d", tx.committed, tx.rolledBack)
+	}
+	if len(events.msgs) != 1 {
+		t.Fatalf("expected 1 outbox message, got %d", len(events.msgs))
+	}
+	m := events.msgs[0]
+	if m.AggregateType != AggregateType || m.AggregateID != testUserID || m.EventType != EventCreated {
+		t.Errorf("unexpected message %+v", m)
+	}
+	var e Event
+	if err := json.Unmarshal(m.Payload, &e); err != nil {
+		t.Fatalf("payload: %v", err)
+	}
+	if e.ID == "" || e.Type != EventCreated || e.User.Email != "jane@example.com" || e.Time.IsZero() {
+		t.Errorf("unexpected event %+v", e)
+	}
+	// The relay publishes the event with its ID and tenant, which the JSON
+	// of a User leaves out.
+	relayed := &recordingPublisher{}
+	if err := NewOutboxPublisher(relayed).Publish(ctx, m); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if len(relayed.events) == 1 && relayed.events[0].ID != e.ID {
+		t.Errorf("expected the relayed event to keep ID %q, got %q", e.ID, relayed.events[0].ID)
+	}
+	if len(relayed.events) != 1 || relayed.events[0].User.TenantID != "acme" {
+		t.Errorf("expected the relayed event to keep its tenant, got %+v", relayed.events)
+	}
+	if data, _ := json.Marshal(relayed.events[0]); strings.Contains(string(data), "acme") {
+		t.Errorf("expected the event JSON to leave out the tenant, got %s", data)
+	}
+
+	// A write whose event cannot be stored is rolled back.
+	events.err = errors.New("outbox error")
+	if err := svc.CreateUser(ctx, &User{Name: "John", Email: "john@example.com"}); !errors.Is(err, events.err) {
+		t.Fatalf("expected %v, got %v", events.err, err)
+	}
+	if tx.rolledBack != 2 {
+		t.Errorf("expected the write to be rolled back")
+	}
+}
+
+// enqueuer is a recordingPublisher that also implements Enqueuer.
+type enqueuer struct {
+	recordingPublisher
+	enqueued []Event
+	err      error
+}
+
+func (p *enqueuer) Enqueue(ctx context.Context, e Event) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.enqueued = append(p.enqueued, e)
+	return nil
+}
+
+func TestOutboxPublisher(t *testing.T) {
+	ctx := context.Background()
+	e := Event{Type: EventUpdated, User: User{ID: testUserID, Name: "Jane"}, Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &outbox.Message{ID: 1, AggregateType: AggregateType, AggregateID: testUserID, EventType: e.Type, Payload: payload}
+
+	stream := &recordingPublisher{}
+	webhooks := &enqueuer{}
+	pub := NewOutboxPublisher(Publishers{stream, webhooks})
+	if err := pub.Publish(ctx, msg); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if len(stream.events) != 1 || stream.events[0] != e {
+		t.Errorf("expected %+v to be published, got %+v", e, stream.events)
+	}
+	if len(webhooks.enqueued) != 1 || len(webhooks.events) != 0 {
+		t.Errorf("expected the event to be enqueued, got %d enqueued and %d published", len(webhooks.enqueued), len(webhooks.events))
+	}
+
+	// A failure is returned so the relay retries the message.
+	webhooks.err = errors.New("enqueue failed")
+	if err := pub.Publish(ctx, msg); !errors.Is(err, webhooks.err) {
+		t.Errorf("expected %v, got %v", webhooks.err, err)
+	}
+
+	// A message that cannot be decoded is dropped rather than retried.
+	if err := pub.Publish(ctx, &outbox.Message{ID: 2, Payload: []byte("{")}); err != nil {
+		t.Errorf("expected an undecodable message to be dropped, got %v", err)
+	}
+}
+func TestUserService_SearchUsers(t *testing.T) {
+	type page struct {
+		query         string
+		limit, offset int
+	}
+	var got page
+	repo := &searchRepository{
+		SearchFunc: func(ctx context.Context, query string, limit, offset int) ([]*User, error) {
+			got = page{query, limit, offset}
+			return []*User{{ID: testUserID, Name: "Ada Lovelace"}}, nil
+		},
+	}
+	svc := NewService(repo, idgen.UUIDv7{}, nil)
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		in            page
+		expected      page
+		expectedError error
+	}{
+		{name: "Success", in: page{"ada", 5, 10}, expected: page{"ada", 5, 10}},
+		{name: "Trimmed", in: page{"  ada  ", 5, 0}, expected: page{"ada", 5, 0}},
+		{name: "DefaultLimit", in: page{"ada", 0, -1}, expected: page{"ada", DefaultSearchLimit, 0}},
+		{name: "MaxLimit", in: page{"ada", 1000, 0}, expected: page{"ada", MaxSearchLimit, 0}},
+		{name: "TooShort", in: page{" ad ", 5, 0}, expectedError: ErrSearchQueryTooShort},
+	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockSvc := &mockService{}
-			tt.mockBehavior(mockSvc)
+			got = page{}
+			users, err := svc.SearchUsers(ctx, tt.in.query, tt.in.limit, tt.in.offset)
+			if !errors.Is(err, tt.expectedError) {
+				t.Fatalf("expected error %v, got %v", tt.expectedError, err)
+			}
+			if err != nil {
+				return
+			}
+			if got != tt.expected {
+				t.Errorf("expected search %+v, got %+v", tt.expected, got)
+			}
+			if len(users) != 1 || users[0].ID != testUserID {
+				t.Errorf("unexpected users %+v", users)
+			}
+		})
+	}
+
+	t.Run("Unsupported", func(t *testing.T) {
+		svc := NewService(&mockRepository{}, idgen.UUIDv7{}, nil)
+		if _, err := svc.SearchUsers(ctx, "ada", 5, 0); !errors.Is(err, ErrSearchUnsupported) {
+			t.Errorf("expected error %v, got %v", ErrSearchUnsupported, err)
+		}
+	})
+}
 
-			handler := NewHandler(mockSvc)
-			r := chi.NewRouter()
-			r.Get("/users/{id}", handler.GetUser)
+func TestUserService_GetUser_Fields(t *testing.T) {
+	var got fieldmask.Mask
+	repo := &mockRepository{
+		GetFunc: func(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+			got = fields
+			return &User{ID: id}, nil
+		},
+	}
+	svc := NewService(repo, idgen.UUIDv7{}, nil)
 
-			req := httptest.NewRequest("GET", "/users/"+tt.userID, nil)
-			w := httptest.NewRecorder()
+	if _, err := svc.GetUser(context.Background(), testUserID, fieldmask.Mask{"id", "name"}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, fieldmask.Mask{"id", "name"}) {
+		t.Errorf("expected fields to reach the repository, got %v", got)
+	}
 
-			r.ServeHTTP(w, req)
+	got = nil
+	if _, err := svc.GetUser(context.Background(), testUserID, fieldmask.Mask{"password"}); !errors.Is(err, fieldmask.ErrUnknownField) {
+		t.Errorf("expected error %v, got %v", fieldmask.ErrUnknownField, err)
+	}
+	if got != nil {
+		t.Error("unknown fields must not reach the repository")
+	}
+}
 
-			if w.Code != tt.expectedStatus {
-				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+func TestUserService_ImportUsers(t *testing.T) {
+	repo := &mockRepository{
+		CreateFunc: func(ctx context.Context, user *User) error {
+			if user.Email == "taken@example.com" {
+				return errors.New("duplicate email")
 			}
-			if tt.expectedBody != "" {
-				body := strings.TrimSpace(w.Body.String())
-				if !strings.Contains(body, tt.expectedBody) {
-					// Relaxed check for JSON formatting differences
-					if body != tt.expectedBody && !strings.Contains(body, `"id":"123"`) {
-						t.Errorf("expected body to contain %q, got %q", tt.expectedBody, body)
-					}
-				}
+			user.ID = "id-" + user.Name
+			return nil
+		},
+	}
+	pub := &recordingPublisher{}
+	svc := NewService(repo, idgen.UUIDv7{}, pub)
+	users := []*User{
+		{Name: "Ada", Email: "ada@example.com"},
+		{Name: "Taken", Email: "taken@example.com"},
+		{Name: "Alan", Email: "alan@example.com"},
+	}
+
+	var progress []int
+	res, err := svc.ImportUsers(context.Background(), users, func(done int) { progress = append(progress, done) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Created != 2 || len(res.Failed) != 1 || res.Failed[1] == nil {
+		t.Errorf("expected 2 created and user 1 failed, got %+v", res)
+	}
+	if !slices.Equal(progress, []int{1, 2, 3}) {
+		t.Errorf("expected progress after every user, got %v", progress)
+	}
+	if len(pub.events) != 2 {
+		t.Errorf("expected an event per created user, got %d", len(pub.events))
+	}
+
+	t.Run("Forbidden", func(t *testing.T) {
+		ctx := authz.NewContext(context.Background(), authz.NewAuthorizer(authz.StaticRoles{"user": {PermissionWrite}}, 0))
+		ctx = auth.NewContext(ctx, &auth.Claims{Roles: []string{"user"}})
+		if _, err := svc.ImportUsers(ctx, users, nil); !errors.Is(err, authz.ErrPermissionDenied) {
+			t.Errorf("expected error %v, got %v", authz.ErrPermissionDenied, err)
+		}
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		res, err := svc.ImportUsers(ctx, users, func(done int) { cancel() })
+		if !errors.Is(err, context.Canceled) || res.Created != 1 {
+			t.Errorf("expected the import to stop after one user, got %+v, %v", res, err)
+		}
+	})
+}
+
+func TestSqliteRepository_Transaction(t *testing.T) {
+	ctx := tenant.NewContext(context.Background(), tenant.DefaultTenant)
+	source := filepath.Join(t.TempDir(), "test.db")
+	if err := migration.Up(ctx, "sqlite", source); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	db, err := sql.Open("sqlite", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	repo := NewSqliteRepository(db)
+	tx := transaction.NewSqliteManager(db)
+
+	kept := newTestUser("Kept", "kept@example.com")
+	discarded := newTestUser("Discarded", "discarded@example.com")
+	errRollback := errors.New("rollback")
+	err = tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := repo.Create(ctx, kept); err != nil {
+			return err
+		}
+		// The uncommitted user is visible inside the transaction.
+		if _, err := repo.Get(ctx, kept.ID, nil); err != nil {
+			return err
+		}
+		err := tx.WithinTx(ctx, func(ctx context.Context) error {
+			if err := repo.Create(ctx, discarded); err != nil {
+				return err
 			}
+			return errRollback
 		})
+		if !errors.Is(err, errRollback) {
+			t.Errorf("expected the nested error, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithinTx: %v", err)
+	}
+
+	if _, err := repo.Get(ctx, kept.ID, nil); err != nil {
+		t.Errorf("expected the committed user, got %v", err)
+	}
+	if _, err := repo.Get(ctx, discarded.ID, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the rolled back user to be missing, got %v", err)
+	}
+
+	err = tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := repo.Delete(ctx, kept.ID); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("expected errRollback, got %v", err)
+	}
+	if _, err := repo.Get(ctx, kept.ID, nil); err != nil {
+		t.Errorf("expected the delete to be rolled back, got %v", err)
 	}
 }
 
-func TestHandler_CreateUser(t *testing.T) {
-	tests := []struct {
-		name           string
-		inputBody      string
-		mockBehavior   func(m *mockService)
-		expectedStatus int
+func TestUserService_ListDeletedUsers(t *testing.T) {
+	type page struct{ limit, offset int }
+	var got page
+	repo := &trashRepository{
+		ListDeletedFunc: func(ctx context.Context, limit, offset int) ([]*User, error) {
+			got = page{limit, offset}
+			return []*User{{ID: testUserID}}, nil
+		},
+	}
+	svc := NewService(repo, idgen.UUIDv7{}, nil)
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name         string
+		in, expected page
 	}{
-		{
-			name:      "Success",
-			inputBody: `{"name":"John","email":"john@example.com"}`,
-			mockBehavior: func(m *mockService) {
-				m.CreateUserFunc = func(ctx context.Context, user *User) error {
-					return nil
-				}
-			},
-			expectedStatus: http.StatusCreated,
+		{name: "Success", in: page{5, 10}, expected: page{5, 10}},
+		{name: "DefaultLimit", in: page{0, -1}, expected: page{DefaultListLimit, 0}},
+		{name: "MaxLimit", in: page{1000, 0}, expected: page{MaxListLimit, 0}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			users, err := svc.ListDeletedUsers(ctx, tt.in.limit, tt.in.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected page %+v, got %+v", tt.expected, got)
+			}
+			if len(users) != 1 || users[0].ID != testUserID {
+				t.Errorf("unexpected users %+v", users)
+			}
+		})
+	}
+
+	t.Run("Forbidden", func(t *testing.T) {
+		ctx := authz.NewContext(ctx, authz.NewAuthorizer(authz.StaticRoles{"user": {PermissionRead}}, 0))
+		ctx = auth.NewContext(ctx, &auth.Claims{Roles: []string{"user"}})
+		if _, err := svc.ListDeletedUsers(ctx, 5, 0); !errors.Is(err, authz.ErrPermissionDenied) {
+			t.Errorf("expected error %v, got %v", authz.ErrPermissionDenied, err)
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		svc := NewService(&mockRepository{}, idgen.UUIDv7{}, nil)
+		if _, err := svc.ListDeletedUsers(ctx, 5, 0); !errors.Is(err, ErrTrashUnsupported) {
+			t.Errorf("expected error %v, got %v", ErrTrashUnsupported, err)
+		}
+	})
+}
+
+func TestUserService_RestoreUser(t *testing.T) {
+	repo := &trashRepository{
+		RestoreFunc: func(ctx context.Context, id string) (*User, error) {
+			if id != testUserID {
+				return nil, ErrNotFound
+			}
+			return &User{ID: id, Name: "Ada"}, nil
 		},
-		{
-			name:      "InvalidJSON",
-			inputBody: `{"name":`,
-			mockBehavior: func(m *mockService) {
+	}
+	events := &recordingPublisher{}
+	svc := NewService(repo, idgen.UUIDv7{}, events)
+	ctx := context.Background()
+
+	u, err := svc.RestoreUser(ctx, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != testUserID || u.Name != "Ada" {
+		t.Errorf("expected the restored user, got %+v", u)
+	}
+	if _, err := svc.RestoreUser(ctx, otherUserID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected error %v, got %v", ErrNotFound, err)
+	}
+	denied := auth.NewContext(authz.NewContext(ctx, authz.NewAuthorizer(authz.StaticRoles{}, 0)), &auth.Claims{})
+	if _, err := svc.RestoreUser(denied, testUserID); !errors.Is(err, authz.ErrPermissionDenied) {
+		t.Errorf("expected error %v, got %v", authz.ErrPermissionDenied, err)
+	}
+
+	if len(events.events) != 1 || events.events[0].Type != EventRestored || events.events[0].User.ID != testUserID {
+		t.Errorf("expected one %s event, got %+v", EventRestored, events.events)
+	}
+
+	t.Run("Unsupported", func(t *testing.T) {
+		svc := NewService(&mockRepository{}, idgen.UUIDv7{}, nil)
+		if _, err := svc.RestoreUser(ctx, testUserID); !errors.Is(err, ErrTrashUnsupported) {
+			t.Errorf("expected error %v, got %v", ErrTrashUnsupported, err)
+		}
+	})
+}
+
+func TestPurger_Purge(t *testing.T) {
+	var got time.Time
+	repo := &trashRepository{
+		PurgeFunc: func(ctx context.Context, before time.Time) (int64, error) {
+			got = before
+			return 2, nil
+		},
+	}
+	p := NewPurger(repo, PurgeOptions{Retention: 48 * time.Hour, Interval: time.Hour})
+	defer p.Close()
+
+	n, err := p.Purge(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 users purged, got %d (%v)", n, err)
+	}
+	if d := time.Since(got) - 48*time.Hour; d < 0 || d > time.Minute {
+		t.Errorf("expected users deleted over 48h ago to be purged, got a cutoff of %v", got)
+	}
+}
+
+func TestUserService_Audit(t *testing.T) {
+	repo := &auditRepository{
+		mockRepository: mockRepository{
+			CreateFunc: func(ctx context.Context, user *User) error {
+				user.ID = testUserID
+				return nil
+			},
+			UpdateFunc: func(ctx context.Context, user *User) error {
+				return nil
+			},
+			DeleteFunc: func(ctx context.Context, id string) error {
+				return nil
 			},
-			expectedStatus: http.StatusBadRequest,
 		},
-		{
-			name:      "InternalError",
-			inputBody: `{"name":"John"}`,
-			mockBehavior: func(m *mockService) {
-				m.CreateUserFunc = func(ctx context.Context, user *User) error {
-					return errors.New("internal error")
-				}
+		GetForUpdateFunc: func(ctx context.Context, id string) (*User, error) {
+			if id != testUserID {
+				return nil, ErrNotFound
+			}
+			return &User{ID: id, Name: "Jane", Email: "jane@example.com"}, nil
+		},
+	}
+	tx := &fakeTx{}
+	events := &recordingOutbox{}
+	svc := NewTransactionalService(repo, idgen.UUIDv7{}, tx, events)
+	claims := &auth.Claims{Scope: PermissionAdmin}
+	claims.Subject = "admin"
+	ctx := authz.NewContext(auth.NewContext(context.Background(), claims), authz.NewAuthorizer(authz.StaticRoles{}, 0))
+	ctx = requestid.NewContext(ctx, "req-1")
+
+	if err := svc.CreateUser(ctx, &User{Name: "Jane", Email: "jane@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.UpdateUser(ctx, &User{ID: testUserID, Name: "Janet", Email: "jane@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.DeleteUser(ctx, testUserID); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(repo.entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(repo.entries))
+	}
+	for i, action := range []string{EventCreated, EventUpdated, EventDeleted} {
+		e := repo.entries[i]
+		if e.UserID != testUserID || e.Action != action || e.Actor != "admin" || e.RequestID != "req-1" || e.Time.IsZero() {
+			t.Errorf("entry %d: unexpected %+v", i, e)
+		}
+	}
+	if created := repo.entries[0]; created.Before != nil || created.After == nil || created.After.Name != "Jane" {
+		t.Errorf("unexpected creation %+v", created)
+	}
+	if updated := repo.entries[1]; updated.Before == nil || updated.Before.Name != "Jane" || updated.After == nil || updated.After.Name != "Janet" {
+		t.Errorf("unexpected update %+v", updated)
+	}
+	if deleted := repo.entries[2]; deleted.Before == nil || deleted.Before.Name != "Jane" || deleted.After != nil {
+		t.Errorf("unexpected deletion %+v", deleted)
+	}
+	if tx.committed != 3 {
+		t.Errorf("expected 3 commits, got %d", tx.committed)
+	}
+
+	// A user that does not exist is not written.
+	if err := svc.UpdateUser(ctx, &User{ID: otherUserID, Name: "John"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// A write whose entry cannot be stored is rolled back with its event.
+	repo.err = errors.New("audit error")
+	if err := svc.UpdateUser(ctx, &User{ID: testUserID, Name: "Janet"}); !errors.Is(err, repo.err) {
+		t.Fatalf("expected %v, got %v", repo.err, err)
+	}
+	if tx.rolledBack != 2 || len(events.msgs) != 3 {
+		t.Errorf("expected the write to be rolled back, got %d rollbacks and %d messages", tx.rolledBack, len(events.msgs))
+	}
+}
+
+// Without an outbox, the audit entry is still added in the transaction of
+// its write, and the event is published once it commits.
+func TestUserService_AuditWithoutOutbox(t *testing.T) {
+	repo := &auditRepository{
+		mockRepository: mockRepository{
+			UpdateFunc: func(ctx context.Context, user *User) error {
+				return nil
 			},
-			expectedStatus: http.StatusInternalServerError,
+		},
+		GetForUpdateFunc: func(ctx context.Context, id string) (*User, error) {
+			return &User{ID: id, Name: "Jane", Email: "jane@example.com"}, nil
 		},
 	}
+	tx := &fakeTx{}
+	events := &recordingPublisher{}
+	svc := NewAuditedService(repo, idgen.UUIDv7{}, tx, events)
+	ctx := context.Background()
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			mockSvc := &mockService{}
-			tt.mockBehavior(mockSvc)
+	if err := svc.UpdateUser(ctx, &User{ID: testUserID, Name: "Janet", Email: "jane@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if tx.committed != 1 || len(repo.entries) != 1 || len(events.events) != 1 {
+		t.Errorf("expected 1 commit, entry and event, got %d, %d and %d", tx.committed, len(repo.entries), len(events.events))
+	}
+
+	// A write whose entry cannot be stored is rolled back and not published.
+	repo.err = errors.New("audit error")
+	if err := svc.UpdateUser(ctx, &User{ID: testUserID, Name: "Janet", Email: "jane@example.com"}); !errors.Is(err, repo.err) {
+		t.Fatalf("expected %v, got %v", repo.err, err)
+	}
+	if tx.rolledBack != 1 || len(events.events) != 1 {
+		t.Errorf("expected the write to be rolled back, got %d rollbacks and %d events", tx.rolledBack, len(events.events))
+	}
+}
+
+func TestUserService_UserHistory(t *testing.T) {
+	repo := &auditRepository{
+		HistoryFunc: func(ctx context.Context, userID string, limit, offset int) ([]*AuditEntry, error) {
+			if userID != testUserID || limit != MaxListLimit || offset != 0 {
+				t.Errorf("unexpected arguments %q, %d, %d", userID, limit, offset)
+			}
+			return []*AuditEntry{{ID: 1, UserID: userID, Action: EventCreated}}, nil
+		},
+	}
+	ctx := context.Background()
+
+	entries, err := NewService(repo, idgen.UUIDv7{}, nil).UserHistory(ctx, testUserID, 1000, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected 1 entry, got %d", len(entries))
+	}
 
-			handler := NewHandler(mockSvc)
-			r := chi.NewRouter()
-			r.Post("/users", handler.CreateUser)
+	denied := auth.NewContext(authz.NewContext(ctx, authz.NewAuthorizer(authz.StaticRoles{}, 0)), &auth.Claims{})
+	if _, err := NewService(repo, idgen.UUIDv7{}, nil).UserHistory(denied, testUserID, 0, 0); !errors.Is(err, authz.ErrPermissionDenied) {
+		t.Errorf("expected ErrPermissionDenied, got %v", err)
+	}
 
-			req := httptest.NewRequest("POST", "/users", bytes.NewBufferString(tt.inputBody))
-			w := httptest.NewRecorder()
+	t.Run("Unsupported", func(t *testing.T) {
+		for _, repo := range []Repository{
+			&mockRepository{},
+			NewCachingRepository(&mockRepository{}, cache.NewLRU(cache.LRUOptions{}), CacheOptions{}),
+		} {
+			if _, err := NewService(repo, idgen.UUIDv7{}, nil).UserHistory(ctx, testUserID, 0, 0); !errors.Is(err, ErrAuditUnsupported) {
+				t.Errorf("expected ErrAuditUnsupported, got %v", err)
+			}
+		}
+	})
+}
 
-			r.ServeHTTP(w, req)
+// --- Caching Repository Tests ---
 
-			if w.Code != tt.expectedStatus {
-				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+// countingRepository returns users from a map and counts the Get calls that
+// reach it.
+func countingRepository(users map[string]*User, gets *atomic.Int32) *mockRepository {
+	return &mockRepository{
+		GetFunc: func(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+			gets.Add(1)
+			if fields != nil {
+				return nil, errors.New("expected the whole user to be loaded")
 			}
-		})
+			u, ok := users[id]
+			if !ok {
+				return nil, ErrNotFound
+			}
+			copied := *u
+			return &copied, nil
+		},
+		CreateFunc: func(ctx context.Context, user *User) error { return nil },
+		UpdateFunc: func(ctx context.Context, user *User) error { return nil },
+		DeleteFunc: func(ctx context.Context, id string) error { return nil },
+	}
+}
+
+func TestCachingRepository_Get(t *testing.T) {
+	ctx := context.Background()
+	var gets atomic.Int32
+	created := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	users := map[string]*User{"1": {ID: "1", Name: "Ada", Email: "ada@example.com", CreatedAt: created}}
+	repo := NewCachingRepository(countingRepository(users, &gets), cache.NewLRU(cache.LRUOptions{}), CacheOptions{})
+
+	for range 2 {
+		u, err := repo.Get(ctx, "1", nil)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if *u != *users["1"] {
+			t.Errorf("expected %+v, got %+v", users["1"], u)
+		}
+	}
+	u, err := repo.Get(ctx, "1", fieldmask.Mask{"name"})
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if *u != (User{Name: "Ada"}) {
+		t.Errorf("expected only the name, got %+v", u)
+	}
+
+	for range 2 {
+		if _, err := repo.Get(ctx, "2", nil); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	}
+
+	if n := gets.Load(); n != 2 {
+		t.Errorf("expected one load per user, got %d", n)
+	}
+	if s := repo.Stats(); s != (CacheStats{Hits: 3, Misses: 2}) {
+		t.Errorf("expected 3 hits and 2 misses, got %+v", s)
+	}
+}
+
+func TestCachingRepository_Invalidation(t *testing.T) {
+	ctx := context.Background()
+	var gets atomic.Int32
+	users := map[string]*User{"1": {ID: "1", Name: "Ada"}}
+	repo := NewCachingRepository(countingRepository(users, &gets), cache.NewLRU(cache.LRUOptions{}), CacheOptions{})
+
+	repo.Get(ctx, "1", nil)
+	users["1"] = &User{ID: "1", Name: "Grace"}
+	if err := repo.Update(ctx, &User{ID: "1", Name: "Grace"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if u, err := repo.Get(ctx, "1", nil); err != nil || u.Name != "Grace" {
+		t.Errorf("expected the updated user, got %+v (%v)", u, err)
+	}
+
+	delete(users, "1")
+	if err := repo.Delete(ctx, "1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := repo.Get(ctx, "1", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after Delete, got %v", err)
+	}
+
+	// Creating the user forgets that it was missing.
+	users["1"] = &User{ID: "1", Name: "Ada"}
+	if err := repo.Create(ctx, &User{ID: "1", Name: "Ada"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if u, err := repo.Get(ctx, "1", nil); err != nil || u.Name != "Ada" {
+		t.Errorf("expected the created user, got %+v (%v)", u, err)
+	}
+	if n := gets.Load(); n != 4 {
+		t.Errorf("expected every write to force a load, got %d loads", n)
+	}
+}
+
+func TestCachingRepository_SingleFlight(t *testing.T) {
+	ctx := context.Background()
+	var gets atomic.Int32
+	release := make(chan struct{})
+	inner := countingRepository(map[string]*User{"1": {ID: "1"}}, &gets)
+	load := inner.GetFunc
+	inner.GetFunc = func(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+		<-release
+		return load(ctx, id, fields)
+	}
+	repo := NewCachingRepository(inner, cache.NewLRU(cache.LRUOptions{}), CacheOptions{})
+
+	const callers = 10
+	var wg sync.WaitGroup
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := repo.Get(ctx, "1", nil); err != nil {
+				t.Errorf("Get: %v", err)
+			}
+		}()
+	}
+	for repo.Stats().Misses < callers {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if n := gets.Load(); n != 1 {
+		t.Errorf("expected concurrent misses to share one load, got %d", n)
+	}
+}
+
+func TestCachingRepository_Restore(t *testing.T) {
+	ctx := context.Background()
+	var gets atomic.Int32
+	users := map[string]*User{}
+	repo := NewCachingRepository(&trashRepository{
+		mockRepository: *countingRepository(users, &gets),
+		RestoreFunc: func(ctx context.Context, id string) (*User, error) {
+			users[id] = &User{ID: id, Name: "Ada"}
+			return users[id], nil
+		},
+	}, cache.NewLRU(cache.LRUOptions{}), CacheOptions{})
+
+	if _, err := repo.Get(ctx, "1", nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	// Restoring the user forgets that it was missing.
+	if _, err := repo.Restore(ctx, "1"); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if u, err := repo.Get(ctx, "1", nil); err != nil || u.Name != "Ada" {
+		t.Errorf("expected the restored user, got %+v (%v)", u, err)
+	}
+
+	repo = NewCachingRepository(&mockRepository{}, cache.NewLRU(cache.LRUOptions{}), CacheOptions{})
+	if _, err := repo.Restore(ctx, "1"); !errors.Is(err, ErrTrashUnsupported) {
+		t.Errorf("expected ErrTrashUnsupported, got %v", err)
+	}
+}
+
+func TestCachingRepository_Search(t *testing.T) {
+	repo := NewCachingRepository(&mockRepository{}, cache.NewLRU(cache.LRUOptions{}), CacheOptions{})
+	if _, err := repo.Search(context.Background(), "ada", 10, 0); !errors.Is(err, ErrSearchUnsupported) {
+		t.Errorf("expected ErrSearchUnsupported, got %v", err)
+	}
+
+	searcher := &searchRepository{SearchFunc: func(ctx context.Context, query string, limit, offset int) ([]*User, error) {
+		return []*User{{ID: "1"}}, nil
+	}}
+	repo = NewCachingRepository(searcher, cache.NewLRU(cache.LRUOptions{}), CacheOptions{})
+	if users, err := repo.Search(context.Background(), "ada", 10, 0); err != nil || len(users) != 1 {
+		t.Errorf("expected the wrapped search results, got %v (%v)", users, err)
+	}
+}
+
+// --- Tenant Isolation Tests ---
+
+// testTenantIsolation checks that repo never lets one tenant read, change or
+// find the users of another, nor act without a tenant.
+// newTestUser returns a user to create with a repository directly, with the
+// ID the service would give it.
+func newTestUser(name, email string) *User {
+	return &User{ID: idgen.UUIDv7{}.New(), Name: name, Email: email}
+}
+
+func testTenantIsolation(t *testing.T, repo interface {
+	Repository
+	Searcher
+}) {
+	t.Helper()
+	acme := tenant.NewContext(context.Background(), "acme")
+	globex := tenant.NewContext(context.Background(), "globex")
+
+	// Emails are unique per tenant, so both tenants can hold this one.
+	mine := newTestUser("Isolation Acme", "isolation@example.com")
+	theirs := newTestUser("Isolation Globex", "isolation@example.com")
+	if err := repo.Create(acme, mine); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := repo.Create(globex, theirs); err != nil {
+		t.Fatalf("Create in another tenant: %v", err)
+	}
+	if mine.TenantID != "acme" || theirs.TenantID != "globex" {
+		t.Errorf("expected the users to belong to their tenants, got %q and %q", mine.TenantID, theirs.TenantID)
+	}
+	if err := repo.Create(acme, newTestUser("Duplicate", "isolation@example.com")); err == nil {
+		t.Error("expected a duplicate email within a tenant to fail")
+	}
+
+	if _, err := repo.Get(acme, theirs.ID, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected another tenant's user to be missing, got %v", err)
+	}
+	if _, err := repo.Get(acme, theirs.ID, fieldmask.Mask{"id", "name"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected another tenant's user to be missing with fields, got %v", err)
+	}
+	if err := repo.Update(acme, &User{ID: theirs.ID, Name: "Hijacked", Email: "hijacked@example.com"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected updating another tenant's user to fail, got %v", err)
+	}
+	if err := repo.Delete(acme, theirs.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected deleting another tenant's user to fail, got %v", err)
+	}
+	if u, err := repo.Get(globex, theirs.ID, nil); err != nil || u.Name != "Isolation Globex" || u.TenantID != "globex" {
+		t.Errorf("expected the other tenant's user to be unchanged, got %+v (%v)", u, err)
+	}
+
+	found, err := repo.Search(acme, "Isolation", 10, 0)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(found) != 1 || found[0].ID != mine.ID {
+		t.Errorf("expected only the tenant's own user to be found, got %+v", found)
+	}
+
+	ctx := context.Background()
+	if _, err := repo.Get(ctx, mine.ID, nil); !errors.Is(err, tenant.ErrMissing) {
+		t.Errorf("expected Get without a tenant to fail, got %v", err)
+	}
+	if err := repo.Create(ctx, newTestUser("Nobody", "nobody@example.com")); !errors.Is(err, tenant.ErrMissing) {
+		t.Errorf("expected Create without a tenant to fail, got %v", err)
+	}
+	if _, err := repo.Search(ctx, "Isolation", 10, 0); !errors.Is(err, tenant.ErrMissing) {
+		t.Errorf("expected Search without a tenant to fail, got %v", err)
+	}
+}
+
+func TestCachingRepository_Tenant(t *testing.T) {
+	var gets atomic.Int32
+	inner := countingRepository(map[string]*User{"1": {ID: "1", Name: "Ada", TenantID: "acme"}}, &gets)
+	load := inner.GetFunc
+	inner.GetFunc = func(ctx context.Context, id string, fields fieldmask.Mask) (*User, error) {
+		u, err := load(ctx, id, fields)
+		if tenantID, _ := tenant.FromContext(ctx); err == nil && u.TenantID != tenantID {
+			return nil, ErrNotFound
+		}
+		return u, err
+	}
+	repo := NewCachingRepository(inner, cache.NewLRU(cache.LRUOptions{}), CacheOptions{})
+	acme := tenant.NewContext(context.Background(), "acme")
+	globex := tenant.NewContext(context.Background(), "globex")
+
+	if _, err := repo.Get(acme, "1", nil); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	// The user cached for acme is not served to globex, and globex's miss
+	// does not hide it from acme.
+	if _, err := repo.Get(globex, "1", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected another tenant's cached user to be missing, got %v", err)
+	}
+	if u, err := repo.Get(acme, "1", nil); err != nil || u.Name != "Ada" {
+		t.Errorf("expected the cached user, got %+v (%v)", u, err)
+	}
+	if n := gets.Load(); n != 2 {
+		t.Errorf("expected one load per tenant, got %d", n)
+	}
+}
+
+// newTestSqliteRepository returns a repository over a migrated database in a
+// temporary file.
+func newTestSqliteRepository(t *testing.T) *SqliteRepository {
+	t.Helper()
+	source := filepath.Join(t.TempDir(), "test.db")
+	if err := migration.Up(context.Background(), "sqlite", source); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	db, err := sql.Open("sqlite", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewSqliteRepository(db)
+}
+
+func TestSqliteRepository_TenantIsolation(t *testing.T) {
+	testTenantIsolation(t, newTestSqliteRepository(t))
+}
+
+// --- Trash Tests ---
+
+// testTrash checks that repo deletes users softly: deleted users are hidden
+// and free their email until they are restored or purged.
+func testTrash(t *testing.T, repo interface {
+	Repository
+	Searcher
+	Trash
+}) {
+	t.Helper()
+	ctx := tenant.NewContext(context.Background(), "acme")
+
+	u := newTestUser("Trash Ada", "trash@example.com")
+	if err := repo.Create(ctx, u); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := repo.Delete(ctx, u.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if _, err := repo.Get(ctx, u.ID, nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a deleted user to be missing, got %v", err)
+	}
+	if _, err := repo.Get(ctx, u.ID, fieldmask.Mask{"name"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a deleted user's fields to be missing, got %v", err)
+	}
+	if err := repo.Update(ctx, &User{ID: u.ID, Name: "Trash Grace", Email: u.Email}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a deleted user not to be updated, got %v", err)
+	}
+	if err := repo.Delete(ctx, u.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a deleted user not to be deleted again, got %v", err)
+	}
+	if found, err := repo.Search(ctx, "Trash", 10, 0); err != nil || len(found) != 0 {
+		t.Errorf("expected a deleted user not to be found, got %+v (%v)", found, err)
+	}
+
+	deleted, err := repo.ListDeleted(ctx, 10, 0)
+	if err != nil {
+		t.Fatalf("ListDeleted: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != u.ID || deleted[0].DeletedAt == nil {
+		t.Errorf("expected the deleted user with its deletion time, got %+v", deleted)
+	}
+	globex := tenant.NewContext(context.Background(), "globex")
+	if deleted, err := repo.ListDeleted(globex, 10, 0); err != nil || len(deleted) != 0 {
+		t.Errorf("expected another tenant's deleted users to be hidden, got %+v (%v)", deleted, err)
+	}
+
+	// The deleted user's email is free, so it cannot be restored while
+	// another user holds it.
+	taken := newTestUser("Trash Grace", u.Email)
+	if err := repo.Create(ctx, taken); err != nil {
+		t.Fatalf("Create with a deleted user's email: %v", err)
+	}
+	if _, err := repo.Restore(ctx, u.ID); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("expected ErrEmailTaken, got %v", err)
+	}
+	if err := repo.Delete(ctx, taken.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	restored, err := repo.Restore(ctx, u.ID)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if restored.ID != u.ID || restored.Email != u.Email || restored.DeletedAt != nil {
+		t.Errorf("expected the restored user, got %+v", restored)
+	}
+	if _, err := repo.Get(ctx, u.ID, nil); err != nil {
+		t.Errorf("expected the restored user, got %v", err)
+	}
+	if _, err := repo.Restore(ctx, u.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a user that is not deleted not to be restored, got %v", err)
+	}
+
+	// Only users deleted before the cutoff are purged.
+	if n, err := repo.Purge(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("expected nothing to purge, got %d (%v)", n, err)
+	}
+	if n, err := repo.Purge(ctx, time.Now().Add(time.Hour)); err != nil || n != 1 {
+		t.Errorf("expected the deleted user to be purged, got %d (%v)", n, err)
+	}
+	if deleted, err := repo.ListDeleted(ctx, 10, 0); err != nil || len(deleted) != 0 {
+		t.Errorf("expected no deleted users after the purge, got %+v (%v)", deleted, err)
+	}
+	if _, err := repo.Get(ctx, u.ID, nil); err != nil {
+		t.Errorf("expected the purge to keep live users, got %v", err)
+	}
+}
+
+func TestSqliteRepository_Trash(t *testing.T) {
+	testTrash(t, newTestSqliteRepository(t))
+}
+
+// --- Audit Tests ---
+
+// testAudit checks that repo keeps the entries of each user in its tenant,
+// newest first, and locks users for update.
+func testAudit(t *testing.T, repo interface {
+	Repository
+	Auditor
+}) {
+	t.Helper()
+	acme := tenant.NewContext(context.Background(), "acme")
+	globex := tenant.NewContext(context.Background(), "globex")
+
+	ada := newTestUser("Ada", "ada@example.com")
+	if err := repo.Create(acme, ada); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.GetForUpdate(acme, ada.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != ada.ID || got.Name != ada.Name || got.Email != ada.Email {
+		t.Errorf("expected %+v, got %+v", ada, got)
+	}
+	if _, err := repo.GetForUpdate(globex, ada.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound in another tenant, got %v", err)
+	}
+	if _, err := repo.GetForUpdate(acme, "00000000-0000-0000-0000-000000000000"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	renamed := *ada
+	renamed.Name = "Ada Lovelace"
+	// Stores keep times to the millisecond at least.
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	added := []*AuditEntry{
+		{UserID: ada.ID, Action: EventCreated, Actor: "admin", RequestID: "req-1", After: ada, Time: now.Add(-2 * time.Second)},
+		{UserID: ada.ID, Action: EventUpdated, Actor: "admin", RequestID: "req-2", Before: ada, After: &renamed, Time: now.Add(-time.Second)},
+		{UserID: ada.ID, Action: EventDeleted, Before: &renamed, Time: now},
+	}
+	for _, e := range added {
+		if err := repo.AddAudit(acme, e); err != nil {
+			t.Fatal(err)
+		}
+		if e.ID == 0 || e.TenantID != "acme" {
+			t.Errorf("expected the ID and tenant to be set, got %+v", e)
+		}
+	}
+
+	entries, err := repo.History(acme, ada.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	for i, e := range entries {
+		want := added[2-i]
+		if e.ID != want.ID || e.UserID != ada.ID || e.TenantID != "acme" || e.Action != want.Action ||
+			e.Actor != want.Actor || e.RequestID != want.RequestID || !e.Time.Equal(want.Time) {
+			t.Errorf("entry %d: expected %+v, got %+v", i, want, e)
+		}
+		if !sameUser(e.Before, want.Before) || !sameUser(e.After, want.After) {
+			t.Errorf("entry %d: expected %v -> %v, got %v -> %v", i, want.Before, want.After, e.Before, e.After)
+		}
+	}
+
+	page, err := repo.History(acme, ada.ID, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].ID != added[1].ID {
+		t.Errorf("expected the update, got %+v", page)
+	}
+	if entries, err := repo.History(globex, ada.ID, 10, 0); err != nil || len(entries) != 0 {
+		t.Errorf("expected no entries in another tenant, got %v, %v", entries, err)
+	}
+	if entries, err := repo.History(acme, "00000000-0000-0000-0000-000000000000", 10, 0); err != nil || len(entries) != 0 {
+		t.Errorf("expected no entries of another user, got %v, %v", entries, err)
+	}
+}
+
+// sameUser reports whether a and b are both nil or have the same ID, name
+// and email.
+func sameUser(a, b *User) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.ID == b.ID && a.Name == b.Name && a.Email == b.Email
+}
+
+func TestSqliteRepository_Audit(t *testing.T) {
+	testAudit(t, newTestSqliteRepository(t))
+}
+
+func TestSqliteRepository_AuditRollback(t *testing.T) {
+	repo := newTestSqliteRepository(t)
+	events := &recordingOutbox{}
+	svc := NewTransactionalService(repo, idgen.UUIDv7{}, transaction.NewSqliteManager(repo.db), events)
+	ctx := tenant.NewContext(context.Background(), "acme")
+
+	ada := newTestUser("Ada", "ada@example.com")
+	if err := svc.CreateUser(ctx, ada); err != nil {
+		t.Fatal(err)
+	}
+	// The entry of an update whose event cannot be stored is rolled back
+	// with the update.
+	events.err = errors.New("outbox error")
+	if err := svc.UpdateUser(ctx, &User{ID: ada.ID, Name: "Ada Lovelace", Email: ada.Email}); !errors.Is(err, events.err) {
+		t.Fatalf("expected %v, got %v", events.err, err)
+	}
+
+	entries, err := repo.History(ctx, ada.ID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != EventCreated {
+		t.Fatalf("expected only the creation, got %+v", entries)
+	}
+	if u, err := repo.Get(ctx, ada.ID, nil); err != nil || u.Name != "Ada" {
+		t.Errorf("expected the update to be rolled back, got %+v, %v", u, err)
 	}
 }
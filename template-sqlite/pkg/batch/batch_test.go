@@ -0,0 +1,238 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// fakeTx records whether WithinTx committed.
+type fakeTx struct {
+	committed bool
+}
+
+func (tx *fakeTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	tx.committed = true
+	return nil
+}
+
+// newRouter mounts h under /api/v1 next to a few test routes.
+func newRouter(opts Options) (chi.Router, *[]string) {
+	var mu sync.Mutex
+	var seen []string
+	r := chi.NewRouter()
+	h := NewHandler(r, opts)
+	r.Route("/api/v1", func(r chi.Router) {
+		h.RegisterRoutes(r)
+		r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			seen = append(seen, r.Method+" "+r.URL.Path+" "+r.Header.Get("Authorization"))
+			mu.Unlock()
+			if chi.URLParam(r, "id") == "missing" {
+				http.Error(w, "user not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"id": chi.URLParam(r, "id"), "fields": r.URL.Query().Get("fields")})
+		})
+		r.Post("/users", func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			seen = append(seen, r.Method+" "+r.URL.Path+" "+r.Header.Get("Content-Type"))
+			mu.Unlock()
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Location", "/api/v1/users/1")
+			w.WriteHeader(http.StatusCreated)
+			w.Write(body)
+		})
+	})
+	return r, &seen
+}
+
+func serve(t *testing.T, r http.Handler, body string) (*httptest.ResponseRecorder, Response) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/v1/batch", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp Response
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+	}
+	return w, resp
+}
+
+func TestHandler_Batch(t *testing.T) {
+	r, seen := newRouter(Options{})
+
+	w, resp := serve(t, r, `{"operations":[
+		{"method":"GET","path":"/api/v1/users/1?fields=id"},
+		{"method":"GET","path":"/api/v1/users/missing"},
+		{"method":"POST","path":"/api/v1/users","body":{"name":"John"}},
+		{"method":"GET","path":"/api/v1/unknown"}
+	]}`)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(resp.Results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(resp.Results))
+	}
+
+	wantStatus := []int{http.StatusOK, http.StatusNotFound, http.StatusCreated, http.StatusNotFound}
+	for i, res := range resp.Results {
+		if res.Status != wantStatus[i] {
+			t.Errorf("result %d: expected status %d, got %d", i, wantStatus[i], res.Status)
+		}
+	}
+	if got := string(resp.Results[0].Body); got != `{"fields":"id","id":"1"}` {
+		t.Errorf("expected JSON body, got %s", got)
+	}
+	if got := string(resp.Results[1].Body); got != `"user not found"` {
+		t.Errorf("expected text body as JSON string, got %s", got)
+	}
+	if got := resp.Results[2].Headers["Location"]; got != "/api/v1/users/1" {
+		t.Errorf("expected Location header, got %q", got)
+	}
+	if got := string(resp.Results[2].Body); got != `{"name":"John"}` {
+		t.Errorf("expected echoed body, got %s", got)
+	}
+	for _, s := range *seen {
+		if strings.HasPrefix(s, "GET") && !strings.HasSuffix(s, "Bearer token") {
+			t.Errorf("expected batch headers on sub-request, got %q", s)
+		}
+		if strings.HasPrefix(s, "POST") && !strings.HasSuffix(s, "application/json") {
+			t.Errorf("expected JSON content type on sub-request, got %q", s)
+		}
+	}
+}
+
+func TestHandler_Batch_Invalid(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "Empty", body: `{"operations":[]}`, expectedStatus: http.StatusBadRequest},
+		{name: "TooMany", body: `{"operations":[` + strings.Repeat(`{"method":"GET","path":"/api/v1/users/1"},`, 3) + `{"method":"GET","path":"/api/v1/users/1"}]}`, expectedStatus: http.StatusBadRequest},
+		{name: "Method", body: `{"operations":[{"method":"TRACE","path":"/api/v1/users/1"}]}`, expectedStatus: http.StatusBadRequest},
+		{name: "RelativePath", body: `{"operations":[{"method":"GET","path":"api/v1/users/1"}]}`, expectedStatus: http.StatusBadRequest},
+		{name: "AbsoluteURL", body: `{"operations":[{"method":"GET","path":"//example.com/api/v1/users/1"}]}`, expectedStatus: http.StatusBadRequest},
+		{name: "Nested", body: `{"operations":[{"method":"POST","path":"/api/v1/batch/","body":{"operations":[]}}]}`, expectedStatus: http.StatusBadRequest},
+		{name: "UnknownField", body: `{"operations":[{"method":"GET","path":"/api/v1/users/1","headers":{}}]}`, expectedStatus: http.StatusBadRequest},
+		{name: "AtomicWithoutTx", body: `{"atomic":true,"operations":[{"method":"GET","path":"/api/v1/users/1"}]}`, expectedStatus: http.StatusNotImplemented},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, seen := newRouter(Options{MaxOperations: 3})
+			w, _ := serve(t, r, tt.body)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if len(*seen) != 0 {
+				t.Errorf("expected no operation to run, got %v", *seen)
+			}
+		})
+	}
+}
+
+func TestHandler_Batch_Atomic(t *testing.T) {
+	t.Run("Commit", func(t *testing.T) {
+		tx := &fakeTx{}
+		r, _ := newRouter(Options{Tx: tx})
+		_, resp := serve(t, r, `{"atomic":true,"operations":[
+			{"method":"POST","path":"/api/v1/users","body":{"name":"John"}},
+			{"method":"GET","path":"/api/v1/users/1"}
+		]}`)
+
+		if !tx.committed || resp.RolledBack {
+			t.Errorf("expected commit, got committed=%v rolled_back=%v", tx.committed, resp.RolledBack)
+		}
+		if resp.Results[0].Status != http.StatusCreated || resp.Results[1].Status != http.StatusOK {
+			t.Errorf("unexpected results: %+v", resp.Results)
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		tx := &fakeTx{}
+		r, seen := newRouter(Options{Tx: tx})
+		_, resp := serve(t, r, `{"atomic":true,"operations":[
+			{"method":"POST","path":"/api/v1/users","body":{"name":"John"}},
+			{"method":"GET","path":"/api/v1/users/missing"},
+			{"method":"GET","path":"/api/v1/users/1"}
+		]}`)
+
+		if tx.committed || !resp.RolledBack {
+			t.Errorf("expected rollback, got committed=%v rolled_back=%v", tx.committed, resp.RolledBack)
+		}
+		wantStatus := []int{http.StatusCreated, http.StatusNotFound, http.StatusFailedDependency}
+		for i, res := range resp.Results {
+			if res.Status != wantStatus[i] {
+				t.Errorf("result %d: expected status %d, got %d", i, wantStatus[i], res.Status)
+			}
+		}
+		if len(*seen) != 2 {
+			t.Errorf("expected operations after the failure to be skipped, ran %v", *seen)
+		}
+	})
+}
+
+func TestHandler_Batch_Concurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	r := chi.NewRouter()
+	h := NewHandler(r, Options{Concurrency: 2})
+	r.Post("/batch", h.Batch)
+	r.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	})
+
+	req := httptest.NewRequest("POST", "/batch", strings.NewReader(`{"operations":[`+strings.Repeat(`{"method":"GET","path":"/slow"},`, 5)+`{"method":"GET","path":"/slow"}]}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := peak.Load(); got != 2 {
+		t.Errorf("expected at most 2 operations in flight, peak was %d", got)
+	}
+}
+
+func TestHandler_Batch_Timeout(t *testing.T) {
+	r := chi.NewRouter()
+	h := NewHandler(r, Options{Timeout: 10 * time.Millisecond})
+	r.Post("/api/v1/batch", h.Batch)
+	r.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		http.Error(w, r.Context().Err().Error(), http.StatusGatewayTimeout)
+	})
+
+	_, resp := serve(t, r, `{"operations":[{"method":"GET","path":"/slow"}]}`)
+	if len(resp.Results) != 1 || resp.Results[0].Status != http.StatusGatewayTimeout {
+		t.Errorf("expected the operation to time out, got %+v", resp.Results)
+	}
+}
@@ -0,0 +1,111 @@
+package idgen
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerators(t *testing.T) {
+	for _, strategy := range []string{StrategyUUIDv4, StrategyUUIDv7, StrategyULID} {
+		t.Run(strategy, func(t *testing.T) {
+			g, err := New(strategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen := make(map[string]bool)
+			for range 100 {
+				id := g.New()
+				if seen[id] {
+					t.Fatalf("duplicate id %q", id)
+				}
+				seen[id] = true
+
+				b, err := g.Parse(id)
+				if err != nil {
+					t.Fatalf("parsing %q: %v", id, err)
+				}
+				if got := g.Format(b); got != id {
+					t.Fatalf("expected %q to round trip, got %q", id, got)
+				}
+			}
+		})
+	}
+}
+
+func TestTimeOrdered(t *testing.T) {
+	for _, g := range []Generator{UUIDv7{}, ULID{}} {
+		start := time.Now().UnixMilli()
+		first := g.New()
+		time.Sleep(2 * time.Millisecond)
+		second := g.New()
+		if first >= second {
+			t.Errorf("%T: expected %q < %q", g, first, second)
+		}
+
+		b, _ := g.Parse(first)
+		var ms [8]byte
+		copy(ms[2:], b[:6])
+		if created := int64(binary.BigEndian.Uint64(ms[:])); created < start || created > start+1000 {
+			t.Errorf("%T: expected a timestamp near %d, got %d", g, start, created)
+		}
+	}
+}
+
+func TestULID(t *testing.T) {
+	// Its timestamp is the example of the ULID specification.
+	const id = "01ARYZ6S41TSV4RRFFQ69G5FAV"
+	b, err := ULID{}.Parse(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ms [8]byte
+	copy(ms[2:], b[:6])
+	if got := binary.BigEndian.Uint64(ms[:]); got != 1469918176385 {
+		t.Errorf("expected timestamp 1469918176385, got %d", got)
+	}
+	lower, err := ULID{}.Parse(strings.ToLower(id))
+	if err != nil || lower != b {
+		t.Errorf("expected lowercase to parse the same, got %v", err)
+	}
+	if got := (ULID{}).Format([16]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}); got != "7ZZZZZZZZZZZZZZZZZZZZZZZZZ" {
+		t.Errorf("expected the largest ULID, got %q", got)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		g    Generator
+		id   string
+	}{
+		{name: "UUIDEmpty", g: UUIDv7{}, id: ""},
+		{name: "UUIDShort", g: UUIDv7{}, id: "123"},
+		{name: "UUIDWithoutHyphens", g: UUIDv4{}, id: "0190a0b43f1c7c2a9b1e5d2f8a4c6e01"},
+		{name: "UUIDBraces", g: UUIDv4{}, id: "{0190a0b4-3f1c-7c2a-9b1e-5d2f8a4c6e01}"},
+		{name: "UUIDNotHex", g: UUIDv7{}, id: "0190a0b4-3f1c-7c2a-9b1e-5d2f8a4c6e0z"},
+		{name: "UUIDAsULID", g: ULID{}, id: "0190a0b4-3f1c-7c2a-9b1e-5d2f8a4c6e01"},
+		{name: "ULIDAsUUID", g: UUIDv7{}, id: "01ARZ3NDEKTSV4RRFFQ69G5FAV"},
+		{name: "ULIDOverflow", g: ULID{}, id: "81ARZ3NDEKTSV4RRFFQ69G5FAV"},
+		{name: "ULIDExcludedLetter", g: ULID{}, id: "01ARZ3NDEKTSV4RRFFQ69G5FAU"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.g.Parse(tt.id); !errors.Is(err, ErrInvalid) {
+				t.Errorf("expected ErrInvalid, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNew_Unknown(t *testing.T) {
+	if _, err := New("snowflake"); err == nil {
+		t.Error("expected an error")
+	}
+	if g, err := New(""); err != nil || g != (UUIDv7{}) {
+		t.Errorf("expected UUIDv7 by default, got %v, %v", g, err)
+	}
+}
@@ -0,0 +1,57 @@
+package jsonbody
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/user/go-templates/template-sqlite/pkg/bodylimit"
+)
+
+type payload struct {
+	Name string `json:"name"`
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedName   string
+	}{
+		{name: "Valid", body: `{"name":"John"}`, expectedStatus: http.StatusOK, expectedName: "John"},
+		{name: "TrailingWhitespace", body: "{\"name\":\"John\"}\n\n", expectedStatus: http.StatusOK, expectedName: "John"},
+		{name: "UnknownField", body: `{"name":"John","admin":true}`, expectedStatus: http.StatusBadRequest},
+		{name: "MultipleValues", body: `{"name":"John"}{"name":"Jane"}`, expectedStatus: http.StatusBadRequest},
+		{name: "TrailingGarbage", body: `{"name":"John"} garbage`, expectedStatus: http.StatusBadRequest},
+		{name: "Empty", body: ``, expectedStatus: http.StatusBadRequest},
+		{name: "Malformed", body: `{"name":`, expectedStatus: http.StatusBadRequest},
+		{name: "TooLarge", body: `{"name":"` + strings.Repeat("a", 64) + `"}`, expectedStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got payload
+			r := chi.NewRouter()
+			r.Use(bodylimit.Middleware(bodylimit.Options{Default: 1 << 20, Routes: map[string]int64{"POST /users": 32}}))
+			r.Post("/users", func(w http.ResponseWriter, r *http.Request) {
+				if err := Decode(r, &got); err != nil {
+					http.Error(w, err.Error(), Status(err))
+					return
+				}
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("POST", "/users", strings.NewReader(tt.body)))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if got.Name != tt.expectedName && tt.expectedStatus == http.StatusOK {
+				t.Errorf("expected name %q, got %q", tt.expectedName, got.Name)
+			}
+		})
+	}
+}
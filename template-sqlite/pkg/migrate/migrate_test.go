@@ -0,0 +1,146 @@
+package migrate
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name             string
+		files            fstest.MapFS
+		expectedVersions []uint64
+		expectedErr      bool
+	}{
+		{
+			name: "Ordered",
+			files: fstest.MapFS{
+				"000010_later.up.sql":       {Data: []byte("10 up")},
+				"000002_second.up.sql":      {Data: []byte("2 up")},
+				"000002_second.down.sql":    {Data: []byte("2 down")},
+				"000001_init_schema.up.sql": {Data: []byte("1 up")},
+				"migration.go":              {Data: []byte("package migration")},
+				"README.md":                 {Data: []byte("ignored")},
+			},
+			expectedVersions: []uint64{1, 2, 10},
+		},
+		{name: "Empty", files: fstest.MapFS{}},
+		{
+			name:        "DownOnly",
+			files:       fstest.MapFS{"000001_init.down.sql": {Data: []byte("down")}},
+			expectedErr: true,
+		},
+		{
+			name: "NameMismatch",
+			files: fstest.MapFS{
+				"000001_init.up.sql":  {Data: []byte("up")},
+				"000001_other.up.sql": {Data: []byte("up")},
+			},
+			expectedErr: true,
+		},
+		{
+			name:        "ZeroVersion",
+			files:       fstest.MapFS{"000000_init.up.sql": {Data: []byte("up")}},
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := Load(tt.files)
+			if tt.expectedErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if len(migrations) != len(tt.expectedVersions) {
+				t.Fatalf("expected %d migrations, got %d", len(tt.expectedVersions), len(migrations))
+			}
+			for i, m := range migrations {
+				if m.Version != tt.expectedVersions[i] {
+					t.Errorf("migration %d: expected version %d, got %d", i, tt.expectedVersions[i], m.Version)
+				}
+			}
+		})
+	}
+}
+
+func TestLoad_Bodies(t *testing.T) {
+	migrations, err := Load(fstest.MapFS{
+		"000001_init_schema.up.sql":   {Data: []byte("CREATE TABLE t (id int);")},
+		"000001_init_schema.down.sql": {Data: []byte("DROP TABLE t;")},
+	})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	expected := Migration{Version: 1, Name: "init_schema", Up: "CREATE TABLE t (id int);", Down: "DROP TABLE t;"}
+	if len(migrations) != 1 || migrations[0] != expected {
+		t.Errorf("expected %+v, got %+v", expected, migrations)
+	}
+}
+
+func TestStatus_Pending(t *testing.T) {
+	migrations := []Migration{{Version: 1}, {Version: 2}, {Version: 5}}
+
+	tests := []struct {
+		version  uint64
+		expected int
+	}{
+		{version: 0, expected: 3},
+		{version: 1, expected: 2},
+		{version: 5, expected: 0},
+		{version: 7, expected: 0},
+	}
+
+	for _, tt := range tests {
+		st := Status{Version: tt.version, Migrations: migrations}
+		if got := len(st.Pending()); got != tt.expected {
+			t.Errorf("version %d: expected %d pending, got %d", tt.version, tt.expected, got)
+		}
+	}
+}
+
+func TestMigrator_Rebind(t *testing.T) {
+	query := "INSERT INTO schema_migrations (version, dirty) VALUES (?, ?)"
+
+	tests := []struct {
+		dialect  Dialect
+		expected string
+	}{
+		{dialect: Postgres, expected: "INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)"},
+		{dialect: MySQL, expected: query},
+		{dialect: SQLite, expected: query},
+	}
+
+	for _, tt := range tests {
+		m := &Migrator{dialect: tt.dialect}
+		if got := m.rebind(query); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.dialect, tt.expected, got)
+		}
+	}
+}
+
+func TestNew_UnsupportedDialect(t *testing.T) {
+	if _, err := New(nil, "oracle", fstest.MapFS{}, Options{}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	expected := []string{"column users.email text NOT NULL", "column users.id uuid NOT NULL", "index users_email_key"}
+	actual := []string{"column users.email text", "column users.id uuid NOT NULL", "column users.nickname text", "index users_email_key"}
+
+	got := Diff(expected, actual)
+	want := []string{"- column users.email text NOT NULL", "+ column users.email text", "+ column users.nickname text"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if diff := Diff(expected, expected); len(diff) != 0 {
+		t.Errorf("expected no difference, got %q", diff)
+	}
+}
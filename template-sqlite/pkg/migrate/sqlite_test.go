@@ -0,0 +1,195 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+var testMigrations = fstest.MapFS{
+	"000001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER);\nCREATE INDEX a_id_idx ON a (id);")},
+	"000001_create_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	"000002_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);")},
+	"000002_create_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	"000003_create_c.up.sql":   {Data: []byte("CREATE TABLE c (id INTEGER);")},
+}
+
+func newSQLiteMigrator(t *testing.T, path string, fsys fstest.MapFS, opts Options) *Migrator {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(db, SQLite, fsys, opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func tables(t *testing.T, m *Migrator) map[string]bool {
+	t.Helper()
+	rows, err := m.db.Query("SELECT name FROM sqlite_master WHERE type = 'table'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	names := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names[name] = true
+	}
+	return names
+}
+
+func expectVersion(t *testing.T, m *Migrator, expected uint64) {
+	t.Helper()
+	st, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if st.Version != expected || st.Dirty {
+		t.Errorf("expected clean version %d, got %d (dirty %v)", expected, st.Version, st.Dirty)
+	}
+}
+
+func TestMigrator_SQLite(t *testing.T) {
+	ctx := context.Background()
+	m := newSQLiteMigrator(t, filepath.Join(t.TempDir(), "test.db"), testMigrations, Options{})
+
+	expectVersion(t, m, 0)
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	expectVersion(t, m, 3)
+	if got := tables(t, m); !got["a"] || !got["b"] || !got["c"] {
+		t.Errorf("expected tables a, b and c, got %v", got)
+	}
+
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("second Up: %v", err)
+	}
+	expectVersion(t, m, 3)
+
+	if err := m.Down(ctx); !errors.Is(err, ErrNoDownMigration) {
+		t.Errorf("expected ErrNoDownMigration, got %v", err)
+	}
+	expectVersion(t, m, 3)
+
+	if err := m.Force(ctx, 2); err != nil {
+		t.Fatalf("Force: %v", err)
+	}
+	if err := m.Down(ctx); err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	expectVersion(t, m, 1)
+	if got := tables(t, m); got["b"] {
+		t.Error("expected table b to be dropped")
+	}
+
+	if err := m.Goto(ctx, 0); err != nil {
+		t.Fatalf("Goto 0: %v", err)
+	}
+	expectVersion(t, m, 0)
+	if got := tables(t, m); got["a"] {
+		t.Error("expected table a to be dropped")
+	}
+
+	if err := m.Goto(ctx, 2); err != nil {
+		t.Fatalf("Goto 2: %v", err)
+	}
+	expectVersion(t, m, 2)
+
+	if err := m.Goto(ctx, 4); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("expected ErrUnknownVersion, got %v", err)
+	}
+}
+
+func TestMigrator_SQLiteFailure(t *testing.T) {
+	ctx := context.Background()
+	files := fstest.MapFS{
+		"000001_create_a.up.sql": {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"000002_broken.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);\nINSERT INTO missing VALUES (1);")},
+	}
+	m := newSQLiteMigrator(t, filepath.Join(t.TempDir(), "test.db"), files, Options{})
+
+	if err := m.Up(ctx); err == nil {
+		t.Fatal("expected Up to fail")
+	}
+	// The failed migration is rolled back as a whole.
+	expectVersion(t, m, 1)
+	if got := tables(t, m); got["b"] {
+		t.Error("expected table b to be rolled back")
+	}
+}
+
+func TestMigrator_SQLiteDirty(t *testing.T) {
+	ctx := context.Background()
+	m := newSQLiteMigrator(t, filepath.Join(t.TempDir(), "test.db"), testMigrations, Options{})
+	if err := m.Goto(ctx, 1); err != nil {
+		t.Fatalf("Goto: %v", err)
+	}
+	if _, err := m.db.Exec("UPDATE schema_migrations SET dirty = 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	var dirty *DirtyError
+	if err := m.Up(ctx); !errors.As(err, &dirty) || dirty.Version != 1 {
+		t.Fatalf("expected DirtyError at version 1, got %v", err)
+	}
+
+	if err := m.Force(ctx, 1); err != nil {
+		t.Fatalf("Force: %v", err)
+	}
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Up after Force: %v", err)
+	}
+	expectVersion(t, m, 3)
+}
+
+func TestMigrator_SQLiteLock(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	t.Run("Concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make([]error, 4)
+		for i := range errs {
+			m := newSQLiteMigrator(t, path, testMigrations, Options{})
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = m.Up(ctx)
+			}()
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("Up %d: %v", i, err)
+			}
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		m := newSQLiteMigrator(t, path, testMigrations, Options{LockTimeout: 200 * time.Millisecond})
+		if _, err := m.db.Exec("INSERT INTO schema_migrations_lock (id, locked_at) VALUES (1, ?)", time.Now().UTC()); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := m.Up(ctx); err == nil {
+			t.Error("expected Up to time out while the lock is held")
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package tenant
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/user/go-templates/template-sqlite/pkg/auth"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   Options
+		host   string
+		header string
+		claim  *auth.Claims
+		status int
+		tenant string
+	}{
+		{name: "NoSource", opts: Options{}, status: http.StatusOK, tenant: DefaultTenant},
+		{name: "Header", opts: Options{Source: SourceHeader}, header: "acme", status: http.StatusOK, tenant: "acme"},
+		{name: "HeaderMissing", opts: Options{Source: SourceHeader}, status: http.StatusBadRequest},
+		{name: "HeaderDefault", opts: Options{Source: SourceHeader, Default: "shared"}, status: http.StatusOK, tenant: "shared"},
+		{name: "HeaderInvalid", opts: Options{Source: SourceHeader}, header: "Acme Inc", status: http.StatusBadRequest},
+		{name: "Claim", opts: Options{Source: SourceClaim}, claim: &auth.Claims{TenantID: "acme"}, status: http.StatusOK, tenant: "acme"},
+		{name: "ClaimMissing", opts: Options{Source: SourceClaim}, claim: &auth.Claims{}, status: http.StatusBadRequest},
+		{name: "Subdomain", opts: Options{Source: SourceSubdomain, Domain: "example.com"}, host: "ACME.example.com:8080", status: http.StatusOK, tenant: "acme"},
+		{name: "SubdomainNested", opts: Options{Source: SourceSubdomain, Domain: "example.com"}, host: "a.acme.example.com", status: http.StatusBadRequest},
+		{name: "SubdomainApex", opts: Options{Source: SourceSubdomain, Domain: "example.com"}, host: "example.com", status: http.StatusBadRequest},
+		{name: "TokenOfOtherTenant", opts: Options{Source: SourceHeader}, header: "acme", claim: &auth.Claims{TenantID: "globex"}, status: http.StatusForbidden},
+		{name: "TokenOfSameTenant", opts: Options{Source: SourceHeader}, header: "acme", claim: &auth.Claims{TenantID: "acme"}, status: http.StatusOK, tenant: "acme"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw, err := Middleware(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got string
+			h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = FromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest("GET", "/api/v1/users", nil)
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			if tt.header != "" {
+				req.Header.Set(DefaultHeader, tt.header)
+			}
+			if tt.claim != nil {
+				req = req.WithContext(auth.NewContext(req.Context(), tt.claim))
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+			if got != tt.tenant {
+				t.Errorf("expected tenant %q, got %q", tt.tenant, got)
+			}
+		})
+	}
+}
+
+func TestMiddleware_KeepsTenant(t *testing.T) {
+	mw, err := Middleware(Options{Source: SourceHeader})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	}))
+
+	// A batch operation carries the tenant of the batch request, whatever
+	// its headers say.
+	req := httptest.NewRequest("GET", "/api/v1/users", nil)
+	req.Header.Set(DefaultHeader, "globex")
+	req = req.WithContext(NewContext(req.Context(), "acme"))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != "acme" {
+		t.Errorf("expected the tenant in the context to be kept, got %q", got)
+	}
+}
+
+func TestMiddleware_Options(t *testing.T) {
+	for _, opts := range []Options{
+		{Source: "cookie"},
+		{Source: SourceSubdomain},
+		{Source: SourceHeader, Default: "Not Valid"},
+	} {
+		if _, err := Middleware(opts); err == nil {
+			t.Errorf("expected an error for %+v", opts)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	for id, want := range map[string]bool{
+		"acme":                  true,
+		"acme-2":                true,
+		"0":                     true,
+		"":                      false,
+		"-acme":                 false,
+		"acme-":                 false,
+		"Acme":                  false,
+		"acme.example":          false,
+		"user:1":                false,
+		strings.Repeat("a", 64): false,
+	} {
+		if got := Valid(id); got != want {
+			t.Errorf("Valid(%q) = %v, want %v", id, got, want)
+		}
+	}
+}